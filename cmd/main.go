@@ -11,6 +11,13 @@ import (
 	"ai-cloud/internal/router"
 	"ai-cloud/internal/service"
 	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -41,21 +48,88 @@ func main() {
 
 	msgDao := history.NewMsgDao(db)
 	convDao := history.NewConvDao(db)
-	historyService := service.NewHistoryService(convDao, msgDao)
+	searchDao := history.NewSearchDao(db)
+	historyService := service.NewHistoryService(convDao, msgDao, searchDao)
 
 	agentDao := dao.NewAgentDao(db)
-	agentService := service.NewAgentService(agentDao, modelService, kbService, kbDao, modelDao, historyService)
+	agentVersionDao := dao.NewAgentVersionDao(db)
+	traceDao := dao.NewTraceDao(db)
+	agentRunDao := dao.NewAgentRunDao(db)
+	memoryDao := dao.NewMemoryDao(db)
+	memoryService := service.NewMemoryService(memoryDao, modelDao)
+	memoryController := controller.NewMemoryController(memoryService)
+	agentService := service.NewAgentService(agentDao, agentVersionDao, modelService, kbService, kbDao, modelDao, historyService, traceDao, agentRunDao, memoryService, fileService)
 	agentController := controller.NewAgentController(agentService)
 
-	// 创建ConversationService和ConversationController
-	conversationService := service.NewConversationService(agentService, historyService)
+	// 聊天附件
+	attachDao := history.NewAttachDao(db)
+	attachmentService := service.NewAttachmentService(attachDao, fileService)
+	attachmentController := controller.NewAttachmentController(attachmentService)
+
+	// 创建ConversationService和ConversationController，多实例部署时通过MySQL传递停止生成的请求
+	var stopDao history.StopDao
+	if config.GetConfig().Conversation.Coordination == "mysql" {
+		stopDao = history.NewStopDao(db)
+	}
+	conversationService := service.NewConversationService(agentService, historyService, attachmentService, stopDao)
 	conversationController := controller.NewConversationController(conversationService)
 
+	traceService := service.NewTraceService(traceDao)
+	traceController := controller.NewTraceController(traceService)
+
+	// 回复评价和质量统计
+	feedbackDao := dao.NewFeedbackDao(db)
+	feedbackService := service.NewFeedbackService(feedbackDao, traceDao, historyService)
+	feedbackController := controller.NewFeedbackController(feedbackService)
+
+	apiKeyDao := dao.NewAPIKeyDao(db)
+	apiKeyService := service.NewAPIKeyService(apiKeyDao)
+	apiKeyController := controller.NewAPIKeyController(apiKeyService)
+
+	// OpenAI兼容接口
+	openAIService := service.NewOpenAIService(agentService)
+	openAIController := controller.NewOpenAIController(openAIService)
+
+	// 公开分享
+	shareDao := dao.NewShareDao(db)
+	shareService := service.NewShareService(shareDao, convDao, agentService, historyService, conversationService)
+	shareController := controller.NewShareController(shareService)
+
+	// 定时任务，各实例都运行调度器，通过数据库抢占避免重复运行
+	scheduleDao := dao.NewScheduleDao(db)
+	scheduleService := service.NewScheduleService(scheduleDao, agentService, historyService, conversationService)
+	scheduleController := controller.NewScheduleController(scheduleService)
+	scheduleService.Start(ctx)
+
+	// Agent评测
+	evalDao := dao.NewEvalDao(db)
+	evalService := service.NewEvalService(evalDao, agentService, modelService)
+	evalController := controller.NewEvalController(evalService)
+
 	r := gin.Default()
+	if err := r.SetTrustedProxies(config.GetConfig().Server.TrustedProxies); err != nil {
+		log.Fatalf("可信代理配置错误: %v", err)
+	}
 	// 配置跨域
 	r.Use(middleware.SetupCORS())
 	// 配置路由
-	router.SetUpRouters(r, userController, fileController, kbController, modelController, agentController, conversationController)
+	router.SetUpRouters(r, userController, fileController, kbController, modelController, agentController, conversationController, traceController, apiKeyController, openAIController, shareController, memoryController, feedbackController, attachmentController, scheduleController, evalController, apiKeyService)
+
+	// 收到退出信号后停止接收请求，并等待进行中的定时运行保存结果
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("服务启动失败: %v", err)
+		}
+	}()
+	quit, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-quit.Done()
 
-	r.Run(":8080")
+	shutdownCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("关闭服务失败: %v", err)
+	}
+	scheduleService.Stop()
 }
@@ -7,6 +7,9 @@ import (
 // ServerConfig 服务器配置
 type ServerConfig struct {
 	Port string `mapstructure:"port"`
+	// TrustedProxies 可信的反向代理地址，只有来自这些地址的请求才使用X-Forwarded-For作为客户端IP，
+	// 为空时直接使用连接地址，避免访客伪造IP绕过分享的限流
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 // DatabaseConfig 数据库配置
@@ -155,6 +158,14 @@ type LLMConfig struct {
 	Temperature float32 `mapstructure:"temperature"`
 }
 
+// ConversationConfig 会话配置
+type ConversationConfig struct {
+	// TitleLLM 生成会话标题和历史摘要使用的低成本模型（OpenAI兼容接口），未配置时使用Agent自身的模型
+	TitleLLM LLMConfig `mapstructure:"title_llm"`
+	// Coordination 多实例部署时的共享协调后端，设为mysql时停止生成的请求可以作用于其他实例上的运行
+	Coordination string `mapstructure:"coordination"`
+}
+
 // AppConfig 应用配置
 type AppConfig struct {
 	Server   ServerConfig   `mapstructure:"server"`
@@ -165,4 +176,6 @@ type AppConfig struct {
 	RAG      RAGConfig      `mapstructure:"rag"`
 	LLM      LLMConfig      `mapstructure:"llm"`
 	Milvus   MilvusConfig   `mapstructure:"milvus"`
+	// Conversation 会话配置
+	Conversation ConversationConfig `mapstructure:"conversation"`
 }
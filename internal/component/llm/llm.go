@@ -3,11 +3,14 @@ package llmfactory
 import (
 	"ai-cloud/internal/model"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
+	acl_openai "github.com/cloudwego/eino-ext/libs/acl/openai"
 	eino_model "github.com/cloudwego/eino/components/model"
 	ollama_api "github.com/ollama/ollama/api"
 
@@ -25,6 +28,13 @@ const (
 
 // GetLLMClient 使用 传入的 配置基础，并允许通过 clientDefaultOpts 设置客户端级别的默认调用选项。
 func GetLLMClient(ctx context.Context, cfg *model.Model) (eino_model.ToolCallingChatModel, error) {
+	return GetLLMClientWithConfig(ctx, cfg, nil)
+}
+
+// GetLLMClientWithConfig 创建LLM客户端，并将Agent的生成参数设置为客户端的默认调用参数。
+// 模型开启Reasoning时，返回的客户端会把 <think> 标签中的思考内容从回答中分离，写入 Extra[ReasoningContentKey]。
+// 模型未开启Vision时，包含图片的输入返回 ErrVisionUnsupported。
+func GetLLMClientWithConfig(ctx context.Context, cfg *model.Model, genCfg *model.LLMConfig) (eino_model.ToolCallingChatModel, error) {
 	// 检查Model配置
 	// TODO: 考虑通过check函数实现
 	if cfg == nil {
@@ -33,28 +43,102 @@ func GetLLMClient(ctx context.Context, cfg *model.Model) (eino_model.ToolCalling
 	if cfg.Type != modelTypeLLM {
 		return nil, fmt.Errorf("model type is '%s', but expected '%s'", cfg.Type, modelTypeLLM)
 	}
+	if genCfg == nil {
+		genCfg = &model.LLMConfig{}
+	}
+
+	maxTokens := genCfg.MaxOutputLength
+	if maxTokens <= 0 {
+		maxTokens = cfg.MaxOutputLength
+	}
 
 	// 2. 返回对应的server
+	var (
+		cm  eino_model.ToolCallingChatModel
+		err error
+	)
 	switch strings.ToLower(cfg.Server) {
 	case serverOllama:
 		ollamaCfg := &ollama.ChatModelConfig{
 			BaseURL: cfg.BaseURL,
 			Model:   cfg.ModelName, // 使用最终确定的模型名称
 			Timeout: defaultLLMTimeout,
-			Options: &ollama_api.Options{}, // 设置包含默认调用参数的 Options
+			Options: ollamaOptions(genCfg, maxTokens), // 设置包含默认调用参数的 Options
+		}
+		if genCfg.ResponseFormat == model.ResponseFormatJSONObject {
+			ollamaCfg.Format = json.RawMessage(`"json"`)
 		}
-		return ollama.NewChatModel(ctx, ollamaCfg)
+		cm, err = ollama.NewChatModel(ctx, ollamaCfg)
 
 	case serverOpenAI:
 		openAICfg := &openai.ChatModelConfig{
-			APIKey:  cfg.APIKey,
-			Model:   cfg.ModelName,
-			Timeout: defaultLLMTimeout,
-			BaseURL: cfg.BaseURL,
+			APIKey:           cfg.APIKey,
+			Model:            cfg.ModelName,
+			BaseURL:          cfg.BaseURL,
+			Temperature:      toFloat32(genCfg.Temperature),
+			TopP:             toFloat32(genCfg.TopP),
+			Stop:             genCfg.Stop,
+			Seed:             genCfg.Seed,
+			PresencePenalty:  toFloat32(genCfg.PresencePenalty),
+			FrequencyPenalty: toFloat32(genCfg.FrequencyPenalty),
+			HTTPClient: &http.Client{
+				Timeout:   defaultLLMTimeout,
+				Transport: newOpenAITransport(genCfg),
+			},
+		}
+		if maxTokens > 0 {
+			openAICfg.MaxTokens = &maxTokens
 		}
-		return openai.NewChatModel(ctx, openAICfg)
+		if genCfg.ResponseFormat == model.ResponseFormatJSONObject {
+			openAICfg.ResponseFormat = &acl_openai.ChatCompletionResponseFormat{
+				Type: acl_openai.ChatCompletionResponseFormatTypeJSONObject,
+			}
+		}
+		cm, err = openai.NewChatModel(ctx, openAICfg)
 
 	default:
 		return nil, fmt.Errorf("unsupported LLM server type: '%s'", cfg.Server)
 	}
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Vision {
+		cm = newTextOnlyChatModel(cm)
+	}
+	// 其他模型的输出可能正常包含 <think> 文本，不做解析
+	if cfg.Reasoning {
+		cm = newReasoningChatModel(cm)
+	}
+	return cm, nil
+}
+
+func ollamaOptions(genCfg *model.LLMConfig, maxTokens int) *ollama_api.Options {
+	opts := &ollama_api.Options{
+		NumPredict: maxTokens,
+		Stop:       genCfg.Stop,
+	}
+	if v := toFloat32(genCfg.Temperature); v != nil {
+		opts.Temperature = *v
+	}
+	if v := toFloat32(genCfg.TopP); v != nil {
+		opts.TopP = *v
+	}
+	if v := toFloat32(genCfg.PresencePenalty); v != nil {
+		opts.PresencePenalty = *v
+	}
+	if v := toFloat32(genCfg.FrequencyPenalty); v != nil {
+		opts.FrequencyPenalty = *v
+	}
+	if genCfg.Seed != nil {
+		opts.Seed = *genCfg.Seed
+	}
+	return opts
+}
+
+func toFloat32(v *float64) *float32 {
+	if v == nil {
+		return nil
+	}
+	f := float32(*v)
+	return &f
 }
@@ -0,0 +1,88 @@
+package ollama
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/ollama/ollama/api"
+)
+
+// maxImageBytes limits the size of an image downloaded from a URL
+const maxImageBytes = 20 << 20
+
+// toOllamaContent converts the content of a message. Ollama takes images as raw
+// bytes next to the text, so text parts are joined and image parts are loaded
+// from data URLs or downloaded from http(s) URLs.
+func (cm *ChatModel) toOllamaContent(ctx context.Context, msg *schema.Message) (string, []api.ImageData, error) {
+	if len(msg.MultiContent) == 0 {
+		return msg.Content, nil, nil
+	}
+
+	var (
+		texts  []string
+		images []api.ImageData
+	)
+	for _, part := range msg.MultiContent {
+		switch part.Type {
+		case schema.ChatMessagePartTypeText:
+			texts = append(texts, part.Text)
+		case schema.ChatMessagePartTypeImageURL:
+			if part.ImageURL == nil {
+				return "", nil, errors.New("image part without image url")
+			}
+			img, err := cm.loadImage(ctx, part.ImageURL.URL)
+			if err != nil {
+				return "", nil, err
+			}
+			images = append(images, img)
+		default:
+			return "", nil, fmt.Errorf("unsupported content part type: %s", part.Type)
+		}
+	}
+	return strings.Join(texts, "\n"), images, nil
+}
+
+func (cm *ChatModel) loadImage(ctx context.Context, u string) (api.ImageData, error) {
+	if strings.HasPrefix(u, "data:") {
+		// data:[<mediatype>];base64,<data>
+		meta, data, ok := strings.Cut(strings.TrimPrefix(u, "data:"), ",")
+		if !ok || !strings.HasSuffix(meta, ";base64") {
+			return nil, errors.New("image data url must be base64 encoded")
+		}
+		img, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding image data url: %w", err)
+		}
+		return img, nil
+	}
+
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		return nil, fmt.Errorf("unsupported image url: %.32s", u)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image url: %w", err)
+	}
+	resp, err := cm.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading image: status %d", resp.StatusCode)
+	}
+	img, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("error downloading image: %w", err)
+	}
+	if len(img) > maxImageBytes {
+		return nil, fmt.Errorf("image exceeds %d bytes", maxImageBytes)
+	}
+	return img, nil
+}
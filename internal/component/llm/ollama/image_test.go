@@ -0,0 +1,150 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/ollama/ollama/api"
+)
+
+var (
+	pngBytes = []byte("\x89PNG\r\n\x1a\nfake-png")
+	jpgBytes = []byte("\xff\xd8\xff\xe0fake-jpg")
+)
+
+// fakeServer 模拟Ollama的/api/chat（返回录制的响应，记录请求）和图片下载地址
+func fakeServer(t *testing.T) (*httptest.Server, *[]api.ChatRequest) {
+	t.Helper()
+	fixture, err := os.ReadFile("testdata/chat_response.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reqs []api.ChatRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/chat", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req api.ChatRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		reqs = append(reqs, req)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = w.Write(fixture)
+	})
+	mux.HandleFunc("/images/cat.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = w.Write(jpgBytes)
+	})
+	mux.HandleFunc("/images/large.jpg", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(make([]byte, maxImageBytes+1))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &reqs
+}
+
+func newTestModel(t *testing.T, baseURL string) *ChatModel {
+	t.Helper()
+	cm, err := NewChatModel(context.Background(), &ChatModelConfig{
+		BaseURL: baseURL,
+		Model:   "llava:7b",
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cm
+}
+
+func TestGenerateSendsImages(t *testing.T) {
+	srv, reqs := fakeServer(t)
+	cm := newTestModel(t, srv.URL)
+
+	dataURL := "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngBytes)
+	in := []*schema.Message{
+		schema.SystemMessage("你是一个助手"),
+		{
+			Role: schema.User,
+			MultiContent: []schema.ChatMessagePart{
+				{Type: schema.ChatMessagePartTypeText, Text: "比较这两张图片"},
+				{Type: schema.ChatMessagePartTypeImageURL, ImageURL: &schema.ChatMessageImageURL{URL: dataURL}},
+				{Type: schema.ChatMessagePartTypeImageURL, ImageURL: &schema.ChatMessageImageURL{URL: srv.URL + "/images/cat.jpg"}},
+				{Type: schema.ChatMessagePartTypeText, Text: "哪张是猫？"},
+			},
+		},
+	}
+	out, err := cm.Generate(context.Background(), in)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if out.Content != "图片里是一只猫。" {
+		t.Errorf("content = %q", out.Content)
+	}
+
+	if len(*reqs) != 1 {
+		t.Fatalf("got %d chat requests, want 1", len(*reqs))
+	}
+	msgs := (*reqs)[0].Messages
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+	if msgs[0].Content != "你是一个助手" || len(msgs[0].Images) != 0 {
+		t.Errorf("system message = %+v", msgs[0])
+	}
+	if msgs[1].Content != "比较这两张图片\n哪张是猫？" {
+		t.Errorf("user content = %q", msgs[1].Content)
+	}
+	if len(msgs[1].Images) != 2 {
+		t.Fatalf("got %d images, want 2", len(msgs[1].Images))
+	}
+	if !bytes.Equal(msgs[1].Images[0], pngBytes) {
+		t.Errorf("data url image = %q", msgs[1].Images[0])
+	}
+	if !bytes.Equal(msgs[1].Images[1], jpgBytes) {
+		t.Errorf("downloaded image = %q", msgs[1].Images[1])
+	}
+}
+
+func TestGenerateRejectsInvalidImages(t *testing.T) {
+	srv, reqs := fakeServer(t)
+	cm := newTestModel(t, srv.URL)
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"data url without base64", "data:image/png,abc", "must be base64 encoded"},
+		{"invalid base64", "data:image/png;base64,!!!", "error decoding image data url"},
+		{"unsupported scheme", "file:///etc/passwd", "unsupported image url"},
+		{"download not found", srv.URL + "/images/missing.jpg", "status 404"},
+		{"download too large", srv.URL + "/images/large.jpg", "exceeds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := []*schema.Message{{
+				Role: schema.User,
+				MultiContent: []schema.ChatMessagePart{
+					{Type: schema.ChatMessagePartTypeImageURL, ImageURL: &schema.ChatMessageImageURL{URL: tt.url}},
+				},
+			}}
+			_, err := cm.Generate(context.Background(), in)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+	if len(*reqs) != 0 {
+		t.Errorf("invalid input reached the server: %d requests", len(*reqs))
+	}
+}
@@ -61,6 +61,8 @@ var _ model.ChatModel = (*ChatModel)(nil)
 type ChatModel struct {
 	cli    *api.Client
 	config *ChatModelConfig
+	// httpClient is also used to download images referenced by URL
+	httpClient *http.Client
 
 	tools []*schema.ToolInfo
 }
@@ -87,8 +89,9 @@ func NewChatModel(ctx context.Context, config *ChatModelConfig) (*ChatModel, err
 	cli := api.NewClient(baseURL, httpClient)
 
 	return &ChatModel{
-		cli:    cli,
-		config: config,
+		cli:        cli,
+		config:     config,
+		httpClient: httpClient,
 
 		tools: make([]*schema.ToolInfo, 0),
 	}, nil
@@ -275,7 +278,7 @@ func (cm *ChatModel) genRequest(ctx context.Context, stream bool, in []*schema.M
 		return nil, nil, fmt.Errorf("error unmarshal options: %w", err)
 	}
 
-	msgs, err := toOllamaMessages(in)
+	msgs, err := cm.toOllamaMessages(ctx, in)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error convert messages: %w", err)
 	}
@@ -314,10 +317,10 @@ func (cm *ChatModel) genRequest(ctx context.Context, stream bool, in []*schema.M
 	return req, cbInput, nil
 }
 
-func toOllamaMessages(messages []*schema.Message) ([]api.Message, error) {
+func (cm *ChatModel) toOllamaMessages(ctx context.Context, messages []*schema.Message) ([]api.Message, error) {
 	var ollamaMessages []api.Message
 	for _, msg := range messages {
-		ollamaMsg, err := toOllamaMessage(msg)
+		ollamaMsg, err := cm.toOllamaMessage(ctx, msg)
 		if err != nil {
 			return nil, err
 		}
@@ -327,7 +330,7 @@ func toOllamaMessages(messages []*schema.Message) ([]api.Message, error) {
 	return ollamaMessages, nil
 }
 
-func toOllamaMessage(einoMsg *schema.Message) (api.Message, error) {
+func (cm *ChatModel) toOllamaMessage(ctx context.Context, einoMsg *schema.Message) (api.Message, error) {
 	var toolCalls []api.ToolCall
 	for _, toolCall := range einoMsg.ToolCalls {
 		args, err := parseJSONToObject(toolCall.Function.Arguments)
@@ -343,10 +346,16 @@ func toOllamaMessage(einoMsg *schema.Message) (api.Message, error) {
 		})
 	}
 
-	// Notice: not support ToolCallID, MultiContent
+	content, images, err := cm.toOllamaContent(ctx, einoMsg)
+	if err != nil {
+		return api.Message{}, err
+	}
+
+	// Notice: not support ToolCallID
 	return api.Message{
 		Role:      string(einoMsg.Role),
-		Content:   einoMsg.Content,
+		Content:   content,
+		Images:    images,
 		ToolCalls: toolCalls,
 	}, nil
 }
@@ -0,0 +1,57 @@
+package openai
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// toOpenAIInput prepares messages with multi content for the OpenAI client.
+// The API takes either a string content or content parts, and the client rejects
+// messages that set both, so Content is dropped when MultiContent is present.
+// Image parts must reference an http(s) URL or a base64 data URL.
+func toOpenAIInput(in []*schema.Message) ([]*schema.Message, error) {
+	var out []*schema.Message
+	for i, msg := range in {
+		if len(msg.MultiContent) == 0 {
+			continue
+		}
+		for _, part := range msg.MultiContent {
+			if part.Type != schema.ChatMessagePartTypeImageURL {
+				continue
+			}
+			if part.ImageURL == nil {
+				return nil, errors.New("image part without image url")
+			}
+			if err := checkImageURL(part.ImageURL.URL); err != nil {
+				return nil, err
+			}
+		}
+		if msg.Content == "" {
+			continue
+		}
+		if out == nil {
+			out = make([]*schema.Message, len(in))
+			copy(out, in)
+		}
+		m := *msg
+		m.Content = ""
+		out[i] = &m
+	}
+	if out == nil {
+		return in, nil
+	}
+	return out, nil
+}
+
+func checkImageURL(u string) error {
+	if strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
+		return nil
+	}
+	if strings.HasPrefix(u, "data:image/") && strings.Contains(u, ";base64,") {
+		return nil
+	}
+	return fmt.Errorf("unsupported image url: %.32s", u)
+}
@@ -0,0 +1,133 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// fakeServer 返回录制的响应，并记录收到的请求体
+func fakeServer(t *testing.T) (*httptest.Server, *[]map[string]any) {
+	t.Helper()
+	fixture, err := os.ReadFile("testdata/chat_completion.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reqs []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req map[string]any
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		reqs = append(reqs, req)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(fixture)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &reqs
+}
+
+func newTestModel(t *testing.T, baseURL string) *ChatModel {
+	t.Helper()
+	cm, err := NewChatModel(context.Background(), &ChatModelConfig{
+		APIKey:  "test",
+		BaseURL: baseURL,
+		Model:   "gpt-4o-mini",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cm
+}
+
+func TestGenerateSerializesImageParts(t *testing.T) {
+	srv, reqs := fakeServer(t)
+	cm := newTestModel(t, srv.URL)
+
+	const dataURL = "data:image/png;base64,iVBORw0KGgo="
+	in := []*schema.Message{
+		schema.SystemMessage("你是一个助手"),
+		{
+			Role: schema.User,
+			// Content与MultiContent同时存在时只发送MultiContent
+			Content: "这是什么？",
+			MultiContent: []schema.ChatMessagePart{
+				{Type: schema.ChatMessagePartTypeText, Text: "这是什么？"},
+				{Type: schema.ChatMessagePartTypeImageURL, ImageURL: &schema.ChatMessageImageURL{URL: dataURL, Detail: schema.ImageURLDetailLow}},
+				{Type: schema.ChatMessagePartTypeImageURL, ImageURL: &schema.ChatMessageImageURL{URL: "https://example.com/cat.jpg"}},
+			},
+		},
+	}
+	out, err := cm.Generate(context.Background(), in)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if out.Content != "图片里是一只猫。" {
+		t.Errorf("content = %q", out.Content)
+	}
+	if in[1].Content != "这是什么？" {
+		t.Error("input message was modified")
+	}
+
+	if len(*reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*reqs))
+	}
+	msgs := (*reqs)[0]["messages"].([]any)
+	if got := msgs[0].(map[string]any)["content"]; got != "你是一个助手" {
+		t.Errorf("system content = %#v", got)
+	}
+	// 内容以content数组发送，不再包含字符串形式的Content
+	parts, ok := msgs[1].(map[string]any)["content"].([]any)
+	if !ok {
+		t.Fatalf("user content = %#v, want content parts", msgs[1].(map[string]any)["content"])
+	}
+	want := []any{
+		map[string]any{"type": "text", "text": "这是什么？"},
+		map[string]any{"type": "image_url", "image_url": map[string]any{"url": dataURL, "detail": "low"}},
+		map[string]any{"type": "image_url", "image_url": map[string]any{"url": "https://example.com/cat.jpg"}},
+	}
+	gotJSON, _ := json.Marshal(parts)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("parts = %s\nwant %s", gotJSON, wantJSON)
+	}
+}
+
+func TestGenerateRejectsUnsupportedImageURL(t *testing.T) {
+	srv, reqs := fakeServer(t)
+	cm := newTestModel(t, srv.URL)
+
+	tests := []struct {
+		name string
+		part schema.ChatMessagePart
+		want string
+	}{
+		{"file url", schema.ChatMessagePart{Type: schema.ChatMessagePartTypeImageURL, ImageURL: &schema.ChatMessageImageURL{URL: "file:///etc/passwd"}}, "unsupported image url"},
+		{"data url without base64", schema.ChatMessagePart{Type: schema.ChatMessagePartTypeImageURL, ImageURL: &schema.ChatMessageImageURL{URL: "data:image/png,abc"}}, "unsupported image url"},
+		{"missing url", schema.ChatMessagePart{Type: schema.ChatMessagePartTypeImageURL}, "without image url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := []*schema.Message{{Role: schema.User, MultiContent: []schema.ChatMessagePart{tt.part}}}
+			_, err := cm.Generate(context.Background(), in)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+	if len(*reqs) != 0 {
+		t.Errorf("invalid input reached the server: %d requests", len(*reqs))
+	}
+}
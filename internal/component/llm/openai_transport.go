@@ -0,0 +1,229 @@
+package llmfactory
+
+import (
+	"ai-cloud/internal/model"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// openAITransport 补充OpenAI客户端不支持的请求参数，并兼容返回思考内容的模型。
+// 部分OpenAI兼容服务（如DeepSeek、Qwen）在 reasoning_content / reasoning 字段中返回思考过程，
+// 这里将其改写为 <think>...</think> 包裹的正文，交由 reasoningChatModel 统一分离。
+type openAITransport struct {
+	base  http.RoundTripper
+	extra map[string]any
+}
+
+func newOpenAITransport(genCfg *model.LLMConfig) http.RoundTripper {
+	t := &openAITransport{
+		base:  http.DefaultTransport,
+		extra: map[string]any{},
+	}
+	if genCfg.ReasoningEffort != "" {
+		t.extra["reasoning_effort"] = genCfg.ReasoningEffort
+	}
+	return t
+}
+
+func (t *openAITransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/chat/completions") {
+		return t.base.RoundTrip(req)
+	}
+
+	if len(t.extra) > 0 && req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = t.patchRequest(body)
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body = newReasoningSSEReader(resp.Body)
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	body = rewriteReasoningResponse(body)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+func (t *openAITransport) patchRequest(body []byte) []byte {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return body
+	}
+	for k, v := range t.extra {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		payload[k] = raw
+	}
+	patched, err := json.Marshal(payload)
+	if err != nil {
+		return body
+	}
+	return patched
+}
+
+// popReasoning 取出并删除消息中的思考内容字段
+func popReasoning(msg map[string]any) string {
+	for _, key := range []string{"reasoning_content", "reasoning"} {
+		if s, ok := msg[key].(string); ok {
+			delete(msg, key)
+			if s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// rewriteReasoningResponse 改写非流式响应
+func rewriteReasoningResponse(body []byte) []byte {
+	var resp map[string]any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&resp); err != nil {
+		return body
+	}
+	choices, _ := resp["choices"].([]any)
+	changed := false
+	for _, c := range choices {
+		choice, _ := c.(map[string]any)
+		msg, _ := choice["message"].(map[string]any)
+		if msg == nil {
+			continue
+		}
+		if reasoning := popReasoning(msg); reasoning != "" {
+			content, _ := msg["content"].(string)
+			msg["content"] = thinkOpenTag + reasoning + thinkCloseTag + content
+			changed = true
+		}
+	}
+	if !changed {
+		return body
+	}
+	out, err := json.Marshal(resp)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// newReasoningSSEReader 逐行改写流式响应中的思考内容
+func newReasoningSSEReader(body io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer body.Close()
+		r := bufio.NewReader(body)
+		inReasoning := false
+		for {
+			line, err := r.ReadBytes('\n')
+			if len(line) > 0 {
+				line = rewriteReasoningLine(line, &inReasoning)
+				if _, werr := pw.Write(line); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				_ = pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return &sseReadCloser{PipeReader: pr, body: body}
+}
+
+type sseReadCloser struct {
+	*io.PipeReader
+	body io.ReadCloser
+}
+
+func (r *sseReadCloser) Close() error {
+	_ = r.PipeReader.Close()
+	return r.body.Close()
+}
+
+func rewriteReasoningLine(line []byte, inReasoning *bool) []byte {
+	const prefix = "data:"
+	trimmed := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(trimmed, []byte(prefix)) {
+		return line
+	}
+	data := bytes.TrimSpace(trimmed[len(prefix):])
+	if len(data) == 0 || data[0] != '{' {
+		return line
+	}
+
+	var chunk map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&chunk); err != nil {
+		return line
+	}
+	choices, _ := chunk["choices"].([]any)
+	changed := false
+	for _, c := range choices {
+		choice, _ := c.(map[string]any)
+		delta, _ := choice["delta"].(map[string]any)
+		if delta == nil {
+			continue
+		}
+		content, _ := delta["content"].(string)
+		reasoning := popReasoning(delta)
+		switch {
+		case reasoning != "":
+			if !*inReasoning {
+				reasoning = thinkOpenTag + reasoning
+				*inReasoning = true
+			}
+			if content != "" {
+				// 同一个chunk中同时包含思考结束和正文
+				reasoning += thinkCloseTag
+				*inReasoning = false
+			}
+			delta["content"] = reasoning + content
+			changed = true
+		case *inReasoning && (content != "" || delta["tool_calls"] != nil):
+			delta["content"] = thinkCloseTag + content
+			*inReasoning = false
+			changed = true
+		}
+	}
+	if !changed {
+		return line
+	}
+	out, err := json.Marshal(chunk)
+	if err != nil {
+		return line
+	}
+	return append(append([]byte("data: "), out...), '\n')
+}
@@ -0,0 +1,182 @@
+package llmfactory
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/cloudwego/eino/components"
+	eino_model "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ReasoningContentKey 思考内容在 schema.Message.Extra 中的key
+const ReasoningContentKey = "reasoning_content"
+
+const (
+	thinkOpenTag  = "<think>"
+	thinkCloseTag = "</think>"
+)
+
+// ReasoningContent 获取消息中的思考内容
+func ReasoningContent(msg *schema.Message) string {
+	if msg == nil || msg.Extra == nil {
+		return ""
+	}
+	s, _ := msg.Extra[ReasoningContentKey].(string)
+	return s
+}
+
+// reasoningChatModel 将推理模型输出中 <think>...</think> 包裹的思考内容从回答中分离，
+// 写入 Extra[ReasoningContentKey] 单独输出
+type reasoningChatModel struct {
+	cm eino_model.ToolCallingChatModel
+}
+
+func newReasoningChatModel(cm eino_model.ToolCallingChatModel) eino_model.ToolCallingChatModel {
+	return &reasoningChatModel{cm: cm}
+}
+
+func (m *reasoningChatModel) Generate(ctx context.Context, in []*schema.Message, opts ...eino_model.Option) (*schema.Message, error) {
+	msg, err := m.cm.Generate(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p := &thinkParser{}
+	content, reasoning := p.feed(msg.Content)
+	c, r := p.flush()
+	return m.rewrite(msg, content+c, reasoning+r), nil
+}
+
+func (m *reasoningChatModel) Stream(ctx context.Context, in []*schema.Message, opts ...eino_model.Option) (*schema.StreamReader[*schema.Message], error) {
+	sr, err := m.cm.Stream(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	out, sw := schema.Pipe[*schema.Message](1)
+	go func() {
+		defer sw.Close()
+		defer sr.Close()
+
+		p := &thinkParser{}
+		for {
+			msg, err := sr.Recv()
+			if errors.Is(err, io.EOF) {
+				// 输出被截断在标签中间时，剩余内容按当前状态输出
+				if content, reasoning := p.flush(); content != "" || reasoning != "" {
+					sw.Send(m.rewrite(&schema.Message{Role: schema.Assistant}, content, reasoning), nil)
+				}
+				return
+			}
+			if err != nil {
+				sw.Send(nil, err)
+				return
+			}
+			content, reasoning := p.feed(msg.Content)
+			if closed := sw.Send(m.rewrite(msg, content, reasoning), nil); closed {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (m *reasoningChatModel) WithTools(tools []*schema.ToolInfo) (eino_model.ToolCallingChatModel, error) {
+	cm, err := m.cm.WithTools(tools)
+	if err != nil {
+		return nil, err
+	}
+	return &reasoningChatModel{cm: cm}, nil
+}
+
+func (m *reasoningChatModel) GetType() string {
+	if typ, ok := components.GetType(m.cm); ok {
+		return typ
+	}
+	return "ReasoningChatModel"
+}
+
+// IsCallbacksEnabled 回调由内部的模型客户端负责触发
+func (m *reasoningChatModel) IsCallbacksEnabled() bool {
+	return components.IsCallbacksEnabled(m.cm)
+}
+
+func (m *reasoningChatModel) rewrite(msg *schema.Message, content, reasoning string) *schema.Message {
+	out := *msg
+	out.Content = content
+	if reasoning != "" {
+		out.Extra = make(map[string]any, len(msg.Extra)+1)
+		for k, v := range msg.Extra {
+			out.Extra[k] = v
+		}
+		out.Extra[ReasoningContentKey] = reasoning
+	}
+	return &out
+}
+
+// thinkParser 流式解析 <think> 标签，标签可能被拆分到多个chunk中
+type thinkParser struct {
+	buf     string
+	inThink bool
+	// trimLeading 思考结束后，去掉回答开头的换行
+	trimLeading bool
+}
+
+func (p *thinkParser) feed(s string) (content, reasoning string) {
+	var c, r strings.Builder
+	emit := func(text string) {
+		if p.inThink {
+			r.WriteString(text)
+			return
+		}
+		if p.trimLeading {
+			text = strings.TrimLeft(text, "\r\n")
+			if text == "" {
+				return
+			}
+			p.trimLeading = false
+		}
+		c.WriteString(text)
+	}
+
+	p.buf += s
+	for {
+		tag := thinkOpenTag
+		if p.inThink {
+			tag = thinkCloseTag
+		}
+		if i := strings.Index(p.buf, tag); i >= 0 {
+			emit(p.buf[:i])
+			p.buf = p.buf[i+len(tag):]
+			p.inThink = !p.inThink
+			p.trimLeading = !p.inThink
+			continue
+		}
+		// 保留可能是标签前缀的结尾部分，等待下一个chunk
+		keep := partialTagSuffix(p.buf, tag)
+		emit(p.buf[:len(p.buf)-keep])
+		p.buf = p.buf[len(p.buf)-keep:]
+		return c.String(), r.String()
+	}
+}
+
+func (p *thinkParser) flush() (content, reasoning string) {
+	rest := p.buf
+	p.buf = ""
+	if p.inThink {
+		return "", rest
+	}
+	return rest, ""
+}
+
+// partialTagSuffix 返回s的结尾与tag前缀重合的最大长度
+func partialTagSuffix(s, tag string) int {
+	for n := min(len(s), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
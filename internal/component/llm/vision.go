@@ -0,0 +1,68 @@
+package llmfactory
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cloudwego/eino/components"
+	eino_model "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ErrVisionUnsupported 模型不支持图片输入
+var ErrVisionUnsupported = errors.New("model does not support image input")
+
+// HasImages 消息中是否包含图片
+func HasImages(msgs []*schema.Message) bool {
+	for _, msg := range msgs {
+		for _, part := range msg.MultiContent {
+			if part.Type == schema.ChatMessagePartTypeImageURL {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// textOnlyChatModel 未开启Vision的模型，在请求发出前拒绝包含图片的输入
+type textOnlyChatModel struct {
+	cm eino_model.ToolCallingChatModel
+}
+
+func newTextOnlyChatModel(cm eino_model.ToolCallingChatModel) eino_model.ToolCallingChatModel {
+	return &textOnlyChatModel{cm: cm}
+}
+
+func (m *textOnlyChatModel) Generate(ctx context.Context, in []*schema.Message, opts ...eino_model.Option) (*schema.Message, error) {
+	if HasImages(in) {
+		return nil, ErrVisionUnsupported
+	}
+	return m.cm.Generate(ctx, in, opts...)
+}
+
+func (m *textOnlyChatModel) Stream(ctx context.Context, in []*schema.Message, opts ...eino_model.Option) (*schema.StreamReader[*schema.Message], error) {
+	if HasImages(in) {
+		return nil, ErrVisionUnsupported
+	}
+	return m.cm.Stream(ctx, in, opts...)
+}
+
+func (m *textOnlyChatModel) WithTools(tools []*schema.ToolInfo) (eino_model.ToolCallingChatModel, error) {
+	cm, err := m.cm.WithTools(tools)
+	if err != nil {
+		return nil, err
+	}
+	return &textOnlyChatModel{cm: cm}, nil
+}
+
+func (m *textOnlyChatModel) GetType() string {
+	if typ, ok := components.GetType(m.cm); ok {
+		return typ
+	}
+	return "TextOnlyChatModel"
+}
+
+// IsCallbacksEnabled 回调由内部的模型客户端负责触发
+func (m *textOnlyChatModel) IsCallbacksEnabled() bool {
+	return components.IsCallbacksEnabled(m.cm)
+}
@@ -0,0 +1,124 @@
+package llmfactory
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// fakeOpenAIServer 返回录制的响应并统计收到的请求数
+func fakeOpenAIServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	fixture, err := os.ReadFile("testdata/chat_completion.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(fixture)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func testModel(baseURL string, vision bool) *model.Model {
+	return &model.Model{
+		Type:      modelTypeLLM,
+		Server:    serverOpenAI,
+		BaseURL:   baseURL,
+		ModelName: "gpt-4o-mini",
+		APIKey:    "test",
+		Vision:    vision,
+	}
+}
+
+func imageMessage() []*schema.Message {
+	return []*schema.Message{{
+		Role: schema.User,
+		MultiContent: []schema.ChatMessagePart{
+			{Type: schema.ChatMessagePartTypeText, Text: "这是什么？"},
+			{Type: schema.ChatMessagePartTypeImageURL, ImageURL: &schema.ChatMessageImageURL{URL: "https://example.com/cat.jpg"}},
+		},
+	}}
+}
+
+func TestTextOnlyModelRejectsImages(t *testing.T) {
+	srv, calls := fakeOpenAIServer(t)
+	ctx := context.Background()
+	cm, err := GetLLMClientWithConfig(ctx, testModel(srv.URL, false), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cm.Generate(ctx, imageMessage()); !errors.Is(err, ErrVisionUnsupported) {
+		t.Errorf("Generate err = %v, want ErrVisionUnsupported", err)
+	}
+	if _, err := cm.Stream(ctx, imageMessage()); !errors.Is(err, ErrVisionUnsupported) {
+		t.Errorf("Stream err = %v, want ErrVisionUnsupported", err)
+	}
+	// 绑定工具后仍然拒绝图片
+	withTools, err := cm.WithTools([]*schema.ToolInfo{{Name: "search", Desc: "search the web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := withTools.Generate(ctx, imageMessage()); !errors.Is(err, ErrVisionUnsupported) {
+		t.Errorf("Generate with tools err = %v, want ErrVisionUnsupported", err)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("image input reached the server: %d requests", n)
+	}
+
+	// 纯文本输入正常发送
+	out, err := cm.Generate(ctx, []*schema.Message{schema.UserMessage("你好")})
+	if err != nil {
+		t.Fatalf("Generate text: %v", err)
+	}
+	if out.Content != "图片里是一只猫。" {
+		t.Errorf("content = %q", out.Content)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestVisionModelSendsImages(t *testing.T) {
+	srv, calls := fakeOpenAIServer(t)
+	ctx := context.Background()
+	cm, err := GetLLMClientWithConfig(ctx, testModel(srv.URL, true), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cm.Generate(ctx, imageMessage()); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestHasImages(t *testing.T) {
+	tests := []struct {
+		name string
+		msgs []*schema.Message
+		want bool
+	}{
+		{"empty", nil, false},
+		{"text only", []*schema.Message{schema.UserMessage("hi")}, false},
+		{"text parts", []*schema.Message{{Role: schema.User, MultiContent: []schema.ChatMessagePart{{Type: schema.ChatMessagePartTypeText, Text: "hi"}}}}, false},
+		{"image in history", append([]*schema.Message{schema.UserMessage("hi")}, imageMessage()...), true},
+	}
+	for _, tt := range tests {
+		if got := HasImages(tt.msgs); got != tt.want {
+			t.Errorf("%s: HasImages = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -226,3 +226,14 @@ func (m *MilvusRetrieverConfig) check() error {
 
 	return nil
 }
+
+// DocumentScore 获取检索结果的相似度分数，检索时写入 MetaData["score"]
+func DocumentScore(doc *schema.Document) float64 {
+	switch v := doc.MetaData["score"].(type) {
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return doc.Score()
+}
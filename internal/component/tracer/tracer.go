@@ -0,0 +1,413 @@
+package tracer
+
+import (
+	mretriever "ai-cloud/internal/component/retriever/milvus"
+	"ai-cloud/internal/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxFieldLength 输入输出等字段保存的最大字符数
+	maxFieldLength = 4000
+	// maxDocContentLength 检索文档保存的最大字符数
+	maxDocContentLength = 500
+	// maxStreamChunks 非消息类型的流最多记录的chunk数
+	maxStreamChunks = 100
+	// maxStoredChunks 读取流时最多保存的chunk数，避免大量空chunk占用内存
+	maxStoredChunks = 10000
+)
+
+// Tracer 通过eino回调记录一次Agent运行的所有步骤。
+// 嵌套运行的子Agent、工作流等会继承ctx中的回调，因此也记录在同一个Trace中。
+type Tracer struct {
+	trace *model.Trace
+	start time.Time
+
+	mu    sync.Mutex
+	spans []*model.TraceSpan
+	root  string
+
+	// streams 尚未读取完的流式输入输出
+	streams  sync.WaitGroup
+	once     sync.Once
+	done     chan struct{}
+	onEvent  func(*model.TraceEvent)
+	onFinish func(*model.Trace, []*model.TraceSpan)
+}
+
+type Option func(*Tracer)
+
+// WithOnEvent 实时接收Trace事件
+func WithOnEvent(fn func(*model.TraceEvent)) Option {
+	return func(t *Tracer) {
+		t.onEvent = fn
+	}
+}
+
+// WithOnFinish 运行结束后接收完整的Trace，用于持久化
+func WithOnFinish(fn func(*model.Trace, []*model.TraceSpan)) Option {
+	return func(t *Tracer) {
+		t.onFinish = fn
+	}
+}
+
+func New(trace *model.Trace, opts ...Option) *Tracer {
+	trace.Status = model.TraceStatusRunning
+	t := &Tracer{
+		trace: trace,
+		start: time.Now(),
+		done:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Trace 返回Trace记录，运行结束前其中的统计字段尚未填充
+func (t *Tracer) Trace() *model.Trace {
+	return t.trace
+}
+
+// Done 运行结束且Trace已经处理完毕时关闭
+func (t *Tracer) Done() <-chan struct{} {
+	return t.done
+}
+
+// Handler 返回需要注册到Graph上的回调
+func (t *Tracer) Handler() callbacks.Handler {
+	return callbacks.NewHandlerBuilder().
+		OnStartFn(func(ctx context.Context, info *callbacks.RunInfo, input callbacks.CallbackInput) context.Context {
+			span := t.startSpan(ctx, info)
+			t.update(span, func() { span.Input = formatInput(info, input) })
+			t.emit(model.TraceEventSpanStart, span)
+			return context.WithValue(ctx, t, span)
+		}).
+		OnEndFn(func(ctx context.Context, info *callbacks.RunInfo, output callbacks.CallbackOutput) context.Context {
+			if span, ok := ctx.Value(t).(*model.TraceSpan); ok {
+				t.update(span, func() { setOutput(span, info, output) })
+				t.endSpan(span, nil)
+			}
+			return ctx
+		}).
+		OnErrorFn(func(ctx context.Context, info *callbacks.RunInfo, err error) context.Context {
+			if span, ok := ctx.Value(t).(*model.TraceSpan); ok {
+				t.endSpan(span, err)
+			}
+			return ctx
+		}).
+		OnStartWithStreamInputFn(func(ctx context.Context, info *callbacks.RunInfo, input *schema.StreamReader[callbacks.CallbackInput]) context.Context {
+			span := t.startSpan(ctx, info)
+			t.emit(model.TraceEventSpanStart, span)
+			t.streams.Add(1)
+			go func() {
+				defer t.streams.Done()
+				chunks, _ := readStream(input)
+				t.update(span, func() { span.Input = truncate(marshal(chunks)) })
+			}()
+			return context.WithValue(ctx, t, span)
+		}).
+		OnEndWithStreamOutputFn(func(ctx context.Context, info *callbacks.RunInfo, output *schema.StreamReader[callbacks.CallbackOutput]) context.Context {
+			span, ok := ctx.Value(t).(*model.TraceSpan)
+			if !ok {
+				output.Close()
+				return ctx
+			}
+			t.streams.Add(1)
+			go func() {
+				defer t.streams.Done()
+				chunks, err := readStream(output)
+				t.update(span, func() { setStreamOutput(span, info, chunks) })
+				t.endSpan(span, err)
+			}()
+			return ctx
+		}).
+		Build()
+}
+
+// Finish 在Graph未能开始运行时（如构建失败）结束Trace
+func (t *Tracer) Finish(err error) {
+	go t.finish(err)
+}
+
+func (t *Tracer) startSpan(ctx context.Context, info *callbacks.RunInfo) *model.TraceSpan {
+	span := &model.TraceSpan{
+		ID:        uuid.NewString(),
+		TraceID:   t.trace.ID,
+		StartedAt: time.Now(),
+	}
+	if info != nil {
+		span.Name = info.Name
+		span.Component = string(info.Component)
+		span.Type = info.Type
+	}
+	if parent, ok := ctx.Value(t).(*model.TraceSpan); ok {
+		span.ParentID = parent.ID
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span.Seq = len(t.spans)
+	t.spans = append(t.spans, span)
+	if span.ParentID == "" && t.root == "" {
+		t.root = span.ID
+	}
+	return span
+}
+
+func (t *Tracer) endSpan(span *model.TraceSpan, err error) {
+	t.mu.Lock()
+	span.EndedAt = time.Now()
+	span.DurationMs = span.EndedAt.Sub(span.StartedAt).Milliseconds()
+	if err != nil {
+		span.Error = err.Error()
+	}
+	isRoot := span.ID == t.root
+	t.mu.Unlock()
+
+	t.emit(model.TraceEventSpanEnd, span)
+	if isRoot {
+		go t.finish(err)
+	}
+}
+
+func (t *Tracer) update(span *model.TraceSpan, fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn()
+}
+
+func (t *Tracer) emit(typ string, span *model.TraceSpan) {
+	if t.onEvent == nil {
+		return
+	}
+	t.mu.Lock()
+	cp := *span
+	t.mu.Unlock()
+	t.onEvent(&model.TraceEvent{Type: typ, Span: &cp})
+}
+
+// finish 等待所有流读取完毕后汇总Trace
+func (t *Tracer) finish(err error) {
+	t.once.Do(func() {
+		defer close(t.done)
+		t.streams.Wait()
+
+		t.mu.Lock()
+		trace := t.trace
+		trace.DurationMs = time.Since(t.start).Milliseconds()
+		trace.Status = model.TraceStatusSuccess
+		if err != nil {
+			trace.Status = model.TraceStatusError
+			trace.Error = err.Error()
+		}
+		for _, span := range t.spans {
+			if span.Component == string(components.ComponentOfChatModel) {
+				trace.PromptTokens += span.PromptTokens
+				trace.CompletionTokens += span.CompletionTokens
+				trace.TotalTokens += span.TotalTokens
+			}
+		}
+		spans := t.spans
+		t.mu.Unlock()
+
+		if t.onEvent != nil {
+			cp := *trace
+			t.onEvent(&model.TraceEvent{Type: model.TraceEventEnd, Trace: &cp})
+		}
+		if t.onFinish != nil {
+			t.onFinish(trace, spans)
+		}
+	})
+}
+
+func formatInput(info *callbacks.RunInfo, input callbacks.CallbackInput) string {
+	switch component(info) {
+	case components.ComponentOfChatModel:
+		if in := einomodel.ConvCallbackInput(input); in != nil {
+			tools := make([]string, 0, len(in.Tools))
+			for _, t := range in.Tools {
+				tools = append(tools, t.Name)
+			}
+			return truncate(marshal(map[string]any{
+				"messages": in.Messages,
+				"tools":    tools,
+				"config":   in.Config,
+			}))
+		}
+	case components.ComponentOfRetriever:
+		if in := retriever.ConvCallbackInput(input); in != nil {
+			return truncate(marshal(map[string]any{"query": in.Query, "top_k": in.TopK}))
+		}
+	case components.ComponentOfTool:
+		if in := tool.ConvCallbackInput(input); in != nil {
+			return truncate(in.ArgumentsInJSON)
+		}
+	}
+	return truncate(marshal(input))
+}
+
+func setOutput(span *model.TraceSpan, info *callbacks.RunInfo, output callbacks.CallbackOutput) {
+	switch component(info) {
+	case components.ComponentOfChatModel:
+		if out := einomodel.ConvCallbackOutput(output); out != nil {
+			span.Output = truncate(marshal(out.Message))
+			setTokenUsage(span, out.TokenUsage)
+			return
+		}
+	case components.ComponentOfRetriever:
+		if out := retriever.ConvCallbackOutput(output); out != nil {
+			span.Documents = marshal(toTraceDocuments(out.Docs))
+			span.Output = fmt.Sprintf("%d documents", len(out.Docs))
+			return
+		}
+	case components.ComponentOfTool:
+		if out := tool.ConvCallbackOutput(output); out != nil {
+			span.Output = truncate(out.Response)
+			return
+		}
+	}
+	span.Output = truncate(marshal(output))
+}
+
+func setStreamOutput(span *model.TraceSpan, info *callbacks.RunInfo, chunks []any) {
+	var msgs []*schema.Message
+	for _, c := range chunks {
+		switch v := c.(type) {
+		case *schema.Message:
+			msgs = append(msgs, v)
+		case *einomodel.CallbackOutput:
+			if v.Message != nil {
+				msgs = append(msgs, v.Message)
+			}
+			setTokenUsage(span, v.TokenUsage)
+		}
+	}
+	if len(msgs) > 0 && len(msgs) == len(chunks) || component(info) == components.ComponentOfChatModel {
+		if msg, err := schema.ConcatMessages(msgs); err == nil {
+			span.Output = truncate(marshal(msg))
+			return
+		}
+	}
+	if len(chunks) > maxStreamChunks {
+		chunks = chunks[:maxStreamChunks]
+	}
+	span.Output = truncate(marshal(chunks))
+}
+
+func setTokenUsage(span *model.TraceSpan, usage *einomodel.TokenUsage) {
+	if usage == nil {
+		return
+	}
+	// 流式输出中用量通常只在最后一个chunk中出现，取最大值
+	span.PromptTokens = max(span.PromptTokens, usage.PromptTokens)
+	span.CompletionTokens = max(span.CompletionTokens, usage.CompletionTokens)
+	span.TotalTokens = max(span.TotalTokens, usage.TotalTokens)
+}
+
+func toTraceDocuments(docs []*schema.Document) []model.TraceDocument {
+	out := make([]model.TraceDocument, 0, len(docs))
+	for _, d := range docs {
+		name, _ := d.MetaData["document_name"].(string)
+		content := []rune(d.Content)
+		if len(content) > maxDocContentLength {
+			content = content[:maxDocContentLength]
+		}
+		out = append(out, model.TraceDocument{
+			ID:           d.ID,
+			DocumentName: name,
+			Score:        mretriever.DocumentScore(d),
+			Content:      string(content),
+		})
+	}
+	return out
+}
+
+func component(info *callbacks.RunInfo) components.Component {
+	if info == nil {
+		return ""
+	}
+	return info.Component
+}
+
+// readStream 读取并关闭回调中的流。已保存的内容超过字段长度上限后只读取不再保存，
+// 最后一个chunk始终保留，流式输出的用量通常在其中
+func readStream[T any](sr *schema.StreamReader[T]) ([]any, error) {
+	defer sr.Close()
+	var (
+		chunks  []any
+		size    int
+		last    any
+		dropped bool
+	)
+	for {
+		chunk, err := sr.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if dropped {
+				chunks = append(chunks, last)
+			}
+			return chunks, err
+		}
+		if size < maxFieldLength && len(chunks) < maxStoredChunks {
+			chunks = append(chunks, chunk)
+			size += chunkSize(chunk)
+			continue
+		}
+		last, dropped = chunk, true
+	}
+	if dropped {
+		chunks = append(chunks, last)
+	}
+	return chunks, nil
+}
+
+// chunkSize 估算chunk保存后的字符数
+func chunkSize(chunk any) int {
+	switch v := chunk.(type) {
+	case *schema.Message:
+		return utf8.RuneCountInString(v.Content)
+	case *einomodel.CallbackOutput:
+		if v.Message == nil {
+			return 0
+		}
+		return utf8.RuneCountInString(v.Message.Content)
+	}
+	return utf8.RuneCountInString(marshal(chunk))
+}
+
+func marshal(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+func truncate(s string) string {
+	r := []rune(s)
+	if len(r) <= maxFieldLength {
+		return s
+	}
+	return string(r[:maxFieldLength]) + "...(truncated)"
+}
@@ -0,0 +1,746 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Eval 计算表达式的值。
+//
+// 支持的语法：
+//   - 字面量：数字、字符串（单/双引号）、true/false/null
+//   - 变量：node_id.field、node_id.list[0].field
+//   - 运算符：|| && ! == != < <= > >= + - * / %
+//   - 函数：len contains lower upper trim startsWith endsWith join str num
+func Eval(expression string, vars map[string]any) (any, error) {
+	node, err := parse(expression)
+	if err != nil {
+		return nil, err
+	}
+	return node.eval(vars)
+}
+
+// CheckExpression 校验表达式语法
+func CheckExpression(expression string) error {
+	_, err := parse(expression)
+	return err
+}
+
+// EvalBool 计算表达式并转换为布尔值
+func EvalBool(expression string, vars map[string]any) (bool, error) {
+	v, err := Eval(expression, vars)
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+// Lookup 按路径从变量中取值，例如 retriever_1.documents[0].content
+func Lookup(path string, vars map[string]any) (any, error) {
+	return Eval(path, vars)
+}
+
+/******************** 词法分析 ********************/
+
+type tokenKind int
+
+const (
+	tokNumber tokenKind = iota
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// tokenize 按UTF-8字符切分，字符串字面量和标识符可以包含中文等非ASCII字符
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case c == utf8.RuneError && size == 1:
+			return nil, fmt.Errorf("invalid utf-8 in expression %q", s)
+		case unicode.IsSpace(c):
+			i += size
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, s[i:j]})
+			i = j
+		case c == '"' || c == '\'':
+			j := i + size
+			var sb strings.Builder
+			closed := false
+			for j < len(s) {
+				r, n := utf8.DecodeRuneInString(s[j:])
+				if r == c {
+					closed = true
+					j += n
+					break
+				}
+				if r == '\\' && j+n < len(s) {
+					j += n
+					r, n = utf8.DecodeRuneInString(s[j:])
+				}
+				sb.WriteRune(r)
+				j += n
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string in expression %q", s)
+			}
+			tokens = append(tokens, token{tokString, sb.String()})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) {
+				r, n := utf8.DecodeRuneInString(s[j:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+					break
+				}
+				j += n
+			}
+			tokens = append(tokens, token{tokIdent, s[i:j]})
+			i = j
+		default:
+			if i+1 < len(s) {
+				two := s[i : i+2]
+				switch two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					tokens = append(tokens, token{tokOp, two})
+					i += 2
+					continue
+				}
+			}
+			if strings.ContainsRune("<>!+-*/%().,[]", c) {
+				tokens = append(tokens, token{tokOp, string(c)})
+				i += size
+				continue
+			}
+			return nil, fmt.Errorf("unexpected character %q in expression %q", c, s)
+		}
+	}
+	return tokens, nil
+}
+
+/******************** 语法分析 ********************/
+
+func parse(expression string) (exprNode, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", expression, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token %q in expression %q", p.tokens[p.pos].text, expression)
+	}
+	return node, nil
+}
+
+type exprNode interface {
+	eval(vars map[string]any) (any, error)
+}
+
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) peek() *token {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *exprParser) acceptOp(ops ...string) (string, bool) {
+	t := p.peek()
+	if t == nil || t.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expectOp(op string) error {
+	if _, ok := p.acceptOp(op); !ok {
+		return fmt.Errorf("expected %q", op)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	left, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.acceptOp("==", "!=", "<", "<=", ">", ">="); ok {
+		right, err := p.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAdd() (exprNode, error) {
+	left, err := p.parseMul()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMul()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseMul() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if op, ok := p.acceptOp("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("."); ok {
+			t := p.peek()
+			if t == nil || t.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name after '.'")
+			}
+			p.pos++
+			node = &indexNode{target: node, index: &literalNode{value: t.text}}
+			continue
+		}
+		if _, ok := p.acceptOp("["); ok {
+			idx, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp("]"); err != nil {
+				return nil, err
+			}
+			node = &indexNode{target: node, index: idx}
+			continue
+		}
+		return node, nil
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return &literalNode{value: f}, nil
+	case tokString:
+		return &literalNode{value: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if _, ok := p.acceptOp("("); ok {
+			var args []exprNode
+			if _, ok := p.acceptOp(")"); !ok {
+				for {
+					arg, err := p.parseOr()
+					if err != nil {
+						return nil, err
+					}
+					args = append(args, arg)
+					if _, ok := p.acceptOp(","); ok {
+						continue
+					}
+					if err := p.expectOp(")"); err != nil {
+						return nil, err
+					}
+					break
+				}
+			}
+			return &callNode{name: t.text, args: args}, nil
+		}
+		return &varNode{name: t.text}, nil
+	case tokOp:
+		if t.text == "(" {
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return node, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected token %q", t.text)
+}
+
+/******************** 求值 ********************/
+
+type literalNode struct{ value any }
+
+func (n *literalNode) eval(map[string]any) (any, error) { return n.value, nil }
+
+type varNode struct{ name string }
+
+func (n *varNode) eval(vars map[string]any) (any, error) {
+	return vars[n.name], nil
+}
+
+type indexNode struct {
+	target exprNode
+	index  exprNode
+}
+
+func (n *indexNode) eval(vars map[string]any) (any, error) {
+	target, err := n.target.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := n.index.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return index(normalize(target), idx), nil
+}
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+func (n *unaryNode) eval(vars map[string]any) (any, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !truthy(v), nil
+	}
+	f, ok := toNumber(v)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %v", v)
+	}
+	return -f, nil
+}
+
+type logicalNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *logicalNode) eval(vars map[string]any) (any, error) {
+	l, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" && !truthy(l) {
+		return false, nil
+	}
+	if n.op == "||" && truthy(l) {
+		return true, nil
+	}
+	r, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(r), nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(vars map[string]any) (any, error) {
+	l, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equals(l, r), nil
+	case "!=":
+		return !equals(l, r), nil
+	case "+":
+		if ls, ok := l.(string); ok {
+			return ls + ToString(r), nil
+		}
+		if rs, ok := r.(string); ok {
+			return ToString(l) + rs, nil
+		}
+	}
+
+	if ls, ok := l.(string); ok {
+		if rs, ok := r.(string); ok {
+			switch n.op {
+			case "<":
+				return ls < rs, nil
+			case "<=":
+				return ls <= rs, nil
+			case ">":
+				return ls > rs, nil
+			case ">=":
+				return ls >= rs, nil
+			}
+		}
+	}
+
+	lf, lok := toNumber(l)
+	rf, rok := toNumber(r)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s does not support operands %v and %v", n.op, l, r)
+	}
+	switch n.op {
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case ">":
+		return lf > rf, nil
+	case ">=":
+		return lf >= rf, nil
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf / rf, nil
+	case "%":
+		if int64(rf) == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return float64(int64(lf) % int64(rf)), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", n.op)
+}
+
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+func (n *callNode) eval(vars map[string]any) (any, error) {
+	args := make([]any, 0, len(n.args))
+	for _, a := range n.args {
+		v, err := a.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, normalize(v))
+	}
+
+	argc := func(want int) error {
+		if len(args) != want {
+			return fmt.Errorf("%s expects %d argument(s), got %d", n.name, want, len(args))
+		}
+		return nil
+	}
+
+	switch n.name {
+	case "len":
+		if err := argc(1); err != nil {
+			return nil, err
+		}
+		switch v := args[0].(type) {
+		case string:
+			return float64(len([]rune(v))), nil
+		case []any:
+			return float64(len(v)), nil
+		case map[string]any:
+			return float64(len(v)), nil
+		case nil:
+			return float64(0), nil
+		}
+		return nil, fmt.Errorf("len does not support %T", args[0])
+	case "contains":
+		if err := argc(2); err != nil {
+			return nil, err
+		}
+		switch v := args[0].(type) {
+		case string:
+			return strings.Contains(v, ToString(args[1])), nil
+		case []any:
+			for _, item := range v {
+				if equals(item, args[1]) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]any:
+			_, ok := v[ToString(args[1])]
+			return ok, nil
+		}
+		return false, nil
+	case "lower", "upper", "trim":
+		if err := argc(1); err != nil {
+			return nil, err
+		}
+		s := ToString(args[0])
+		switch n.name {
+		case "lower":
+			return strings.ToLower(s), nil
+		case "upper":
+			return strings.ToUpper(s), nil
+		default:
+			return strings.TrimSpace(s), nil
+		}
+	case "startsWith", "endsWith":
+		if err := argc(2); err != nil {
+			return nil, err
+		}
+		if n.name == "startsWith" {
+			return strings.HasPrefix(ToString(args[0]), ToString(args[1])), nil
+		}
+		return strings.HasSuffix(ToString(args[0]), ToString(args[1])), nil
+	case "join":
+		if err := argc(2); err != nil {
+			return nil, err
+		}
+		list, _ := args[0].([]any)
+		parts := make([]string, 0, len(list))
+		for _, item := range list {
+			parts = append(parts, ToString(item))
+		}
+		return strings.Join(parts, ToString(args[1])), nil
+	case "str":
+		if err := argc(1); err != nil {
+			return nil, err
+		}
+		return ToString(args[0]), nil
+	case "num":
+		if err := argc(1); err != nil {
+			return nil, err
+		}
+		f, ok := toNumber(args[0])
+		if !ok {
+			return nil, fmt.Errorf("cannot convert %v to number", args[0])
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown function %s", n.name)
+}
+
+/******************** 工具函数 ********************/
+
+// normalize 将任意Go值转换为JSON兼容的基础类型（map[string]any、[]any、float64等）
+func normalize(v any) any {
+	switch v.(type) {
+	case nil, string, bool, float64, map[string]any, []any:
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func index(target any, idx any) any {
+	switch t := target.(type) {
+	case map[string]any:
+		return t[ToString(idx)]
+	case []any:
+		f, ok := toNumber(idx)
+		if !ok {
+			return nil
+		}
+		i := int(f)
+		if i < 0 {
+			i += len(t)
+		}
+		if i < 0 || i >= len(t) {
+			return nil
+		}
+		return t[i]
+	}
+	return nil
+}
+
+func truthy(v any) bool {
+	switch val := normalize(v).(type) {
+	case nil:
+		return false
+	case bool:
+		return val
+	case float64:
+		return val != 0
+	case string:
+		return val != ""
+	case []any:
+		return len(val) > 0
+	case map[string]any:
+		return len(val) > 0
+	}
+	return true
+}
+
+func toNumber(v any) (float64, bool) {
+	switch val := normalize(v).(type) {
+	case float64:
+		return val, true
+	case bool:
+		if val {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func equals(a, b any) bool {
+	a, b = normalize(a), normalize(b)
+	if af, ok := a.(float64); ok {
+		if bf, ok := toNumber(b); ok {
+			return af == bf
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// ToString 将值转换为字符串，复杂类型使用JSON编码
+func ToString(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case fmt.Stringer:
+		return val.String()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
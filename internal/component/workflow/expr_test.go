@@ -0,0 +1,152 @@
+package workflow
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]any{
+		"start": map[string]any{
+			"query": "你好，世界",
+			"count": 3,
+			"tags":  []string{"a", "b"},
+		},
+		"retriever_1": map[string]any{
+			"documents": []any{
+				map[string]any{"content": "first"},
+				map[string]any{"content": "last"},
+			},
+		},
+		"用户": map[string]any{"名字": "小明"},
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		want any
+	}{
+		// 优先级和结合性
+		{"mul before add", "1 + 2 * 3", 7.0},
+		{"parentheses", "(1 + 2) * 3", 9.0},
+		{"left associative sub", "10 - 4 - 3", 3.0},
+		{"left associative div", "8 / 4 / 2", 1.0},
+		{"modulo", "7 % 4 + 1", 4.0},
+		{"unary minus", "-2 * -3", 6.0},
+		{"double negation", "!!1", true},
+		{"compare before and", "1 < 2 && 3 > 4", false},
+		{"and before or", "true || false && false", true},
+		{"or of parenthesized and", "(true || false) && false", false},
+		{"not binds tighter than and", "!false && true", true},
+
+		// 类型
+		{"string concat", "'a' + 1", "a1"},
+		{"number concat", "1 + 'a'", "1a"},
+		{"numeric string", "'2' * 3", 6.0},
+		{"number equals numeric string", "1 == '1'", true},
+		{"string compare", "'abc' < 'abd'", true},
+		{"bool as number", "true + 1", 2.0},
+		{"null equals null", "null == null", true},
+		{"missing var is null", "missing == null", true},
+		{"int var", "start.count * 2", 6.0},
+		{"string slice var", "start.tags[1]", "b"},
+		{"negative index", "retriever_1.documents[-1].content", "last"},
+		{"out of range index", "retriever_1.documents[5]", nil},
+		{"bracket field", "start['query']", "你好，世界"},
+		{"short circuit skips error", "false && 1 / 0", false},
+
+		// UTF-8
+		{"utf8 string literal", "'中文' + \"字符串\"", "中文字符串"},
+		{"utf8 escaped quote", `'它\'s'`, "它's"},
+		{"utf8 identifier", "用户.名字", "小明"},
+		{"utf8 len counts runes", "len(start.query)", 5.0},
+		{"utf8 contains", "contains(start.query, '世界')", true},
+
+		// 函数
+		{"len list", "len(retriever_1.documents)", 2.0},
+		{"len null", "len(null)", 0.0},
+		{"contains list", "contains(start.tags, 'a')", true},
+		{"contains map", "contains(start, 'count')", true},
+		{"upper", "upper('abc')", "ABC"},
+		{"trim", "trim('  x ')", "x"},
+		{"startsWith", "startsWith('hello', 'he')", true},
+		{"endsWith", "endsWith('hello', 'lo')", true},
+		{"join", "join(start.tags, ',')", "a,b"},
+		{"str", "str(1.5)", "1.5"},
+		{"num", "num(' 42 ') + 1", 43.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Eval(tt.expr, vars)
+			if err != nil {
+				t.Fatalf("Eval(%q) error: %v", tt.expr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Eval(%q) = %#v, want %#v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{"unterminated string", "'abc", "unterminated string"},
+		{"unterminated utf8 string", "'中文", "unterminated string"},
+		{"unexpected character", "1 # 2", "unexpected character"},
+		{"unexpected utf8 character", "1 ＋ 2", "unexpected character"},
+		{"invalid utf8", "'a' + \xff", "invalid utf-8"},
+		{"missing operand", "1 +", "unexpected end of expression"},
+		{"unclosed paren", "(1 + 2", `expected ")"`},
+		{"trailing token", "1 2", "unexpected token"},
+		{"field after dot", "start.1", "expected field name"},
+		{"invalid number", "1.2.3", "invalid number"},
+		{"division by zero", "1 / 0", "division by zero"},
+		{"modulo by zero", "1 % 0", "division by zero"},
+		{"negate string", "-'a'", "cannot negate"},
+		{"non-numeric operands", "'a' * 2", "does not support operands"},
+		{"unknown function", "foo(1)", "unknown function"},
+		{"wrong arity", "len(1, 2)", "expects 1 argument"},
+		{"len of number", "len(1)", "len does not support"},
+		{"num of text", "num('x')", "cannot convert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Eval(tt.expr, nil)
+			if err == nil {
+				t.Fatalf("Eval(%q) succeeded, want error containing %q", tt.expr, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Eval(%q) error = %q, want it to contain %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvalBool(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"''", false},
+		{"'0'", true},
+		{"0", false},
+		{"null", false},
+		{"x", true},
+		{"len(x) > 1", true},
+	}
+	vars := map[string]any{"x": []any{1, 2}}
+	for _, tt := range tests {
+		got, err := EvalBool(tt.expr, vars)
+		if err != nil {
+			t.Fatalf("EvalBool(%q) error: %v", tt.expr, err)
+		}
+		if got != tt.want {
+			t.Errorf("EvalBool(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
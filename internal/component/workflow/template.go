@@ -0,0 +1,100 @@
+package workflow
+
+import (
+	"fmt"
+	"strings"
+)
+
+// templatePart 模板片段，expression为空时为普通文本
+type templatePart struct {
+	text       string
+	expression exprNode
+}
+
+// parseTemplate 将模板拆分为文本和 {{ 表达式 }} 片段
+func parseTemplate(tpl string) ([]templatePart, error) {
+	var parts []templatePart
+	rest := tpl
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			if rest != "" {
+				parts = append(parts, templatePart{text: rest})
+			}
+			return parts, nil
+		}
+		end := strings.Index(rest[start+2:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed '{{' in template %q", tpl)
+		}
+		if start > 0 {
+			parts = append(parts, templatePart{text: rest[:start]})
+		}
+
+		expression := strings.TrimSpace(rest[start+2 : start+2+end])
+		node, err := parse(expression)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, templatePart{text: expression, expression: node})
+
+		rest = rest[start+2+end+2:]
+	}
+}
+
+// Render 渲染模板，将其中的 {{ 表达式 }} 替换为表达式的值
+func Render(tpl string, vars map[string]any) (string, error) {
+	parts, err := parseTemplate(tpl)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, part := range parts {
+		if part.expression == nil {
+			sb.WriteString(part.text)
+			continue
+		}
+		v, err := part.expression.eval(vars)
+		if err != nil {
+			return "", fmt.Errorf("failed to render {{%s}}: %w", part.text, err)
+		}
+		sb.WriteString(ToString(v))
+	}
+	return sb.String(), nil
+}
+
+// RenderValue 递归渲染任意JSON值中的字符串模板。
+// 当字符串恰好是一个完整的 {{ 表达式 }} 时，保留表达式结果的原始类型。
+func RenderValue(v any, vars map[string]any) (any, error) {
+	switch val := v.(type) {
+	case string:
+		trimmed := strings.TrimSpace(val)
+		if strings.HasPrefix(trimmed, "{{") && strings.HasSuffix(trimmed, "}}") &&
+			strings.Count(trimmed, "{{") == 1 {
+			return Eval(strings.TrimSpace(trimmed[2:len(trimmed)-2]), vars)
+		}
+		return Render(val, vars)
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			rendered, err := RenderValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = rendered
+		}
+		return out, nil
+	case []any:
+		out := make([]any, 0, len(val))
+		for _, item := range val {
+			rendered, err := RenderValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, rendered)
+		}
+		return out, nil
+	}
+	return v, nil
+}
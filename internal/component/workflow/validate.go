@@ -0,0 +1,278 @@
+package workflow
+
+import (
+	"ai-cloud/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var nodeIDPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate 校验工作流定义：节点ID与类型、节点配置、连线合法性以及图是否为DAG
+func Validate(wf *model.WorkflowSchema) error {
+	if wf == nil {
+		return errors.New("workflow is empty")
+	}
+	if len(wf.Nodes) == 0 {
+		return errors.New("workflow must contain at least one node")
+	}
+
+	nodes := make(map[string]*model.WorkflowNode, len(wf.Nodes))
+	for i := range wf.Nodes {
+		n := &wf.Nodes[i]
+		if !nodeIDPattern.MatchString(n.ID) {
+			return fmt.Errorf("invalid node id %q: only letters, digits and '_' are allowed", n.ID)
+		}
+		if n.ID == model.WorkflowStartNode || n.ID == model.WorkflowEndNode || n.ID == "loop" {
+			return fmt.Errorf("node id %q is reserved", n.ID)
+		}
+		if _, ok := nodes[n.ID]; ok {
+			return fmt.Errorf("duplicate node id %q", n.ID)
+		}
+		nodes[n.ID] = n
+	}
+
+	exists := func(id string) bool {
+		_, ok := nodes[id]
+		return ok || id == model.WorkflowEndNode
+	}
+
+	// 邻接表，包含普通连线和条件分支
+	adj := make(map[string][]string)
+	for _, e := range wf.Edges {
+		if e.From != model.WorkflowStartNode {
+			from, ok := nodes[e.From]
+			if !ok {
+				return fmt.Errorf("edge source %q does not exist", e.From)
+			}
+			if from.Type == model.NodeTypeCondition {
+				return fmt.Errorf("condition node %q must use branches instead of edges", e.From)
+			}
+		}
+		if !exists(e.To) {
+			return fmt.Errorf("edge target %q does not exist", e.To)
+		}
+		adj[e.From] = append(adj[e.From], e.To)
+	}
+	if len(adj[model.WorkflowStartNode]) == 0 {
+		return errors.New("workflow must have at least one edge from start")
+	}
+
+	for _, n := range wf.Nodes {
+		targets, err := validateNodeConfig(&n)
+		if err != nil {
+			return fmt.Errorf("node %q: %w", n.ID, err)
+		}
+		for _, t := range targets {
+			if !exists(t) {
+				return fmt.Errorf("node %q: branch target %q does not exist", n.ID, t)
+			}
+			adj[n.ID] = append(adj[n.ID], t)
+		}
+	}
+
+	if wf.Output != "" {
+		if _, err := parseTemplate(wf.Output); err != nil {
+			return fmt.Errorf("invalid output template: %w", err)
+		}
+	}
+
+	return checkTopology(wf, adj)
+}
+
+// checkTopology 检查是否存在环，以及所有节点是否都能从start到达、并最终到达end
+func checkTopology(wf *model.WorkflowSchema, adj map[string][]string) error {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("workflow contains a cycle at node %q, use a loop node instead", id)
+		case done:
+			return nil
+		}
+		state[id] = visiting
+		for _, next := range adj[id] {
+			if err := visit(next); err != nil {
+				return err
+			}
+		}
+		state[id] = done
+		return nil
+	}
+	if err := visit(model.WorkflowStartNode); err != nil {
+		return err
+	}
+
+	for _, n := range wf.Nodes {
+		if state[n.ID] != done {
+			return fmt.Errorf("node %q is not reachable from start", n.ID)
+		}
+		if len(adj[n.ID]) == 0 {
+			return fmt.Errorf("node %q has no outgoing edge, connect it to end", n.ID)
+		}
+	}
+	if state[model.WorkflowEndNode] != done {
+		return errors.New("end is not reachable from start")
+	}
+	return nil
+}
+
+// validateNodeConfig 校验节点配置，返回条件节点的分支目标
+func validateNodeConfig(n *model.WorkflowNode) ([]string, error) {
+	switch n.Type {
+	case model.NodeTypeLLM:
+		var c model.LLMNodeConfig
+		if err := decodeConfig(n, &c); err != nil {
+			return nil, err
+		}
+		if c.ModelID == "" {
+			return nil, errors.New("model_id is required")
+		}
+		if c.Prompt == "" {
+			return nil, errors.New("prompt is required")
+		}
+		return nil, checkTemplates(c.SystemPrompt, c.Prompt)
+
+	case model.NodeTypeRetriever:
+		var c model.RetrieverNodeConfig
+		if err := decodeConfig(n, &c); err != nil {
+			return nil, err
+		}
+		if len(c.KnowledgeIDs) == 0 {
+			return nil, errors.New("knowledge_ids is required")
+		}
+		return nil, checkTemplates(c.Query)
+
+	case model.NodeTypePrompt:
+		var c model.PromptNodeConfig
+		if err := decodeConfig(n, &c); err != nil {
+			return nil, err
+		}
+		if c.Template == "" {
+			return nil, errors.New("template is required")
+		}
+		return nil, checkTemplates(c.Template)
+
+	case model.NodeTypeTool:
+		var c model.ToolNodeConfig
+		if err := decodeConfig(n, &c); err != nil {
+			return nil, err
+		}
+		if c.MCPServer == "" || c.ToolName == "" {
+			return nil, errors.New("mcp_server and tool_name are required")
+		}
+		return nil, nil
+
+	case model.NodeTypeCondition:
+		var c model.ConditionNodeConfig
+		if err := decodeConfig(n, &c); err != nil {
+			return nil, err
+		}
+		if len(c.Branches) == 0 {
+			return nil, errors.New("at least one branch is required")
+		}
+		targets := make([]string, 0, len(c.Branches)+1)
+		for _, b := range c.Branches {
+			if err := CheckExpression(b.Expression); err != nil {
+				return nil, err
+			}
+			targets = append(targets, b.Target)
+		}
+		if c.Default != "" {
+			targets = append(targets, c.Default)
+		}
+		return targets, nil
+
+	case model.NodeTypeLoop:
+		var c model.LoopNodeConfig
+		if err := decodeConfig(n, &c); err != nil {
+			return nil, err
+		}
+		if err := CheckExpression(c.Items); err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+		if err := Validate(&c.Body); err != nil {
+			return nil, fmt.Errorf("loop body: %w", err)
+		}
+		return nil, nil
+
+	case model.NodeTypeCode:
+		var c model.CodeNodeConfig
+		if err := decodeConfig(n, &c); err != nil {
+			return nil, err
+		}
+		if len(c.Outputs) == 0 {
+			return nil, errors.New("outputs is required")
+		}
+		for key, expression := range c.Outputs {
+			if err := CheckExpression(expression); err != nil {
+				return nil, fmt.Errorf("output %q: %w", key, err)
+			}
+		}
+		return nil, nil
+
+	case model.NodeTypeHTTP:
+		var c model.HTTPNodeConfig
+		if err := decodeConfig(n, &c); err != nil {
+			return nil, err
+		}
+		if c.URL == "" {
+			return nil, errors.New("url is required")
+		}
+		switch strings.ToUpper(c.Method) {
+		case "", http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return nil, fmt.Errorf("unsupported http method %q", c.Method)
+		}
+		return nil, checkTemplates(c.URL, c.Body)
+
+	case model.NodeTypeAgent:
+		var c model.AgentNodeConfig
+		if err := decodeConfig(n, &c); err != nil {
+			return nil, err
+		}
+		if c.AgentID == "" {
+			return nil, errors.New("agent_id is required")
+		}
+		return nil, checkTemplates(c.Query)
+	}
+	return nil, fmt.Errorf("unknown node type %q", n.Type)
+}
+
+func decodeConfig(n *model.WorkflowNode, v any) error {
+	if len(n.Config) == 0 {
+		return errors.New("config is required")
+	}
+	if err := json.Unmarshal(n.Config, v); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
+
+// DecodeConfig 解析节点配置
+func DecodeConfig[T any](n *model.WorkflowNode) (*T, error) {
+	var c T
+	if err := decodeConfig(n, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func checkTemplates(tpls ...string) error {
+	for _, tpl := range tpls {
+		if _, err := parseTemplate(tpl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
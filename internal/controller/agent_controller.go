@@ -7,12 +7,13 @@ import (
 	"ai-cloud/pkgs/errcode"
 	"ai-cloud/pkgs/response"
 	"encoding/json"
-	"errors"
-	"github.com/gin-contrib/sse"
+	"fmt"
 	"io"
 	"log"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type AgentController struct {
@@ -45,6 +46,7 @@ func (c *AgentController) CreateAgent(ctx *gin.Context) {
 		Tools:     model.ToolsConfig{ToolIDs: []string{}},
 		Prompt:    "",
 		Knowledge: model.KnowledgeConfig{KnowledgeIDs: []string{}, TopK: 3},
+		SubAgents: model.SubAgentsConfig{AgentIDs: []string{}},
 	}
 
 	// Convert to JSON string
@@ -54,12 +56,18 @@ func (c *AgentController) CreateAgent(ctx *gin.Context) {
 		return
 	}
 
+	agentType := req.Type
+	if agentType == "" {
+		agentType = model.AgentTypeSimple
+	}
+
 	// Create new agent with just name and description
 	agent := &model.Agent{
 		ID:          utils.GenerateUUID(),
 		UserID:      userID,
 		Name:        req.Name,
 		Description: req.Description,
+		Type:        agentType,
 		AgentSchema: string(schemaBytes),
 	}
 
@@ -130,6 +138,26 @@ func (c *AgentController) UpdateAgent(ctx *gin.Context) {
 		agentSchema.Prompt = req.Prompt
 	}
 
+	// Update SubAgents if provided
+	if req.SubAgents.AgentIDs != nil {
+		agentSchema.SubAgents = req.SubAgents
+	}
+
+	// Update Approval if provided
+	if req.Approval != nil {
+		agentSchema.Approval = *req.Approval
+	}
+
+	// Update Memory if provided
+	if req.Memory != nil {
+		agentSchema.Memory = *req.Memory
+	}
+
+	// Update Workflow if provided
+	if req.Workflow != nil {
+		agentSchema.Workflow = req.Workflow
+	}
+
 	// Update Knowledge if provided
 	if req.Knowledge.KnowledgeIDs != nil {
 		agentSchema.Knowledge = req.Knowledge
@@ -210,13 +238,15 @@ func (c *AgentController) GetAgent(ctx *gin.Context) {
 
 	// Return the agent with parsed schema
 	response.SuccessWithMessage(ctx, "Agent retrieved successfully", gin.H{
-		"id":          agent.ID,
-		"user_id":     agent.UserID,
-		"name":        agent.Name,
-		"description": agent.Description,
-		"schema":      agentSchema,
-		"created_at":  agent.CreatedAt,
-		"updated_at":  agent.UpdatedAt,
+		"id":                agent.ID,
+		"user_id":           agent.UserID,
+		"name":              agent.Name,
+		"description":       agent.Description,
+		"type":              agent.Type,
+		"schema":            agentSchema,
+		"published_version": agent.PublishedVersion,
+		"created_at":        agent.CreatedAt,
+		"updated_at":        agent.UpdatedAt,
 	})
 }
 
@@ -252,19 +282,167 @@ func (c *AgentController) PageAgents(ctx *gin.Context) {
 		}
 
 		agentsResponse = append(agentsResponse, gin.H{
-			"id":          agent.ID,
-			"user_id":     agent.UserID,
-			"name":        agent.Name,
-			"description": agent.Description,
-			"schema":      agentSchema,
-			"created_at":  agent.CreatedAt,
-			"updated_at":  agent.UpdatedAt,
+			"id":                agent.ID,
+			"user_id":           agent.UserID,
+			"name":              agent.Name,
+			"description":       agent.Description,
+			"type":              agent.Type,
+			"schema":            agentSchema,
+			"published_version": agent.PublishedVersion,
+			"created_at":        agent.CreatedAt,
+			"updated_at":        agent.UpdatedAt,
 		})
 	}
 
 	response.PageSuccess(ctx, agentsResponse, count)
 }
 
+// PublishAgent 将草稿发布为新版本
+func (c *AgentController) PublishAgent(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.PublishAgentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	version, err := c.svc.PublishAgent(ctx.Request.Context(), userID, req.AgentID, req.Changelog)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to publish agent: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Agent published successfully", gin.H{"version": version.Version})
+}
+
+// ListAgentVersions 获取Agent的版本列表
+func (c *AgentController) ListAgentVersions(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	agentID := ctx.Query("agent_id")
+	if agentID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Agent ID is required")
+		return
+	}
+
+	versions, err := c.svc.ListAgentVersions(ctx.Request.Context(), userID, agentID)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to list agent versions: "+err.Error())
+		return
+	}
+
+	versionsResponse := make([]gin.H, 0, len(versions))
+	for _, v := range versions {
+		versionsResponse = append(versionsResponse, gin.H{
+			"version":    v.Version,
+			"changelog":  v.Changelog,
+			"created_at": v.CreatedAt,
+		})
+	}
+
+	response.SuccessWithMessage(ctx, "Agent versions retrieved successfully", gin.H{"versions": versionsResponse})
+}
+
+// GetAgentVersion 获取指定版本的Agent配置
+func (c *AgentController) GetAgentVersion(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	agentID := ctx.Query("agent_id")
+	version := utils.StringToInt(ctx.Query("version"))
+	if agentID == "" || version <= 0 {
+		response.ParamError(ctx, errcode.ParamBindError, "Agent ID and version are required")
+		return
+	}
+
+	v, err := c.svc.GetAgentVersion(ctx.Request.Context(), userID, agentID, version)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to get agent version: "+err.Error())
+		return
+	}
+
+	var agentSchema model.AgentSchema
+	if err := json.Unmarshal([]byte(v.AgentSchema), &agentSchema); err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to parse agent schema")
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Agent version retrieved successfully", gin.H{
+		"agent_id":   v.AgentID,
+		"version":    v.Version,
+		"changelog":  v.Changelog,
+		"schema":     agentSchema,
+		"created_at": v.CreatedAt,
+	})
+}
+
+// RollbackAgent 回滚到指定的历史版本
+func (c *AgentController) RollbackAgent(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.RollbackAgentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	if err := c.svc.RollbackAgent(ctx.Request.Context(), userID, req.AgentID, req.Version); err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to rollback agent: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Agent rolled back successfully", nil)
+}
+
+// DiffAgentVersions 比较两个版本的配置，from/to 缺省时表示草稿
+func (c *AgentController) DiffAgentVersions(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	agentID := ctx.Query("agent_id")
+	if agentID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Agent ID is required")
+		return
+	}
+	from := parseVersionQuery(ctx.Query("from"))
+	to := parseVersionQuery(ctx.Query("to"))
+
+	diffs, err := c.svc.DiffAgentVersions(ctx.Request.Context(), userID, agentID, from, to)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to diff agent versions: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Agent versions compared successfully", gin.H{"diffs": diffs})
+}
+
+// parseVersionQuery 解析版本号参数，空值或"draft"表示草稿
+func parseVersionQuery(v string) int {
+	if v == "" || v == "draft" {
+		return model.AgentVersionDraft
+	}
+	return utils.StringToInt(v)
+}
+
 // ExecuteAgent 执行Agent
 func (c *AgentController) ExecuteAgent(ctx *gin.Context) {
 	// Get user ID from context
@@ -320,46 +498,121 @@ func (ac *AgentController) StreamExecuteAgent(c *gin.Context) {
 		return
 	}
 
-	// Set headers for SSE
-	c.Writer.Header().Set("Content-Type", "text/event-stream")
-	c.Writer.Header().Set("Cache-Control", "no-cache")
-	c.Writer.Header().Set("Connection", "keep-alive")
-	c.Writer.Header().Set("Transfer-Encoding", "chunked")
-
-	done := make(chan struct{})
-	defer func() {
-		sr.Close()
-		close(done)
-		log.Printf("[Stream] Finish Stream with ID: %s\n", req.ID)
-	}()
-
-	// Stream the response
-	c.Stream(func(w io.Writer) bool {
-		select {
-		case <-ctx.Done():
-			log.Printf("[Stream] Context done for chat ID: %s\n", req.ID)
-			return false
-		case <-done:
-			return false
-		default:
-			msg, err := sr.Recv()
-			if errors.Is(err, io.EOF) {
-				log.Printf("[Stream] EOF received for chat ID: %s\n", req.ID)
-				return false
-			}
-			if err != nil {
-				log.Printf("[Stream] Error receiving message: %v\n", err)
-				return false
-			}
-
-			// Send SSE event
-			sse.Encode(w, sse.Event{
-				Data: []byte(msg.Content),
-			})
-
-			// Flush the response immediately
-			c.Writer.Flush()
-			return true
-		}
-	})
+	streamEvents(c, sr, uuid.NewString(), "", req.ID, "Stream")
+}
+
+// ListPendingApprovals 获取当前用户待审批的工具调用
+func (c *AgentController) ListPendingApprovals(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	approvals, err := c.svc.ListPendingApprovals(ctx.Request.Context(), userID)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to list approvals: "+err.Error())
+		return
+	}
+	response.SuccessWithMessage(ctx, "Get approvals successfully", approvals)
+}
+
+// ExportAgent 导出Agent为可在其他环境导入的JSON或YAML，可选包含知识库文档
+func (c *AgentController) ExportAgent(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.ExportAgentRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	name, contentType, data, err := c.svc.ExportAgent(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to export agent: "+err.Error())
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+	ctx.Data(http.StatusOK, contentType, data)
+}
+
+// ImportAgent 从导出的JSON或YAML创建Agent，返回依赖的映射结果和未解决的依赖
+func (c *AgentController) ImportAgent(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var opts model.ImportAgentOptions
+	if err := ctx.ShouldBind(&opts); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "File is required")
+		return
+	}
+	if fileHeader.Size > service.MaxImportSize {
+		response.ParamError(ctx, errcode.ParamValidateError, "File is too large")
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		response.ParamError(ctx, errcode.FileParseFailed, "Failed to read file")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		response.ParamError(ctx, errcode.FileParseFailed, "Failed to read file")
+		return
+	}
+
+	result, err := c.svc.ImportAgent(ctx.Request.Context(), userID, data, &opts)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to import agent: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Agent imported successfully", result)
+}
+
+// ListAgentTemplates 获取内置的Agent模板
+func (c *AgentController) ListAgentTemplates(ctx *gin.Context) {
+	templates, err := c.svc.ListAgentTemplates()
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to list templates: "+err.Error())
+		return
+	}
+	response.SuccessWithMessage(ctx, "Get templates successfully", templates)
+}
+
+// InstantiateTemplate 从内置模板创建Agent
+func (c *AgentController) InstantiateTemplate(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.InstantiateTemplateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	result, err := c.svc.InstantiateTemplate(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to create agent from template: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Agent created successfully", result)
 }
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/service"
+	"ai-cloud/internal/utils"
+	"ai-cloud/pkgs/errcode"
+	"ai-cloud/pkgs/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyController struct {
+	svc service.APIKeyService
+}
+
+func NewAPIKeyController(svc service.APIKeyService) *APIKeyController {
+	return &APIKeyController{svc: svc}
+}
+
+// CreateAPIKey 创建API Key，明文只在本次响应中返回
+func (c *APIKeyController) CreateAPIKey(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.CreateAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	key, plain, err := c.svc.CreateAPIKey(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to create api key: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "API key created successfully", model.CreateAPIKeyResponse{APIKey: key, Key: plain})
+}
+
+// ListAPIKeys 获取当前用户的API Key，不包含明文
+func (c *APIKeyController) ListAPIKeys(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	keys, err := c.svc.ListAPIKeys(ctx.Request.Context(), userID)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to list api keys: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Get api keys successfully", keys)
+}
+
+// DeleteAPIKey 删除API Key，删除后立即失效
+func (c *APIKeyController) DeleteAPIKey(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	id := ctx.Query("id")
+	if id == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "API key ID is required")
+		return
+	}
+
+	if err := c.svc.DeleteAPIKey(ctx.Request.Context(), userID, id); err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to delete api key: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "API key deleted successfully", nil)
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/service"
+	"ai-cloud/internal/utils"
+	"ai-cloud/pkgs/errcode"
+	"ai-cloud/pkgs/response"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AttachmentController struct {
+	svc service.AttachmentService
+}
+
+func NewAttachmentController(svc service.AttachmentService) *AttachmentController {
+	return &AttachmentController{svc: svc}
+}
+
+// UploadAttachment 上传聊天附件，返回的attach_id随消息一起发送
+func (c *AttachmentController) UploadAttachment(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "File is required")
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		response.ParamError(ctx, errcode.FileParseFailed, "Failed to read file")
+		return
+	}
+	defer file.Close()
+
+	ref, err := c.svc.Upload(ctx.Request.Context(), userID, fileHeader, file)
+	if err != nil {
+		response.InternalError(ctx, errcode.FileUploadFailed, "Failed to upload attachment: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Attachment uploaded successfully", ref)
+}
+
+// AttachDriveFile 将云盘中的文件添加为聊天附件
+func (c *AttachmentController) AttachDriveFile(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.DriveAttachmentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	ref, err := c.svc.AttachDriveFile(ctx.Request.Context(), userID, req.FileID)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to attach file: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "File attached successfully", ref)
+}
+
+// DownloadAttachment 下载附件，用于在历史中展示图片和文件
+func (c *AttachmentController) DownloadAttachment(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	attachID := ctx.Query("attach_id")
+	if attachID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Attachment ID is required")
+		return
+	}
+
+	attachment, data, err := c.svc.Download(ctx.Request.Context(), userID, attachID)
+	if err != nil {
+		response.InternalError(ctx, errcode.FileNotFound, "Failed to download attachment: "+err.Error())
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", attachment.FileName))
+	ctx.Data(http.StatusOK, attachment.MimeType, data)
+}
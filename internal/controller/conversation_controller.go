@@ -6,11 +6,13 @@ import (
 	"ai-cloud/internal/utils"
 	"ai-cloud/pkgs/errcode"
 	"ai-cloud/pkgs/response"
+	"ai-cloud/pkgs/stream"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"net/http"
 
-	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -44,50 +46,7 @@ func (c *ConversationController) DebugStreamAgent(ctx *gin.Context) {
 		return
 	}
 
-	// 设置SSE响应头
-	ctx.Writer.Header().Set("Content-Type", "text/event-stream")
-	ctx.Writer.Header().Set("Cache-Control", "no-cache")
-	ctx.Writer.Header().Set("Connection", "keep-alive")
-	ctx.Writer.Header().Set("Transfer-Encoding", "chunked")
-
-	// 传输流
-	sessionID := uuid.NewString()
-	done := make(chan struct{})
-	defer func() {
-		sr.Close()
-		close(done)
-		log.Printf("[Debug Stream] Finish Stream with ID: %s\n", sessionID)
-	}()
-
-	// 流式响应
-	ctx.Stream(func(w io.Writer) bool {
-		select {
-		case <-ctx.Request.Context().Done():
-			log.Printf("[Debug Stream] Context done for session ID: %s\n", sessionID)
-			return false
-		case <-done:
-			return false
-		default:
-			msg, err := sr.Recv()
-			if errors.Is(err, io.EOF) {
-				log.Printf("[Debug Stream] EOF received for session ID: %s\n", sessionID)
-				return false
-			}
-			if err != nil {
-				log.Printf("[Debug Stream] Error receiving message: %v\n", err)
-				return false
-			}
-
-			// 发送SSE事件
-			sse.Encode(w, sse.Event{
-				Data: []byte(msg.Content),
-			})
-
-			// 立即刷新响应
-			ctx.Writer.Flush()
-			return true
-		}
-	})
+	streamEvents(ctx, sr, uuid.NewString(), "", "", "Debug Stream")
 }
 
 // CreateConversation 创建新会话
@@ -105,16 +64,25 @@ func (c *ConversationController) CreateConversation(ctx *gin.Context) {
 	}
 
 	// 创建会话
-	convID, err := c.svc.CreateConversation(ctx.Request.Context(), userID, req.AgentID)
+	convID, err := c.svc.CreateConversation(ctx.Request.Context(), userID, req.AgentID, req.PinVersion)
 	if err != nil {
-		log.Printf("[Conversation Create] Error creating conversation: %v\n", err)
-		response.InternalError(ctx, errcode.InternalServerError, "Failed to create conversation")
+		createConversationError(ctx, err)
 		return
 	}
 
 	response.SuccessWithMessage(ctx, "Conversation created successfully", gin.H{"conv_id": convID})
 }
 
+// createConversationError 固定版本但Agent未发布属于参数错误，其余为服务端错误
+func createConversationError(ctx *gin.Context, err error) {
+	if errors.Is(err, service.ErrAgentNotPublished) {
+		response.ParamError(ctx, errcode.ParamValidateError, "pin_version requires the agent to have a published version")
+		return
+	}
+	log.Printf("[Conversation Create] Error creating conversation: %v\n", err)
+	response.InternalError(ctx, errcode.InternalServerError, "Failed to create conversation")
+}
+
 // StreamConversation 会话模式，保存历史
 func (c *ConversationController) StreamConversation(ctx *gin.Context) {
 	userID, err := utils.GetUserIDFromContext(ctx)
@@ -130,66 +98,239 @@ func (c *ConversationController) StreamConversation(ctx *gin.Context) {
 	}
 
 	if req.ConvID == "" {
-		convID, err := c.svc.CreateConversation(ctx.Request.Context(), userID, req.AgentID)
+		convID, err := c.svc.CreateConversation(ctx.Request.Context(), userID, req.AgentID, req.PinVersion)
 		if err != nil {
-			log.Printf("[Conversation Create] Error creating conversation: %v\n", err)
-			response.InternalError(ctx, errcode.InternalServerError, "Failed to create conversation")
+			createConversationError(ctx, err)
 			return
 		}
 		req.ConvID = convID
 	}
 
 	// 调用会话模式流式处理
-	sr, err := c.svc.StreamAgentWithConversation(ctx.Request.Context(), userID, req.AgentID, req.ConvID, req.Message)
+	sr, msgID, parentID, err := c.svc.StreamAgentWithConversation(ctx.Request.Context(), userID, req.AgentID, req.ConvID, req.Message, req.AttachmentIDs)
 	if err != nil {
 		log.Printf("[Conversation Stream] Error running agent: %v\n", err)
-		response.InternalError(ctx, errcode.InternalServerError, "Agent execution failed")
-		return
-	}
-
-	// 设置SSE响应头
-	ctx.Writer.Header().Set("Content-Type", "text/event-stream")
-	ctx.Writer.Header().Set("Cache-Control", "no-cache")
-	ctx.Writer.Header().Set("Connection", "keep-alive")
-	ctx.Writer.Header().Set("Transfer-Encoding", "chunked")
-
-	// 传输流
-	done := make(chan struct{})
-	defer func() {
-		sr.Close()
-		close(done)
-		log.Printf("[Conversation Stream] Finish Stream with ConvID: %s\n", req.ConvID)
-	}()
-
-	// 流式响应
-	ctx.Stream(func(w io.Writer) bool {
-		select {
-		case <-ctx.Request.Context().Done():
-			log.Printf("[Conversation Stream] Context done for ConvID: %s\n", req.ConvID)
-			return false
-		case <-done:
-			return false
-		default:
-			msg, err := sr.Recv()
-			if errors.Is(err, io.EOF) {
-				log.Printf("[Conversation Stream] EOF received for ConvID: %s\n", req.ConvID)
-				return false
-			}
-			if err != nil {
-				log.Printf("[Conversation Stream] Error receiving message: %v\n", err)
-				return false
-			}
-
-			// 发送SSE事件
-			sse.Encode(w, sse.Event{
-				Data: []byte(msg.Content),
-			})
-
-			// 立即刷新响应
-			ctx.Writer.Flush()
-			return true
+		response.InternalError(ctx, errcode.InternalServerError, "Agent execution failed: "+err.Error())
+		return
+	}
+
+	streamEvents(ctx, sr, msgID, parentID, req.ConvID, "Conversation Stream")
+}
+
+// RegenerateReply 重新生成助手回复，新回复作为原回复的兄弟节点流式返回
+func (c *ConversationController) RegenerateReply(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.RegenerateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	sr, msgID, parentID, err := c.svc.RegenerateReply(ctx.Request.Context(), userID, req.ConvID, req.MsgID)
+	if err != nil {
+		log.Printf("[Conversation Regenerate] Error regenerating message %s: %v\n", req.MsgID, err)
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to regenerate reply: "+err.Error())
+		return
+	}
+
+	streamEvents(ctx, sr, msgID, parentID, req.ConvID, "Regenerate Stream")
+}
+
+// EditMessage 编辑用户消息并重新发送，在新分支上流式返回回复
+func (c *ConversationController) EditMessage(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.EditMessageRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	sr, msgID, parentID, err := c.svc.EditMessage(ctx.Request.Context(), userID, req.ConvID, req.MsgID, req.Message)
+	if err != nil {
+		log.Printf("[Conversation Edit] Error editing message %s: %v\n", req.MsgID, err)
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to edit message: "+err.Error())
+		return
+	}
+
+	streamEvents(ctx, sr, msgID, parentID, req.ConvID, "Edit Stream")
+}
+
+// SwitchBranch 切换会话的当前分支，之后的历史和对话沿该分支进行
+func (c *ConversationController) SwitchBranch(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.SwitchBranchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	if err := c.svc.SwitchBranch(ctx.Request.Context(), userID, req.ConvID, req.MsgID); err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to switch branch: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Branch switched successfully", nil)
+}
+
+// GetMessageTree 获取会话的消息树，包括全部分支和当前分支
+func (c *ConversationController) GetMessageTree(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	convID := ctx.Query("conv_id")
+	if convID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Conversation ID is required")
+		return
+	}
+
+	tree, err := c.svc.GetMessageTree(ctx.Request.Context(), userID, convID)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to get message tree: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Message tree retrieved successfully", tree)
+}
+
+// ApproveToolCalls 提交工具调用的审批结果（批准、修改参数或拒绝），以流式方式恢复暂停的运行
+func (c *ConversationController) ApproveToolCalls(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.ResumeRunRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	sr, msgID, convID, err := c.svc.ResumeAgentWithApproval(ctx.Request.Context(), userID, req.RunID, req.Decisions)
+	if err != nil {
+		log.Printf("[Approval] Error resuming run %s: %v\n", req.RunID, err)
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to resume run: "+err.Error())
+		return
+	}
+
+	streamEvents(ctx, sr, msgID, "", convID, "Approval Stream")
+}
+
+// GetSettings 获取会话设置及与Agent配置合并后的生效值
+func (c *ConversationController) GetSettings(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.ConvSettingsQuery
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	settings, err := c.svc.GetSettings(ctx.Request.Context(), userID, req.ConvID)
+	if err != nil {
+		log.Printf("[Conversation Settings] Error getting settings for %s: %v\n", req.ConvID, err)
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to get settings: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Settings retrieved successfully", settings)
+}
+
+// UpdateSettings 更新会话设置，覆盖Agent的模型、温度、知识库、工具和提示词等默认配置
+func (c *ConversationController) UpdateSettings(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.ConvSettingsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	if err := c.svc.UpdateSettings(ctx.Request.Context(), userID, req.ConvID, req.Settings); err != nil {
+		log.Printf("[Conversation Settings] Error updating settings for %s: %v\n", req.ConvID, err)
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to update settings: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Settings updated successfully", nil)
+}
+
+// StopReply 停止进行中的回复生成，已生成的部分保存为回复，回复流以finish_reason=stopped结束
+func (c *ConversationController) StopReply(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.StopReplyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	if err := c.svc.StopReply(ctx.Request.Context(), userID, req.ConvID, req.MsgID); err != nil {
+		if errors.Is(err, service.ErrReplyRunNotFound) {
+			response.ErrorCustom(ctx, http.StatusNotFound, errcode.ReplyRunNotFound, err.Error(), nil)
+			return
 		}
-	})
+		log.Printf("[Conversation Stop] Error stopping reply %s: %v\n", req.MsgID, err)
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to stop reply: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Reply stopped", nil)
+}
+
+// AttachReply 重新连接到进行中或刚结束的回复生成，从after_seq之后的事件开始回放
+func (c *ConversationController) AttachReply(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.AttachReplyRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	sr, parentID, convID, err := c.svc.AttachReply(ctx.Request.Context(), userID, req.MsgID)
+	if err != nil {
+		// 已过期的回复通过 /chat/messages 或 /chat/tree 获取保存的结果
+		response.ErrorCustom(ctx, http.StatusNotFound, errcode.ReplyRunNotFound, err.Error(), nil)
+		return
+	}
+
+	w := stream.NewWriter(ctx.Writer, req.MsgID, convID).WithParent(parentID).Skip(req.AfterSeq)
+	writeEvents(ctx, sr, w, req.MsgID, "Attach Stream")
 }
 
 // ListConversations 获取用户所有会话
@@ -268,6 +409,163 @@ func (c *ConversationController) GetConversationHistory(ctx *gin.Context) {
 	response.SuccessWithMessage(ctx, "Conversation history retrieved successfully", gin.H{"messages": msgs})
 }
 
+// RenameConversation 手动设置会话标题，手动设置的标题不会被自动生成的标题覆盖
+func (c *ConversationController) RenameConversation(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.RenameConvRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	if err := c.svc.RenameConversation(ctx.Request.Context(), userID, req.ConvID, req.Title); err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to rename conversation: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Conversation renamed successfully", nil)
+}
+
+// SearchHistory 在会话标题和消息中全文检索，可按Agent、角色和时间范围过滤
+func (c *ConversationController) SearchHistory(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.SearchRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	result, err := c.svc.SearchHistory(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to search history: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Search completed successfully", result)
+}
+
+// PageMessages 以消息ID为游标分页获取会话历史，可从检索结果跳转到消息所在位置
+func (c *ConversationController) PageMessages(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.MessagePageRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	page, err := c.svc.PageMessages(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to get messages: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Messages retrieved successfully", page)
+}
+
+// ExportConversations 导出会话为Markdown、HTML或JSON，多个会话或按Agent导出时打包为zip
+func (c *ConversationController) ExportConversations(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.ExportConvRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	name, contentType, data, err := c.svc.ExportConversations(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to export conversations: "+err.Error())
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+	ctx.Data(http.StatusOK, contentType, data)
+}
+
+// ImportConversations 导入会话到指定Agent，支持导出的JSON、ChatGPT的conversations.json及其zip
+func (c *ConversationController) ImportConversations(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	agentID := ctx.PostForm("agent_id")
+	if agentID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Agent ID is required")
+		return
+	}
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "File is required")
+		return
+	}
+	if fileHeader.Size > service.MaxImportSize {
+		response.ParamError(ctx, errcode.ParamValidateError, "File is too large")
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		response.ParamError(ctx, errcode.FileParseFailed, "Failed to read file")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		response.ParamError(ctx, errcode.FileParseFailed, "Failed to read file")
+		return
+	}
+
+	result, err := c.svc.ImportConversations(ctx.Request.Context(), userID, agentID, fileHeader.Filename, data)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to import conversations: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Conversations imported successfully", result)
+}
+
+// ClearContext 清除会话上下文，之后的对话不再携带之前的历史，历史消息仍然保留
+func (c *ConversationController) ClearContext(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	convID := ctx.Query("conv_id")
+	if convID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Conversation ID is required")
+		return
+	}
+
+	if err := c.svc.ClearContext(ctx.Request.Context(), userID, convID); err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to clear context: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Context cleared successfully", nil)
+}
+
 // DeleteConversation 删除会话
 func (c *ConversationController) DeleteConversation(ctx *gin.Context) {
 	// 获取会话ID
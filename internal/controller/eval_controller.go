@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/service"
+	"ai-cloud/internal/utils"
+	"ai-cloud/pkgs/errcode"
+	"ai-cloud/pkgs/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EvalController struct {
+	svc service.EvalService
+}
+
+func NewEvalController(svc service.EvalService) *EvalController {
+	return &EvalController{svc: svc}
+}
+
+// CreateEvalRun 创建A/B评测，评测在后台运行
+func (c *EvalController) CreateEvalRun(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.CreateEvalRunRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	run, err := c.svc.CreateEvalRun(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to create eval run: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Eval run created successfully", run)
+}
+
+// GetEvalRun 获取评测的进度和汇总结果
+func (c *EvalController) GetEvalRun(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	id := ctx.Query("id")
+	if id == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Eval run ID is required")
+		return
+	}
+
+	run, err := c.svc.GetEvalRun(ctx.Request.Context(), userID, id)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to get eval run: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Get eval run successfully", run)
+}
+
+// PageEvalRuns 分页获取评测
+func (c *EvalController) PageEvalRuns(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	page := utils.StringToInt(ctx.DefaultQuery("page", "1"))
+	size := utils.StringToInt(ctx.DefaultQuery("size", "10"))
+
+	runs, count, err := c.svc.PageEvalRuns(ctx.Request.Context(), userID, page, size)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to list eval runs: "+err.Error())
+		return
+	}
+
+	response.PageSuccess(ctx, runs, count)
+}
+
+// PageEvalResults 分页获取评测各用例的输出、得分和对比
+func (c *EvalController) PageEvalResults(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	runID := ctx.Query("run_id")
+	if runID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Eval run ID is required")
+		return
+	}
+
+	page := utils.StringToInt(ctx.DefaultQuery("page", "1"))
+	size := utils.StringToInt(ctx.DefaultQuery("size", "10"))
+
+	results, count, err := c.svc.PageEvalResults(ctx.Request.Context(), userID, runID, page, size)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to list eval results: "+err.Error())
+		return
+	}
+
+	response.PageSuccess(ctx, results, count)
+}
+
+// DeleteEvalRun 删除评测及其结果
+func (c *EvalController) DeleteEvalRun(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	id := ctx.Query("id")
+	if id == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Eval run ID is required")
+		return
+	}
+
+	if err := c.svc.DeleteEvalRun(ctx.Request.Context(), userID, id); err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to delete eval run: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Eval run deleted successfully", nil)
+}
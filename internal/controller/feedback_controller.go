@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/service"
+	"ai-cloud/internal/utils"
+	"ai-cloud/pkgs/errcode"
+	"ai-cloud/pkgs/response"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFeedbackExport 未指定limit时导出的最大样本数
+const maxFeedbackExport = 1000
+
+type FeedbackController struct {
+	svc service.FeedbackService
+}
+
+func NewFeedbackController(svc service.FeedbackService) *FeedbackController {
+	return &FeedbackController{svc: svc}
+}
+
+// SubmitFeedback 评价一条助手回复：好评/差评，可附带差评原因和文字反馈
+func (c *FeedbackController) SubmitFeedback(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.FeedbackRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	fb, err := c.svc.Submit(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to submit feedback: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Feedback submitted successfully", fb)
+}
+
+// GetFeedback 获取用户对一条回复的评价
+func (c *FeedbackController) GetFeedback(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	msgID := ctx.Query("msg_id")
+	if msgID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Message ID is required")
+		return
+	}
+
+	fb, err := c.svc.Get(ctx.Request.Context(), userID, msgID)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to get feedback: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Feedback retrieved successfully", fb)
+}
+
+// DeleteFeedback 撤销对一条回复的评价
+func (c *FeedbackController) DeleteFeedback(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	msgID := ctx.Query("msg_id")
+	if msgID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Message ID is required")
+		return
+	}
+
+	if err := c.svc.Delete(ctx.Request.Context(), userID, msgID); err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to delete feedback: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Feedback deleted successfully", nil)
+}
+
+// GetStats 满意度统计，可按Agent和时间范围过滤，按天、周或月给出趋势
+func (c *FeedbackController) GetStats(ctx *gin.Context) {
+	userID, q, ok := bindFeedbackQuery(ctx)
+	if !ok {
+		return
+	}
+
+	stats, err := c.svc.Stats(ctx.Request.Context(), userID, q)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to get feedback stats: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Feedback stats retrieved successfully", stats)
+}
+
+// WorstConversations 差评最多的会话
+func (c *FeedbackController) WorstConversations(ctx *gin.Context) {
+	userID, q, ok := bindFeedbackQuery(ctx)
+	if !ok {
+		return
+	}
+
+	convs, err := c.svc.WorstConversations(ctx.Request.Context(), userID, q)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to get conversations: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Conversations retrieved successfully", convs)
+}
+
+// TopReasons 最常见的差评原因
+func (c *FeedbackController) TopReasons(ctx *gin.Context) {
+	userID, q, ok := bindFeedbackQuery(ctx)
+	if !ok {
+		return
+	}
+
+	reasons, err := c.svc.TopReasons(ctx.Request.Context(), userID, q)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to get feedback reasons: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Feedback reasons retrieved successfully", reasons)
+}
+
+// ExportDataset 导出评价及对应的问题、回答和检索到的分块（JSON Lines），用于评测检索效果
+func (c *FeedbackController) ExportDataset(ctx *gin.Context) {
+	userID, q, ok := bindFeedbackQuery(ctx)
+	if !ok {
+		return
+	}
+	if ctx.Query("limit") == "" {
+		q.Limit = maxFeedbackExport
+	}
+
+	data, err := c.svc.ExportDataset(ctx.Request.Context(), userID, q)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to export feedback: "+err.Error())
+		return
+	}
+
+	name := fmt.Sprintf("feedback-%s.jsonl", time.Now().Format("20060102-150405"))
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+	ctx.Data(http.StatusOK, "application/x-ndjson", data)
+}
+
+// bindFeedbackQuery 获取当前用户和统计的过滤条件，失败时已写入响应
+func bindFeedbackQuery(ctx *gin.Context) (uint, *model.FeedbackQuery, bool) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return 0, nil, false
+	}
+
+	var q model.FeedbackQuery
+	if err := ctx.ShouldBindQuery(&q); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return 0, nil, false
+	}
+	return userID, &q, true
+}
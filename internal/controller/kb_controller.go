@@ -6,12 +6,12 @@ import (
 	"ai-cloud/internal/utils"
 	"ai-cloud/pkgs/errcode"
 	"ai-cloud/pkgs/response"
-	"encoding/json"
 	"fmt"
 	"path/filepath"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type KBController struct {
@@ -37,7 +37,7 @@ func (kc *KBController) Create(ctx *gin.Context) {
 		return
 	}
 
-	if err := kc.kbService.CreateKB(userID, req.Name, req.Description, req.EmbedModelID); err != nil {
+	if _, err := kc.kbService.CreateKB(userID, req.Name, req.Description, req.EmbedModelID); err != nil {
 		response.InternalError(ctx, errcode.InternalServerError, "创建失败: "+err.Error())
 		return
 	}
@@ -289,24 +289,15 @@ func (kc *KBController) ChatStream(ctx *gin.Context) {
 		return
 	}
 
-	// 3. 设置响应头
-	ctx.Writer.Header().Set("Content-Type", "text/event-stream")
-	ctx.Writer.Header().Set("Cache-Control", "no-cache")
-	ctx.Writer.Header().Set("Connection", "keep-alive")
-
-	// 4. 调用服务层获取流式响应
-	responseChan, err := kc.kbService.RAGQueryStream(ctx.Request.Context(), userID, req.Query, req.KBs)
+	// 3. 调用服务层获取流式响应
+	sr, err := kc.kbService.RAGQueryStream(ctx.Request.Context(), userID, req.Query, req.KBs)
 	if err != nil {
-		ctx.SSEvent("error", err.Error())
+		response.InternalError(ctx, errcode.InternalServerError, "检索失败: "+err.Error())
 		return
 	}
 
-	// 5. 发送流式响应
-	for r := range responseChan {
-		data, _ := json.Marshal(r)
-		ctx.Writer.Write([]byte("data: " + string(data) + "\n\n"))
-		ctx.Writer.Flush()
-	}
+	// 4. 发送流式响应
+	streamEvents(ctx, sr, uuid.NewString(), "", "", "KB Stream")
 }
 
 func (kc *KBController) GetKBDetail(ctx *gin.Context) {
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/service"
+	"ai-cloud/internal/utils"
+	"ai-cloud/pkgs/errcode"
+	"ai-cloud/pkgs/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MemoryController struct {
+	svc service.MemoryService
+}
+
+func NewMemoryController(svc service.MemoryService) *MemoryController {
+	return &MemoryController{svc: svc}
+}
+
+// ListMemories 分页获取当前用户的长期记忆，可按agent_id过滤
+func (c *MemoryController) ListMemories(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	page := utils.StringToInt(ctx.DefaultQuery("page", "1"))
+	size := utils.StringToInt(ctx.DefaultQuery("size", "10"))
+
+	memories, count, err := c.svc.ListMemories(ctx.Request.Context(), userID, ctx.Query("agent_id"), page, size)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to list memories: "+err.Error())
+		return
+	}
+
+	response.PageSuccess(ctx, memories, count)
+}
+
+// UpdateMemory 修改记忆内容
+func (c *MemoryController) UpdateMemory(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.UpdateMemoryRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	if err := c.svc.UpdateMemory(ctx.Request.Context(), userID, req.ID, req.Content); err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to update memory: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Memory updated successfully", nil)
+}
+
+// DeleteMemory 删除一条记忆；传agent_id时删除该Agent下的全部记忆
+func (c *MemoryController) DeleteMemory(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	id, agentID := ctx.Query("id"), ctx.Query("agent_id")
+	switch {
+	case id != "":
+		err = c.svc.DeleteMemory(ctx.Request.Context(), userID, id)
+	case agentID != "":
+		err = c.svc.DeleteAgentMemories(ctx.Request.Context(), userID, agentID)
+	default:
+		response.ParamError(ctx, errcode.ParamBindError, "Memory ID or Agent ID is required")
+		return
+	}
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to delete memory: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Memory deleted successfully", nil)
+}
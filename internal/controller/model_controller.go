@@ -46,6 +46,9 @@ func (c *ModelController) CreateModel(ctx *gin.Context) {
 		// llm
 		MaxOutputLength: req.MaxOutputLength,
 		Function:        req.Function,
+		Vision:          req.Vision,
+		Reasoning:       req.Reasoning,
+		ContextWindow:   req.ContextWindow,
 		// common
 		MaxTokens: req.MaxTokens,
 	}
@@ -87,6 +90,9 @@ func (c *ModelController) UpdateModel(ctx *gin.Context) {
 		// llm
 		MaxOutputLength: req.MaxOutputLength,
 		Function:        req.Function,
+		Vision:          req.Vision,
+		Reasoning:       req.Reasoning,
+		ContextWindow:   req.ContextWindow,
 		// common
 		MaxTokens: req.MaxTokens,
 	}
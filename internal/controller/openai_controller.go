@@ -0,0 +1,277 @@
+package controller
+
+import (
+	llmfactory "ai-cloud/internal/component/llm"
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/service"
+	"ai-cloud/internal/utils"
+	"ai-cloud/pkgs/stream"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	finishReasonStop      = "stop"
+	finishReasonToolCalls = "tool_calls"
+)
+
+// OpenAIController OpenAI兼容接口，使用API Key认证，响应格式遵循OpenAI规范而非统一的response格式
+type OpenAIController struct {
+	svc service.OpenAIService
+}
+
+func NewOpenAIController(svc service.OpenAIService) *OpenAIController {
+	return &OpenAIController{svc: svc}
+}
+
+// ListModels 以模型列表的形式返回用户的Agent
+func (c *OpenAIController) ListModels(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		openAIError(ctx, http.StatusUnauthorized, "authentication_error", "Failed to get user")
+		return
+	}
+
+	agents, err := c.svc.ListModels(ctx.Request.Context(), userID)
+	if err != nil {
+		openAIError(ctx, http.StatusInternalServerError, "api_error", err.Error())
+		return
+	}
+
+	list := &model.ModelList{Object: "list", Data: make([]*model.ModelCard, 0, len(agents))}
+	for _, agent := range agents {
+		list.Data = append(list.Data, &model.ModelCard{
+			ID:      agent.ID,
+			Object:  "model",
+			Created: agent.CreatedAt.Unix(),
+			OwnedBy: "ai-cloud",
+			Name:    agent.Name,
+		})
+	}
+	ctx.JSON(http.StatusOK, list)
+}
+
+// ChatCompletions 运行model对应的Agent，支持流式和非流式响应
+func (c *OpenAIController) ChatCompletions(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		openAIError(ctx, http.StatusUnauthorized, "authentication_error", "Failed to get user")
+		return
+	}
+
+	var req model.ChatCompletionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		openAIError(ctx, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	sr, err := c.svc.ChatCompletion(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		log.Printf("[OpenAI] Error running agent %s: %v\n", req.Model, err)
+		openAIError(ctx, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	defer sr.Close()
+
+	resp := &model.ChatCompletionResponse{
+		ID:      "chatcmpl-" + uuid.NewString(),
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+	}
+	if req.Stream {
+		resp.Object = "chat.completion.chunk"
+		c.streamCompletion(ctx, sr, resp, req.StreamOptions != nil && req.StreamOptions.IncludeUsage)
+		return
+	}
+
+	resp.Object = "chat.completion"
+	var chunks []*schema.Message
+	var reasoning string
+	var approval *stream.ApprovalRequest
+	finishReason := finishReasonStop
+	for {
+		msg, err := sr.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			openAIError(ctx, http.StatusInternalServerError, "api_error", err.Error())
+			return
+		}
+		if e, ok := service.IsStreamEvent(msg); ok {
+			switch {
+			case e.Usage != nil:
+				resp.Usage = toOpenAIUsage(e.Usage)
+			case e.ApprovalRequest != nil:
+				approval = e.ApprovalRequest
+			}
+			continue
+		}
+		if isRunEvent(msg) {
+			continue
+		}
+		reasoning += llmfactory.ReasoningContent(msg)
+		chunks = append(chunks, msg)
+	}
+
+	out := &model.ChatCompletionMessage{Role: string(schema.Assistant), ReasoningContent: reasoning}
+	if len(chunks) > 0 {
+		full, err := schema.ConcatMessages(chunks)
+		if err != nil {
+			openAIError(ctx, http.StatusInternalServerError, "api_error", err.Error())
+			return
+		}
+		out.ToolCalls = toOpenAIToolCalls(full.ToolCalls, false)
+		// 等待审批的工具调用由服务端执行，调用方不需要处理，finish_reason保持stop
+		if len(out.ToolCalls) > 0 && approval == nil {
+			finishReason = finishReasonToolCalls
+		}
+		if full.Content != "" || len(out.ToolCalls) == 0 {
+			content := model.MessageContent(full.Content)
+			out.Content = &content
+		}
+	}
+	resp.Choices = []model.ChatCompletionChoice{{Index: 0, Message: out, FinishReason: &finishReason, Approval: approval}}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// streamCompletion 以OpenAI的SSE格式输出回复，每个chunk为一个data行，最后以 [DONE] 结束
+func (c *OpenAIController) streamCompletion(ctx *gin.Context, sr *schema.StreamReader[*schema.Message], resp *model.ChatCompletionResponse, includeUsage bool) {
+	ctx.Writer.Header().Set("Content-Type", "text/event-stream")
+	ctx.Writer.Header().Set("Cache-Control", "no-cache")
+	ctx.Writer.Header().Set("Connection", "keep-alive")
+
+	write := func(v any) {
+		data, _ := json.Marshal(v)
+		_, _ = fmt.Fprintf(ctx.Writer, "data: %s\n\n", data)
+		ctx.Writer.Flush()
+	}
+	writeDelta := func(delta *model.ChatCompletionMessage, finishReason *string) {
+		chunk := *resp
+		chunk.Choices = []model.ChatCompletionChoice{{Index: 0, Delta: delta, FinishReason: finishReason}}
+		write(&chunk)
+	}
+
+	writeDelta(&model.ChatCompletionMessage{Role: string(schema.Assistant)}, nil)
+
+	var usage *model.ChatCompletionUsage
+	var approval *stream.ApprovalRequest
+	finishReason := finishReasonStop
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		default:
+		}
+
+		msg, err := sr.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Printf("[OpenAI] Error receiving message: %v\n", err)
+			write(&model.OpenAIError{Error: model.OpenAIErrorBody{Message: err.Error(), Type: "api_error"}})
+			return
+		}
+		if e, ok := service.IsStreamEvent(msg); ok {
+			switch {
+			case e.Usage != nil:
+				usage = toOpenAIUsage(e.Usage)
+			case e.ApprovalRequest != nil:
+				approval = e.ApprovalRequest
+			}
+			continue
+		}
+		if isRunEvent(msg) {
+			continue
+		}
+
+		delta := &model.ChatCompletionMessage{ReasoningContent: llmfactory.ReasoningContent(msg)}
+		if msg.Content != "" {
+			content := model.MessageContent(msg.Content)
+			delta.Content = &content
+		}
+		if len(msg.ToolCalls) > 0 {
+			delta.ToolCalls = toOpenAIToolCalls(msg.ToolCalls, true)
+			finishReason = finishReasonToolCalls
+		}
+		if delta.Content != nil || delta.ReasoningContent != "" || len(delta.ToolCalls) > 0 {
+			writeDelta(delta, nil)
+		}
+	}
+
+	// 等待审批的工具调用由服务端执行，finish_reason保持stop，审批信息通过扩展字段approval下发
+	if approval != nil {
+		finishReason = finishReasonStop
+	}
+	chunk := *resp
+	chunk.Choices = []model.ChatCompletionChoice{{Index: 0, Delta: &model.ChatCompletionMessage{}, FinishReason: &finishReason, Approval: approval}}
+	write(&chunk)
+	if includeUsage && usage != nil {
+		chunk = *resp
+		chunk.Choices = []model.ChatCompletionChoice{}
+		chunk.Usage = usage
+		write(&chunk)
+	}
+	_, _ = fmt.Fprint(ctx.Writer, "data: [DONE]\n\n")
+	ctx.Writer.Flush()
+}
+
+// isRunEvent 判断是否为子Agent调用、Trace等运行过程中的事件，这些事件不在OpenAI兼容接口中下发
+func isRunEvent(msg *schema.Message) bool {
+	if _, ok := service.IsAgentEvent(msg); ok {
+		return true
+	}
+	if _, ok := service.IsTraceEvent(msg); ok {
+		return true
+	}
+	_, ok := msg.Extra["node_outputs"]
+	return ok
+}
+
+// toOpenAIToolCalls 转换模型发起的工具调用，流式响应中需要携带index
+func toOpenAIToolCalls(calls []schema.ToolCall, withIndex bool) []model.ChatCompletionToolCall {
+	res := make([]model.ChatCompletionToolCall, 0, len(calls))
+	for i, call := range calls {
+		tc := model.ChatCompletionToolCall{
+			ID: call.ID,
+			Function: model.ChatCompletionFunctionCall{
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			},
+		}
+		if call.ID != "" {
+			tc.Type = "function"
+		}
+		if withIndex {
+			index := i
+			if call.Index != nil {
+				index = *call.Index
+			}
+			tc.Index = &index
+		}
+		res = append(res, tc)
+	}
+	return res
+}
+
+func toOpenAIUsage(u *stream.Usage) *model.ChatCompletionUsage {
+	return &model.ChatCompletionUsage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+}
+
+func openAIError(ctx *gin.Context, status int, typ string, message string) {
+	ctx.AbortWithStatusJSON(status, &model.OpenAIError{Error: model.OpenAIErrorBody{Message: message, Type: typ}})
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/service"
+	"ai-cloud/internal/utils"
+	"ai-cloud/pkgs/errcode"
+	"ai-cloud/pkgs/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScheduleController struct {
+	svc service.ScheduleService
+}
+
+func NewScheduleController(svc service.ScheduleService) *ScheduleController {
+	return &ScheduleController{svc: svc}
+}
+
+// CreateSchedule 为Agent创建定时任务
+func (c *ScheduleController) CreateSchedule(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.CreateScheduleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	schedule, err := c.svc.CreateSchedule(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to create schedule: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Schedule created successfully", schedule)
+}
+
+// UpdateSchedule 更新定时任务
+func (c *ScheduleController) UpdateSchedule(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.UpdateScheduleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	schedule, err := c.svc.UpdateSchedule(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to update schedule: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Schedule updated successfully", schedule)
+}
+
+// DeleteSchedule 删除定时任务
+func (c *ScheduleController) DeleteSchedule(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	id := ctx.Query("id")
+	if id == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Schedule ID is required")
+		return
+	}
+
+	if err := c.svc.DeleteSchedule(ctx.Request.Context(), userID, id); err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to delete schedule: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Schedule deleted successfully", nil)
+}
+
+// ListSchedules 获取当前用户的定时任务，可按agent_id过滤
+func (c *ScheduleController) ListSchedules(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	schedules, err := c.svc.ListSchedules(ctx.Request.Context(), userID, ctx.Query("agent_id"))
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to list schedules: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Get schedules successfully", schedules)
+}
+
+// TriggerSchedule 立即运行一次定时任务，运行在后台进行
+func (c *ScheduleController) TriggerSchedule(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	id := ctx.Query("id")
+	if id == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Schedule ID is required")
+		return
+	}
+
+	run, err := c.svc.TriggerSchedule(ctx.Request.Context(), userID, id)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to trigger schedule: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Schedule triggered successfully", run)
+}
+
+// PageRuns 分页获取定时任务的运行记录
+func (c *ScheduleController) PageRuns(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	scheduleID := ctx.Query("schedule_id")
+	if scheduleID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Schedule ID is required")
+		return
+	}
+
+	page := utils.StringToInt(ctx.DefaultQuery("page", "1"))
+	size := utils.StringToInt(ctx.DefaultQuery("size", "10"))
+
+	runs, count, err := c.svc.PageRuns(ctx.Request.Context(), userID, scheduleID, page, size)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to list schedule runs: "+err.Error())
+		return
+	}
+
+	response.PageSuccess(ctx, runs, count)
+}
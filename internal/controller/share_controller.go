@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/service"
+	"ai-cloud/internal/utils"
+	"ai-cloud/pkgs/errcode"
+	"ai-cloud/pkgs/response"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ShareController struct {
+	svc service.ShareService
+}
+
+func NewShareController(svc service.ShareService) *ShareController {
+	return &ShareController{svc: svc}
+}
+
+// CreateShare 为Agent创建公开分享链接
+func (c *ShareController) CreateShare(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.CreateShareRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	share, err := c.svc.CreateShare(ctx.Request.Context(), userID, &req)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to create share: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Share created successfully", share)
+}
+
+// ListShares 获取当前用户的分享链接，可按agent_id过滤
+func (c *ShareController) ListShares(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	shares, err := c.svc.ListShares(ctx.Request.Context(), userID, ctx.Query("agent_id"))
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to list shares: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Get shares successfully", shares)
+}
+
+// RevokeShare 撤销分享链接，撤销后访客无法继续访问
+func (c *ShareController) RevokeShare(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	id := ctx.Query("id")
+	if id == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Share ID is required")
+		return
+	}
+
+	if err := c.svc.RevokeShare(ctx.Request.Context(), userID, id); err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to revoke share: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Share revoked successfully", nil)
+}
+
+// ListVisitorConversations 分页获取分享链接下的访客会话
+func (c *ShareController) ListVisitorConversations(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	shareID := ctx.Query("share_id")
+	if shareID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Share ID is required")
+		return
+	}
+
+	page := utils.StringToInt(ctx.DefaultQuery("page", "1"))
+	size := utils.StringToInt(ctx.DefaultQuery("size", "10"))
+
+	convs, count, err := c.svc.ListVisitorConversations(ctx.Request.Context(), userID, shareID, page, size)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to list visitor conversations: "+err.Error())
+		return
+	}
+
+	response.PageSuccess(ctx, convs, count)
+}
+
+// GetShareInfo 公开接口：获取分享的基本信息
+func (c *ShareController) GetShareInfo(ctx *gin.Context) {
+	info, err := c.svc.GetShareInfo(ctx.Request.Context(), ctx.Param("token"), ctx.GetHeader("Origin"))
+	if err != nil {
+		shareError(ctx, err)
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Get share successfully", info)
+}
+
+// CreateVisitorConversation 公开接口：访客创建会话，返回的访客ID需在之后的请求头中携带
+func (c *ShareController) CreateVisitorConversation(ctx *gin.Context) {
+	var req model.CreateShareConvRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	res, err := c.svc.CreateVisitorConversation(ctx.Request.Context(), ctx.Param("token"), ctx.GetHeader("Origin"), ctx.ClientIP(), ctx.GetHeader(model.VisitorIDHeader), req.Password)
+	if err != nil {
+		shareError(ctx, err)
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Conversation created successfully", res)
+}
+
+// StreamVisitorConversation 公开接口：访客发送消息，流式返回回复
+func (c *ShareController) StreamVisitorConversation(ctx *gin.Context) {
+	var req model.ShareConvRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	sr, msgID, parentID, err := c.svc.StreamVisitorConversation(ctx.Request.Context(), ctx.Param("token"), ctx.GetHeader("Origin"), ctx.ClientIP(), ctx.GetHeader(model.VisitorIDHeader), req.ConvID, req.Message)
+	if err != nil {
+		shareError(ctx, err)
+		return
+	}
+
+	streamEvents(ctx, sr, msgID, parentID, req.ConvID, "Share Stream")
+}
+
+// GetVisitorHistory 公开接口：获取访客会话的历史消息
+func (c *ShareController) GetVisitorHistory(ctx *gin.Context) {
+	convID := ctx.Query("conv_id")
+	if convID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Conversation ID is required")
+		return
+	}
+	limit := utils.StringToInt(ctx.DefaultQuery("limit", "50"))
+
+	msgs, err := c.svc.GetVisitorHistory(ctx.Request.Context(), ctx.Param("token"), ctx.GetHeader("Origin"), ctx.GetHeader(model.VisitorIDHeader), convID, limit)
+	if err != nil {
+		shareError(ctx, err)
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Conversation history retrieved successfully", gin.H{"messages": msgs})
+}
+
+// shareError 将公开接口的错误映射为对应的状态码，内部错误不向访客暴露细节
+func shareError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrShareNotFound):
+		response.ErrorCustom(ctx, http.StatusNotFound, errcode.ShareNotFound, "分享不存在或已失效", nil)
+	case errors.Is(err, service.ErrShareOriginDenied):
+		response.ErrorCustom(ctx, http.StatusForbidden, errcode.ShareOriginDenied, "当前来源不允许访问该分享", nil)
+	case errors.Is(err, service.ErrSharePassword):
+		response.UnauthorizedError(ctx, errcode.SharePasswordError, "分享密码错误")
+	case errors.Is(err, service.ErrShareVisitor):
+		response.ErrorCustom(ctx, http.StatusForbidden, errcode.ShareVisitorError, "访客身份或会话无效", nil)
+	case errors.Is(err, service.ErrShareMessageLimit):
+		response.ErrorCustom(ctx, http.StatusTooManyRequests, errcode.ShareMessageLimit, "消息数已达上限", nil)
+	case errors.Is(err, service.ErrShareConvLimit):
+		response.ErrorCustom(ctx, http.StatusTooManyRequests, errcode.ShareConvLimit, "会话数已达上限", nil)
+	case errors.Is(err, service.ErrShareRateLimited):
+		response.ErrorCustom(ctx, http.StatusTooManyRequests, errcode.RateLimitExceeded, "请求过于频繁，请稍后再试", nil)
+	default:
+		log.Printf("[Share] Error handling visitor request: %v\n", err)
+		response.InternalError(ctx, errcode.InternalServerError, "Internal server error")
+	}
+}
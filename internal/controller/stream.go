@@ -0,0 +1,91 @@
+package controller
+
+import (
+	llmfactory "ai-cloud/internal/component/llm"
+	"ai-cloud/internal/service"
+	"ai-cloud/pkgs/stream"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/gin-gonic/gin"
+)
+
+// streamEvents 以统一的事件协议（见 pkgs/stream）输出流式回复，运行出错时下发error事件。
+// parentID为回复在会话消息树中的父消息，非会话模式为空
+func streamEvents(ctx *gin.Context, sr *schema.StreamReader[*schema.Message], messageID, parentID, convID string, tag string) {
+	writeEvents(ctx, sr, stream.NewWriter(ctx.Writer, messageID, convID).WithParent(parentID), messageID, tag)
+}
+
+// writeEvents 将回复流编码为事件写入响应
+func writeEvents(ctx *gin.Context, sr *schema.StreamReader[*schema.Message], w *stream.Writer, messageID string, tag string) {
+	ctx.Writer.Header().Set("Content-Type", "text/event-stream")
+	ctx.Writer.Header().Set("Cache-Control", "no-cache")
+	ctx.Writer.Header().Set("Connection", "keep-alive")
+	ctx.Writer.Header().Set("Transfer-Encoding", "chunked")
+	ctx.Writer.Header().Set(stream.VersionHeader, stream.Version)
+
+	defer func() {
+		sr.Close()
+		log.Printf("[%s] Finish stream for message ID: %s\n", tag, messageID)
+	}()
+
+	_ = w.Start()
+	ctx.Writer.Flush()
+
+	ctx.Stream(func(_ io.Writer) bool {
+		select {
+		case <-ctx.Request.Context().Done():
+			log.Printf("[%s] Context done for message ID: %s\n", tag, messageID)
+			return false
+		default:
+		}
+
+		msg, err := sr.Recv()
+		if errors.Is(err, io.EOF) {
+			_ = w.Done()
+			return false
+		}
+		if errors.Is(err, service.ErrReplyStopped) {
+			_ = w.Stopped()
+			return false
+		}
+		if err != nil {
+			log.Printf("[%s] Error receiving message: %v\n", tag, err)
+			_ = w.Error(err)
+			return false
+		}
+		writeMessage(w, msg)
+		return true
+	})
+}
+
+// writeMessage 将流中的一个消息块编码为事件：运行过程中的事件原样下发，思考内容和回答分别下发
+func writeMessage(w *stream.Writer, msg *schema.Message) {
+	if e, ok := service.IsStreamEvent(msg); ok {
+		// 回复可能被多次回放，复制后再填充序号
+		ev := *e
+		_ = w.Write(&ev)
+		return
+	}
+	if e, ok := service.IsAgentEvent(msg); ok {
+		_ = w.Extension(e.Type, e)
+		return
+	}
+	if e, ok := service.IsTraceEvent(msg); ok {
+		_ = w.Extension(stream.EventTrace, e)
+		return
+	}
+
+	// 调试模式下工作流附带每个节点的输出
+	if nodeOutputs, ok := msg.Extra["node_outputs"]; ok {
+		_ = w.Extension(stream.EventNodeOutputs, nodeOutputs)
+	}
+	if reasoning := llmfactory.ReasoningContent(msg); reasoning != "" {
+		_ = w.Reasoning(reasoning)
+	}
+	if msg.Content != "" {
+		_ = w.Content(msg.Content)
+	}
+}
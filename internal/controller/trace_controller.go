@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/service"
+	"ai-cloud/internal/utils"
+	"ai-cloud/pkgs/errcode"
+	"ai-cloud/pkgs/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TraceController struct {
+	svc service.TraceService
+}
+
+func NewTraceController(svc service.TraceService) *TraceController {
+	return &TraceController{svc: svc}
+}
+
+// GetTrace 获取Trace详情
+func (c *TraceController) GetTrace(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	traceID := ctx.Query("id")
+	if traceID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Trace ID is required")
+		return
+	}
+
+	detail, err := c.svc.GetTrace(ctx.Request.Context(), userID, traceID)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to get trace: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Trace retrieved successfully", detail)
+}
+
+// GetMessageTrace 获取生成某条助手消息的Trace
+func (c *TraceController) GetMessageTrace(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	msgID := ctx.Query("msg_id")
+	if msgID == "" {
+		response.ParamError(ctx, errcode.ParamBindError, "Message ID is required")
+		return
+	}
+
+	detail, err := c.svc.GetTraceByMessage(ctx.Request.Context(), userID, msgID)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to get trace: "+err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(ctx, "Trace retrieved successfully", detail)
+}
+
+// PageTraces 分页查询Trace，可按Agent过滤
+func (c *TraceController) PageTraces(ctx *gin.Context) {
+	userID, err := utils.GetUserIDFromContext(ctx)
+	if err != nil {
+		response.UnauthorizedError(ctx, errcode.UnauthorizedError, "Failed to get user")
+		return
+	}
+
+	var req model.PageTraceRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		response.ParamError(ctx, errcode.ParamBindError, "Parameter error: "+err.Error())
+		return
+	}
+
+	traces, count, err := c.svc.PageTraces(ctx.Request.Context(), userID, req.AgentID, req.Page, req.Size)
+	if err != nil {
+		response.InternalError(ctx, errcode.InternalServerError, "Failed to get traces: "+err.Error())
+		return
+	}
+
+	response.PageSuccess(ctx, traces, count)
+}
@@ -14,6 +14,7 @@ type AgentDao interface {
 	GetByID(ctx context.Context, userID uint, agentID string) (*model.Agent, error)
 	List(ctx context.Context, userID uint) ([]*model.Agent, error)
 	Page(ctx context.Context, userID uint, page, size int) ([]*model.Agent, int64, error)
+	UpdatePublishedVersion(ctx context.Context, userID uint, agentID string, version int) error
 }
 
 type agentDao struct {
@@ -86,3 +87,10 @@ func (d *agentDao) Page(ctx context.Context, userID uint, page, size int) ([]*mo
 	err = db.Offset((page - 1) * size).Limit(size).Find(&agents).Error
 	return agents, count, err
 }
+
+// UpdatePublishedVersion 更新Agent当前发布的版本号
+func (d *agentDao) UpdatePublishedVersion(ctx context.Context, userID uint, agentID string, version int) error {
+	return d.db.WithContext(ctx).Model(&model.Agent{}).
+		Where("id = ? AND user_id = ?", agentID, userID).
+		Update("published_version", version).Error
+}
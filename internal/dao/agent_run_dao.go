@@ -0,0 +1,160 @@
+package dao
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AgentRunDao interface {
+	Create(ctx context.Context, run *model.AgentRun) error
+	GetByID(ctx context.Context, userID uint, runID string) (*model.AgentRun, error)
+	UpdateStatus(ctx context.Context, runID string, status string) error
+	// GetCheckpoint/SetCheckpoint 供eino的CheckPointStore使用
+	GetCheckpoint(ctx context.Context, runID string) ([]byte, bool, error)
+	SetCheckpoint(ctx context.Context, runID string, checkpoint []byte) error
+	// SaveToolResults 保存中断时已执行完成的工具调用结果
+	SaveToolResults(ctx context.Context, runID string, results map[string]string) error
+
+	CreateApprovals(ctx context.Context, approvals []*model.ToolApproval) error
+	ListApprovals(ctx context.Context, runID string) ([]*model.ToolApproval, error)
+	ListPendingApprovals(ctx context.Context, userID uint) ([]*model.ToolApproval, error)
+	DecideApproval(ctx context.Context, approval *model.ToolApproval) error
+	// CancelByMsg 取消助手回复对应的、等待审批的运行及其待审批的调用，返回是否存在这样的运行
+	CancelByMsg(ctx context.Context, userID uint, msgID string) (bool, error)
+	DeleteByAgent(ctx context.Context, agentID string) error
+}
+
+type agentRunDao struct {
+	db *gorm.DB
+}
+
+func NewAgentRunDao(db *gorm.DB) AgentRunDao {
+	return &agentRunDao{db: db}
+}
+
+func (d *agentRunDao) Create(ctx context.Context, run *model.AgentRun) error {
+	return d.db.WithContext(ctx).Create(run).Error
+}
+
+func (d *agentRunDao) GetByID(ctx context.Context, userID uint, runID string) (*model.AgentRun, error) {
+	var run model.AgentRun
+	err := d.db.WithContext(ctx).Omit("checkpoint").Where("id = ? AND user_id = ?", runID, userID).First(&run).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("run not found or no permission")
+		}
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (d *agentRunDao) UpdateStatus(ctx context.Context, runID string, status string) error {
+	return d.db.WithContext(ctx).Model(&model.AgentRun{}).Where("id = ?", runID).Update("status", status).Error
+}
+
+func (d *agentRunDao) GetCheckpoint(ctx context.Context, runID string) ([]byte, bool, error) {
+	var run model.AgentRun
+	err := d.db.WithContext(ctx).Select("checkpoint").Where("id = ?", runID).First(&run).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return run.Checkpoint, len(run.Checkpoint) > 0, nil
+}
+
+func (d *agentRunDao) SetCheckpoint(ctx context.Context, runID string, checkpoint []byte) error {
+	return d.db.WithContext(ctx).Model(&model.AgentRun{}).Where("id = ?", runID).Update("checkpoint", checkpoint).Error
+}
+
+func (d *agentRunDao) SaveToolResults(ctx context.Context, runID string, results map[string]string) error {
+	return d.db.WithContext(ctx).Model(&model.AgentRun{ID: runID}).Select("ToolResults").
+		Updates(&model.AgentRun{ToolResults: results}).Error
+}
+
+func (d *agentRunDao) CreateApprovals(ctx context.Context, approvals []*model.ToolApproval) error {
+	if len(approvals) == 0 {
+		return nil
+	}
+	return d.db.WithContext(ctx).Create(approvals).Error
+}
+
+func (d *agentRunDao) ListApprovals(ctx context.Context, runID string) ([]*model.ToolApproval, error) {
+	var approvals []*model.ToolApproval
+	err := d.db.WithContext(ctx).Where("run_id = ?", runID).Order("created_at asc").Find(&approvals).Error
+	if err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
+func (d *agentRunDao) ListPendingApprovals(ctx context.Context, userID uint) ([]*model.ToolApproval, error) {
+	var approvals []*model.ToolApproval
+	err := d.db.WithContext(ctx).Where("user_id = ? AND status = ?", userID, model.ApprovalStatusPending).
+		Order("created_at desc").Find(&approvals).Error
+	if err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
+// DecideApproval 记录审批结果，只能修改待审批的记录
+func (d *agentRunDao) DecideApproval(ctx context.Context, approval *model.ToolApproval) error {
+	now := time.Now()
+	res := d.db.WithContext(ctx).Model(&model.ToolApproval{}).
+		Where("id = ? AND status = ?", approval.ID, model.ApprovalStatusPending).
+		Updates(map[string]any{
+			"status":           approval.Status,
+			"edited_arguments": approval.EditedArguments,
+			"comment":          approval.Comment,
+			"decided_at":       now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("approval not found or already decided")
+	}
+	approval.DecidedAt = &now
+	return nil
+}
+
+func (d *agentRunDao) CancelByMsg(ctx context.Context, userID uint, msgID string) (bool, error) {
+	cancelled := false
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var run model.AgentRun
+		err := tx.Omit("checkpoint").
+			Where("user_id = ? AND msg_id = ? AND status = ?", userID, msgID, model.AgentRunStatusInterrupted).
+			First(&run).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// 条件更新，与同时进行的恢复只有一个能成功
+		res := tx.Model(&model.AgentRun{}).Where("id = ? AND status = ?", run.ID, model.AgentRunStatusInterrupted).
+			Update("status", model.AgentRunStatusCancelled)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		cancelled = true
+		return tx.Model(&model.ToolApproval{}).Where("run_id = ? AND status = ?", run.ID, model.ApprovalStatusPending).
+			Updates(map[string]any{"status": model.ApprovalStatusCancelled, "decided_at": time.Now()}).Error
+	})
+	return cancelled, err
+}
+
+func (d *agentRunDao) DeleteByAgent(ctx context.Context, agentID string) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("agent_id = ?", agentID).Delete(&model.ToolApproval{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("agent_id = ?", agentID).Delete(&model.AgentRun{}).Error
+	})
+}
@@ -0,0 +1,70 @@
+package dao
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type AgentVersionDao interface {
+	Create(ctx context.Context, version *model.AgentVersion) error
+	GetByVersion(ctx context.Context, userID uint, agentID string, version int) (*model.AgentVersion, error)
+	List(ctx context.Context, userID uint, agentID string) ([]*model.AgentVersion, error)
+	MaxVersion(ctx context.Context, agentID string) (int, error)
+	DeleteByAgent(ctx context.Context, agentID string) error
+}
+
+type agentVersionDao struct {
+	db *gorm.DB
+}
+
+func NewAgentVersionDao(db *gorm.DB) AgentVersionDao {
+	return &agentVersionDao{db: db}
+}
+
+func (d *agentVersionDao) Create(ctx context.Context, version *model.AgentVersion) error {
+	return d.db.WithContext(ctx).Create(version).Error
+}
+
+func (d *agentVersionDao) GetByVersion(ctx context.Context, userID uint, agentID string, version int) (*model.AgentVersion, error) {
+	var v model.AgentVersion
+	err := d.db.WithContext(ctx).
+		Where("agent_id = ? AND user_id = ? AND version = ?", agentID, userID, version).
+		First(&v).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("agent version not found or no permission")
+		}
+		return nil, err
+	}
+	return &v, nil
+}
+
+// List 按版本号倒序返回Agent的所有版本
+func (d *agentVersionDao) List(ctx context.Context, userID uint, agentID string) ([]*model.AgentVersion, error) {
+	var versions []*model.AgentVersion
+	err := d.db.WithContext(ctx).
+		Where("agent_id = ? AND user_id = ?", agentID, userID).
+		Order("version desc").
+		Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// MaxVersion 获取Agent当前最大的版本号，没有版本时返回0
+func (d *agentVersionDao) MaxVersion(ctx context.Context, agentID string) (int, error) {
+	var max int
+	err := d.db.WithContext(ctx).Model(&model.AgentVersion{}).
+		Where("agent_id = ?", agentID).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&max).Error
+	return max, err
+}
+
+func (d *agentVersionDao) DeleteByAgent(ctx context.Context, agentID string) error {
+	return d.db.WithContext(ctx).Where("agent_id = ?", agentID).Delete(&model.AgentVersion{}).Error
+}
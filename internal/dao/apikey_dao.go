@@ -0,0 +1,64 @@
+package dao
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type APIKeyDao interface {
+	Create(ctx context.Context, key *model.APIKey) error
+	GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error)
+	List(ctx context.Context, userID uint) ([]*model.APIKey, error)
+	Delete(ctx context.Context, userID uint, id string) error
+	UpdateLastUsed(ctx context.Context, id string, t time.Time) error
+}
+
+type apiKeyDao struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyDao(db *gorm.DB) APIKeyDao {
+	return &apiKeyDao{db: db}
+}
+
+func (d *apiKeyDao) Create(ctx context.Context, key *model.APIKey) error {
+	return d.db.WithContext(ctx).Create(key).Error
+}
+
+func (d *apiKeyDao) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	var key model.APIKey
+	if err := d.db.WithContext(ctx).Where("key_hash = ?", keyHash).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("api key not found")
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (d *apiKeyDao) List(ctx context.Context, userID uint) ([]*model.APIKey, error) {
+	var keys []*model.APIKey
+	if err := d.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at desc").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (d *apiKeyDao) Delete(ctx context.Context, userID uint, id string) error {
+	res := d.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&model.APIKey{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("api key not found or no permission")
+	}
+	return nil
+}
+
+func (d *apiKeyDao) UpdateLastUsed(ctx context.Context, id string, t time.Time) error {
+	return d.db.WithContext(ctx).Model(&model.APIKey{}).Where("id = ?", id).Update("last_used_at", t).Error
+}
@@ -0,0 +1,124 @@
+package dao
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type EvalDao interface {
+	CreateRun(ctx context.Context, run *model.EvalRun) error
+	GetRun(ctx context.Context, userID uint, id string) (*model.EvalRun, error)
+	PageRuns(ctx context.Context, userID uint, page, size int) ([]*model.EvalRun, int64, error)
+	DeleteRun(ctx context.Context, userID uint, id string) error
+	// FinishRun 保存运行的状态、汇总和错误
+	FinishRun(ctx context.Context, run *model.EvalRun) error
+	// FailStaleRuns 将创建时间早于before仍在运行的评测标记为失败，用于清理实例退出时中断的评测
+	FailStaleRuns(ctx context.Context, before time.Time, reason string) error
+
+	// SaveResult 保存一条用例的结果并增加运行的完成数
+	SaveResult(ctx context.Context, result *model.EvalResult) error
+	ListResults(ctx context.Context, runID string) ([]*model.EvalResult, error)
+	PageResults(ctx context.Context, runID string, page, size int) ([]*model.EvalResult, int64, error)
+}
+
+type evalDao struct {
+	db *gorm.DB
+}
+
+func NewEvalDao(db *gorm.DB) EvalDao {
+	return &evalDao{db: db}
+}
+
+func (d *evalDao) CreateRun(ctx context.Context, run *model.EvalRun) error {
+	return d.db.WithContext(ctx).Create(run).Error
+}
+
+func (d *evalDao) GetRun(ctx context.Context, userID uint, id string) (*model.EvalRun, error) {
+	var run model.EvalRun
+	if err := d.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&run).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("eval run not found or no permission")
+		}
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (d *evalDao) PageRuns(ctx context.Context, userID uint, page, size int) ([]*model.EvalRun, int64, error) {
+	var (
+		runs  []*model.EvalRun
+		total int64
+	)
+	db := d.db.WithContext(ctx).Model(&model.EvalRun{}).Where("user_id = ?", userID)
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * size
+	if err := db.Order("created_at desc").Offset(offset).Limit(size).Find(&runs).Error; err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+func (d *evalDao) DeleteRun(ctx context.Context, userID uint, id string) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&model.EvalRun{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("eval run not found or no permission")
+		}
+		return tx.Where("run_id = ?", id).Delete(&model.EvalResult{}).Error
+	})
+}
+
+func (d *evalDao) FinishRun(ctx context.Context, run *model.EvalRun) error {
+	return d.db.WithContext(ctx).Model(run).
+		Select("Status", "Summary", "Error", "FinishedAt").
+		Updates(run).Error
+}
+
+func (d *evalDao) FailStaleRuns(ctx context.Context, before time.Time, reason string) error {
+	return d.db.WithContext(ctx).Model(&model.EvalRun{}).
+		Where("status = ? AND created_at < ?", model.EvalRunRunning, before).
+		Updates(map[string]any{"status": model.EvalRunFailed, "error": reason, "finished_at": time.Now()}).Error
+}
+
+func (d *evalDao) SaveResult(ctx context.Context, result *model.EvalResult) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(result).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.EvalRun{}).Where("id = ?", result.RunID).
+			UpdateColumn("completed", gorm.Expr("completed + 1")).Error
+	})
+}
+
+func (d *evalDao) ListResults(ctx context.Context, runID string) ([]*model.EvalResult, error) {
+	var results []*model.EvalResult
+	err := d.db.WithContext(ctx).Where("run_id = ?", runID).Order("case_index").Find(&results).Error
+	return results, err
+}
+
+func (d *evalDao) PageResults(ctx context.Context, runID string, page, size int) ([]*model.EvalResult, int64, error) {
+	var (
+		results []*model.EvalResult
+		total   int64
+	)
+	db := d.db.WithContext(ctx).Model(&model.EvalResult{}).Where("run_id = ?", runID)
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * size
+	if err := db.Order("case_index").Offset(offset).Limit(size).Find(&results).Error; err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
@@ -0,0 +1,131 @@
+package dao
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// trendFormats 满意度趋势各统计周期的DATE_FORMAT格式
+var trendFormats = map[string]string{
+	"day":   "%Y-%m-%d",
+	"week":  "%x-W%v",
+	"month": "%Y-%m",
+}
+
+type FeedbackDao interface {
+	// Upsert 保存评价，同一用户对同一回复的评价会被覆盖
+	Upsert(ctx context.Context, fb *model.MessageFeedback) error
+	Delete(ctx context.Context, userID uint, msgID string) error
+	Get(ctx context.Context, userID uint, msgID string) (*model.MessageFeedback, error)
+	// Trend 按统计周期汇总好评和差评数
+	Trend(ctx context.Context, userID uint, q *model.FeedbackQuery) ([]*model.FeedbackTrend, error)
+	// WorstConversations 差评最多的会话
+	WorstConversations(ctx context.Context, userID uint, q *model.FeedbackQuery) ([]*model.ConvFeedback, error)
+	// ListReasons 差评的原因分类
+	ListReasons(ctx context.Context, userID uint, q *model.FeedbackQuery) ([][]string, error)
+	// List 按时间倒序返回评价
+	List(ctx context.Context, userID uint, q *model.FeedbackQuery) ([]*model.MessageFeedback, error)
+}
+
+type feedbackDao struct {
+	db *gorm.DB
+}
+
+func NewFeedbackDao(db *gorm.DB) FeedbackDao {
+	return &feedbackDao{db: db}
+}
+
+func (d *feedbackDao) Upsert(ctx context.Context, fb *model.MessageFeedback) error {
+	return d.db.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"trace_id", "rating", "reasons", "comment", "created_at"}),
+	}).Create(fb).Error
+}
+
+func (d *feedbackDao) Delete(ctx context.Context, userID uint, msgID string) error {
+	return d.db.WithContext(ctx).Where("user_id = ? AND msg_id = ?", userID, msgID).Delete(&model.MessageFeedback{}).Error
+}
+
+func (d *feedbackDao) Get(ctx context.Context, userID uint, msgID string) (*model.MessageFeedback, error) {
+	var fb model.MessageFeedback
+	err := d.db.WithContext(ctx).Where("user_id = ? AND msg_id = ?", userID, msgID).First(&fb).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("feedback not found")
+		}
+		return nil, err
+	}
+	return &fb, nil
+}
+
+// filter 按Agent和时间范围过滤用户的评价
+func (d *feedbackDao) filter(ctx context.Context, userID uint, q *model.FeedbackQuery) *gorm.DB {
+	db := d.db.WithContext(ctx).Model(&model.MessageFeedback{}).Where("message_feedbacks.user_id = ?", userID)
+	if q.AgentID != "" {
+		db = db.Where("message_feedbacks.agent_id = ?", q.AgentID)
+	}
+	if q.Start > 0 {
+		db = db.Where("message_feedbacks.created_at >= ?", time.Unix(q.Start, 0))
+	}
+	if q.End > 0 {
+		db = db.Where("message_feedbacks.created_at <= ?", time.Unix(q.End, 0))
+	}
+	return db
+}
+
+func (d *feedbackDao) Trend(ctx context.Context, userID uint, q *model.FeedbackQuery) ([]*model.FeedbackTrend, error) {
+	format, ok := trendFormats[q.Interval]
+	if !ok {
+		format = trendFormats["day"]
+	}
+	var trend []*model.FeedbackTrend
+	err := d.filter(ctx, userID, q).
+		Select("DATE_FORMAT(created_at, ?) AS period, SUM(rating = 'up') AS up, SUM(rating = 'down') AS down", format).
+		Group("period").Order("period asc").
+		Scan(&trend).Error
+	return trend, err
+}
+
+func (d *feedbackDao) WorstConversations(ctx context.Context, userID uint, q *model.FeedbackQuery) ([]*model.ConvFeedback, error) {
+	var convs []*model.ConvFeedback
+	err := d.filter(ctx, userID, q).
+		Joins("JOIN conversations ON conversations.conv_id = message_feedbacks.conv_id").
+		Select("message_feedbacks.conv_id, conversations.title, conversations.agent_id, " +
+			"SUM(message_feedbacks.rating = 'up') AS up, SUM(message_feedbacks.rating = 'down') AS down").
+		Group("message_feedbacks.conv_id, conversations.title, conversations.agent_id").
+		Having("SUM(message_feedbacks.rating = 'down') > 0").
+		Order("SUM(message_feedbacks.rating = 'down') - SUM(message_feedbacks.rating = 'up') DESC, down DESC").
+		Limit(q.Limit).
+		Scan(&convs).Error
+	return convs, err
+}
+
+func (d *feedbackDao) ListReasons(ctx context.Context, userID uint, q *model.FeedbackQuery) ([][]string, error) {
+	var fbs []*model.MessageFeedback
+	err := d.filter(ctx, userID, q).
+		Where("rating = ?", model.FeedbackDown).
+		Select("reasons").
+		Find(&fbs).Error
+	if err != nil {
+		return nil, err
+	}
+	reasons := make([][]string, 0, len(fbs))
+	for _, fb := range fbs {
+		reasons = append(reasons, fb.Reasons)
+	}
+	return reasons, nil
+}
+
+func (d *feedbackDao) List(ctx context.Context, userID uint, q *model.FeedbackQuery) ([]*model.MessageFeedback, error) {
+	db := d.filter(ctx, userID, q)
+	if q.Rating != "" {
+		db = db.Where("rating = ?", q.Rating)
+	}
+	var fbs []*model.MessageFeedback
+	err := db.Order("created_at desc").Limit(q.Limit).Find(&fbs).Error
+	return fbs, err
+}
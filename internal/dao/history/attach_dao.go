@@ -0,0 +1,177 @@
+package history
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ChunkHit 命中的附件分块及其相关度
+type ChunkHit struct {
+	AttachID   string
+	ChunkIndex int
+	Content    string
+	FileName   string
+	Score      float64
+}
+
+// AttachDao 聊天附件、消息与附件的关联，以及会话内的附件分块索引
+type AttachDao interface {
+	// Create 保存附件及其文本分块
+	Create(ctx context.Context, attachment *model.Attachment, chunks []*model.AttachmentChunk) error
+	Get(ctx context.Context, attachID string) (*model.Attachment, error)
+	// Bind 将尚未发送的附件及其分块绑定到会话
+	Bind(ctx context.Context, attachID, convID string) error
+	// Link 关联用户消息与附件，保持附件的顺序。首次发送的附件同时记录该消息
+	Link(ctx context.Context, msgID string, attachIDs []string) error
+	// ListByMessage 用户消息的附件ID，按关联顺序
+	ListByMessage(ctx context.Context, msgID string) ([]string, error)
+	ListByConv(ctx context.Context, convID string) ([]*model.Attachment, error)
+	// HasChunks 会话中是否有已建立索引的附件
+	HasChunks(ctx context.Context, convID string) (bool, error)
+	// SearchChunks 在会话的附件分块中全文检索，按相关度排序
+	SearchChunks(ctx context.Context, convID, query string, limit int) ([]*ChunkHit, error)
+	// DeleteByConv 删除会话的附件、分块和关联
+	DeleteByConv(ctx context.Context, convID string) error
+}
+
+type attachDao struct {
+	db *gorm.DB
+}
+
+func NewAttachDao(db *gorm.DB) AttachDao {
+	return &attachDao{db: db}
+}
+
+func (d *attachDao) Create(ctx context.Context, attachment *model.Attachment, chunks []*model.AttachmentChunk) error {
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(attachment).Error; err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(chunks, 100).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+	return nil
+}
+
+func (d *attachDao) Get(ctx context.Context, attachID string) (*model.Attachment, error) {
+	var attachment model.Attachment
+	err := d.db.WithContext(ctx).Where("attach_id = ?", attachID).First(&attachment).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("attachment not found")
+		}
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	return &attachment, nil
+}
+
+func (d *attachDao) Bind(ctx context.Context, attachID, convID string) error {
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.Attachment{}).
+			Where("attach_id = ? AND conv_id = ''", attachID).
+			Update("conv_id", convID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("attachment already belongs to a conversation")
+		}
+		return tx.Model(&model.AttachmentChunk{}).Where("attach_id = ?", attachID).Update("conv_id", convID).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to bind attachment: %w", err)
+	}
+	return nil
+}
+
+func (d *attachDao) Link(ctx context.Context, msgID string, attachIDs []string) error {
+	if len(attachIDs) == 0 {
+		return nil
+	}
+	links := make([]*model.MessageAttachment, 0, len(attachIDs))
+	for _, id := range attachIDs {
+		links = append(links, &model.MessageAttachment{MessageID: msgID, AttachmentID: id})
+	}
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&links).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Attachment{}).
+			Where("attach_id IN ? AND message_id = ''", attachIDs).
+			Update("message_id", msgID).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to link attachments: %w", err)
+	}
+	return nil
+}
+
+func (d *attachDao) ListByMessage(ctx context.Context, msgID string) ([]string, error) {
+	var ids []string
+	err := d.db.WithContext(ctx).Model(&model.MessageAttachment{}).
+		Where("message_id = ?", msgID).Order("id asc").
+		Pluck("attachment_id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message attachments: %w", err)
+	}
+	return ids, nil
+}
+
+func (d *attachDao) ListByConv(ctx context.Context, convID string) ([]*model.Attachment, error) {
+	var attachments []*model.Attachment
+	if err := d.db.WithContext(ctx).Where("conv_id = ?", convID).Find(&attachments).Error; err != nil {
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+	return attachments, nil
+}
+
+func (d *attachDao) HasChunks(ctx context.Context, convID string) (bool, error) {
+	var count int64
+	err := d.db.WithContext(ctx).Model(&model.AttachmentChunk{}).Where("conv_id = ?", convID).Limit(1).Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to count attachment chunks: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (d *attachDao) SearchChunks(ctx context.Context, convID, query string, limit int) ([]*ChunkHit, error) {
+	var hits []*ChunkHit
+	err := d.db.WithContext(ctx).Table("attachment_chunks").
+		Select("attachment_chunks.attach_id, attachment_chunks.chunk_index, attachment_chunks.content, attachments.file_name, "+
+			"MATCH(attachment_chunks.content) AGAINST(? IN NATURAL LANGUAGE MODE) AS score", query).
+		Joins("JOIN attachments ON attachments.attach_id = attachment_chunks.attach_id").
+		Where("attachment_chunks.conv_id = ?", convID).
+		Where("MATCH(attachment_chunks.content) AGAINST(? IN NATURAL LANGUAGE MODE)", query).
+		Order("score DESC").Limit(limit).
+		Scan(&hits).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to search attachment chunks: %w", err)
+	}
+	return hits, nil
+}
+
+func (d *attachDao) DeleteByConv(ctx context.Context, convID string) error {
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ids := tx.Model(&model.Attachment{}).Select("attach_id").Where("conv_id = ?", convID)
+		if err := tx.Where("attachment_id IN (?)", ids).Delete(&model.MessageAttachment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("conv_id = ?", convID).Delete(&model.AttachmentChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("conv_id = ?", convID).Delete(&model.Attachment{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete attachments: %w", err)
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ package history
 import (
 	"ai-cloud/internal/model"
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"gorm.io/gorm"
@@ -23,6 +24,15 @@ type ConvDao interface {
 	FirstOrCreate(ctx context.Context, conv *model.Conversation) error
 	Page(ctx context.Context, userID uint, page, size int) ([]*model.Conversation, int64, error)
 	PageByAgent(ctx context.Context, userID uint, agentID string, page, size int) ([]*model.Conversation, int64, error)
+	PageByShare(ctx context.Context, userID uint, shareID string, page, size int) ([]*model.Conversation, int64, error)
+	CountByVisitor(ctx context.Context, shareID, visitorID string) (int64, error)
+	CountByShare(ctx context.Context, shareID string) (int64, error)
+	UpdateSummary(ctx context.Context, convID, summary string, summaryMsgID uint64) error
+	SetCurrentMsg(ctx context.Context, convID, msgID string) error
+	SetTitle(ctx context.Context, convID, title string, manual bool) error
+	SetSettings(ctx context.Context, convID string, settings json.RawMessage) error
+	Touch(ctx context.Context, convID string, updatedAt int64) error
+	CountVisitorMessages(ctx context.Context, shareID, visitorID string) (int64, error)
 	Archive(ctx context.Context, convID string) error
 	UnArchive(ctx context.Context, convID string) error
 	Pin(ctx context.Context, convID string) error
@@ -94,7 +104,7 @@ func (d *convDao) Page(ctx context.Context, userID uint, page, size int) ([]*mod
 	var convs []*model.Conversation
 	var total int64
 
-	db := d.db.WithContext(ctx).Model(&model.Conversation{}).Where("user_id = ?", userID).Order("updated_at DESC") // 按照更新时间降序排序
+	db := d.db.WithContext(ctx).Model(&model.Conversation{}).Where("user_id = ? AND share_id = ''", userID).Order("updated_at DESC") // 按照更新时间降序排序，不含访客会话
 
 	err := db.Count(&total).Error
 	if err != nil {
@@ -109,7 +119,7 @@ func (d *convDao) PageByAgent(ctx context.Context, userID uint, agentID string,
 	var convs []*model.Conversation
 	var total int64
 
-	db := d.db.WithContext(ctx).Model(&model.Conversation{}).Where("user_id = ? AND agent_id = ?", userID, agentID).Order("updated_at DESC") // 按照更新时间降序排序
+	db := d.db.WithContext(ctx).Model(&model.Conversation{}).Where("user_id = ? AND agent_id = ? AND share_id = ''", userID, agentID).Order("updated_at DESC") // 按照更新时间降序排序，不含访客会话
 
 	err := db.Count(&total).Error
 	if err != nil {
@@ -119,6 +129,106 @@ func (d *convDao) PageByAgent(ctx context.Context, userID uint, agentID string,
 	return convs, total, err
 }
 
+// PageByShare 分页获取分享链接下的访客会话
+func (d *convDao) PageByShare(ctx context.Context, userID uint, shareID string, page, size int) ([]*model.Conversation, int64, error) {
+	var convs []*model.Conversation
+	var total int64
+
+	db := d.db.WithContext(ctx).Model(&model.Conversation{}).Where("user_id = ? AND share_id = ?", userID, shareID).Order("updated_at DESC")
+
+	err := db.Count(&total).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count conversations: %w", err)
+	}
+	err = db.Offset((page - 1) * size).Limit(size).Find(&convs).Error
+	return convs, total, err
+}
+
+// CountByVisitor 统计访客在分享链接下的会话数
+func (d *convDao) CountByVisitor(ctx context.Context, shareID, visitorID string) (int64, error) {
+	var total int64
+	err := d.db.WithContext(ctx).Model(&model.Conversation{}).Where("share_id = ? AND visitor_id = ?", shareID, visitorID).Count(&total).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count conversations: %w", err)
+	}
+	return total, nil
+}
+
+// CountByShare 统计分享链接下所有访客的会话数
+func (d *convDao) CountByShare(ctx context.Context, shareID string) (int64, error) {
+	var total int64
+	err := d.db.WithContext(ctx).Model(&model.Conversation{}).Where("share_id = ?", shareID).Count(&total).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count conversations: %w", err)
+	}
+	return total, nil
+}
+
+// CountVisitorMessages 统计访客在分享链接下发送的消息总数
+func (d *convDao) CountVisitorMessages(ctx context.Context, shareID, visitorID string) (int64, error) {
+	var total int64
+	err := d.db.WithContext(ctx).Model(&model.Message{}).
+		Joins("JOIN conversations ON conversations.conv_id = messages.conv_id").
+		Where("conversations.share_id = ? AND conversations.visitor_id = ? AND messages.role = ?", shareID, visitorID, "user").
+		Count(&total).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+	return total, nil
+}
+
+// UpdateSummary 更新会话的滚动摘要
+func (d *convDao) UpdateSummary(ctx context.Context, convID, summary string, summaryMsgID uint64) error {
+	err := d.db.WithContext(ctx).Model(&model.Conversation{}).Where("conv_id = ?", convID).
+		Updates(map[string]any{"summary": summary, "summary_msg_id": summaryMsgID}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update conversation summary: %w", err)
+	}
+	return nil
+}
+
+// SetCurrentMsg 设置会话当前分支的末端消息
+func (d *convDao) SetCurrentMsg(ctx context.Context, convID, msgID string) error {
+	err := d.db.WithContext(ctx).Model(&model.Conversation{}).Where("conv_id = ?", convID).Update("current_msg_id", msgID).Error
+	if err != nil {
+		return fmt.Errorf("failed to update current message: %w", err)
+	}
+	return nil
+}
+
+// SetSettings 设置会话设置，settings为nil时清空
+func (d *convDao) SetSettings(ctx context.Context, convID string, settings json.RawMessage) error {
+	err := d.db.WithContext(ctx).Model(&model.Conversation{}).Where("conv_id = ?", convID).Update("settings", settings).Error
+	if err != nil {
+		return fmt.Errorf("failed to update settings: %w", err)
+	}
+	return nil
+}
+
+// SetTitle 设置会话标题。manual为false时是自动生成的标题，用户手动设置过标题的会话不会被覆盖
+func (d *convDao) SetTitle(ctx context.Context, convID, title string, manual bool) error {
+	db := d.db.WithContext(ctx).Model(&model.Conversation{}).Where("conv_id = ?", convID)
+	var err error
+	if manual {
+		err = db.Updates(map[string]any{"title": title, "title_manual": true}).Error
+	} else {
+		err = db.Where("title_manual = ?", false).Update("title", title).Error
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update title: %w", err)
+	}
+	return nil
+}
+
+// Touch 更新会话的最后更新时间
+func (d *convDao) Touch(ctx context.Context, convID string, updatedAt int64) error {
+	err := d.db.WithContext(ctx).Model(&model.Conversation{}).Where("conv_id = ?", convID).Update("updated_at", updatedAt).Error
+	if err != nil {
+		return fmt.Errorf("failed to update conversation time: %w", err)
+	}
+	return nil
+}
+
 // Archive 归档一个会话
 func (d *convDao) Archive(ctx context.Context, convID string) error {
 	err := d.db.WithContext(ctx).Model(&model.Conversation{}).Where("conv_id = ?", convID).Update("is_archived", true).Error
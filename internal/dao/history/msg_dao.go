@@ -4,6 +4,8 @@ import (
 	"ai-cloud/internal/model"
 	"context"
 	"fmt"
+	"time"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -11,12 +13,17 @@ import (
 type MsgDao interface {
 	GetDB() *gorm.DB
 	Create(ctx context.Context, msg *model.Message) error
+	CreateBatch(ctx context.Context, msgs []*model.Message) error
 	Update(ctx context.Context, msg *model.Message) error
 	Delete(ctx context.Context, msgID string) error
 	GetByID(ctx context.Context, msgID string) (*model.Message, error)
 	ListByConvID(ctx context.Context, convID string) ([]*model.Message, error)
 	List(ctx context.Context, convID string, offset, limit int) ([]*model.Message, int64, error)
+	ListRecent(ctx context.Context, convID string, afterID uint64, limit int) ([]*model.Message, error)
+	LastContextEdge(ctx context.Context, convID string) (uint64, error)
 	UpdateStatus(ctx context.Context, msgID, status string) error
+	UpdateReply(ctx context.Context, msg *model.Message) error
+	FailStaleReplies(ctx context.Context, convID string, before int64) (int64, error)
 	UpdateTokenCount(ctx context.Context, msgID string, tokenCount int)
 	SetContextEdge(ctx context.Context, msgID string, isContextEdge bool) error
 	SetVariant(ctx context.Context, msgID string, isVariant bool) error
@@ -44,6 +51,19 @@ func (d *msgDao) Create(ctx context.Context, msg *model.Message) error {
 	return nil
 }
 
+// CreateBatch 按顺序批量创建消息
+func (d *msgDao) CreateBatch(ctx context.Context, msgs []*model.Message) error {
+	for _, msg := range msgs {
+		if len(msg.MsgID) == 0 {
+			msg.MsgID = uuid.NewString()
+		}
+	}
+	if err := d.db.WithContext(ctx).CreateInBatches(msgs, 100).Error; err != nil {
+		return fmt.Errorf("failed to create messages: %w", err)
+	}
+	return nil
+}
+
 func (d *msgDao) Update(ctx context.Context, msg *model.Message) error {
 	if err := d.db.WithContext(ctx).Save(msg).Error; err != nil {
 		return fmt.Errorf("failed to update message: %w", err)
@@ -70,7 +90,7 @@ func (d *msgDao) GetByID(ctx context.Context, msgID string) (*model.Message, err
 func (d *msgDao) ListByConvID(ctx context.Context, convID string) ([]*model.Message, error) {
 	var msgs []*model.Message
 	if err := d.db.WithContext(ctx).Where("conv_id = ?", convID).
-		Order("order_seq ASC").
+		Order("order_seq ASC, id ASC").
 		Find(&msgs).Error; err != nil {
 		return nil, fmt.Errorf("failed to list messages: %w", err)
 	}
@@ -82,7 +102,7 @@ func (d *msgDao) List(ctx context.Context, convID string, offset, limit int) ([]
 	var msgs []*model.Message
 	var total int64
 	db := d.db.WithContext(ctx).Model(&model.Message{}).Where("conv_id = ?", convID).
-		Order("order_seq ASC")
+		Order("order_seq ASC, id ASC")
 	err := db.Count(&total).Error
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to count messages: %w", err)
@@ -94,6 +114,28 @@ func (d *msgDao) List(ctx context.Context, convID string, offset, limit int) ([]
 	return msgs, total, err
 }
 
+// ListRecent 获取ID大于afterID的最近limit条消息，按时间倒序
+func (d *msgDao) ListRecent(ctx context.Context, convID string, afterID uint64, limit int) ([]*model.Message, error) {
+	var msgs []*model.Message
+	err := d.db.WithContext(ctx).Where("conv_id = ? AND id > ?", convID, afterID).
+		Order("id DESC").Limit(limit).Find(&msgs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+	return msgs, nil
+}
+
+// LastContextEdge 获取最近一个上下文边界消息的ID，没有时返回0
+func (d *msgDao) LastContextEdge(ctx context.Context, convID string) (uint64, error) {
+	var id uint64
+	err := d.db.WithContext(ctx).Model(&model.Message{}).Where("conv_id = ? AND is_context_edge = ?", convID, true).
+		Select("COALESCE(MAX(id), 0)").Scan(&id).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to get context edge: %w", err)
+	}
+	return id, nil
+}
+
 // UpdateStatus 更新消息状态
 func (d *msgDao) UpdateStatus(ctx context.Context, msgID, status string) error {
 	err := d.db.WithContext(ctx).Model(&model.Message{}).Where("msg_id = ?", msgID).Update("status", status).Error
@@ -103,6 +145,38 @@ func (d *msgDao) UpdateStatus(ctx context.Context, msgID, status string) error {
 	return nil
 }
 
+// UpdateReply 更新助手回复的内容、运行信息和状态
+func (d *msgDao) UpdateReply(ctx context.Context, msg *model.Message) error {
+	err := d.db.WithContext(ctx).Model(&model.Message{}).Where("msg_id = ?", msg.MsgID).Updates(map[string]interface{}{
+		"content":           msg.Content,
+		"reasoning_content": msg.ReasoningContent,
+		"token_count":       msg.TokenCount,
+		"metadata":          msg.Metadata,
+		"status":            msg.Status,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update reply: %w", err)
+	}
+	return nil
+}
+
+// FailStaleReplies 将before（Unix秒）之前创建、仍为pending的回复标记为error，convID为空时处理所有会话。
+// 等待审批的运行和在before之后恢复的运行对应的回复不处理
+func (d *msgDao) FailStaleReplies(ctx context.Context, convID string, before int64) (int64, error) {
+	db := d.db.WithContext(ctx).Model(&model.Message{}).
+		Where("status = ? AND created_at < ?", model.MessageStatusPending, before).
+		Where("NOT EXISTS (SELECT 1 FROM agent_runs WHERE agent_runs.msg_id = messages.msg_id AND (agent_runs.status = ? OR agent_runs.updated_at >= ?))",
+			model.AgentRunStatusInterrupted, time.Unix(before, 0))
+	if convID != "" {
+		db = db.Where("conv_id = ?", convID)
+	}
+	res := db.Update("status", model.MessageStatusError)
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to fail stale replies: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
 // UpdateTokenCount 更新消息的token数量
 func (d *msgDao) UpdateTokenCount(ctx context.Context, msgID string, tokenCount int) {
 	err := d.db.WithContext(ctx).Model(&model.Message{}).Where("msg_id = ?", msgID).Update("token_count", tokenCount).Error
@@ -0,0 +1,102 @@
+package history
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// MessageHit 命中的消息及其所在会话
+type MessageHit struct {
+	MsgID     string
+	ConvID    string
+	Role      string
+	Content   string
+	CreatedAt int64
+	Title     string
+	AgentID   string
+}
+
+// SearchDao 会话历史全文检索。默认实现基于MySQL的ngram全文索引，可替换为其他本地索引
+type SearchDao interface {
+	SearchMessages(ctx context.Context, userID uint, terms []string, req *model.SearchRequest) ([]*MessageHit, int64, error)
+	SearchTitles(ctx context.Context, userID uint, terms []string, req *model.SearchRequest, limit int) ([]*model.Conversation, error)
+}
+
+type searchDao struct {
+	db *gorm.DB
+}
+
+func NewSearchDao(db *gorm.DB) SearchDao {
+	return &searchDao{db: db}
+}
+
+// SearchMessages 检索用户会话中的消息，不含访客会话，按相关度和时间排序
+func (d *searchDao) SearchMessages(ctx context.Context, userID uint, terms []string, req *model.SearchRequest) ([]*MessageHit, int64, error) {
+	query := booleanQuery(terms)
+	db := d.db.WithContext(ctx).Table("messages").
+		Joins("JOIN conversations ON conversations.conv_id = messages.conv_id").
+		Where("conversations.user_id = ? AND conversations.share_id = ''", userID).
+		Where("MATCH(messages.content) AGAINST(? IN BOOLEAN MODE)", query)
+	if req.AgentID != "" {
+		db = db.Where("conversations.agent_id = ?", req.AgentID)
+	}
+	if req.Role != "" {
+		db = db.Where("messages.role = ?", req.Role)
+	}
+	if req.Start > 0 {
+		db = db.Where("messages.created_at >= ?", req.Start)
+	}
+	if req.End > 0 {
+		db = db.Where("messages.created_at <= ?", req.End)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+
+	var hits []*MessageHit
+	err := db.Select("messages.msg_id, messages.conv_id, messages.role, messages.content, messages.created_at, conversations.title, conversations.agent_id").
+		Order(gorm.Expr("MATCH(messages.content) AGAINST(? IN BOOLEAN MODE) DESC, messages.id DESC", query)).
+		Offset((req.Page - 1) * req.Size).Limit(req.Size).
+		Scan(&hits).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search messages: %w", err)
+	}
+	return hits, total, nil
+}
+
+// SearchTitles 检索标题匹配的会话，不含访客会话，时间范围按会话的更新时间过滤
+func (d *searchDao) SearchTitles(ctx context.Context, userID uint, terms []string, req *model.SearchRequest, limit int) ([]*model.Conversation, error) {
+	db := d.db.WithContext(ctx).Model(&model.Conversation{}).
+		Where("user_id = ? AND share_id = ''", userID).
+		Where("MATCH(title) AGAINST(? IN BOOLEAN MODE)", booleanQuery(terms))
+	if req.AgentID != "" {
+		db = db.Where("agent_id = ?", req.AgentID)
+	}
+	if req.Start > 0 {
+		db = db.Where("updated_at >= ?", req.Start)
+	}
+	if req.End > 0 {
+		db = db.Where("updated_at <= ?", req.End)
+	}
+
+	var convs []*model.Conversation
+	if err := db.Order("updated_at DESC").Limit(limit).Find(&convs).Error; err != nil {
+		return nil, fmt.Errorf("failed to search conversations: %w", err)
+	}
+	return convs, nil
+}
+
+// booleanQuery 将检索词转为布尔模式的查询：每个词作为必须出现的短语，避免用户输入被解析为运算符
+func booleanQuery(terms []string) string {
+	parts := make([]string, 0, len(terms))
+	for _, t := range terms {
+		parts = append(parts, `+"`+strings.ReplaceAll(t, `"`, " ")+`"`)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,59 @@
+package history
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StopDao 停止回复生成的请求，多实例部署时用于通知运行所在的实例
+type StopDao interface {
+	Create(ctx context.Context, msgID string) error
+	// ListRequested 返回msgIDs中已被请求停止的消息
+	ListRequested(ctx context.Context, msgIDs []string) ([]string, error)
+	Delete(ctx context.Context, msgIDs []string) error
+	// DeleteBefore 删除早于createdAt的请求
+	DeleteBefore(ctx context.Context, createdAt int64) error
+}
+
+type stopDao struct {
+	db *gorm.DB
+}
+
+func NewStopDao(db *gorm.DB) StopDao {
+	return &stopDao{db: db}
+}
+
+func (d *stopDao) Create(ctx context.Context, msgID string) error {
+	err := d.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&model.ReplyStop{MsgID: msgID}).Error
+	if err != nil {
+		return fmt.Errorf("failed to create stop request: %w", err)
+	}
+	return nil
+}
+
+func (d *stopDao) ListRequested(ctx context.Context, msgIDs []string) ([]string, error) {
+	var ids []string
+	err := d.db.WithContext(ctx).Model(&model.ReplyStop{}).Where("msg_id IN ?", msgIDs).Pluck("msg_id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stop requests: %w", err)
+	}
+	return ids, nil
+}
+
+func (d *stopDao) Delete(ctx context.Context, msgIDs []string) error {
+	if err := d.db.WithContext(ctx).Where("msg_id IN ?", msgIDs).Delete(&model.ReplyStop{}).Error; err != nil {
+		return fmt.Errorf("failed to delete stop requests: %w", err)
+	}
+	return nil
+}
+
+func (d *stopDao) DeleteBefore(ctx context.Context, createdAt int64) error {
+	if err := d.db.WithContext(ctx).Where("created_at < ?", createdAt).Delete(&model.ReplyStop{}).Error; err != nil {
+		return fmt.Errorf("failed to delete stop requests: %w", err)
+	}
+	return nil
+}
@@ -14,6 +14,7 @@ type KnowledgeBaseDao interface {
 	CountKBs(userID uint) (int64, error)                                        // 统计知识库数量
 	ListKBs(userID uint, page int, pageSize int) ([]model.KnowledgeBase, error) // 获取知识库列表
 	GetKBByID(kb_id string) (*model.KnowledgeBase, error)                       // 获取知识库
+	GetKBByName(userID uint, name string) (*model.KnowledgeBase, error)         // 按名称获取用户的知识库
 
 	// 文档相关
 	CreateDocument(doc *model.Document) error                         // 创建文档
@@ -51,6 +52,14 @@ func (kd *kbDao) GetKBByID(kb_id string) (*model.KnowledgeBase, error) {
 	return kb, nil
 }
 
+func (kd *kbDao) GetKBByName(userID uint, name string) (*model.KnowledgeBase, error) {
+	kb := &model.KnowledgeBase{}
+	if err := kd.db.Where("user_id = ? AND name = ?", userID, name).Order("created_at asc").First(kb).Error; err != nil {
+		return nil, err
+	}
+	return kb, nil
+}
+
 func (kd *kbDao) CountKBs(userID uint) (int64, error) {
 	var total int64
 	query := kd.db.Model(&model.KnowledgeBase{}).Where("user_id = ?", userID)
@@ -0,0 +1,112 @@
+package dao
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type MemoryDao interface {
+	Create(ctx context.Context, memories []*model.Memory) error
+	GetByID(ctx context.Context, userID uint, id string) (*model.Memory, error)
+	GetByIDs(ctx context.Context, userID uint, ids []string) ([]*model.Memory, error)
+	// List 获取用户在Agent下最近更新的记忆，limit<=0表示不限制
+	List(ctx context.Context, userID uint, agentID string, limit int) ([]*model.Memory, error)
+	Page(ctx context.Context, userID uint, agentID string, page, size int) ([]*model.Memory, int64, error)
+	Update(ctx context.Context, userID uint, id, content, embedModelID string) error
+	Delete(ctx context.Context, userID uint, ids []string) error
+	DeleteByAgent(ctx context.Context, agentID string) error
+}
+
+type memoryDao struct {
+	db *gorm.DB
+}
+
+func NewMemoryDao(db *gorm.DB) MemoryDao {
+	return &memoryDao{db: db}
+}
+
+func (d *memoryDao) Create(ctx context.Context, memories []*model.Memory) error {
+	if len(memories) == 0 {
+		return nil
+	}
+	return d.db.WithContext(ctx).Create(memories).Error
+}
+
+func (d *memoryDao) GetByID(ctx context.Context, userID uint, id string) (*model.Memory, error) {
+	var memory model.Memory
+	if err := d.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&memory).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("memory not found or no permission")
+		}
+		return nil, err
+	}
+	return &memory, nil
+}
+
+func (d *memoryDao) GetByIDs(ctx context.Context, userID uint, ids []string) ([]*model.Memory, error) {
+	var memories []*model.Memory
+	if len(ids) == 0 {
+		return memories, nil
+	}
+	if err := d.db.WithContext(ctx).Where("id IN ? AND user_id = ?", ids, userID).Find(&memories).Error; err != nil {
+		return nil, err
+	}
+	return memories, nil
+}
+
+func (d *memoryDao) List(ctx context.Context, userID uint, agentID string, limit int) ([]*model.Memory, error) {
+	var memories []*model.Memory
+	db := d.db.WithContext(ctx).Where("user_id = ? AND agent_id = ?", userID, agentID).Order("updated_at desc")
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	if err := db.Find(&memories).Error; err != nil {
+		return nil, err
+	}
+	return memories, nil
+}
+
+func (d *memoryDao) Page(ctx context.Context, userID uint, agentID string, page, size int) ([]*model.Memory, int64, error) {
+	var memories []*model.Memory
+	var total int64
+
+	db := d.db.WithContext(ctx).Model(&model.Memory{}).Where("user_id = ?", userID)
+	if agentID != "" {
+		db = db.Where("agent_id = ?", agentID)
+	}
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * size
+	if err := db.Order("updated_at desc").Offset(offset).Limit(size).Find(&memories).Error; err != nil {
+		return nil, 0, err
+	}
+	return memories, total, nil
+}
+
+func (d *memoryDao) Update(ctx context.Context, userID uint, id, content, embedModelID string) error {
+	res := d.db.WithContext(ctx).Model(&model.Memory{}).Where("id = ? AND user_id = ?", id, userID).
+		Updates(map[string]any{"content": content, "embed_model_id": embedModelID})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("memory not found or no permission")
+	}
+	return nil
+}
+
+func (d *memoryDao) Delete(ctx context.Context, userID uint, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return d.db.WithContext(ctx).Where("id IN ? AND user_id = ?", ids, userID).Delete(&model.Memory{}).Error
+}
+
+func (d *memoryDao) DeleteByAgent(ctx context.Context, agentID string) error {
+	return d.db.WithContext(ctx).Where("agent_id = ?", agentID).Delete(&model.Memory{}).Error
+}
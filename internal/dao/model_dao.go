@@ -42,7 +42,7 @@ func (d *modelDao) Update(ctx context.Context, m *model.Model) error {
 	return d.db.WithContext(ctx).Model(m).
 		Select(
 			"ShowName", "Server", "BaseURL", "ModelName", "APIKey",
-			"Dimension", "MaxOutputLength", "Function", "MaxTokens",
+			"Dimension", "MaxOutputLength", "Function", "Vision", "Reasoning", "ContextWindow", "MaxTokens",
 		).
 		Updates(m).Error
 }
@@ -0,0 +1,137 @@
+package dao
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ScheduleDao interface {
+	Create(ctx context.Context, schedule *model.AgentSchedule) error
+	Update(ctx context.Context, schedule *model.AgentSchedule) error
+	Delete(ctx context.Context, userID uint, id string) error
+	GetByID(ctx context.Context, userID uint, id string) (*model.AgentSchedule, error)
+	List(ctx context.Context, userID uint, agentID string) ([]*model.AgentSchedule, error)
+	// ListDue 获取已到运行时间的启用任务
+	ListDue(ctx context.Context, now int64, limit int) ([]*model.AgentSchedule, error)
+	// Claim 仅当next_run_at仍为prev时将其更新为next，返回是否抢占成功。多个实例同时轮询时只有一个能抢占同一次运行
+	Claim(ctx context.Context, id string, prev, next, now int64) (bool, error)
+	SetLastStatus(ctx context.Context, id, status string) error
+
+	CreateRun(ctx context.Context, run *model.ScheduleRun) error
+	FinishRun(ctx context.Context, run *model.ScheduleRun) error
+	PageRuns(ctx context.Context, userID uint, scheduleID string, page, size int) ([]*model.ScheduleRun, int64, error)
+	// FailStaleRuns 将开始时间早于before仍在运行的记录标记为失败，用于清理实例退出时中断的运行
+	FailStaleRuns(ctx context.Context, before time.Time, reason string) error
+}
+
+type scheduleDao struct {
+	db *gorm.DB
+}
+
+func NewScheduleDao(db *gorm.DB) ScheduleDao {
+	return &scheduleDao{db: db}
+}
+
+func (d *scheduleDao) Create(ctx context.Context, schedule *model.AgentSchedule) error {
+	return d.db.WithContext(ctx).Create(schedule).Error
+}
+
+func (d *scheduleDao) Update(ctx context.Context, schedule *model.AgentSchedule) error {
+	return d.db.WithContext(ctx).Model(schedule).
+		Select("Name", "CronExpr", "Timezone", "Message", "WebhookURL", "Enabled", "NextRunAt").
+		Updates(schedule).Error
+}
+
+func (d *scheduleDao) Delete(ctx context.Context, userID uint, id string) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&model.AgentSchedule{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("schedule not found or no permission")
+		}
+		return tx.Where("schedule_id = ?", id).Delete(&model.ScheduleRun{}).Error
+	})
+}
+
+func (d *scheduleDao) GetByID(ctx context.Context, userID uint, id string) (*model.AgentSchedule, error) {
+	var schedule model.AgentSchedule
+	if err := d.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&schedule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("schedule not found or no permission")
+		}
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (d *scheduleDao) List(ctx context.Context, userID uint, agentID string) ([]*model.AgentSchedule, error) {
+	var schedules []*model.AgentSchedule
+	db := d.db.WithContext(ctx).Where("user_id = ?", userID)
+	if agentID != "" {
+		db = db.Where("agent_id = ?", agentID)
+	}
+	if err := db.Order("created_at desc").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (d *scheduleDao) ListDue(ctx context.Context, now int64, limit int) ([]*model.AgentSchedule, error) {
+	var schedules []*model.AgentSchedule
+	err := d.db.WithContext(ctx).
+		Where("enabled = ? AND next_run_at > 0 AND next_run_at <= ?", true, now).
+		Order("next_run_at").Limit(limit).Find(&schedules).Error
+	return schedules, err
+}
+
+func (d *scheduleDao) Claim(ctx context.Context, id string, prev, next, now int64) (bool, error) {
+	res := d.db.WithContext(ctx).Model(&model.AgentSchedule{}).
+		Where("id = ? AND enabled = ? AND next_run_at = ?", id, true, prev).
+		Updates(map[string]any{"next_run_at": next, "last_run_at": now, "last_status": model.ScheduleRunRunning})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (d *scheduleDao) SetLastStatus(ctx context.Context, id, status string) error {
+	return d.db.WithContext(ctx).Model(&model.AgentSchedule{}).
+		Where("id = ?", id).Update("last_status", status).Error
+}
+
+func (d *scheduleDao) CreateRun(ctx context.Context, run *model.ScheduleRun) error {
+	return d.db.WithContext(ctx).Create(run).Error
+}
+
+func (d *scheduleDao) FinishRun(ctx context.Context, run *model.ScheduleRun) error {
+	return d.db.WithContext(ctx).Model(run).
+		Select("Status", "MsgID", "Output", "Error", "WebhookStatus", "WebhookError", "FinishedAt").
+		Updates(run).Error
+}
+
+func (d *scheduleDao) PageRuns(ctx context.Context, userID uint, scheduleID string, page, size int) ([]*model.ScheduleRun, int64, error) {
+	var (
+		runs  []*model.ScheduleRun
+		count int64
+	)
+	db := d.db.WithContext(ctx).Model(&model.ScheduleRun{}).Where("schedule_id = ? AND user_id = ?", scheduleID, userID)
+	if err := db.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := db.Order("started_at desc").Offset((page - 1) * size).Limit(size).Find(&runs).Error; err != nil {
+		return nil, 0, err
+	}
+	return runs, count, nil
+}
+
+func (d *scheduleDao) FailStaleRuns(ctx context.Context, before time.Time, reason string) error {
+	return d.db.WithContext(ctx).Model(&model.ScheduleRun{}).
+		Where("status = ? AND started_at < ?", model.ScheduleRunRunning, before).
+		Updates(map[string]any{"status": model.ScheduleRunFailed, "error": reason, "finished_at": time.Now()}).Error
+}
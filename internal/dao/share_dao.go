@@ -0,0 +1,77 @@
+package dao
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ShareDao interface {
+	Create(ctx context.Context, share *model.AgentShare) error
+	GetByToken(ctx context.Context, token string) (*model.AgentShare, error)
+	GetByID(ctx context.Context, userID uint, id string) (*model.AgentShare, error)
+	List(ctx context.Context, userID uint, agentID string) ([]*model.AgentShare, error)
+	Revoke(ctx context.Context, userID uint, id string, t time.Time) error
+}
+
+type shareDao struct {
+	db *gorm.DB
+}
+
+func NewShareDao(db *gorm.DB) ShareDao {
+	return &shareDao{db: db}
+}
+
+func (d *shareDao) Create(ctx context.Context, share *model.AgentShare) error {
+	return d.db.WithContext(ctx).Create(share).Error
+}
+
+func (d *shareDao) GetByToken(ctx context.Context, token string) (*model.AgentShare, error) {
+	var share model.AgentShare
+	if err := d.db.WithContext(ctx).Where("token = ?", token).First(&share).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("share not found")
+		}
+		return nil, err
+	}
+	return &share, nil
+}
+
+func (d *shareDao) GetByID(ctx context.Context, userID uint, id string) (*model.AgentShare, error) {
+	var share model.AgentShare
+	if err := d.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&share).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("share not found or no permission")
+		}
+		return nil, err
+	}
+	return &share, nil
+}
+
+func (d *shareDao) List(ctx context.Context, userID uint, agentID string) ([]*model.AgentShare, error) {
+	var shares []*model.AgentShare
+	db := d.db.WithContext(ctx).Where("user_id = ?", userID)
+	if agentID != "" {
+		db = db.Where("agent_id = ?", agentID)
+	}
+	if err := db.Order("created_at desc").Find(&shares).Error; err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func (d *shareDao) Revoke(ctx context.Context, userID uint, id string, t time.Time) error {
+	res := d.db.WithContext(ctx).Model(&model.AgentShare{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", t)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("share not found, already revoked or no permission")
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package dao
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type TraceDao interface {
+	Create(ctx context.Context, trace *model.Trace) error
+	// Finish 更新Trace的最终状态并写入全部步骤
+	Finish(ctx context.Context, trace *model.Trace, spans []*model.TraceSpan) error
+	GetByID(ctx context.Context, userID uint, traceID string) (*model.Trace, error)
+	GetByMsgID(ctx context.Context, userID uint, msgID string) (*model.Trace, error)
+	ListSpans(ctx context.Context, traceID string) ([]*model.TraceSpan, error)
+	Page(ctx context.Context, userID uint, agentID string, page, size int) ([]*model.Trace, int64, error)
+	DeleteByAgent(ctx context.Context, agentID string) error
+}
+
+type traceDao struct {
+	db *gorm.DB
+}
+
+func NewTraceDao(db *gorm.DB) TraceDao {
+	return &traceDao{db: db}
+}
+
+func (d *traceDao) Create(ctx context.Context, trace *model.Trace) error {
+	return d.db.WithContext(ctx).Create(trace).Error
+}
+
+func (d *traceDao) Finish(ctx context.Context, trace *model.Trace, spans []*model.TraceSpan) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Trace{}).Where("id = ?", trace.ID).Updates(map[string]any{
+			"msg_id":            trace.MsgID,
+			"status":            trace.Status,
+			"error":             trace.Error,
+			"prompt_tokens":     trace.PromptTokens,
+			"completion_tokens": trace.CompletionTokens,
+			"total_tokens":      trace.TotalTokens,
+			"duration_ms":       trace.DurationMs,
+		}).Error; err != nil {
+			return err
+		}
+		if len(spans) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(spans, 100).Error
+	})
+}
+
+func (d *traceDao) GetByID(ctx context.Context, userID uint, traceID string) (*model.Trace, error) {
+	var trace model.Trace
+	err := d.db.WithContext(ctx).Where("id = ? AND user_id = ?", traceID, userID).First(&trace).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("trace not found or no permission")
+		}
+		return nil, err
+	}
+	return &trace, nil
+}
+
+func (d *traceDao) GetByMsgID(ctx context.Context, userID uint, msgID string) (*model.Trace, error) {
+	var trace model.Trace
+	err := d.db.WithContext(ctx).Where("msg_id = ? AND user_id = ?", msgID, userID).First(&trace).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("trace not found or no permission")
+		}
+		return nil, err
+	}
+	return &trace, nil
+}
+
+// ListSpans 按开始顺序返回Trace的全部步骤
+func (d *traceDao) ListSpans(ctx context.Context, traceID string) ([]*model.TraceSpan, error) {
+	var spans []*model.TraceSpan
+	err := d.db.WithContext(ctx).Where("trace_id = ?", traceID).Order("seq asc").Find(&spans).Error
+	if err != nil {
+		return nil, err
+	}
+	return spans, nil
+}
+
+// Page 分页获取Trace，agentID为空时返回用户的全部Trace
+func (d *traceDao) Page(ctx context.Context, userID uint, agentID string, page, size int) ([]*model.Trace, int64, error) {
+	var traces []*model.Trace
+	var total int64
+
+	db := d.db.WithContext(ctx).Model(&model.Trace{}).Where("user_id = ?", userID)
+	if agentID != "" {
+		db = db.Where("agent_id = ?", agentID)
+	}
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * size
+	if err := db.Order("created_at desc").Offset(offset).Limit(size).Find(&traces).Error; err != nil {
+		return nil, 0, err
+	}
+	return traces, total, nil
+}
+
+func (d *traceDao) DeleteByAgent(ctx context.Context, agentID string) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		sub := tx.Model(&model.Trace{}).Select("id").Where("agent_id = ?", agentID)
+		if err := tx.Where("trace_id IN (?)", sub).Delete(&model.TraceSpan{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("agent_id = ?", agentID).Delete(&model.Trace{}).Error
+	})
+}
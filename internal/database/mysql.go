@@ -41,11 +41,34 @@ func GetDB() (*gorm.DB, error) {
 			&model.Document{},
 			&model.Model{},
 			&model.Agent{},
+			&model.AgentVersion{},
 			// 会话记录相关
 			&model.Conversation{},
 			&model.Message{},
 			&model.Attachment{},
 			&model.MessageAttachment{},
+			&model.AttachmentChunk{},
+			&model.ReplyStop{},
+			// 回复评价
+			&model.MessageFeedback{},
+			// 运行记录
+			&model.Trace{},
+			&model.TraceSpan{},
+			// 工具审批
+			&model.AgentRun{},
+			&model.ToolApproval{},
+			// API Key
+			&model.APIKey{},
+			// 公开分享
+			&model.AgentShare{},
+			// 长期记忆
+			&model.Memory{},
+			// 定时任务
+			&model.AgentSchedule{},
+			&model.ScheduleRun{},
+			// 评测
+			&model.EvalRun{},
+			&model.EvalResult{},
 		); err != nil {
 			dbErr = err
 			return
@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"ai-cloud/internal/model"
 	"ai-cloud/pkgs/errcode"
+	"context"
 	"errors"
 	"net/http"
 	"strings"
@@ -69,3 +71,56 @@ func JWTAuth() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// APIKeyVerifier 校验API Key，返回的记录包含所属用户和权限范围
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (*model.APIKey, error)
+}
+
+// APIKeyContextKey 使用API Key认证时，上下文中保存的API Key记录
+const APIKeyContextKey = "api_key"
+
+// Auth 统一认证：Authorization: Bearer 后为 sk- 开头的API Key时校验API Key，否则按登录JWT校验。
+// 权限范围由 RequireScope 在各路由组上检查
+func Auth(verifier APIKeyVerifier) gin.HandlerFunc {
+	jwtAuth := JWTAuth()
+	return func(c *gin.Context) {
+		parts := strings.SplitN(c.GetHeader(AuthHeaderKey), " ", 2)
+		if len(parts) != 2 || parts[0] != AuthBearerType || !strings.HasPrefix(parts[1], model.APIKeyPrefix) {
+			jwtAuth(c)
+			return
+		}
+
+		key, err := verifier.VerifyAPIKey(c.Request.Context(), parts[1])
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"code":    errcode.TokenInvalid,
+				"message": "API Key无效或已过期",
+			})
+			return
+		}
+
+		c.Set("user_id", key.UserID)
+		c.Set(APIKeyContextKey, key)
+		c.Next()
+	}
+}
+
+// RequireScope 要求API Key拥有任一权限范围，登录JWT不受限制
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := c.Get(APIKeyContextKey)
+		if !ok {
+			c.Next()
+			return
+		}
+		if key := v.(*model.APIKey); !key.HasScope(scopes...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"code":    errcode.ForbiddenError,
+				"message": "API Key缺少权限：" + strings.Join(scopes, " 或 "),
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -2,11 +2,16 @@ package middleware
 
 import (
 	"ai-cloud/config"
+	"ai-cloud/internal/model"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"strings"
 	"time"
 )
 
+// PublicPathPrefix 公开分享接口的路径前缀，这些接口允许任意站点嵌入，来源由分享自身的白名单校验
+const PublicPathPrefix = "/api/public/"
+
 // SetupCORS 封装CORS配置
 func SetupCORS() gin.HandlerFunc {
 	corsConfig := config.GetConfig().CORS
@@ -16,7 +21,7 @@ func SetupCORS() gin.HandlerFunc {
 		maxAge = 12 * time.Hour
 	}
 
-	return cors.New(cors.Config{
+	handler := cors.New(cors.Config{
 		AllowOrigins:     corsConfig.AllowOrigins,     // 允许所有域名
 		AllowMethods:     corsConfig.AllowMethods,     // 允许的HTTP方法
 		AllowHeaders:     corsConfig.AllowHeaders,     // 允许的请求头
@@ -24,4 +29,19 @@ func SetupCORS() gin.HandlerFunc {
 		AllowCredentials: corsConfig.AllowCredentials, // 允许携带凭证（如Cookie）
 		MaxAge:           maxAge,                      // 预检请求缓存时间
 	})
+	// 公开分享接口不携带凭证，放行所有来源
+	public := cors.New(cors.Config{
+		AllowAllOrigins: true,
+		AllowMethods:    []string{"GET", "POST", "OPTIONS"},
+		AllowHeaders:    []string{"Origin", "Content-Type", "Accept", model.VisitorIDHeader},
+		MaxAge:          maxAge,
+	})
+
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, PublicPathPrefix) {
+			public(c)
+			return
+		}
+		handler(c)
+	}
 }
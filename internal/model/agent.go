@@ -1,19 +1,41 @@
 package model
 
 import (
+	"encoding/json"
 	"github.com/cloudwego/eino/schema"
 	"time"
 )
 
 // Agent
 type Agent struct {
+	ID          string `gorm:"primaryKey;type:char(36)"`
+	UserID      uint   `gorm:"index"`
+	Name        string `gorm:"not null"`
+	Description string `gorm:"type:text"`
+	Type        string `gorm:"type:varchar(32);default:'simple'"` // simple 或 workflow
+	AgentSchema string `gorm:"type:json"`                         // 草稿配置，调试页面的修改只作用于草稿
+	// PublishedVersion 当前发布的版本号，0表示尚未发布（此时会话直接使用草稿）
+	PublishedVersion int       `gorm:"default:0"`
+	CreatedAt        time.Time `gorm:"autoCreateTime"`
+	UpdatedAt        time.Time `gorm:"autoUpdateTime"`
+}
+
+const (
+	// AgentVersionDraft 使用草稿配置运行（调试模式）
+	AgentVersionDraft = -1
+	// AgentVersionLatest 跟随最新发布的版本
+	AgentVersionLatest = 0
+)
+
+// AgentVersion Agent发布后的不可变快照
+type AgentVersion struct {
 	ID          string    `gorm:"primaryKey;type:char(36)"`
+	AgentID     string    `gorm:"uniqueIndex:idx_agent_version;type:char(36)"`
 	UserID      uint      `gorm:"index"`
-	Name        string    `gorm:"not null"`
-	Description string    `gorm:"type:text"`
+	Version     int       `gorm:"uniqueIndex:idx_agent_version"`
 	AgentSchema string    `gorm:"type:json"`
+	Changelog   string    `gorm:"type:text"`
 	CreatedAt   time.Time `gorm:"autoCreateTime"`
-	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
 }
 
 // AgentSchema 配置Agent
@@ -23,18 +45,53 @@ type AgentSchema struct {
 	Tools     ToolsConfig     `json:"tools"`
 	Prompt    string          `json:"prompt"`
 	Knowledge KnowledgeConfig `json:"knowledge"`
+	// SubAgents 可作为工具调用的其他Agent
+	SubAgents SubAgentsConfig `json:"sub_agents"`
+	// Approval 工具调用的人工审批策略
+	Approval ToolApprovalConfig `json:"approval"`
+	// Memory 跨会话的用户长期记忆
+	Memory MemoryConfig `json:"memory"`
+	// Workflow 仅workflow类型的Agent使用
+	Workflow *WorkflowSchema `json:"workflow,omitempty"`
 }
 
-// TODO：后续需要优化这一块，提高全面性
-// LLMConfig 配置Agent关联的LLM模型
+// LLMConfig 配置Agent关联的LLM模型及生成参数，未设置的参数使用模型服务的默认值
 type LLMConfig struct {
-	ModelID         string  `json:"model_id"`
-	Temperature     float64 `json:"temperature"`
-	TopP            float64 `json:"top_p"`
-	MaxOutputLength int     `json:"max_output_length"`
-	Thinking        bool    `json:"thinking"`
+	ModelID     string   `json:"model_id"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	// MaxOutputLength 最大输出token数，0表示使用模型配置中的MaxOutputLength
+	MaxOutputLength  int      `json:"max_output_length"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+	// ResponseFormat 输出格式：text（默认）或 json_object
+	ResponseFormat string `json:"response_format,omitempty" binding:"omitempty,oneof=text json_object"`
+	// ReasoningEffort 推理强度：low/medium/high，仅对支持的OpenAI兼容模型生效
+	ReasoningEffort string `json:"reasoning_effort,omitempty" binding:"omitempty,oneof=low medium high"`
+	// Thinking 已不再生效：推理模型的思考内容总是与回答分开输出，仅为兼容已保存的配置保留
+	Thinking bool `json:"thinking"`
+}
+
+// UnmarshalJSON 生成参数改为可选之前，未设置的top_p保存为0，而top_p=0会使输出退化，按未设置处理。
+// temperature=0是有意的确定性输出，保持不变
+func (c *LLMConfig) UnmarshalJSON(data []byte) error {
+	type plain LLMConfig
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	if c.TopP != nil && *c.TopP == 0 {
+		c.TopP = nil
+	}
+	return nil
 }
 
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+)
+
 // MCPConfig 配置MCP SSE服务器
 type MCPConfig struct {
 	Servers []string `json:"servers"`
@@ -51,22 +108,67 @@ type KnowledgeConfig struct {
 	TopK         int      `json:"top_k"`
 }
 
+// SubAgentsConfig Agent可调用的其他Agent IDs，每个Agent以其描述作为工具描述暴露给LLM
+type SubAgentsConfig struct {
+	AgentIDs []string `json:"agent_ids"`
+}
+
+const (
+	AgentEventCall   = "agent_call"
+	AgentEventResult = "agent_result"
+)
+
+// AgentEvent 子Agent的调用事件，会随父Agent的流式响应一起下发
+type AgentEvent struct {
+	Type      string `json:"type"`
+	AgentID   string `json:"agent_id"`
+	AgentName string `json:"agent_name"`
+	Depth     int    `json:"depth"`
+	Input     string `json:"input,omitempty"`
+	Output    string `json:"output,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
 // CreateAgentRequest 创建Agent请求
 type CreateAgentRequest struct {
 	Name        string `json:"name" binding:"required"`
 	Description string `json:"description"`
+	Type        string `json:"type" binding:"omitempty,oneof=simple workflow"`
 }
 
 // UpdateAgentRequest 更新Agent请求
 type UpdateAgentRequest struct {
-	ID          string          `json:"id" binding:"required"`
-	Name        string          `json:"name"`
-	Description string          `json:"description"`
-	LLMConfig   LLMConfig       `json:"llm_config"`
-	MCP         MCPConfig       `json:"mcp"`
-	Tools       ToolsConfig     `json:"tools"`
-	Prompt      string          `json:"prompt"`
-	Knowledge   KnowledgeConfig `json:"knowledge"`
+	ID          string              `json:"id" binding:"required"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	LLMConfig   LLMConfig           `json:"llm_config"`
+	MCP         MCPConfig           `json:"mcp"`
+	Tools       ToolsConfig         `json:"tools"`
+	Prompt      string              `json:"prompt"`
+	Knowledge   KnowledgeConfig     `json:"knowledge"`
+	SubAgents   SubAgentsConfig     `json:"sub_agents"`
+	Approval    *ToolApprovalConfig `json:"approval"`
+	Memory      *MemoryConfig       `json:"memory"`
+	Workflow    *WorkflowSchema     `json:"workflow"`
+}
+
+// PublishAgentRequest 将草稿发布为新版本
+type PublishAgentRequest struct {
+	AgentID   string `json:"agent_id" binding:"required"`
+	Changelog string `json:"changelog"`
+}
+
+// RollbackAgentRequest 回滚到历史版本
+type RollbackAgentRequest struct {
+	AgentID string `json:"agent_id" binding:"required"`
+	Version int    `json:"version" binding:"required,min=1"`
+}
+
+// SchemaDiff 两个版本配置之间的差异项
+type SchemaDiff struct {
+	Path string `json:"path"`
+	From any    `json:"from"`
+	To   any    `json:"to"`
 }
 
 type PageAgentRequest struct {
@@ -77,6 +179,10 @@ type PageAgentRequest struct {
 type UserMessage struct {
 	Query   string            `json:"query" binding:"required"`
 	History []*schema.Message `json:"history"`
+	// ToolMessages 本轮用户消息之后，模型对调用方工具的调用及调用方回传的执行结果
+	ToolMessages []*schema.Message `json:"tool_messages,omitempty"`
+	// Attachments 本轮用户消息的附件：文本附加在用户消息之后，图片作为多模态内容，仅对非工作流Agent生效
+	Attachments []schema.ChatMessagePart `json:"attachments,omitempty"`
 }
 
 type ExecuteAgentRequest struct {
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLLMConfigUnmarshal(t *testing.T) {
+	tests := []struct {
+		name            string
+		raw             string
+		wantTemperature *float64
+		wantTopP        *float64
+	}{
+		{"missing keys are unset", `{"model_id":"m"}`, nil, nil},
+		{"zero temperature is kept", `{"temperature":0,"top_p":0.9}`, ptr(0.0), ptr(0.9)},
+		{"legacy zero top_p is unset", `{"temperature":0.7,"top_p":0}`, ptr(0.7), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema AgentSchema
+			if err := json.Unmarshal([]byte(`{"llm_config":`+tt.raw+`}`), &schema); err != nil {
+				t.Fatal(err)
+			}
+			cfg := schema.LLMConfig
+			if !floatPtrEqual(cfg.Temperature, tt.wantTemperature) || !floatPtrEqual(cfg.TopP, tt.wantTopP) {
+				t.Errorf("temperature = %v, top_p = %v", cfg.Temperature, cfg.TopP)
+			}
+		})
+	}
+}
+
+func ptr(v float64) *float64 {
+	return &v
+}
+
+func floatPtrEqual(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
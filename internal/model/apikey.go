@@ -0,0 +1,61 @@
+package model
+
+import "time"
+
+// APIKeyPrefix API Key明文的前缀
+const APIKeyPrefix = "sk-"
+
+// API Key的权限范围，admin包含全部权限。使用登录JWT访问时不受权限范围限制
+const (
+	ScopeFilesRead  = "files:read"
+	ScopeFilesWrite = "files:write"
+	ScopeKBQuery    = "kb:query"
+	ScopeAgentRun   = "agent:run"
+	ScopeAdmin      = "admin"
+)
+
+// LegacyAPIKeyScopes 引入权限范围之前创建的Key没有保存Scopes，这些Key当时只能调用OpenAI兼容接口
+var LegacyAPIKeyScopes = []string{ScopeAgentRun}
+
+// APIKey 用户的API Key，只保存哈希，明文仅在创建时返回一次
+type APIKey struct {
+	ID     string `gorm:"primaryKey;type:char(36)" json:"id"`
+	UserID uint   `gorm:"index" json:"user_id"`
+	Name   string `gorm:"type:varchar(255)" json:"name"`
+	// Prefix 明文的前几位，便于用户辨认
+	Prefix  string   `gorm:"type:varchar(16)" json:"prefix"`
+	KeyHash string   `gorm:"uniqueIndex;type:char(64)" json:"-"`
+	Scopes  []string `gorm:"serializer:json;type:varchar(255)" json:"scopes"`
+	// ExpiresAt 过期时间，为空表示永不过期
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// HasScope 判断是否拥有任一权限范围
+func (k *APIKey) HasScope(scopes ...string) bool {
+	for _, have := range k.Scopes {
+		if have == ScopeAdmin {
+			return true
+		}
+		for _, want := range scopes {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=255"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=files:read files:write kb:query agent:run admin"`
+	// ExpiresAt 可选的过期时间
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKeyResponse 创建结果，Key为明文，之后无法再次查看
+type CreateAPIKeyResponse struct {
+	*APIKey
+	Key string `json:"key"`
+}
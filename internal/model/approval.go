@@ -0,0 +1,116 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	// ApprovalModeAuto 无需审批，直接执行
+	ApprovalModeAuto = "auto"
+	// ApprovalModeAlways 每次调用都需要审批
+	ApprovalModeAlways = "always"
+	// ApprovalModeMatch 参数匹配任一规则时需要审批
+	ApprovalModeMatch = "match"
+)
+
+// ToolApprovalConfig Agent的工具审批策略，未配置策略的工具直接执行。
+// 工作流Agent的节点不经过审批，不能配置审批策略
+type ToolApprovalConfig struct {
+	Policies []ToolApprovalPolicy `json:"policies" binding:"dive"`
+}
+
+// ToolApprovalPolicy 单个工具的审批策略
+type ToolApprovalPolicy struct {
+	// Tool 工具名称，* 匹配所有工具；多个策略匹配时使用第一个
+	Tool  string         `json:"tool" binding:"required"`
+	Mode  string         `json:"mode" binding:"required,oneof=auto always match"`
+	Rules []ApprovalRule `json:"rules,omitempty"`
+}
+
+// ApprovalRule 参数匹配规则
+type ApprovalRule struct {
+	// Argument 参数名（仅支持顶层参数），为空时匹配完整的JSON参数
+	Argument string `json:"argument"`
+	// Pattern 正则表达式
+	Pattern string `json:"pattern" binding:"required"`
+}
+
+const (
+	AgentRunStatusRunning     = "running"
+	AgentRunStatusInterrupted = "interrupted"
+	AgentRunStatusCompleted   = "completed"
+	AgentRunStatusFailed      = "failed"
+	// AgentRunStatusCancelled 等待审批时被停止，不能再恢复
+	AgentRunStatusCancelled = "cancelled"
+)
+
+// AgentRun 一次可中断的Agent运行，中断时保存eino的checkpoint，审批后据此恢复
+type AgentRun struct {
+	ID      string `gorm:"primaryKey;type:char(36)" json:"id"`
+	UserID  uint   `gorm:"index" json:"user_id"`
+	AgentID string `gorm:"index;type:char(36)" json:"agent_id"`
+	// AgentVersion 运行时使用的版本，恢复时使用相同版本
+	AgentVersion int `json:"agent_version"`
+	// ConvID/MsgID 会话模式下关联的会话和助手回复消息
+	ConvID string `gorm:"type:varchar(255)" json:"conv_id"`
+	MsgID  string `gorm:"type:varchar(255)" json:"msg_id"`
+	// Input 运行输入（UserMessage的JSON）
+	Input string `gorm:"type:mediumtext" json:"-"`
+	// Settings 运行使用的会话设置，恢复时构建相同的Agent
+	Settings json.RawMessage `gorm:"type:json" json:"-"`
+	// ToolResults 中断时与待审批调用同一批、已执行完成的工具调用结果，key为ToolCallID。
+	// 恢复时整批工具调用重新运行，这些调用直接返回保存的结果，不会重复执行
+	ToolResults map[string]string `gorm:"serializer:json;type:mediumtext" json:"-"`
+	Checkpoint  []byte            `gorm:"type:longblob" json:"-"`
+	Status      string            `gorm:"type:varchar(16)" json:"status"`
+	CreatedAt   time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+const (
+	ApprovalStatusPending  = "pending"
+	ApprovalStatusApproved = "approved"
+	ApprovalStatusRejected = "rejected"
+	// ApprovalStatusCancelled 运行被停止，审批不再需要
+	ApprovalStatusCancelled = "cancelled"
+)
+
+// ToolApproval 一次待审批的工具调用
+type ToolApproval struct {
+	ID         string `gorm:"primaryKey;type:char(36)" json:"id"`
+	RunID      string `gorm:"index;type:char(36)" json:"run_id"`
+	UserID     uint   `gorm:"index" json:"user_id"`
+	AgentID    string `gorm:"type:char(36)" json:"agent_id"`
+	ToolCallID string `gorm:"type:varchar(255)" json:"tool_call_id"`
+	ToolName   string `gorm:"type:varchar(255)" json:"tool_name"`
+	Arguments  string `gorm:"type:text" json:"arguments"`
+	Status     string `gorm:"type:varchar(16)" json:"status"`
+	// EditedArguments 审批时修改后的参数，为空表示使用原参数
+	EditedArguments string     `gorm:"type:text" json:"edited_arguments,omitempty"`
+	Comment         string     `gorm:"type:text" json:"comment,omitempty"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	DecidedAt       *time.Time `json:"decided_at,omitempty"`
+}
+
+const (
+	ApprovalActionApprove = "approve"
+	ApprovalActionEdit    = "edit"
+	ApprovalActionReject  = "reject"
+)
+
+// ApprovalDecision 对一次工具调用的审批结果
+type ApprovalDecision struct {
+	ApprovalID string `json:"approval_id" binding:"required"`
+	Action     string `json:"action" binding:"required,oneof=approve edit reject"`
+	// Arguments action为edit时使用的新参数（JSON）
+	Arguments string `json:"arguments"`
+	Comment   string `json:"comment"`
+}
+
+// ResumeRunRequest 提交审批结果并恢复运行
+type ResumeRunRequest struct {
+	RunID string `json:"run_id" binding:"required"`
+	// Decisions 待审批调用的审批结果，需覆盖运行中全部待审批的调用
+	Decisions []ApprovalDecision `json:"decisions" binding:"dive"`
+}
@@ -0,0 +1,55 @@
+package model
+
+import "encoding/json"
+
+// 聊天附件类型，音视频附件暂不支持
+const (
+	AttachmentTypeFile  = "file"
+	AttachmentTypeImage = "image"
+	AttachmentTypeCode  = "code"
+)
+
+// AttachmentStorageCloud 附件内容保存在存储驱动中，StoragePath为存储的Key
+const AttachmentStorageCloud = "cloud"
+
+// AttachmentChunk 附件文本内容的分块，作为会话内的临时检索索引，随会话删除。
+// Content建有ngram全文索引，不依赖Embedding模型
+type AttachmentChunk struct {
+	ID       uint64 `gorm:"primaryKey;column:id"`
+	AttachID string `gorm:"index;column:attach_id;type:varchar(255)"`
+	// ConvID 附件绑定到会话后设置，检索只在同一会话内进行
+	ConvID     string `gorm:"index;column:conv_id;type:varchar(255);default:''"`
+	ChunkIndex int    `gorm:"column:chunk_index"`
+	Content    string `gorm:"column:content;type:text;index:idx_attachment_chunks_content,class:FULLTEXT,option:WITH PARSER ngram"`
+}
+
+// TableName 设置表名
+func (AttachmentChunk) TableName() string {
+	return "attachment_chunks"
+}
+
+// AttachmentRef 消息中的附件，随用户消息保存，用于在历史中展示
+type AttachmentRef struct {
+	AttachID string `json:"attach_id"`
+	Type     string `json:"type"`
+	FileName string `json:"file_name"`
+	FileSize int64  `json:"file_size"`
+	MimeType string `json:"mime_type"`
+}
+
+// DriveAttachmentRequest 将云盘中的文件添加为附件
+type DriveAttachmentRequest struct {
+	FileID string `json:"file_id" binding:"required"`
+}
+
+// Attachments 用户消息保存的附件引用，没有附件时为nil
+func (m *Message) Attachments() []*AttachmentRef {
+	if len(m.Metadata) == 0 {
+		return nil
+	}
+	var meta MessageMetadata
+	if err := json.Unmarshal(m.Metadata, &meta); err != nil {
+		return nil
+	}
+	return meta.Attachments
+}
@@ -0,0 +1,131 @@
+package model
+
+const (
+	// BundleFormat/BundleVersion Agent导出包的格式标识和版本
+	BundleFormat  = "ai-cloud.agent"
+	BundleVersion = 1
+
+	// BundleRedacted 导出时替换密钥的占位符
+	BundleRedacted = "REDACTED"
+)
+
+// 导出包中的依赖类型
+const (
+	BundleDepModel     = "model"
+	BundleDepKnowledge = "knowledge_base"
+	BundleDepAgent     = "agent"
+	BundleDepMCP       = "mcp_server"
+	// BundleDepSecret 导出时被替换的HTTP节点和工具节点中的密钥
+	BundleDepSecret   = "secret"
+	BundleDepDocument = "document"
+)
+
+// AgentBundle 可在不同环境之间迁移的Agent导出包。
+// Schema保留导出环境中的ID，导入时根据Models、KnowledgeBases和SubAgents中的描述重新映射
+type AgentBundle struct {
+	Format      string      `json:"format"`
+	Version     int         `json:"version"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Type        string      `json:"type"`
+	Schema      AgentSchema `json:"schema"`
+	// Models Schema和知识库引用的模型，不包含BaseURL和APIKey
+	Models         []*BundleModel         `json:"models,omitempty"`
+	KnowledgeBases []*BundleKnowledgeBase `json:"knowledge_bases,omitempty"`
+	// SubAgents 引用的其他Agent，只记录名称，导入时按名称关联
+	SubAgents  []*BundleAgent `json:"sub_agents,omitempty"`
+	ExportedAt int64          `json:"exported_at,omitempty"`
+}
+
+// BundleModel 导出包中的模型，导入时按服务类型和模型名称匹配
+type BundleModel struct {
+	// Ref 导出环境中的模型ID
+	Ref       string `json:"ref"`
+	Type      string `json:"type"`
+	ShowName  string `json:"show_name,omitempty"`
+	Server    string `json:"server"`
+	ModelName string `json:"model_name"`
+	Dimension int    `json:"dimension,omitempty"`
+	Function  bool   `json:"function,omitempty"`
+	Vision    bool   `json:"vision,omitempty"`
+	Reasoning bool   `json:"reasoning,omitempty"`
+}
+
+// BundleKnowledgeBase 导出包中的知识库，导入时关联同名知识库，不存在时创建
+type BundleKnowledgeBase struct {
+	Ref         string `json:"ref"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// EmbedModel 知识库使用的Embedding模型，对应Models中的Ref
+	EmbedModel string `json:"embed_model"`
+	// Documents 导出时选择包含知识库内容才有
+	Documents []*BundleDocument `json:"documents,omitempty"`
+}
+
+// BundleDocument 知识库文档的原始文件
+type BundleDocument struct {
+	Title   string `json:"title"`
+	Content []byte `json:"content"`
+}
+
+// BundleAgent 导出包引用的其他Agent
+type BundleAgent struct {
+	Ref  string `json:"ref"`
+	Name string `json:"name"`
+}
+
+// BundleDependency 导入时一个依赖的处理结果
+type BundleDependency struct {
+	Kind string `json:"kind"`
+	// Ref 导出包中的ID，MCP服务器和密钥为脱敏后的地址
+	Ref  string `json:"ref"`
+	Name string `json:"name,omitempty"`
+	// Path 依赖在Agent配置中的位置
+	Path string `json:"path"`
+	// TargetID 映射到的本地ID，未解决时为空
+	TargetID string `json:"target_id,omitempty"`
+	// Action matched/default/linked/created，未解决时为空
+	Action string `json:"action,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ExportAgentRequest 导出Agent
+type ExportAgentRequest struct {
+	AgentID string `form:"agent_id" binding:"required"`
+	// Version 0为最新发布的版本（从未发布时为草稿），-1为草稿
+	Version          int    `form:"version"`
+	Format           string `form:"format,default=json" binding:"oneof=json yaml"`
+	IncludeKnowledge bool   `form:"include_knowledge"`
+}
+
+// ImportAgentOptions 导入Agent的选项，未能匹配的模型使用指定的默认模型
+type ImportAgentOptions struct {
+	// Name 覆盖导出包中的名称，与已有Agent重名时自动添加序号
+	Name                string `json:"name" form:"name"`
+	DefaultModelID      string `json:"default_model_id" form:"default_model_id"`
+	DefaultEmbedModelID string `json:"default_embed_model_id" form:"default_embed_model_id"`
+}
+
+// InstantiateTemplateRequest 从内置模板创建Agent
+type InstantiateTemplateRequest struct {
+	TemplateID string `json:"template_id" binding:"required"`
+	ImportAgentOptions
+}
+
+// AgentTemplate 内置的Agent模板
+type AgentTemplate struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	// Dependencies 模板需要的模型和知识库
+	Dependencies []string `json:"dependencies"`
+}
+
+// ImportAgentResult 导入结果，Unresolved中的引用已从配置中移除，或在工作流节点中保留原值，需要手动修改
+type ImportAgentResult struct {
+	AgentID    string              `json:"agent_id"`
+	Name       string              `json:"name"`
+	Resolved   []*BundleDependency `json:"resolved"`
+	Unresolved []*BundleDependency `json:"unresolved"`
+}
@@ -11,16 +11,30 @@ import "encoding/json"
 
 // Conversation 对话表
 type Conversation struct {
-	ID         uint64          `gorm:"primaryKey;column:id"`
-	ConvID     string          `gorm:"uniqueIndex;column:conv_id;type:varchar(255)"`
-	UserID     uint            `gorm:"index;column:user_id"`
-	AgentID    string          `gorm:"index;column:agent_id;type:varchar(255)"`
-	Title      string          `gorm:"column:title;type:varchar(255)"`
-	CreatedAt  int64           `gorm:"column:created_at"`
-	UpdatedAt  int64           `gorm:"column:updated_at"`
+	ID      uint64 `gorm:"primaryKey;column:id"`
+	ConvID  string `gorm:"uniqueIndex;column:conv_id;type:varchar(255)"`
+	UserID  uint   `gorm:"index;column:user_id"`
+	AgentID string `gorm:"index;column:agent_id;type:varchar(255)"`
+	// AgentVersion 会话固定使用的Agent版本，0表示跟随最新发布版本
+	AgentVersion int `gorm:"column:agent_version;default:0"`
+	// Title 建有ngram全文索引，供会话检索按标题匹配
+	Title string `gorm:"column:title;type:varchar(255);index:idx_conversations_title,class:FULLTEXT,option:WITH PARSER ngram"`
+	// TitleManual 标题由用户手动设置，不再自动生成
+	TitleManual bool  `gorm:"column:title_manual;default:0"`
+	CreatedAt   int64 `gorm:"column:created_at"`
+	UpdatedAt   int64 `gorm:"column:updated_at"`
+	// Settings 覆盖Agent默认配置的会话设置，见 ConversationSettings
 	Settings   json.RawMessage `gorm:"column:settings;type:json"`
 	IsArchived bool            `gorm:"column:is_archived;default:0"`
 	IsPinned   bool            `gorm:"column:is_pinned;default:0"`
+	// CurrentMsgID 当前分支末端的消息，历史沿该消息向上追溯。为空时使用最后保存的消息
+	CurrentMsgID string `gorm:"column:current_msg_id;type:varchar(255);default:''"`
+	// Summary 超出上下文窗口的早期消息的滚动摘要，覆盖到ID为SummaryMsgID（含）的消息
+	Summary      string `gorm:"column:summary;type:text"`
+	SummaryMsgID uint64 `gorm:"column:summary_msg_id;default:0"`
+	// ShareID/VisitorID 通过公开分享链接产生的访客会话，普通会话为空
+	ShareID   string `gorm:"index;column:share_id;type:varchar(36);default:''"`
+	VisitorID string `gorm:"index;column:visitor_id;type:varchar(64);default:''"`
 }
 
 // TableName 设置表名
@@ -30,22 +44,37 @@ func (Conversation) TableName() string {
 
 // Message 消息表
 type Message struct {
-	ID            uint64          `gorm:"primaryKey;column:id"`
-	MsgID         string          `gorm:"uniqueIndex;column:msg_id;type:varchar(255)"`
-	UserID        uint            `gorm:"index;column:user_id"`
-	ConvID        string          `gorm:"column:conv_id;type:varchar(255)"`
-	ParentID      string          `gorm:"column:parent_id;type:varchar(255);default:''"`
-	Role          string          `gorm:"column:role;type:enum('user','assistant','system','function')"`
-	Content       string          `gorm:"column:content;type:text"`
-	CreatedAt     int64           `gorm:"column:created_at"`
-	OrderSeq      int             `gorm:"column:order_seq;default:0"`
-	TokenCount    int             `gorm:"column:token_count;default:0"`
-	Status        string          `gorm:"column:status;type:enum('sent','pending','error');default:'sent'"`
-	Metadata      json.RawMessage `gorm:"column:metadata;type:json"`
-	IsContextEdge bool            `gorm:"column:is_context_edge;default:0"`
-	IsVariant     bool            `gorm:"column:is_variant;default:0"`
+	ID     uint64 `gorm:"primaryKey;column:id"`
+	MsgID  string `gorm:"uniqueIndex;column:msg_id;type:varchar(255)"`
+	UserID uint   `gorm:"index;column:user_id"`
+	ConvID string `gorm:"column:conv_id;type:varchar(255)"`
+	// ParentID 消息树中的父消息，重新生成的回复与原回复、编辑后的用户消息与原消息互为兄弟节点
+	ParentID string `gorm:"column:parent_id;type:varchar(255);default:''"`
+	Role     string `gorm:"column:role;type:enum('user','assistant','system','function')"`
+	// Content 建有ngram全文索引，支持中文检索
+	Content string `gorm:"column:content;type:text;index:idx_messages_content,class:FULLTEXT,option:WITH PARSER ngram"`
+	// ReasoningContent 模型的思考过程，与回答分开保存，不会作为历史消息发送给模型
+	ReasoningContent string `gorm:"column:reasoning_content;type:text"`
+	CreatedAt        int64  `gorm:"column:created_at"`
+	OrderSeq         int    `gorm:"column:order_seq;default:0"`
+	// TokenCount 消息占用的token数，保存时计算
+	TokenCount int `gorm:"column:token_count;default:0"`
+	// Status 助手回复生成期间为pending，结束后为sent、error或stopped（被用户停止，保留已生成的部分）
+	Status   string          `gorm:"column:status;type:enum('sent','pending','error','stopped');default:'sent'"`
+	Metadata json.RawMessage `gorm:"column:metadata;type:json"`
+	// IsContextEdge 清除上下文的标记，该消息及之前的消息不再作为历史发送给模型
+	IsContextEdge bool `gorm:"column:is_context_edge;default:0"`
+	// IsVariant 由重新生成或编辑产生的消息
+	IsVariant bool `gorm:"column:is_variant;default:0"`
 }
 
+const (
+	MessageStatusSent    = "sent"
+	MessageStatusPending = "pending"
+	MessageStatusError   = "error"
+	MessageStatusStopped = "stopped"
+)
+
 // TableName 设置表名
 func (Message) TableName() string {
 	return "messages"
@@ -53,20 +82,26 @@ func (Message) TableName() string {
 
 // Attachment 附件表
 type Attachment struct {
-	ID             uint64 `gorm:"primaryKey;column:id"`
-	AttachID       string `gorm:"uniqueIndex;column:attach_id;type:varchar(255)"`
-	UserID         uint   `gorm:"index;column:user_id"`
-	MessageID      string `gorm:"column:message_id;type:varchar(255)"`
+	ID       uint64 `gorm:"primaryKey;column:id"`
+	AttachID string `gorm:"uniqueIndex;column:attach_id;type:varchar(255)"`
+	UserID   uint   `gorm:"index;column:user_id"`
+	// ConvID/MessageID 附件首次随消息发送时绑定的会话和用户消息，上传后尚未发送时为空
+	ConvID    string `gorm:"index;column:conv_id;type:varchar(255);default:''"`
+	MessageID string `gorm:"column:message_id;type:varchar(255)"`
+	// FileID 从云盘添加的附件对应的云盘文件，附件保存的是添加时的副本
+	FileID         string `gorm:"column:file_id;type:char(36);default:''"`
 	AttachmentType string `gorm:"column:attachment_type;type:enum('file','image','code','audio','video')"`
 	FileName       string `gorm:"column:file_name;type:varchar(255)"`
 	FileSize       int64  `gorm:"column:file_size"`
 	StorageType    string `gorm:"column:storage_type;type:enum('path','blob','cloud')"`
 	StoragePath    string `gorm:"column:storage_path;type:varchar(1024)"`
 	Thumbnail      []byte `gorm:"column:thumbnail;type:mediumblob"`
-	Vectorized     bool   `gorm:"column:vectorized;default:0"`
-	DataSummary    string `gorm:"column:data_summary;type:text"`
-	MimeType       string `gorm:"column:mime_type;type:varchar(255)"`
-	CreatedAt      int64  `gorm:"column:created_at"`
+	// Vectorized 文本内容已分块写入会话的附件索引，见 AttachmentChunk
+	Vectorized bool `gorm:"column:vectorized;default:0"`
+	// DataSummary 文本内容的开头部分
+	DataSummary string `gorm:"column:data_summary;type:text"`
+	MimeType    string `gorm:"column:mime_type;type:varchar(255)"`
+	CreatedAt   int64  `gorm:"column:created_at"`
 }
 
 // TableName 设置表名
@@ -74,6 +109,17 @@ func (Attachment) TableName() string {
 	return "attachments"
 }
 
+// Ref 附件在消息中的引用
+func (a *Attachment) Ref() *AttachmentRef {
+	return &AttachmentRef{
+		AttachID: a.AttachID,
+		Type:     a.AttachmentType,
+		FileName: a.FileName,
+		FileSize: a.FileSize,
+		MimeType: a.MimeType,
+	}
+}
+
 // MessageAttachment 消息附件关联表
 type MessageAttachment struct {
 	ID           uint64 `gorm:"primaryKey;column:id"`
@@ -94,7 +140,8 @@ type DebugRequest struct {
 
 // CreateConvRequest 创建会话请求
 type CreateConvRequest struct {
-	AgentID string `json:"agent_id" binding:"required"`
+	AgentID    string `json:"agent_id" binding:"required"`
+	PinVersion bool   `json:"pin_version"` // 固定使用当前发布的版本
 }
 
 // ConvRequest 对话请求
@@ -102,4 +149,139 @@ type ConvRequest struct {
 	AgentID string `json:"agent_id" binding:"required"`
 	Message string `json:"message" binding:"required"`
 	ConvID  string `json:"conv_id"`
+	// PinVersion 仅在ConvID为空、自动创建会话时生效
+	PinVersion bool `json:"pin_version"`
+	// AttachmentIDs 随消息发送的附件，通过 /chat/attachments 上传或从云盘添加
+	AttachmentIDs []string `json:"attachment_ids" binding:"max=10"`
+}
+
+// AttachReplyRequest 重新连接到进行中或刚结束的回复生成，AfterSeq为已收到的最后一个事件序号，从其后开始回放
+type AttachReplyRequest struct {
+	MsgID    string `form:"msg_id" binding:"required"`
+	AfterSeq int    `form:"after_seq"`
+}
+
+// StopReplyRequest 停止进行中的回复生成
+type StopReplyRequest struct {
+	ConvID string `json:"conv_id" binding:"required"`
+	MsgID  string `json:"msg_id" binding:"required"`
+}
+
+// ReplyStop 停止回复生成的请求。配置了共享协调后端时，运行所在的实例轮询读取并停止本地的运行
+type ReplyStop struct {
+	ID        uint64 `gorm:"primaryKey;column:id"`
+	MsgID     string `gorm:"uniqueIndex;column:msg_id;type:varchar(255)"`
+	CreatedAt int64  `gorm:"index;column:created_at"`
+}
+
+// RenameConvRequest 手动设置会话标题
+type RenameConvRequest struct {
+	ConvID string `json:"conv_id" binding:"required"`
+	Title  string `json:"title" binding:"required,max=255"`
+}
+
+// RegenerateRequest 重新生成助手回复，新回复与原回复互为兄弟节点
+type RegenerateRequest struct {
+	ConvID string `json:"conv_id" binding:"required"`
+	MsgID  string `json:"msg_id" binding:"required"`
+}
+
+// EditMessageRequest 编辑用户消息并重新发送，产生新的分支
+type EditMessageRequest struct {
+	ConvID  string `json:"conv_id" binding:"required"`
+	MsgID   string `json:"msg_id" binding:"required"`
+	Message string `json:"message" binding:"required"`
+}
+
+// SwitchBranchRequest 切换到包含该消息的分支，分支末端为该消息最新的后代
+type SwitchBranchRequest struct {
+	ConvID string `json:"conv_id" binding:"required"`
+	MsgID  string `json:"msg_id" binding:"required"`
+}
+
+// MessageNode 消息树中的一个节点
+type MessageNode struct {
+	MsgID    string `json:"msg_id"`
+	ParentID string `json:"parent_id"`
+	Role     string `json:"role"`
+	Content  string `json:"content"`
+	// Status 为pending的回复仍在生成，可通过 /chat/attach 重新连接
+	Status        string   `json:"status"`
+	IsVariant     bool     `json:"is_variant"`
+	IsContextEdge bool     `json:"is_context_edge"`
+	CreatedAt     int64    `json:"created_at"`
+	Children      []string `json:"children"`
+	// Attachments 用户消息的附件
+	Attachments []*AttachmentRef `json:"attachments,omitempty"`
+}
+
+// MessageTree 会话的消息树，Nodes按保存顺序排列
+type MessageTree struct {
+	ConvID string `json:"conv_id"`
+	// CurrentMsgID 当前分支的末端，ActivePath为从根到末端的消息ID
+	CurrentMsgID string         `json:"current_msg_id"`
+	ActivePath   []string       `json:"active_path"`
+	Nodes        []*MessageNode `json:"nodes"`
+}
+
+// ConversationSettings 会话级设置，覆盖Agent的默认配置，仅对非工作流Agent生效。未设置的字段使用Agent配置
+type ConversationSettings struct {
+	ModelID     string   `json:"model_id,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty" binding:"omitempty,min=0,max=2"`
+	// KnowledgeIDs 启用的知识库，只能从Agent关联的知识库中选择，空数组表示不检索知识库
+	KnowledgeIDs *[]string `json:"knowledge_ids,omitempty"`
+	TopK         *int      `json:"top_k,omitempty" binding:"omitempty,min=1,max=50"`
+	// Tools 启用的工具名称（MCP工具和子Agent），空数组表示不使用工具
+	Tools *[]string `json:"tools,omitempty"`
+	// PromptAddendum 追加在Agent系统提示词之后的内容
+	PromptAddendum string `json:"prompt_addendum,omitempty"`
+}
+
+// Apply 将会话设置合并到Agent配置。知识库取与Agent关联知识库的交集，工具在构建Agent时按名称过滤
+func (s *ConversationSettings) Apply(agentSchema *AgentSchema) {
+	if s == nil {
+		return
+	}
+	if s.ModelID != "" {
+		agentSchema.LLMConfig.ModelID = s.ModelID
+	}
+	if s.Temperature != nil {
+		agentSchema.LLMConfig.Temperature = s.Temperature
+	}
+	if s.KnowledgeIDs != nil {
+		enabled := make(map[string]bool, len(*s.KnowledgeIDs))
+		for _, id := range *s.KnowledgeIDs {
+			enabled[id] = true
+		}
+		ids := make([]string, 0, len(*s.KnowledgeIDs))
+		for _, id := range agentSchema.Knowledge.KnowledgeIDs {
+			if enabled[id] {
+				ids = append(ids, id)
+			}
+		}
+		agentSchema.Knowledge.KnowledgeIDs = ids
+	}
+	if s.TopK != nil {
+		agentSchema.Knowledge.TopK = *s.TopK
+	}
+	if s.PromptAddendum != "" {
+		agentSchema.Prompt += "\n\n" + s.PromptAddendum
+	}
+}
+
+// ConvSettingsRequest 更新会话设置，Settings整体替换原有设置，为空时恢复Agent的默认配置
+type ConvSettingsRequest struct {
+	ConvID   string                `json:"conv_id" binding:"required"`
+	Settings *ConversationSettings `json:"settings"`
+}
+
+// ConvSettingsQuery 获取会话设置
+type ConvSettingsQuery struct {
+	ConvID string `form:"conv_id" binding:"required"`
+}
+
+// ConvSettingsResponse 会话设置及与Agent配置合并后的生效值
+type ConvSettingsResponse struct {
+	Settings  *ConversationSettings `json:"settings"`
+	Effective *ConversationSettings `json:"effective"`
 }
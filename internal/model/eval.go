@@ -0,0 +1,137 @@
+package model
+
+import "time"
+
+// 评测的评分方式
+const (
+	// EvalScorerExact 输出与参考答案相同（忽略首尾空白和连续空白的差异）
+	EvalScorerExact = "exact"
+	// EvalScorerRegex 输出匹配用例的正则表达式
+	EvalScorerRegex = "regex"
+	// EvalScorerEmbedding 输出与参考答案向量的余弦相似度
+	EvalScorerEmbedding = "embedding"
+	// EvalScorerJudge 由评审模型按评分标准打分
+	EvalScorerJudge = "judge"
+)
+
+// 评测运行的状态
+const (
+	EvalRunRunning   = "running"
+	EvalRunCompleted = "completed"
+	EvalRunFailed    = "failed"
+)
+
+// 用例的胜出方
+const (
+	EvalWinnerA   = "a"
+	EvalWinnerB   = "b"
+	EvalWinnerTie = "tie"
+)
+
+// EvalCase 评测集中的一条用例，Reference和Pattern可选，缺少时跳过依赖它们的评分
+type EvalCase struct {
+	Input     string `json:"input" binding:"required"`
+	Reference string `json:"reference"`
+	Pattern   string `json:"pattern"`
+}
+
+// EvalVariant 参与对比的一个Agent配置：Agent的某个版本，可覆盖生成参数
+type EvalVariant struct {
+	AgentID string `json:"agent_id" binding:"required"`
+	// Version 0为最新发布的版本（从未发布时为草稿），-1为草稿
+	Version     int      `json:"version"`
+	Temperature *float64 `json:"temperature"`
+	TopP        *float64 `json:"top_p"`
+	MaxTokens   int      `json:"max_tokens" binding:"min=0"`
+}
+
+// EvalScoreStats 一种评分方式的汇总
+type EvalScoreStats struct {
+	// Cases 两个配置都有该项得分的用例数
+	Cases int     `json:"cases"`
+	MeanA float64 `json:"mean_a"`
+	MeanB float64 `json:"mean_b"`
+	WinsA int     `json:"wins_a"`
+	WinsB int     `json:"wins_b"`
+	Ties  int     `json:"ties"`
+}
+
+// EvalSummary 评测的汇总结果，胜率以全部用例数为分母
+type EvalSummary struct {
+	WinsA    int                        `json:"wins_a"`
+	WinsB    int                        `json:"wins_b"`
+	Ties     int                        `json:"ties"`
+	WinRateA float64                    `json:"win_rate_a"`
+	WinRateB float64                    `json:"win_rate_b"`
+	ErrorsA  int                        `json:"errors_a"`
+	ErrorsB  int                        `json:"errors_b"`
+	Scorers  map[string]*EvalScoreStats `json:"scorers"`
+}
+
+// EvalRun 一次A/B评测：同一评测集分别在两个Agent配置上运行并评分
+type EvalRun struct {
+	ID       string       `gorm:"primaryKey;type:char(36)" json:"id"`
+	UserID   uint         `gorm:"index" json:"user_id"`
+	Name     string       `gorm:"type:varchar(255)" json:"name"`
+	VariantA *EvalVariant `gorm:"serializer:json;type:text" json:"variant_a"`
+	VariantB *EvalVariant `gorm:"serializer:json;type:text" json:"variant_b"`
+	Scorers  []string     `gorm:"serializer:json;type:text" json:"scorers"`
+	// EmbedModelID/JudgeModelID 相似度评分使用的Embedding模型和评审模型
+	EmbedModelID string       `gorm:"type:varchar(255)" json:"embed_model_id"`
+	JudgeModelID string       `gorm:"type:varchar(255)" json:"judge_model_id"`
+	Rubric       string       `gorm:"type:text" json:"rubric"`
+	Concurrency  int          `json:"concurrency"`
+	Status       string       `gorm:"index;type:varchar(16)" json:"status"`
+	Total        int          `json:"total"`
+	Completed    int          `json:"completed"`
+	Summary      *EvalSummary `gorm:"serializer:json;type:text" json:"summary"`
+	Error        string       `gorm:"type:text" json:"error"`
+	CreatedAt    time.Time    `gorm:"autoCreateTime" json:"created_at"`
+	FinishedAt   *time.Time   `json:"finished_at"`
+}
+
+// EvalResult 一条用例在两个配置上的输出和得分
+type EvalResult struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+	RunID     string `gorm:"index:idx_eval_result_run;type:char(36)" json:"run_id"`
+	CaseIndex int    `gorm:"index:idx_eval_result_run" json:"case_index"`
+	Input     string `gorm:"type:text" json:"input"`
+	Reference string `gorm:"type:text" json:"reference"`
+	Pattern   string `gorm:"type:varchar(1024)" json:"pattern"`
+	OutputA   string `gorm:"type:mediumtext" json:"output_a"`
+	OutputB   string `gorm:"type:mediumtext" json:"output_b"`
+	ErrorA    string `gorm:"type:text" json:"error_a"`
+	ErrorB    string `gorm:"type:text" json:"error_b"`
+	// ScoresA/ScoresB 各评分方式的得分（0-1），缺少参考答案等原因跳过的评分不出现
+	ScoresA map[string]float64 `gorm:"serializer:json;type:text" json:"scores_a"`
+	ScoresB map[string]float64 `gorm:"serializer:json;type:text" json:"scores_b"`
+	// JudgeA/JudgeB 评审模型给出的理由
+	JudgeA string `gorm:"type:text" json:"judge_a"`
+	JudgeB string `gorm:"type:text" json:"judge_b"`
+	// Winner 按平均得分比较，出错的一方判负
+	Winner string `gorm:"type:varchar(8)" json:"winner"`
+	// Diff 两个输出的对比，查询时生成
+	Diff []*TextDiff `gorm:"-" json:"diff,omitempty"`
+}
+
+// TextDiff 文本对比的一段，Op为equal/delete/insert，delete只出现在A中，insert只出现在B中
+type TextDiff struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// CreateEvalRunRequest 创建评测
+type CreateEvalRunRequest struct {
+	Name     string       `json:"name" binding:"max=255"`
+	VariantA *EvalVariant `json:"variant_a" binding:"required"`
+	VariantB *EvalVariant `json:"variant_b" binding:"required"`
+	Cases    []*EvalCase  `json:"cases" binding:"required,min=1,max=500,dive"`
+	// Scorers 为空时使用exact和regex
+	Scorers      []string `json:"scorers" binding:"dive,oneof=exact regex embedding judge"`
+	EmbedModelID string   `json:"embed_model_id"`
+	JudgeModelID string   `json:"judge_model_id"`
+	// Rubric 评审模型的评分标准，为空时使用默认标准
+	Rubric string `json:"rubric"`
+	// Concurrency 同时运行的用例数，默认4
+	Concurrency int `json:"concurrency" binding:"min=0,max=16"`
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"ai-cloud/pkgs/stream"
+	"time"
+)
+
+const (
+	FeedbackUp   = "up"
+	FeedbackDown = "down"
+)
+
+// 差评原因分类
+const (
+	FeedbackReasonInaccurate = "inaccurate"     // 内容错误
+	FeedbackReasonIrrelevant = "irrelevant"     // 答非所问
+	FeedbackReasonIncomplete = "incomplete"     // 回答不完整
+	FeedbackReasonRetrieval  = "retrieval_miss" // 没有检索到相关资料或引用有误
+	FeedbackReasonFormat     = "format"         // 格式或语言问题
+	FeedbackReasonUnsafe     = "unsafe"         // 有害或不当内容
+	FeedbackReasonOther      = "other"
+)
+
+// MessageFeedback 用户对一条助手回复的评价，每个用户对每条回复只保留最新的一次
+type MessageFeedback struct {
+	ID     uint64 `gorm:"primaryKey" json:"id"`
+	MsgID  string `gorm:"uniqueIndex:idx_feedback_msg_user;type:varchar(255)" json:"msg_id"`
+	UserID uint   `gorm:"uniqueIndex:idx_feedback_msg_user;index" json:"user_id"`
+	ConvID string `gorm:"index;type:varchar(255)" json:"conv_id"`
+	// AgentID/TraceID 回复所属的Agent和生成回复的运行记录，用于统计和回溯检索结果
+	AgentID string   `gorm:"index:idx_feedback_agent_time;type:char(36)" json:"agent_id"`
+	TraceID string   `gorm:"type:char(36)" json:"trace_id"`
+	Rating  string   `gorm:"type:enum('up','down')" json:"rating"`
+	Reasons []string `gorm:"serializer:json;type:varchar(255)" json:"reasons"`
+	Comment string   `gorm:"type:text" json:"comment"`
+	// CreatedAt 最近一次提交的时间
+	CreatedAt time.Time `gorm:"index:idx_feedback_agent_time" json:"created_at"`
+}
+
+// FeedbackRequest 提交评价，重复提交时覆盖之前的评价
+type FeedbackRequest struct {
+	ConvID  string   `json:"conv_id" binding:"required"`
+	MsgID   string   `json:"msg_id" binding:"required"`
+	Rating  string   `json:"rating" binding:"required,oneof=up down"`
+	Reasons []string `json:"reasons" binding:"omitempty,max=7,dive,oneof=inaccurate irrelevant incomplete retrieval_miss format unsafe other"`
+	Comment string   `json:"comment" binding:"max=2000"`
+}
+
+// FeedbackQuery 统计和导出的过滤条件，Start/End为Unix时间戳（秒）
+type FeedbackQuery struct {
+	AgentID string `form:"agent_id"`
+	Start   int64  `form:"start"`
+	End     int64  `form:"end"`
+	// Rating 只导出好评或差评，为空时导出全部
+	Rating string `form:"rating" binding:"omitempty,oneof=up down"`
+	// Interval 满意度趋势的统计周期
+	Interval string `form:"interval,default=day" binding:"oneof=day week month"`
+	// Limit 评价最差的会话数或导出的样本数
+	Limit int `form:"limit,default=10" binding:"min=1,max=1000"`
+}
+
+// FeedbackTrend 一个统计周期内的评价数和满意度（好评占比）
+type FeedbackTrend struct {
+	Period       string  `json:"period"`
+	Up           int64   `json:"up"`
+	Down         int64   `json:"down"`
+	Satisfaction float64 `json:"satisfaction"`
+}
+
+// FeedbackStats Agent的满意度统计
+type FeedbackStats struct {
+	Up           int64            `json:"up"`
+	Down         int64            `json:"down"`
+	Satisfaction float64          `json:"satisfaction"`
+	Trend        []*FeedbackTrend `json:"trend"`
+}
+
+// ConvFeedback 会话收到的评价数，用于找出评价最差的会话
+type ConvFeedback struct {
+	ConvID  string `json:"conv_id"`
+	Title   string `json:"title"`
+	AgentID string `json:"agent_id"`
+	Up      int64  `json:"up"`
+	Down    int64  `json:"down"`
+}
+
+// ReasonCount 差评原因的出现次数
+type ReasonCount struct {
+	Reason string `json:"reason"`
+	Count  int64  `json:"count"`
+}
+
+// FeedbackSample 导出的评测样本：一条被评价的回复、对应的用户问题和生成回复时检索到的分块
+type FeedbackSample struct {
+	FeedbackID uint64              `json:"feedback_id"`
+	AgentID    string              `json:"agent_id"`
+	ConvID     string              `json:"conv_id"`
+	MsgID      string              `json:"msg_id"`
+	TraceID    string              `json:"trace_id,omitempty"`
+	Query      string              `json:"query"`
+	Answer     string              `json:"answer"`
+	Rating     string              `json:"rating"`
+	Reasons    []string            `json:"reasons"`
+	Comment    string              `json:"comment,omitempty"`
+	Chunks     []*stream.Reference `json:"chunks"`
+	CreatedAt  int64               `json:"created_at"`
+}
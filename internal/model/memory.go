@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// DefaultMemoryTopK 每次对话注入提示词的记忆条数
+const DefaultMemoryTopK = 5
+
+// MemoryConfig Agent的长期记忆配置。开启后每轮对话结束时由LLM从对话中提取关于用户的事实，
+// 并在之后的会话中检索相关记忆注入提示词。记忆按用户和Agent隔离，访客会话不使用记忆
+type MemoryConfig struct {
+	Enabled bool `json:"enabled"`
+	// EmbedModelID 记忆向量化使用的Embedding模型，开启记忆时必填
+	EmbedModelID string `json:"embed_model_id"`
+	TopK         int    `json:"top_k"`
+}
+
+// Memory 用户的一条长期记忆，向量保存在Embedding模型对应的Milvus集合中
+type Memory struct {
+	ID      string `gorm:"primaryKey;type:char(36)" json:"id"`
+	UserID  uint   `gorm:"index" json:"user_id"`
+	AgentID string `gorm:"index;type:char(36)" json:"agent_id"`
+	Content string `gorm:"type:text" json:"content"`
+	// EmbedModelID 生成向量时使用的Embedding模型，修改或删除记忆时据此找到向量所在集合
+	EmbedModelID string `gorm:"type:varchar(255)" json:"embed_model_id"`
+	// SourceConvID 提取出该记忆的会话
+	SourceConvID string    `gorm:"type:varchar(255)" json:"source_conv_id"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// UpdateMemoryRequest 修改记忆内容
+type UpdateMemoryRequest struct {
+	ID      string `json:"id" binding:"required"`
+	Content string `json:"content" binding:"required,max=2000"`
+}
+
+// MemoryUpdate 记忆提取的结果：新增、修改和删除的记忆
+type MemoryUpdate struct {
+	Add    []string `json:"add"`
+	Update []struct {
+		ID      string `json:"id"`
+		Content string `json:"content"`
+	} `json:"update"`
+	Delete []string `json:"delete"`
+}
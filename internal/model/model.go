@@ -19,9 +19,12 @@ type Model struct {
 	// LLM模型字段
 	MaxOutputLength int  `gorm:"default:4096"`
 	Function        bool `gorm:"default:false"`
+	Vision          bool `gorm:"default:false"` // 是否支持图片输入
+	Reasoning       bool `gorm:"default:false"` // 是否为推理模型，输出中 <think> 标签内的内容作为思考内容单独输出
+	ContextWindow   int  // 上下文窗口长度（输入与输出的token总数），0表示使用默认值
 
 	// 通用字段
-	MaxTokens int       `gorm:"default:1024"` // 限制最大的输入长度
+	MaxTokens int       `gorm:"default:1024"` // 旧的长度限制字段，上下文长度使用ContextWindow
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 }
@@ -41,6 +44,9 @@ type CreateModelRequest struct {
 	// LLM
 	MaxOutputLength int  `json:"max_output_length"`
 	Function        bool `json:"function"`
+	Vision          bool `json:"vision"`
+	Reasoning       bool `json:"reasoning"`
+	ContextWindow   int  `json:"context_window" binding:"min=0"`
 
 	// 通用字段
 	MaxTokens int `json:"max_tokens"`
@@ -67,6 +73,9 @@ type UpdateModelRequest struct {
 	// LLM
 	MaxOutputLength int  `json:"max_output_length"`
 	Function        bool `json:"function"`
+	Vision          bool `json:"vision"`
+	Reasoning       bool `json:"reasoning"`
+	ContextWindow   int  `json:"context_window" binding:"min=0"`
 
 	// 通用字段
 	MaxTokens int `json:"max_tokens"`
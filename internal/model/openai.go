@@ -0,0 +1,147 @@
+package model
+
+import (
+	"ai-cloud/pkgs/stream"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// OpenAI 兼容接口（/v1/chat/completions、/v1/models）的请求和响应，model 为Agent的ID或名称
+
+type ChatCompletionRequest struct {
+	Model         string                  `json:"model" binding:"required"`
+	Messages      []ChatCompletionMessage `json:"messages" binding:"required,min=1"`
+	Stream        bool                    `json:"stream"`
+	StreamOptions *StreamOptions          `json:"stream_options,omitempty"`
+	Temperature   *float64                `json:"temperature,omitempty"`
+	TopP          *float64                `json:"top_p,omitempty"`
+	MaxTokens     int                     `json:"max_tokens,omitempty"`
+	// MaxCompletionTokens 新版SDK使用的max_tokens
+	MaxCompletionTokens int `json:"max_completion_tokens,omitempty"`
+	// Tools 由调用方执行的工具，模型调用时回复以 finish_reason=tool_calls 结束
+	Tools []ChatCompletionTool `json:"tools,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type ChatCompletionMessage struct {
+	Role string `json:"role,omitempty"`
+	// Content 请求中可以是字符串或内容片段数组，响应中为字符串，仅有工具调用时为null
+	Content          *MessageContent          `json:"content"`
+	ReasoningContent string                   `json:"reasoning_content,omitempty"`
+	Name             string                   `json:"name,omitempty"`
+	ToolCalls        []ChatCompletionToolCall `json:"tool_calls,omitempty"`
+	ToolCallID       string                   `json:"tool_call_id,omitempty"`
+}
+
+// MessageContent 消息内容，反序列化时将文本片段数组合并为字符串
+type MessageContent string
+
+func (c *MessageContent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = MessageContent(text)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return errors.New("content must be a string or an array of content parts")
+	}
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	*c = MessageContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+func (c *MessageContent) String() string {
+	if c == nil {
+		return ""
+	}
+	return string(*c)
+}
+
+type ChatCompletionTool struct {
+	Type     string                 `json:"type"`
+	Function ChatCompletionFunction `json:"function"`
+}
+
+type ChatCompletionFunction struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters JSON Schema
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+type ChatCompletionToolCall struct {
+	// Index 仅流式响应中使用
+	Index    *int                       `json:"index,omitempty"`
+	ID       string                     `json:"id,omitempty"`
+	Type     string                     `json:"type,omitempty"`
+	Function ChatCompletionFunctionCall `json:"function"`
+}
+
+type ChatCompletionFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type ChatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []ChatCompletionChoice `json:"choices"`
+	Usage   *ChatCompletionUsage   `json:"usage,omitempty"`
+}
+
+type ChatCompletionChoice struct {
+	Index        int                    `json:"index"`
+	Message      *ChatCompletionMessage `json:"message,omitempty"`
+	Delta        *ChatCompletionMessage `json:"delta,omitempty"`
+	FinishReason *string                `json:"finish_reason"`
+	// Approval 扩展字段，运行因工具调用需要审批而暂停时携带待审批的调用，此时finish_reason为stop。
+	// 审批后通过 /chat/approve 恢复运行
+	Approval *stream.ApprovalRequest `json:"approval,omitempty"`
+}
+
+type ChatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type ModelList struct {
+	Object string       `json:"object"`
+	Data   []*ModelCard `json:"data"`
+}
+
+// ModelCard 以模型的形式暴露的Agent
+type ModelCard struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+	// Name Agent名称，也可以作为model使用
+	Name string `json:"name"`
+}
+
+// OpenAIError OpenAI格式的错误响应
+type OpenAIError struct {
+	Error OpenAIErrorBody `json:"error"`
+}
+
+type OpenAIErrorBody struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
@@ -0,0 +1,102 @@
+package model
+
+import "time"
+
+// 定时运行的状态
+const (
+	ScheduleRunRunning = "running"
+	ScheduleRunSuccess = "success"
+	ScheduleRunFailed  = "failed"
+	// ScheduleRunPaused 运行等待工具审批，在会话中审批后继续生成
+	ScheduleRunPaused = "paused"
+)
+
+// 定时运行的触发方式
+const (
+	ScheduleTriggerCron   = "cron"
+	ScheduleTriggerManual = "manual"
+)
+
+// AgentSchedule Agent的定时任务，按cron表达式以固定的输入运行Agent，回复追加到指定会话，
+// 可选地将结果POST到Webhook
+type AgentSchedule struct {
+	ID      string `gorm:"primaryKey;type:char(36)" json:"id"`
+	UserID  uint   `gorm:"index" json:"user_id"`
+	AgentID string `gorm:"index;type:char(36)" json:"agent_id"`
+	Name    string `gorm:"type:varchar(255)" json:"name"`
+	// CronExpr 标准5段cron表达式（分 时 日 月 周），也支持@daily、@every 2h等写法
+	CronExpr string `gorm:"type:varchar(128)" json:"cron_expr"`
+	// Timezone IANA时区名，如Asia/Shanghai
+	Timezone string `gorm:"type:varchar(64)" json:"timezone"`
+	Message  string `gorm:"type:text" json:"message"`
+	// ConvID 运行结果追加到的会话
+	ConvID     string `gorm:"column:conv_id;type:varchar(255)" json:"conv_id"`
+	WebhookURL string `gorm:"type:varchar(1024)" json:"webhook_url"`
+	Enabled    bool   `gorm:"not null" json:"enabled"`
+	// NextRunAt 下次运行时间（Unix秒），多个实例通过条件更新该字段抢占同一次运行
+	NextRunAt  int64     `gorm:"index" json:"next_run_at"`
+	LastRunAt  int64     `json:"last_run_at"`
+	LastStatus string    `gorm:"type:varchar(16)" json:"last_status"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// ScheduleRun 定时任务的一次运行记录
+type ScheduleRun struct {
+	ID         string `gorm:"primaryKey;type:char(36)" json:"id"`
+	ScheduleID string `gorm:"index;type:char(36)" json:"schedule_id"`
+	UserID     uint   `gorm:"index" json:"user_id"`
+	Trigger    string `gorm:"type:varchar(16)" json:"trigger"`
+	Status     string `gorm:"index;type:varchar(16)" json:"status"`
+	ConvID     string `gorm:"column:conv_id;type:varchar(255)" json:"conv_id"`
+	// MsgID 助手回复的消息ID，完整回复在会话中查看
+	MsgID string `gorm:"type:varchar(255)" json:"msg_id"`
+	// Output 回复内容的开头部分
+	Output string `gorm:"type:text" json:"output"`
+	Error  string `gorm:"type:text" json:"error"`
+	// WebhookStatus Webhook响应的HTTP状态码，未配置或请求失败时为0
+	WebhookStatus int        `json:"webhook_status"`
+	WebhookError  string     `gorm:"type:text" json:"webhook_error"`
+	StartedAt     time.Time  `gorm:"index" json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+}
+
+// CreateScheduleRequest 创建定时任务，未指定会话时自动创建一个
+type CreateScheduleRequest struct {
+	AgentID    string `json:"agent_id" binding:"required"`
+	Name       string `json:"name" binding:"required,max=255"`
+	CronExpr   string `json:"cron_expr" binding:"required,max=128"`
+	Timezone   string `json:"timezone" binding:"max=64"`
+	Message    string `json:"message" binding:"required"`
+	ConvID     string `json:"conv_id"`
+	WebhookURL string `json:"webhook_url" binding:"omitempty,url,max=1024"`
+	// Enabled 默认为true
+	Enabled *bool `json:"enabled"`
+}
+
+// UpdateScheduleRequest 更新定时任务，Agent和会话不可修改
+type UpdateScheduleRequest struct {
+	ID         string `json:"id" binding:"required"`
+	Name       string `json:"name" binding:"required,max=255"`
+	CronExpr   string `json:"cron_expr" binding:"required,max=128"`
+	Timezone   string `json:"timezone" binding:"max=64"`
+	Message    string `json:"message" binding:"required"`
+	WebhookURL string `json:"webhook_url" binding:"omitempty,url,max=1024"`
+	Enabled    bool   `json:"enabled"`
+}
+
+// ScheduleWebhookPayload 运行结束后POST到Webhook的内容
+type ScheduleWebhookPayload struct {
+	ScheduleID   string    `json:"schedule_id"`
+	ScheduleName string    `json:"schedule_name"`
+	AgentID      string    `json:"agent_id"`
+	RunID        string    `json:"run_id"`
+	Trigger      string    `json:"trigger"`
+	Status       string    `json:"status"`
+	ConvID       string    `json:"conv_id"`
+	MsgID        string    `json:"msg_id"`
+	Output       string    `json:"output"`
+	Error        string    `json:"error,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+}
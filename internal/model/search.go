@@ -0,0 +1,53 @@
+package model
+
+import "github.com/cloudwego/eino/schema"
+
+// SearchRequest 会话历史全文检索，在消息内容和会话标题中查找
+type SearchRequest struct {
+	// Query 检索词，多个词以空格分隔，需全部出现。中文按两字一组分词，至少两个字
+	Query   string `form:"q" binding:"required"`
+	AgentID string `form:"agent_id"`
+	// Role 只检索该角色的消息（user/assistant），指定时不检索会话标题
+	Role string `form:"role" binding:"omitempty,oneof=user assistant"`
+	// Start/End 按创建时间过滤的Unix时间戳（秒），0表示不限
+	Start int64 `form:"start"`
+	End   int64 `form:"end"`
+	Page  int   `form:"page,default=1"`
+	Size  int   `form:"size,default=10"`
+}
+
+// SearchHit 一条检索结果，Snippet为命中位置附近的片段，检索词以<em>标记，其余内容已做HTML转义
+type SearchHit struct {
+	ConvID string `json:"conv_id"`
+	// MsgID 命中的消息，会话标题命中时为空
+	MsgID     string `json:"msg_id,omitempty"`
+	AgentID   string `json:"agent_id"`
+	Title     string `json:"title"`
+	Role      string `json:"role,omitempty"`
+	Snippet   string `json:"snippet"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// SearchResult 检索结果。Conversations为标题命中的会话，只在第一页返回；Total为命中的消息总数
+type SearchResult struct {
+	Conversations []*SearchHit `json:"conversations"`
+	Messages      []*SearchHit `json:"messages"`
+	Total         int64        `json:"total"`
+}
+
+// MessagePageRequest 基于游标的历史消息分页。Cursor为空时返回当前分支最新的消息
+type MessagePageRequest struct {
+	ConvID string `form:"conv_id" binding:"required"`
+	Cursor string `form:"cursor"`
+	// Direction before/after 返回游标之前/之后的消息，around 返回以游标为中心的消息（含游标）
+	Direction string `form:"direction,default=around" binding:"oneof=before after around"`
+	Limit     int    `form:"limit,default=20"`
+}
+
+// MessagePage 一页历史消息，按时间顺序。游标位于非当前分支时沿该分支返回
+type MessagePage struct {
+	Messages []*schema.Message `json:"messages"`
+	// PrevCursor/NextCursor 继续向前/向后翻页的游标，没有更多消息时为空
+	PrevCursor string `json:"prev_cursor"`
+	NextCursor string `json:"next_cursor"`
+}
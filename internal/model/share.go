@@ -0,0 +1,81 @@
+package model
+
+import "time"
+
+// VisitorIDHeader 公开分享接口中标识匿名访客的请求头
+const VisitorIDHeader = "X-Visitor-ID"
+
+// AgentShare Agent的公开分享链接，访客无需登录即可通过Token与Agent对话。
+// 访客的会话保存在分享者名下，并记录分享ID和访客ID
+type AgentShare struct {
+	ID      string `gorm:"primaryKey;type:char(36)" json:"id"`
+	Token   string `gorm:"uniqueIndex;type:varchar(64)" json:"token"`
+	UserID  uint   `gorm:"index" json:"user_id"`
+	AgentID string `gorm:"index;type:char(36)" json:"agent_id"`
+	Name    string `gorm:"type:varchar(255)" json:"name"`
+	// PasswordHash 访问密码的bcrypt哈希，为空表示无需密码
+	PasswordHash string `gorm:"type:varchar(255)" json:"-"`
+	HasPassword  bool   `gorm:"default:0" json:"has_password"`
+	// AllowedOrigins 允许嵌入的来源（如 https://example.com），为空表示不限制
+	AllowedOrigins []string `gorm:"serializer:json;type:text" json:"allowed_origins"`
+	// RateLimit 每位访客每分钟最多发送的消息数，0表示不限制
+	RateLimit int `gorm:"default:0" json:"rate_limit"`
+	// MaxMessages 每位访客最多发送的消息总数，0表示不限制
+	MaxMessages int `gorm:"default:0" json:"max_messages"`
+	// ShareRateLimit 整个分享每分钟最多接收的消息数（所有访客合计），0表示不限制
+	ShareRateLimit int `gorm:"default:0" json:"share_rate_limit"`
+	// MaxConversations 分享下最多创建的访客会话总数，0表示不限制
+	MaxConversations int `gorm:"default:0" json:"max_conversations"`
+	// ExpiresAt 过期时间，为空表示永不过期
+	ExpiresAt *time.Time `json:"expires_at"`
+	// RevokedAt 撤销时间，撤销后链接立即失效
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Active 判断分享当前是否可用
+func (s *AgentShare) Active(now time.Time) bool {
+	if s.RevokedAt != nil {
+		return false
+	}
+	return s.ExpiresAt == nil || now.Before(*s.ExpiresAt)
+}
+
+// CreateShareRequest 创建分享请求
+type CreateShareRequest struct {
+	AgentID string `json:"agent_id" binding:"required"`
+	Name    string `json:"name" binding:"max=255"`
+	// Password 可选的访问密码
+	Password         string     `json:"password" binding:"max=72"`
+	AllowedOrigins   []string   `json:"allowed_origins" binding:"dive,url"`
+	RateLimit        int        `json:"rate_limit" binding:"min=0"`
+	MaxMessages      int        `json:"max_messages" binding:"min=0"`
+	ShareRateLimit   int        `json:"share_rate_limit" binding:"min=0"`
+	MaxConversations int        `json:"max_conversations" binding:"min=0"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+}
+
+// ShareInfo 公开分享的基本信息，供嵌入页面展示
+type ShareInfo struct {
+	Name             string `json:"name"`
+	AgentName        string `json:"agent_name"`
+	AgentDescription string `json:"agent_description"`
+	PasswordRequired bool   `json:"password_required"`
+}
+
+// CreateShareConvRequest 访客创建会话请求，已持有访客ID的访客无需再次输入密码
+type CreateShareConvRequest struct {
+	Password string `json:"password"`
+}
+
+// CreateShareConvResponse 访客创建会话结果，之后的请求需在请求头中携带访客ID
+type CreateShareConvResponse struct {
+	ConvID    string `json:"conv_id"`
+	VisitorID string `json:"visitor_id"`
+}
+
+// ShareConvRequest 访客对话请求
+type ShareConvRequest struct {
+	ConvID  string `json:"conv_id" binding:"required"`
+	Message string `json:"message" binding:"required"`
+}
@@ -0,0 +1,85 @@
+package model
+
+import "time"
+
+const (
+	TraceStatusRunning = "running"
+	TraceStatusSuccess = "success"
+	TraceStatusError   = "error"
+)
+
+// Trace 一次Agent运行的执行记录
+type Trace struct {
+	ID      string `gorm:"primaryKey;type:char(36)" json:"id"`
+	UserID  uint   `gorm:"index" json:"user_id"`
+	AgentID string `gorm:"index;type:char(36)" json:"agent_id"`
+	// ConvID/MsgID 会话模式下关联的会话和助手回复消息，调试模式为空
+	ConvID           string    `gorm:"index;type:varchar(255)" json:"conv_id"`
+	MsgID            string    `gorm:"index;type:varchar(255)" json:"msg_id"`
+	Query            string    `gorm:"type:text" json:"query"`
+	Status           string    `gorm:"type:varchar(16)" json:"status"`
+	Error            string    `gorm:"type:text" json:"error"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	DurationMs       int64     `json:"duration_ms"`
+	CreatedAt        time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TraceSpan 运行过程中的一个步骤，对应eino回调中的一个组件或节点
+type TraceSpan struct {
+	ID       string `gorm:"primaryKey;type:char(36)" json:"id"`
+	TraceID  string `gorm:"index;type:char(36)" json:"trace_id"`
+	ParentID string `gorm:"type:char(36)" json:"parent_id"`
+	// Seq 开始顺序，用于还原执行顺序
+	Seq int `json:"seq"`
+	// Name 节点名称，Component 组件类型（ChatModel、Retriever、Tool、Lambda、Graph等），Type 组件实现类型
+	Name      string `gorm:"type:varchar(255)" json:"name"`
+	Component string `gorm:"type:varchar(64)" json:"component"`
+	Type      string `gorm:"type:varchar(255)" json:"type"`
+	// Input/Output 截断后的输入输出（JSON）
+	Input  string `gorm:"type:mediumtext" json:"input"`
+	Output string `gorm:"type:mediumtext" json:"output"`
+	Error  string `gorm:"type:text" json:"error"`
+	// Documents 检索结果（JSON），仅Retriever
+	Documents        string    `gorm:"type:mediumtext" json:"documents,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	StartedAt        time.Time `json:"started_at"`
+	EndedAt          time.Time `json:"ended_at"`
+	DurationMs       int64     `json:"duration_ms"`
+}
+
+// TraceDocument 检索到的文档摘要
+type TraceDocument struct {
+	ID           string  `json:"id"`
+	DocumentName string  `json:"document_name"`
+	Score        float64 `json:"score"`
+	Content      string  `json:"content"`
+}
+
+const (
+	TraceEventSpanStart = "span_start"
+	TraceEventSpanEnd   = "span_end"
+	TraceEventEnd       = "trace_end"
+)
+
+// TraceEvent 实时下发的Trace事件
+type TraceEvent struct {
+	Type  string     `json:"type"`
+	Span  *TraceSpan `json:"span,omitempty"`
+	Trace *Trace     `json:"trace,omitempty"`
+}
+
+// TraceDetail Trace及其全部步骤
+type TraceDetail struct {
+	Trace *Trace       `json:"trace"`
+	Spans []*TraceSpan `json:"spans"`
+}
+
+type PageTraceRequest struct {
+	AgentID string `form:"agent_id"`
+	Page    int    `form:"page,default=1"`
+	Size    int    `form:"size,default=10"`
+}
@@ -0,0 +1,75 @@
+package model
+
+import "ai-cloud/pkgs/stream"
+
+const (
+	// ExportFormat/ExportVersion 会话导出JSON的格式标识和版本
+	ExportFormat  = "ai-cloud.conversation"
+	ExportVersion = 1
+
+	// 导出格式
+	ExportMarkdown = "markdown"
+	ExportHTML     = "html"
+	ExportJSON     = "json"
+)
+
+// MessageMetadata 助手回复附带的运行信息，保存在Message.Metadata中
+type MessageMetadata struct {
+	ToolCalls   []*stream.ToolCall   `json:"tool_calls,omitempty"`
+	ToolResults []*stream.ToolResult `json:"tool_results,omitempty"`
+	References  []*stream.Reference  `json:"references,omitempty"`
+	Usage       *stream.Usage        `json:"usage,omitempty"`
+	// Settings 生成回复时生效的会话设置（与Agent配置合并后），Tools为空表示使用Agent的全部工具
+	Settings *ConversationSettings `json:"settings,omitempty"`
+	// Attachments 用户消息的附件
+	Attachments []*AttachmentRef `json:"attachments,omitempty"`
+}
+
+// Empty 没有任何运行信息
+func (m *MessageMetadata) Empty() bool {
+	return m == nil || len(m.ToolCalls) == 0 && len(m.ToolResults) == 0 && len(m.References) == 0 && m.Usage == nil && m.Settings == nil && len(m.Attachments) == 0
+}
+
+// ConversationExport 会话的无损导出格式，包含全部分支，可重新导入
+type ConversationExport struct {
+	Format    string `json:"format"`
+	Version   int    `json:"version"`
+	ConvID    string `json:"conv_id"`
+	AgentID   string `json:"agent_id"`
+	Title     string `json:"title"`
+	Summary   string `json:"summary,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+	// CurrentMsgID 当前分支的末端
+	CurrentMsgID string `json:"current_msg_id"`
+	// Messages 按保存顺序，父消息总在子消息之前
+	Messages []*MessageExport `json:"messages"`
+}
+
+// MessageExport 导出的一条消息，ParentID为消息树中的父消息
+type MessageExport struct {
+	MsgID            string           `json:"msg_id"`
+	ParentID         string           `json:"parent_id"`
+	Role             string           `json:"role"`
+	Content          string           `json:"content"`
+	ReasoningContent string           `json:"reasoning_content,omitempty"`
+	CreatedAt        int64            `json:"created_at"`
+	TokenCount       int              `json:"token_count,omitempty"`
+	IsVariant        bool             `json:"is_variant,omitempty"`
+	IsContextEdge    bool             `json:"is_context_edge,omitempty"`
+	Metadata         *MessageMetadata `json:"metadata,omitempty"`
+}
+
+// ExportConvRequest 导出会话：指定一个或多个会话，或导出Agent的全部会话。多个会话打包为zip
+type ExportConvRequest struct {
+	ConvIDs []string `form:"conv_id"`
+	AgentID string   `form:"agent_id"`
+	Format  string   `form:"format,default=markdown" binding:"oneof=markdown html json"`
+}
+
+// ImportConvResult 导入结果
+type ImportConvResult struct {
+	ConvIDs []string `json:"conv_ids"`
+	// Skipped 无法识别或没有消息而跳过的会话数
+	Skipped int `json:"skipped"`
+}
@@ -0,0 +1,125 @@
+package model
+
+import "encoding/json"
+
+const (
+	AgentTypeSimple   = "simple"   // 固定拓扑：检索 → 模板 → 模型/ReAct
+	AgentTypeWorkflow = "workflow" // 用户自定义的工作流
+)
+
+// 工作流中保留的节点ID
+const (
+	WorkflowStartNode = "start"
+	WorkflowEndNode   = "end"
+)
+
+// 工作流节点类型
+const (
+	NodeTypeLLM       = "llm"
+	NodeTypeRetriever = "retriever"
+	NodeTypePrompt    = "prompt"
+	NodeTypeTool      = "tool"
+	NodeTypeCondition = "condition"
+	NodeTypeLoop      = "loop"
+	NodeTypeCode      = "code"
+	NodeTypeHTTP      = "http"
+	NodeTypeAgent     = "agent"
+)
+
+// WorkflowSchema 工作流定义。
+// 节点之间通过变量共享数据：start节点提供 start.query / start.history，
+// 其余节点的输出以节点ID为名称，模板中使用 {{ node_id.field }} 引用。
+type WorkflowSchema struct {
+	Nodes []WorkflowNode `json:"nodes"`
+	Edges []WorkflowEdge `json:"edges"`
+	// Output 最终回复的模板，例如 "{{ llm_1.text }}"
+	Output string `json:"output"`
+}
+
+type WorkflowNode struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Name   string          `json:"name"`
+	Config json.RawMessage `json:"config"`
+}
+
+type WorkflowEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// LLMNodeConfig 调用大模型，输出 {text}
+type LLMNodeConfig struct {
+	ModelID      string  `json:"model_id"`
+	SystemPrompt string  `json:"system_prompt"`
+	Prompt       string  `json:"prompt"`
+	Temperature  float64 `json:"temperature"`
+	WithHistory  bool    `json:"with_history"`
+}
+
+// RetrieverNodeConfig 知识库检索，输出 {documents, text}
+type RetrieverNodeConfig struct {
+	KnowledgeIDs []string `json:"knowledge_ids"`
+	TopK         int      `json:"top_k"`
+	Query        string   `json:"query"` // 默认为 {{ start.query }}
+}
+
+// PromptNodeConfig 渲染文本模板，输出 {text}
+type PromptNodeConfig struct {
+	Template string `json:"template"`
+}
+
+// ToolNodeConfig 调用MCP服务器提供的工具，输出 {result}
+type ToolNodeConfig struct {
+	MCPServer string         `json:"mcp_server"`
+	ToolName  string         `json:"tool_name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+// ConditionNodeConfig 条件分支，按顺序匹配第一个为真的分支
+type ConditionNodeConfig struct {
+	Branches []ConditionBranch `json:"branches"`
+	Default  string            `json:"default"`
+}
+
+type ConditionBranch struct {
+	Expression string `json:"expression"`
+	Target     string `json:"target"`
+}
+
+// LoopNodeConfig 循环执行子工作流，输出 {results}。
+// 子工作流中可以通过 loop.item / loop.index 引用当前元素。
+type LoopNodeConfig struct {
+	Items         string         `json:"items"` // 求值结果为数组的表达式
+	MaxIterations int            `json:"max_iterations"`
+	Body          WorkflowSchema `json:"body"`
+}
+
+// CodeNodeConfig 计算表达式，输出 {key: value}
+type CodeNodeConfig struct {
+	Outputs map[string]string `json:"outputs"`
+}
+
+// HTTPNodeConfig 发送HTTP请求，输出 {status, body, json}
+type HTTPNodeConfig struct {
+	Method         string            `json:"method"`
+	URL            string            `json:"url"`
+	Headers        map[string]string `json:"headers"`
+	Body           string            `json:"body"`
+	TimeoutSeconds int               `json:"timeout_seconds"`
+}
+
+// AgentNodeConfig 调用当前用户的其他Agent，输出 {text}
+type AgentNodeConfig struct {
+	AgentID string `json:"agent_id"`
+	Query   string `json:"query"` // 默认为 {{ start.query }}
+}
+
+// WorkflowNodeOutput 调试模式下返回的单个节点执行结果
+type WorkflowNodeOutput struct {
+	NodeID     string `json:"node_id"`
+	Type       string `json:"type"`
+	Output     any    `json:"output,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
@@ -3,11 +3,12 @@ package router
 import (
 	"ai-cloud/internal/controller"
 	"ai-cloud/internal/middleware"
+	"ai-cloud/internal/model"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetUpRouters(r *gin.Engine, uc *controller.UserController, fc *controller.FileController, kc *controller.KBController, mc *controller.ModelController, ac *controller.AgentController, cc *controller.ConversationController) {
+func SetUpRouters(r *gin.Engine, uc *controller.UserController, fc *controller.FileController, kc *controller.KBController, mc *controller.ModelController, ac *controller.AgentController, cc *controller.ConversationController, tc *controller.TraceController, akc *controller.APIKeyController, oc *controller.OpenAIController, sc *controller.ShareController, mmc *controller.MemoryController, fbc *controller.FeedbackController, atc *controller.AttachmentController, schc *controller.ScheduleController, ec *controller.EvalController, apiKeys middleware.APIKeyVerifier) {
 	api := r.Group("/api")
 	{
 
@@ -17,71 +18,201 @@ func SetUpRouters(r *gin.Engine, uc *controller.UserController, fc *controller.F
 			publicUser.POST("/login", uc.Login)
 		}
 
+		// 使用API Key访问时，各路由组按权限范围检查；登录JWT不受限制
 		auth := api.Group("files")
-		auth.Use(middleware.JWTAuth())
-		{
-			auth.POST("/upload", fc.Upload)
-			auth.GET("/page", fc.PageList)
-			auth.GET("/download", fc.Download)
-			auth.DELETE("/delete", fc.Delete)
-			auth.POST("/folder", fc.CreateFolder)
-			auth.POST("/move", fc.BatchMove)
-			auth.GET("/search", fc.Search)
-			auth.PUT("/rename", fc.Rename)
-			auth.GET("/path", fc.GetPath)
-			auth.GET("/idPath", fc.GetIDPath)
+		auth.Use(middleware.Auth(apiKeys))
+		fileRead := auth.Group("", middleware.RequireScope(model.ScopeFilesRead, model.ScopeFilesWrite))
+		{
+			fileRead.GET("/page", fc.PageList)
+			fileRead.GET("/download", fc.Download)
+			fileRead.GET("/search", fc.Search)
+			fileRead.GET("/path", fc.GetPath)
+			fileRead.GET("/idPath", fc.GetIDPath)
+		}
+		fileWrite := auth.Group("", middleware.RequireScope(model.ScopeFilesWrite))
+		{
+			fileWrite.POST("/upload", fc.Upload)
+			fileWrite.DELETE("/delete", fc.Delete)
+			fileWrite.POST("/folder", fc.CreateFolder)
+			fileWrite.POST("/move", fc.BatchMove)
+			fileWrite.PUT("/rename", fc.Rename)
 		}
 		kb := api.Group("knowledge")
-		kb.Use(middleware.JWTAuth())
+		kb.Use(middleware.Auth(apiKeys))
+		// 知识库及文档的管理视为文件写入
+		kbManage := kb.Group("", middleware.RequireScope(model.ScopeFilesWrite))
 		{
 			// KB
-			kb.POST("/create", kc.Create)
-			kb.DELETE("/delete", kc.Delete)
-			kb.POST("/add", kc.AddExistFile)
-			kb.POST("/addNew", kc.AddNewFile)
-			kb.GET("/page", kc.PageList)
-			kb.GET("/detail", kc.GetKBDetail)
+			kbManage.POST("/create", kc.Create)
+			kbManage.DELETE("/delete", kc.Delete)
+			kbManage.POST("/add", kc.AddExistFile)
+			kbManage.POST("/addNew", kc.AddNewFile)
 			// Doc
-			kb.GET("/docPage", kc.DocPage)
-			kb.POST("/docDelete", kc.DeleteDocs)
+			kbManage.POST("/docDelete", kc.DeleteDocs)
+		}
+		kbQuery := kb.Group("", middleware.RequireScope(model.ScopeKBQuery))
+		{
+			kbQuery.GET("/page", kc.PageList)
+			kbQuery.GET("/detail", kc.GetKBDetail)
+			kbQuery.GET("/docPage", kc.DocPage)
 			// RAG
-			kb.POST("/retrieve", kc.Retrieve)
-			kb.POST("/chat", kc.Chat)
-			kb.POST("/stream", kc.ChatStream)
+			kbQuery.POST("/retrieve", kc.Retrieve)
+			kbQuery.POST("/chat", kc.Chat)
+			kbQuery.POST("/stream", kc.ChatStream)
 		}
-		model := api.Group("model")
-		model.Use(middleware.JWTAuth())
+		llm := api.Group("model")
+		llm.Use(middleware.Auth(apiKeys), middleware.RequireScope(model.ScopeAdmin))
 		{
-			model.POST("/create", mc.CreateModel)
-			model.PUT("/update", mc.UpdateModel)
-			model.DELETE("/delete", mc.DeleteModel)
-			model.GET("/get", mc.GetModel)
-			model.GET("/page", mc.PageModels)
-			model.GET("/list", mc.ListModels)
+			llm.POST("/create", mc.CreateModel)
+			llm.PUT("/update", mc.UpdateModel)
+			llm.DELETE("/delete", mc.DeleteModel)
+			llm.GET("/get", mc.GetModel)
+			llm.GET("/page", mc.PageModels)
+			llm.GET("/list", mc.ListModels)
 		}
 		agent := api.Group("agent")
-		agent.Use(middleware.JWTAuth())
+		agent.Use(middleware.Auth(apiKeys))
+		agentManage := agent.Group("", middleware.RequireScope(model.ScopeAdmin))
+		{
+			agentManage.POST("/create", ac.CreateAgent)
+			agentManage.POST("/update", ac.UpdateAgent)
+			agentManage.DELETE("/delete", ac.DeleteAgent)
+			// 版本管理
+			agentManage.POST("/publish", ac.PublishAgent)
+			agentManage.POST("/rollback", ac.RollbackAgent)
+			// 导出、导入和从模板创建
+			agentManage.GET("/export", ac.ExportAgent)
+			agentManage.POST("/import", ac.ImportAgent)
+			agentManage.POST("/templates/instantiate", ac.InstantiateTemplate)
+		}
+		agentRun := agent.Group("", middleware.RequireScope(model.ScopeAgentRun))
 		{
-			agent.POST("/create", ac.CreateAgent)
-			agent.POST("/update", ac.UpdateAgent)
-			agent.DELETE("/delete", ac.DeleteAgent)
-			agent.GET("/get", ac.GetAgent)
-			agent.GET("/page", ac.PageAgents)
-			agent.POST("/execute/:id", ac.ExecuteAgent)
-			agent.POST("/stream", ac.StreamExecuteAgent)
+			agentRun.GET("/get", ac.GetAgent)
+			agentRun.GET("/page", ac.PageAgents)
+			agentRun.POST("/execute/:id", ac.ExecuteAgent)
+			agentRun.POST("/stream", ac.StreamExecuteAgent)
+			agentRun.GET("/versions", ac.ListAgentVersions)
+			agentRun.GET("/version", ac.GetAgentVersion)
+			agentRun.GET("/diff", ac.DiffAgentVersions)
+			agentRun.GET("/templates", ac.ListAgentTemplates)
+			// 工具审批
+			agentRun.GET("/approvals", ac.ListPendingApprovals)
 		}
 		conv := api.Group("chat")
-		conv.Use(middleware.JWTAuth())
+		conv.Use(middleware.Auth(apiKeys), middleware.RequireScope(model.ScopeAgentRun))
 		{
 			// 调试模式，不保存历史
 			conv.POST("/debug", cc.DebugStreamAgent)
 			// 会话相关功能
 			conv.POST("/create", cc.CreateConversation)
 			conv.POST("/stream", cc.StreamConversation)
+			conv.POST("/approve", cc.ApproveToolCalls)
+			// 重新连接到进行中的回复生成、停止生成
+			conv.GET("/attach", cc.AttachReply)
+			conv.POST("/stop", cc.StopReply)
+			// 消息树：重新生成、编辑后重新发送和切换分支
+			conv.POST("/regenerate", cc.RegenerateReply)
+			conv.POST("/edit", cc.EditMessage)
+			conv.POST("/branch", cc.SwitchBranch)
+			conv.GET("/tree", cc.GetMessageTree)
 			conv.GET("/list", cc.ListConversations)
 			conv.GET("/list/agent", cc.ListAgentConversations)
 			conv.GET("/history", cc.GetConversationHistory)
+			conv.GET("/messages", cc.PageMessages)
+			conv.GET("/search", cc.SearchHistory)
+			conv.GET("/export", cc.ExportConversations)
+			conv.POST("/import", cc.ImportConversations)
+			conv.POST("/rename", cc.RenameConversation)
+			conv.GET("/settings", cc.GetSettings)
+			conv.POST("/settings", cc.UpdateSettings)
+			conv.POST("/clear", cc.ClearContext)
 			conv.DELETE("/delete", cc.DeleteConversation)
+			// 聊天附件：上传或从云盘添加，随消息发送
+			conv.POST("/attachments/upload", atc.UploadAttachment)
+			conv.POST("/attachments/drive", atc.AttachDriveFile)
+			conv.GET("/attachments/download", atc.DownloadAttachment)
+		}
+		trace := api.Group("trace")
+		trace.Use(middleware.Auth(apiKeys), middleware.RequireScope(model.ScopeAgentRun))
+		{
+			trace.GET("/get", tc.GetTrace)
+			trace.GET("/message", tc.GetMessageTrace)
+			trace.GET("/page", tc.PageTraces)
+		}
+		apiKey := api.Group("apikey")
+		apiKey.Use(middleware.Auth(apiKeys), middleware.RequireScope(model.ScopeAdmin))
+		{
+			apiKey.POST("/create", akc.CreateAPIKey)
+			apiKey.GET("/list", akc.ListAPIKeys)
+			apiKey.DELETE("/delete", akc.DeleteAPIKey)
+		}
+		memory := api.Group("memory")
+		memory.Use(middleware.Auth(apiKeys), middleware.RequireScope(model.ScopeAgentRun))
+		{
+			memory.GET("/list", mmc.ListMemories)
+			memory.PUT("/update", mmc.UpdateMemory)
+			memory.DELETE("/delete", mmc.DeleteMemory)
+		}
+		feedback := api.Group("feedback")
+		feedback.Use(middleware.Auth(apiKeys), middleware.RequireScope(model.ScopeAgentRun))
+		{
+			feedback.POST("/submit", fbc.SubmitFeedback)
+			feedback.GET("/get", fbc.GetFeedback)
+			feedback.DELETE("/delete", fbc.DeleteFeedback)
+			// 质量统计和评测数据导出
+			feedback.GET("/stats", fbc.GetStats)
+			feedback.GET("/worst", fbc.WorstConversations)
+			feedback.GET("/reasons", fbc.TopReasons)
+			feedback.GET("/export", fbc.ExportDataset)
 		}
+		share := api.Group("share")
+		share.Use(middleware.Auth(apiKeys), middleware.RequireScope(model.ScopeAdmin))
+		{
+			share.POST("/create", sc.CreateShare)
+			share.GET("/list", sc.ListShares)
+			share.DELETE("/revoke", sc.RevokeShare)
+			// 访客会话，消息通过 /chat/history 查看
+			share.GET("/conversations", sc.ListVisitorConversations)
+		}
+
+		schedule := api.Group("schedule")
+		schedule.Use(middleware.Auth(apiKeys), middleware.RequireScope(model.ScopeAdmin))
+		{
+			schedule.POST("/create", schc.CreateSchedule)
+			schedule.POST("/update", schc.UpdateSchedule)
+			schedule.DELETE("/delete", schc.DeleteSchedule)
+			schedule.GET("/list", schc.ListSchedules)
+			// 立即运行一次和运行记录，回复内容通过 /chat/history 查看
+			schedule.POST("/trigger", schc.TriggerSchedule)
+			schedule.GET("/runs", schc.PageRuns)
+		}
+
+		eval := api.Group("eval")
+		eval.Use(middleware.Auth(apiKeys), middleware.RequireScope(model.ScopeAdmin))
+		{
+			// 对比两个Agent配置，评测在后台运行
+			eval.POST("/create", ec.CreateEvalRun)
+			eval.GET("/get", ec.GetEvalRun)
+			eval.GET("/page", ec.PageEvalRuns)
+			eval.GET("/results", ec.PageEvalResults)
+			eval.DELETE("/delete", ec.DeleteEvalRun)
+		}
+
+		// 公开分享接口，无需登录，访客通过请求头 X-Visitor-ID 标识
+		publicShare := api.Group("public/share/:token")
+		{
+			publicShare.GET("", sc.GetShareInfo)
+			publicShare.POST("/create", sc.CreateVisitorConversation)
+			publicShare.POST("/stream", sc.StreamVisitorConversation)
+			publicShare.GET("/history", sc.GetVisitorHistory)
+		}
+	}
+
+	// OpenAI兼容接口，model为Agent的ID或名称
+	v1 := r.Group("/v1")
+	v1.Use(middleware.Auth(apiKeys), middleware.RequireScope(model.ScopeAgentRun))
+	{
+		v1.GET("/models", oc.ListModels)
+		v1.POST("/chat/completions", oc.ChatCompletions)
 	}
 }
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"ai-cloud/internal/dao"
+	"ai-cloud/internal/model"
+	"ai-cloud/pkgs/stream"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+// findApprovalPolicy 返回工具适用的审批策略，未配置时返回nil（直接执行）
+func findApprovalPolicy(cfg model.ToolApprovalConfig, toolName string) *model.ToolApprovalPolicy {
+	for i := range cfg.Policies {
+		p := &cfg.Policies[i]
+		if p.Tool == toolName || p.Tool == "*" {
+			if p.Mode == model.ApprovalModeAuto {
+				return nil
+			}
+			return p
+		}
+	}
+	return nil
+}
+
+// validateApprovalConfig 校验审批规则中的正则表达式
+func validateApprovalConfig(cfg model.ToolApprovalConfig) error {
+	for _, p := range cfg.Policies {
+		for _, r := range p.Rules {
+			if _, err := regexp.Compile(r.Pattern); err != nil {
+				return fmt.Errorf("invalid approval rule for tool %s: %w", p.Tool, err)
+			}
+		}
+	}
+	return nil
+}
+
+// needApproval 判断一次工具调用是否需要审批
+func needApproval(p *model.ToolApprovalPolicy, argumentsInJSON string) bool {
+	if p.Mode == model.ApprovalModeAlways {
+		return true
+	}
+	var args map[string]any
+	_ = json.Unmarshal([]byte(argumentsInJSON), &args)
+	for _, r := range p.Rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			continue
+		}
+		value := argumentsInJSON
+		if r.Argument != "" {
+			v, ok := args[r.Argument]
+			if !ok {
+				continue
+			}
+			if s, ok := v.(string); ok {
+				value = s
+			} else {
+				b, _ := json.Marshal(v)
+				value = string(b)
+			}
+		}
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+type approvalSessionKey struct{}
+
+// approvalSession 一次可中断运行中的审批状态，通过ctx传递给需要审批的工具
+type approvalSession struct {
+	// decisions 已审批的工具调用，key为ToolCallID
+	decisions map[string]*model.ToolApproval
+
+	mu sync.Mutex
+	// pending 本次运行中新产生的待审批调用
+	pending []*model.ToolApproval
+	// results 已执行完成的工具调用结果，key为ToolCallID，中断时随运行保存
+	results map[string]string
+}
+
+func withApprovalSession(ctx context.Context, session *approvalSession) context.Context {
+	return context.WithValue(ctx, approvalSessionKey{}, session)
+}
+
+func (s *approvalSession) addPending(a *model.ToolApproval) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, a)
+}
+
+func (s *approvalSession) result(callID string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.results[callID]
+	return r, ok
+}
+
+func (s *approvalSession) addResult(callID, result string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.results == nil {
+		s.results = make(map[string]string)
+	}
+	s.results[callID] = result
+}
+
+// approvalTool 可中断运行中的工具。需要审批时（policy不为nil）：未审批时中断运行，
+// 审批通过后以原参数或修改后的参数执行，拒绝时返回拒绝说明。
+// 中断后整批工具调用会重新运行，已执行完成的调用直接返回上次的结果
+type approvalTool struct {
+	tool.InvokableTool
+	name   string
+	policy *model.ToolApprovalPolicy
+}
+
+func (t *approvalTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	session, _ := ctx.Value(approvalSessionKey{}).(*approvalSession)
+	// 不返回调用ID的模型无法区分调用，不使用保存的结果
+	callID := compose.GetToolCallID(ctx)
+	if session != nil && callID != "" {
+		if result, ok := session.result(callID); ok {
+			return result, nil
+		}
+	}
+
+	if t.policy == nil || !needApproval(t.policy, argumentsInJSON) {
+		return t.run(ctx, session, callID, argumentsInJSON, opts...)
+	}
+	if session == nil {
+		return fmt.Sprintf("工具 %s 需要人工审批，当前运行方式不支持审批，未执行该工具", t.name), nil
+	}
+
+	decision, ok := session.decisions[callID]
+	if !ok {
+		session.addPending(&model.ToolApproval{
+			ID:         uuid.NewString(),
+			ToolCallID: callID,
+			ToolName:   t.name,
+			Arguments:  argumentsInJSON,
+			Status:     model.ApprovalStatusPending,
+		})
+		return "", compose.InterruptAndRerun
+	}
+
+	switch decision.Status {
+	case model.ApprovalStatusApproved:
+		if decision.EditedArguments != "" {
+			argumentsInJSON = decision.EditedArguments
+		}
+		return t.run(ctx, session, callID, argumentsInJSON, opts...)
+	default:
+		msg := fmt.Sprintf("用户拒绝执行工具 %s", t.name)
+		if decision.Comment != "" {
+			msg += "，说明：" + decision.Comment
+		}
+		return msg, nil
+	}
+}
+
+// run 执行工具并记录结果，供中断恢复时使用
+func (t *approvalTool) run(ctx context.Context, session *approvalSession, callID, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	result, err := t.InvokableTool.InvokableRun(ctx, argumentsInJSON, opts...)
+	if err == nil && session != nil && callID != "" {
+		session.addResult(callID, result)
+	}
+	return result, err
+}
+
+// wrapApprovalTools 为配置了审批策略的工具加上审批，返回是否存在需要审批的工具。
+// 存在时其他工具也加上包装，以便中断恢复时不重复执行同一批中已完成的调用
+func wrapApprovalTools(ctx context.Context, tools []tool.BaseTool, cfg model.ToolApprovalConfig) ([]tool.BaseTool, bool, error) {
+	if len(cfg.Policies) == 0 {
+		return tools, false, nil
+	}
+	wrapped := make([]tool.BaseTool, 0, len(tools))
+	found := false
+	for _, t := range tools {
+		info, err := t.Info(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		it, ok := t.(tool.InvokableTool)
+		if !ok {
+			wrapped = append(wrapped, t)
+			continue
+		}
+		policy := findApprovalPolicy(cfg, info.Name)
+		wrapped = append(wrapped, &approvalTool{InvokableTool: it, name: info.Name, policy: policy})
+		found = found || policy != nil
+	}
+	if !found {
+		return tools, false, nil
+	}
+	return wrapped, true, nil
+}
+
+// checkPointStore 将eino的checkpoint保存在AgentRun记录中，服务重启后仍可恢复
+type checkPointStore struct {
+	dao dao.AgentRunDao
+}
+
+func (c *checkPointStore) Get(ctx context.Context, checkPointID string) ([]byte, bool, error) {
+	return c.dao.GetCheckpoint(ctx, checkPointID)
+}
+
+func (c *checkPointStore) Set(ctx context.Context, checkPointID string, checkPoint []byte) error {
+	return c.dao.SetCheckpoint(ctx, checkPointID, checkPoint)
+}
+
+// createRun 为可中断的运行创建记录，恢复时使用相同的输入和Agent版本
+func (s *agentService) createRun(ctx context.Context, userID uint, agent *model.Agent, msg model.UserMessage, o *ExecuteOptions) (*model.AgentRun, error) {
+	input, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	run := &model.AgentRun{
+		ID:           uuid.NewString(),
+		UserID:       userID,
+		AgentID:      agent.ID,
+		AgentVersion: resolveVersion(agent, o.Version),
+		ConvID:       o.ConvID,
+		MsgID:        o.MsgID,
+		Input:        string(input),
+		Status:       model.AgentRunStatusRunning,
+	}
+	if o.Settings != nil {
+		run.Settings, _ = json.Marshal(o.Settings)
+	}
+	if err := s.runDao.Create(ctx, run); err != nil {
+		return nil, fmt.Errorf("failed to create agent run: %w", err)
+	}
+	return run, nil
+}
+
+// finishRun 处理可中断运行的结果：因等待审批中断时保存待审批的工具调用并下发审批请求，回复以空流结束
+func (s *agentService) finishRun(ctx context.Context, run *model.AgentRun, session *approvalSession, events *eventStream, sr *schema.StreamReader[*schema.Message], err error) (*schema.StreamReader[*schema.Message], error) {
+	if err == nil {
+		if err := s.runDao.UpdateStatus(ctx, run.ID, model.AgentRunStatusCompleted); err != nil {
+			log.Printf("[Approval] failed to update run %s: %v", run.ID, err)
+		}
+		return sr, nil
+	}
+	if _, ok := compose.ExtractInterruptInfo(err); !ok || len(session.pending) == 0 {
+		if err := s.runDao.UpdateStatus(ctx, run.ID, model.AgentRunStatusFailed); err != nil {
+			log.Printf("[Approval] failed to update run %s: %v", run.ID, err)
+		}
+		return nil, fmt.Errorf("failed to stream: %w", err)
+	}
+
+	req := &stream.ApprovalRequest{RunID: run.ID}
+	for _, a := range session.pending {
+		a.RunID = run.ID
+		a.UserID = run.UserID
+		a.AgentID = run.AgentID
+		req.Approvals = append(req.Approvals, &stream.PendingApproval{
+			ID:         a.ID,
+			ToolCallID: a.ToolCallID,
+			ToolName:   a.ToolName,
+			Arguments:  a.Arguments,
+		})
+	}
+	if err := s.runDao.CreateApprovals(ctx, session.pending); err != nil {
+		return nil, fmt.Errorf("failed to save approvals: %w", err)
+	}
+	if len(session.results) > 0 {
+		if err := s.runDao.SaveToolResults(ctx, run.ID, session.results); err != nil {
+			return nil, fmt.Errorf("failed to save tool results: %w", err)
+		}
+	}
+	if err := s.runDao.UpdateStatus(ctx, run.ID, model.AgentRunStatusInterrupted); err != nil {
+		return nil, fmt.Errorf("failed to update agent run: %w", err)
+	}
+	events.sendStreamEvent(&stream.Event{Type: stream.EventApprovalRequest, ApprovalRequest: req})
+
+	empty, sw := schema.Pipe[*schema.Message](0)
+	sw.Close()
+	return empty, nil
+}
+
+// ResumeAgent 提交审批结果并从checkpoint恢复运行，运行的全部待审批调用都需要给出结果
+func (s *agentService) ResumeAgent(ctx context.Context, userID uint, runID string, decisions []model.ApprovalDecision) (*schema.StreamReader[*schema.Message], *model.AgentRun, error) {
+	run, err := s.runDao.GetByID(ctx, userID, runID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if run.Status != model.AgentRunStatusInterrupted {
+		return nil, nil, fmt.Errorf("run is not waiting for approval: %s", run.Status)
+	}
+
+	approvals, err := s.runDao.ListApprovals(ctx, runID)
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[string]*model.ToolApproval, len(approvals))
+	for _, a := range approvals {
+		byID[a.ID] = a
+	}
+	for _, d := range decisions {
+		a, ok := byID[d.ApprovalID]
+		if !ok {
+			return nil, nil, fmt.Errorf("approval %s not found in run", d.ApprovalID)
+		}
+		if a.Status != model.ApprovalStatusPending {
+			return nil, nil, fmt.Errorf("approval %s already decided", d.ApprovalID)
+		}
+		switch d.Action {
+		case model.ApprovalActionApprove:
+			a.Status = model.ApprovalStatusApproved
+		case model.ApprovalActionEdit:
+			if !json.Valid([]byte(d.Arguments)) {
+				return nil, nil, fmt.Errorf("invalid arguments for approval %s", d.ApprovalID)
+			}
+			a.Status = model.ApprovalStatusApproved
+			a.EditedArguments = d.Arguments
+		case model.ApprovalActionReject:
+			a.Status = model.ApprovalStatusRejected
+		}
+		a.Comment = d.Comment
+	}
+	for _, a := range approvals {
+		if a.Status == model.ApprovalStatusPending {
+			return nil, nil, fmt.Errorf("approval %s is still pending", a.ID)
+		}
+	}
+	for _, d := range decisions {
+		if err := s.runDao.DecideApproval(ctx, byID[d.ApprovalID]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var msg model.UserMessage
+	if err := json.Unmarshal([]byte(run.Input), &msg); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse run input: %w", err)
+	}
+	if err := s.runDao.UpdateStatus(ctx, run.ID, model.AgentRunStatusRunning); err != nil {
+		return nil, nil, err
+	}
+
+	decided := make(map[string]*model.ToolApproval, len(approvals))
+	for _, a := range approvals {
+		decided[a.ToolCallID] = a
+	}
+	o := &ExecuteOptions{Version: run.AgentVersion, ConvID: run.ConvID, MsgID: run.MsgID}
+	if len(run.Settings) > 0 {
+		o.Settings = &model.ConversationSettings{}
+		if err := json.Unmarshal(run.Settings, o.Settings); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse run settings: %w", err)
+		}
+	}
+	sr, err := s.streamAgent(ctx, userID, run.AgentID, msg, o, run, decided)
+	if err != nil {
+		// 审批结果已保存，恢复失败时可以不带审批结果再次恢复
+		_ = s.runDao.UpdateStatus(ctx, run.ID, model.AgentRunStatusInterrupted)
+		return nil, nil, err
+	}
+	return sr, run, nil
+}
+
+func (s *agentService) ListPendingApprovals(ctx context.Context, userID uint) ([]*model.ToolApproval, error) {
+	return s.runDao.ListPendingApprovals(ctx, userID)
+}
+
+func (s *agentService) CancelPausedRun(ctx context.Context, userID uint, msgID string) (bool, error) {
+	return s.runDao.CancelByMsg(ctx, userID, msgID)
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/schema"
+)
+
+// attachmentTemplate 在提示词模板生成的本轮用户消息中加入附件。
+// 嵌入 *prompt.DefaultChatTemplate 沿用其回调，Trace中记录的是不含附件内容的提示词
+type attachmentTemplate struct {
+	*prompt.DefaultChatTemplate
+}
+
+func (t *attachmentTemplate) Format(ctx context.Context, vs map[string]any, opts ...prompt.Option) ([]*schema.Message, error) {
+	msgs, err := t.DefaultChatTemplate.Format(ctx, vs, opts...)
+	if err != nil {
+		return nil, err
+	}
+	parts, _ := vs["attachments"].([]schema.ChatMessagePart)
+	if len(parts) == 0 {
+		return msgs, nil
+	}
+	// 本轮用户消息之后只有调用方工具的消息，从后向前第一条用户消息即为本轮消息
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == schema.User {
+			msgs[i] = withAttachments(msgs[i], parts)
+			break
+		}
+	}
+	return msgs, nil
+}
+
+// withAttachments 文本附加在消息内容之后；有图片时消息改为多模态内容，第一部分为完整的文本
+func withAttachments(msg *schema.Message, parts []schema.ChatMessagePart) *schema.Message {
+	m := *msg
+	var images []schema.ChatMessagePart
+	for _, p := range parts {
+		if p.Type == schema.ChatMessagePartTypeText {
+			m.Content += "\n\n" + p.Text
+		} else {
+			images = append(images, p)
+		}
+	}
+	if len(images) > 0 {
+		m.MultiContent = append([]schema.ChatMessagePart{{Type: schema.ChatMessagePartTypeText, Text: m.Content}}, images...)
+	}
+	return &m
+}
+
+// attachmentRetriever 同时检索知识库和会话附件的索引，附件的分块排在前面
+type attachmentRetriever struct {
+	kb          retriever.Retriever
+	attachments retriever.Retriever
+}
+
+func (r *attachmentRetriever) Retrieve(ctx context.Context, query string, opts ...retriever.Option) ([]*schema.Document, error) {
+	attached, err := r.attachments.Retrieve(ctx, query, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve attachments: %w", err)
+	}
+	docs, err := r.kb.Retrieve(ctx, query, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return append(attached, docs...), nil
+}
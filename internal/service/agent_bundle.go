@@ -0,0 +1,878 @@
+package service
+
+import (
+	"ai-cloud/internal/component/workflow"
+	"ai-cloud/internal/model"
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/invopop/yaml"
+)
+
+//go:embed bundle_templates/*.yaml
+var bundleTemplates embed.FS
+
+// schemaRefs Agent配置中对模型、知识库、其他Agent和外部地址的引用。
+// 每个函数返回替换后的值：导出时收集依赖并脱敏，导入时映射为本地ID，返回空字符串表示无法解决。
+// 列表中无法解决的引用被移除，工作流节点中的引用是必填项，保留原值
+type schemaRefs struct {
+	model func(path, ref, modelType string) string
+	kb    func(path, ref string) string
+	agent func(path, ref string) string
+	// url MCP服务器(kind为mcp_server)和HTTP节点(kind为secret)的地址
+	url func(path, kind, u string) string
+	// secret HTTP节点的请求头、JSON请求体字段和工具节点参数中可能是密钥的值，name为请求头或字段名
+	secret func(path, name, value string) string
+}
+
+func (r *schemaRefs) walk(s *model.AgentSchema) error {
+	if s.LLMConfig.ModelID != "" {
+		s.LLMConfig.ModelID = r.model("llm_config.model_id", s.LLMConfig.ModelID, "llm")
+	}
+	if s.Memory.EmbedModelID != "" {
+		s.Memory.EmbedModelID = r.model("memory.embed_model_id", s.Memory.EmbedModelID, "embedding")
+	}
+	s.Knowledge.KnowledgeIDs = mapRefs("knowledge.knowledge_ids", s.Knowledge.KnowledgeIDs, r.kb)
+	s.SubAgents.AgentIDs = mapRefs("sub_agents.agent_ids", s.SubAgents.AgentIDs, r.agent)
+	s.MCP.Servers = mapRefs("mcp.servers", s.MCP.Servers, func(path, u string) string {
+		return r.url(path, model.BundleDepMCP, u)
+	})
+	if s.Workflow != nil {
+		return r.walkWorkflow("workflow", s.Workflow)
+	}
+	return nil
+}
+
+func (r *schemaRefs) walkWorkflow(prefix string, wf *model.WorkflowSchema) error {
+	for i := range wf.Nodes {
+		n := &wf.Nodes[i]
+		switch n.Type {
+		case model.NodeTypeLLM, model.NodeTypeRetriever, model.NodeTypeTool, model.NodeTypeAgent, model.NodeTypeHTTP, model.NodeTypeLoop:
+		default:
+			continue
+		}
+		if len(n.Config) == 0 {
+			continue
+		}
+		// 按map修改，保留配置中的其他字段
+		var cfg map[string]any
+		if err := json.Unmarshal(n.Config, &cfg); err != nil {
+			return fmt.Errorf("invalid config of node %s: %w", n.ID, err)
+		}
+		p := fmt.Sprintf("%s.nodes[%s]", prefix, n.ID)
+		switch n.Type {
+		case model.NodeTypeLLM:
+			replaceString(cfg, "model_id", func(v string) string { return r.model(p+".model_id", v, "llm") })
+		case model.NodeTypeRetriever:
+			if ids, ok := cfg["knowledge_ids"].([]any); ok {
+				for j, id := range ids {
+					if s, ok := id.(string); ok && s != "" {
+						ids[j] = keepRef(s, r.kb(fmt.Sprintf("%s.knowledge_ids[%d]", p, j), s))
+					}
+				}
+			}
+		case model.NodeTypeTool:
+			replaceString(cfg, "mcp_server", func(v string) string { return r.url(p+".mcp_server", model.BundleDepMCP, v) })
+			if args, ok := cfg["arguments"].(map[string]any); ok {
+				r.walkSecrets(p+".arguments", args)
+			}
+		case model.NodeTypeAgent:
+			replaceString(cfg, "agent_id", func(v string) string { return r.agent(p+".agent_id", v) })
+		case model.NodeTypeHTTP:
+			replaceString(cfg, "url", func(v string) string { return r.url(p+".url", model.BundleDepSecret, v) })
+			if headers, ok := cfg["headers"].(map[string]any); ok {
+				for name, v := range headers {
+					if s, ok := v.(string); ok && s != "" {
+						headers[name] = keepRef(s, r.secret(p+".headers."+name, name, s))
+					}
+				}
+			}
+			// 请求体为JSON时检查其中的字段，模板等非JSON内容保持原样
+			if body, ok := cfg["body"].(string); ok && body != "" {
+				var v any
+				if json.Unmarshal([]byte(body), &v) == nil {
+					before, _ := json.Marshal(v)
+					r.walkSecretValue(p+".body", "", &v)
+					// 没有替换时保留原来的格式
+					if after, err := json.Marshal(v); err == nil && !bytes.Equal(before, after) {
+						cfg["body"] = string(after)
+					}
+				}
+			}
+		case model.NodeTypeLoop:
+			raw, ok := cfg["body"]
+			if !ok {
+				break
+			}
+			var body model.WorkflowSchema
+			if err := remarshal(raw, &body); err != nil {
+				return fmt.Errorf("invalid loop body of node %s: %w", n.ID, err)
+			}
+			if err := r.walkWorkflow(p+".body", &body); err != nil {
+				return err
+			}
+			cfg["body"] = body
+		}
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to marshal config of node %s: %w", n.ID, err)
+		}
+		n.Config = data
+	}
+	return nil
+}
+
+// walkSecrets 递归检查对象中的字符串字段
+func (r *schemaRefs) walkSecrets(path string, m map[string]any) {
+	for name, v := range m {
+		r.walkSecretValue(path+"."+name, name, &v)
+		m[name] = v
+	}
+}
+
+func (r *schemaRefs) walkSecretValue(path, name string, v *any) {
+	switch val := (*v).(type) {
+	case string:
+		if val != "" {
+			*v = keepRef(val, r.secret(path, name, val))
+		}
+	case map[string]any:
+		r.walkSecrets(path, val)
+	case []any:
+		for i := range val {
+			r.walkSecretValue(fmt.Sprintf("%s[%d]", path, i), name, &val[i])
+		}
+	}
+}
+
+func mapRefs(prefix string, refs []string, fn func(path, ref string) string) []string {
+	out := make([]string, 0, len(refs))
+	for i, ref := range refs {
+		if v := fn(fmt.Sprintf("%s[%d]", prefix, i), ref); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func replaceString(cfg map[string]any, key string, fn func(string) string) {
+	if s, ok := cfg[key].(string); ok && s != "" {
+		cfg[key] = keepRef(s, fn(s))
+	}
+}
+
+// keepRef 工作流节点中无法解决的引用保留原值，保证工作流仍然有效
+func keepRef(old, v string) string {
+	if v == "" {
+		return old
+	}
+	return v
+}
+
+func remarshal(in any, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// secretWords 名称中包含这些词的查询参数和请求头视为密钥
+var secretWords = []string{"key", "token", "secret", "password", "passwd", "auth", "credential", "signature", "cookie", "session"}
+
+func isSecretName(name string) bool {
+	name = strings.ToLower(name)
+	for _, w := range secretWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// credentialPrefixes 值以这些前缀开头时视为密钥，不论请求头或字段的名称
+var credentialPrefixes = []string{"bearer ", "basic ", "token ", "digest ", "sk-", "ghp_", "github_pat_", "xoxb-", "xoxp-"}
+
+func isCredentialValue(value string) bool {
+	v := strings.ToLower(strings.TrimSpace(value))
+	for _, p := range credentialPrefixes {
+		if strings.HasPrefix(v, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTemplateRef 值只是一个引用工作流变量的模板，不包含密钥
+func isTemplateRef(value string) bool {
+	v := strings.TrimSpace(value)
+	return strings.HasPrefix(v, "{{") && strings.HasSuffix(v, "}}") && strings.Count(v, "{{") == 1
+}
+
+// redactURL 替换URL中的用户信息和名称像密钥的查询参数，只有用户名时用户名通常就是令牌
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), model.BundleRedacted)
+		} else {
+			u.User = url.User(model.BundleRedacted)
+		}
+	}
+	q := u.Query()
+	changed := false
+	for name := range q {
+		if isSecretName(name) {
+			q.Set(name, model.BundleRedacted)
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// redactSecret 替换名称像密钥或内容像凭证的值，引用工作流变量的模板保留
+func redactSecret(name, value string) string {
+	if isTemplateRef(value) {
+		return value
+	}
+	if isSecretName(name) || isCredentialValue(value) {
+		return model.BundleRedacted
+	}
+	return value
+}
+
+// ExportAgent 将Agent指定版本的配置导出为JSON或YAML，返回文件名、Content-Type和文件内容。
+// 引用的模型、知识库和其他Agent以名称等可移植的信息记录，MCP服务器和HTTP节点中的密钥被替换
+func (s *agentService) ExportAgent(ctx context.Context, userID uint, req *model.ExportAgentRequest) (string, string, []byte, error) {
+	agent, agentSchema, err := s.loadAgentSchema(ctx, userID, req.AgentID, req.Version)
+	if err != nil {
+		return "", "", nil, err
+	}
+	e := &bundleExporter{
+		s:      s,
+		ctx:    ctx,
+		userID: userID,
+		bundle: &model.AgentBundle{
+			Format:      model.BundleFormat,
+			Version:     model.BundleVersion,
+			Name:        agent.Name,
+			Description: agent.Description,
+			Type:        agent.Type,
+			ExportedAt:  time.Now().Unix(),
+		},
+		includeKnowledge: req.IncludeKnowledge,
+		seen:             make(map[string]bool),
+	}
+	refs := &schemaRefs{
+		model: e.addModel,
+		kb:    e.addKB,
+		agent: e.addAgent,
+		url: func(_, _, u string) string {
+			return redactURL(u)
+		},
+		secret: func(_, name, value string) string {
+			return redactSecret(name, value)
+		},
+	}
+	if err := refs.walk(&agentSchema); err != nil {
+		return "", "", nil, err
+	}
+	if e.err != nil {
+		return "", "", nil, e.err
+	}
+	e.bundle.Schema = agentSchema
+
+	name := "agent-" + safeFileName(agent.Name)
+	if req.Format == "yaml" {
+		data, err := yaml.Marshal(e.bundle)
+		if err != nil {
+			return "", "", nil, fmt.Errorf("failed to marshal agent bundle: %w", err)
+		}
+		return name + ".yaml", "application/yaml; charset=utf-8", data, nil
+	}
+	data, err := json.MarshalIndent(e.bundle, "", "  ")
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to marshal agent bundle: %w", err)
+	}
+	return name + ".json", "application/json; charset=utf-8", data, nil
+}
+
+// bundleExporter 收集导出包引用的依赖，同一依赖只记录一次
+type bundleExporter struct {
+	s                *agentService
+	ctx              context.Context
+	userID           uint
+	bundle           *model.AgentBundle
+	includeKnowledge bool
+	seen             map[string]bool
+	// size 已导出的知识库文件大小
+	size int
+	err  error
+}
+
+func (e *bundleExporter) once(kind, ref string) bool {
+	key := kind + ":" + ref
+	if e.seen[key] {
+		return false
+	}
+	e.seen[key] = true
+	return true
+}
+
+// addModel 已删除的模型不写入导出包，导入时报告为未解决
+func (e *bundleExporter) addModel(_, ref, _ string) string {
+	if !e.once(model.BundleDepModel, ref) {
+		return ref
+	}
+	m, err := e.s.modelDao.GetByID(e.ctx, e.userID, ref)
+	if err != nil {
+		log.Printf("[ExportAgent] model %s not found: %v", ref, err)
+		return ref
+	}
+	e.bundle.Models = append(e.bundle.Models, &model.BundleModel{
+		Ref:       ref,
+		Type:      m.Type,
+		ShowName:  m.ShowName,
+		Server:    m.Server,
+		ModelName: m.ModelName,
+		Dimension: m.Dimension,
+		Function:  m.Function,
+		Vision:    m.Vision,
+		Reasoning: m.Reasoning,
+	})
+	return ref
+}
+
+func (e *bundleExporter) addKB(path, ref string) string {
+	if !e.once(model.BundleDepKnowledge, ref) {
+		return ref
+	}
+	kb, err := e.s.kbDao.GetKBByID(ref)
+	if err != nil || kb.UserID != e.userID {
+		log.Printf("[ExportAgent] knowledge base %s not found", ref)
+		return ref
+	}
+	bkb := &model.BundleKnowledgeBase{
+		Ref:         ref,
+		Name:        kb.Name,
+		Description: kb.Description,
+		EmbedModel:  kb.EmbedModelID,
+	}
+	e.addModel(path, kb.EmbedModelID, "embedding")
+	if e.includeKnowledge && e.err == nil {
+		bkb.Documents, e.err = e.documents(kb)
+	}
+	e.bundle.KnowledgeBases = append(e.bundle.KnowledgeBases, bkb)
+	return ref
+}
+
+// documents 知识库中文档的原始文件，导出包的总大小不能超过导入的限制
+func (e *bundleExporter) documents(kb *model.KnowledgeBase) ([]*model.BundleDocument, error) {
+	docs, err := e.s.kbDao.GetAllDocsByKBID(kb.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents of %s: %w", kb.Name, err)
+	}
+	out := make([]*model.BundleDocument, 0, len(docs))
+	for _, doc := range docs {
+		_, data, err := e.s.fileSvc.DownloadFile(doc.FileID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read document %s: %w", doc.Title, err)
+		}
+		e.size += len(data)
+		if e.size > MaxImportSize {
+			return nil, fmt.Errorf("knowledge base contents exceed %d MB", MaxImportSize>>20)
+		}
+		out = append(out, &model.BundleDocument{Title: doc.Title, Content: data})
+	}
+	return out, nil
+}
+
+func (e *bundleExporter) addAgent(_, ref string) string {
+	if !e.once(model.BundleDepAgent, ref) {
+		return ref
+	}
+	agent, err := e.s.dao.GetByID(e.ctx, e.userID, ref)
+	if err != nil {
+		log.Printf("[ExportAgent] agent %s not found: %v", ref, err)
+		return ref
+	}
+	e.bundle.SubAgents = append(e.bundle.SubAgents, &model.BundleAgent{Ref: ref, Name: agent.Name})
+	return ref
+}
+
+// ImportAgent 从导出包创建Agent，支持JSON和YAML
+func (s *agentService) ImportAgent(ctx context.Context, userID uint, data []byte, opts *model.ImportAgentOptions) (*model.ImportAgentResult, error) {
+	bundle, err := parseBundle(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.importBundle(ctx, userID, bundle, opts)
+}
+
+func parseBundle(data []byte) (*model.AgentBundle, error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	var bundle model.AgentBundle
+	var err error
+	if bytes.HasPrefix(data, []byte("{")) {
+		err = json.Unmarshal(data, &bundle)
+	} else {
+		err = yaml.Unmarshal(data, &bundle)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid agent bundle: %w", err)
+	}
+	if bundle.Format != model.BundleFormat {
+		return nil, fmt.Errorf("unrecognized bundle format %q, expected %q", bundle.Format, model.BundleFormat)
+	}
+	if bundle.Version < 1 || bundle.Version > model.BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+	if bundle.Name == "" {
+		return nil, errors.New("bundle name is required")
+	}
+	switch bundle.Type {
+	case "":
+		bundle.Type = model.AgentTypeSimple
+	case model.AgentTypeSimple, model.AgentTypeWorkflow:
+	default:
+		return nil, fmt.Errorf("unsupported agent type %q", bundle.Type)
+	}
+	return &bundle, nil
+}
+
+func (s *agentService) importBundle(ctx context.Context, userID uint, bundle *model.AgentBundle, opts *model.ImportAgentOptions) (*model.ImportAgentResult, error) {
+	if opts == nil {
+		opts = &model.ImportAgentOptions{}
+	}
+	// 先做不依赖映射结果的校验
+	agentSchema := bundle.Schema
+	if bundle.Type == model.AgentTypeWorkflow && agentSchema.Workflow != nil {
+		if err := workflow.Validate(agentSchema.Workflow); err != nil {
+			return nil, fmt.Errorf("invalid workflow: %w", err)
+		}
+	}
+	if err := validateApprovalConfig(agentSchema.Approval); err != nil {
+		return nil, err
+	}
+
+	models, err := s.modelDao.List(ctx, userID, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	agents, err := s.dao.List(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agents: %w", err)
+	}
+	imp := &bundleImporter{
+		s:        s,
+		ctx:      ctx,
+		userID:   userID,
+		bundle:   bundle,
+		opts:     opts,
+		models:   models,
+		agents:   agents,
+		resolved: make(map[string]string),
+		result:   &model.ImportAgentResult{Resolved: []*model.BundleDependency{}, Unresolved: []*model.BundleDependency{}},
+	}
+	refs := &schemaRefs{
+		model:  imp.resolveModel,
+		kb:     imp.resolveKB,
+		agent:  imp.resolveAgent,
+		url:    imp.checkURL,
+		secret: imp.checkSecret,
+	}
+	if err := refs.walk(&agentSchema); err != nil {
+		return nil, err
+	}
+	// 没有可用的Embedding模型时关闭长期记忆
+	if agentSchema.Memory.Enabled && agentSchema.Memory.EmbedModelID == "" {
+		agentSchema.Memory.Enabled = false
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = bundle.Name
+	}
+	agent := &model.Agent{
+		ID:          GenerateUUID(),
+		UserID:      userID,
+		Name:        uniqueAgentName(agents, name),
+		Description: bundle.Description,
+		Type:        bundle.Type,
+	}
+	if err := s.validateAgentSchema(ctx, agent, &agentSchema); err != nil {
+		return nil, err
+	}
+
+	// 校验通过后才创建知识库并导入文档，之后的步骤失败时删除
+	if err := imp.createKBs(&agentSchema); err != nil {
+		imp.rollback()
+		return nil, err
+	}
+	schemaBytes, err := json.Marshal(agentSchema)
+	if err != nil {
+		imp.rollback()
+		return nil, fmt.Errorf("failed to marshal agent schema: %w", err)
+	}
+	agent.AgentSchema = string(schemaBytes)
+	if err := s.dao.Create(ctx, agent); err != nil {
+		imp.rollback()
+		return nil, err
+	}
+	imp.result.AgentID = agent.ID
+	imp.result.Name = agent.Name
+	return imp.result, nil
+}
+
+// uniqueAgentName 与已有Agent重名时添加序号，OpenAI兼容接口可以按名称调用Agent
+func uniqueAgentName(agents []*model.Agent, name string) string {
+	names := make(map[string]bool, len(agents))
+	for _, a := range agents {
+		names[a.Name] = true
+	}
+	candidate := name
+	for i := 2; names[candidate]; i++ {
+		candidate = fmt.Sprintf("%s (%d)", name, i)
+	}
+	return candidate
+}
+
+// bundleImporter 将导出包中的引用映射为当前用户的资源，同一引用只解析和报告一次
+type bundleImporter struct {
+	s      *agentService
+	ctx    context.Context
+	userID uint
+	bundle *model.AgentBundle
+	opts   *model.ImportAgentOptions
+	models []*model.Model
+	agents []*model.Agent
+	// resolved kind:ref -> 本地ID，无法解决时为空字符串
+	resolved map[string]string
+	result   *model.ImportAgentResult
+	// pendingKBs 需要新建的知识库，配置校验通过后才创建，此前配置中使用占位ID
+	pendingKBs []*pendingKB
+	// createdKBs/uploadedFiles 本次导入创建的知识库和上传的文档文件，导入失败时删除
+	createdKBs    []string
+	uploadedFiles []string
+}
+
+type pendingKB struct {
+	placeholder  string
+	bkb          *model.BundleKnowledgeBase
+	embedModelID string
+	dep          *model.BundleDependency
+}
+
+func (imp *bundleImporter) cached(kind, ref string) (string, bool) {
+	id, ok := imp.resolved[kind+":"+ref]
+	return id, ok
+}
+
+// report 记录依赖的处理结果，TargetID为空表示未解决
+func (imp *bundleImporter) report(dep *model.BundleDependency) string {
+	imp.resolved[dep.Kind+":"+dep.Ref] = dep.TargetID
+	if dep.TargetID == "" {
+		imp.result.Unresolved = append(imp.result.Unresolved, dep)
+	} else {
+		imp.result.Resolved = append(imp.result.Resolved, dep)
+	}
+	return dep.TargetID
+}
+
+// resolveModel 按服务类型和模型名称、模型名称、显示名称的顺序匹配同类型的模型，都不匹配时使用默认模型
+func (imp *bundleImporter) resolveModel(path, ref, modelType string) string {
+	if id, ok := imp.cached(model.BundleDepModel, ref); ok {
+		return id
+	}
+	dep := &model.BundleDependency{Kind: model.BundleDepModel, Ref: ref, Path: path}
+	var bm *model.BundleModel
+	for _, m := range imp.bundle.Models {
+		if m.Ref == ref {
+			bm = m
+			break
+		}
+	}
+	if bm == nil {
+		dep.Reason = "model is not described in the bundle"
+		return imp.report(dep)
+	}
+	dep.Name = bm.ModelName
+	if bm.Type != "" {
+		modelType = bm.Type
+	}
+
+	matchers := []func(m *model.Model) bool{
+		func(m *model.Model) bool {
+			return strings.EqualFold(m.Server, bm.Server) && m.ModelName == bm.ModelName
+		},
+		func(m *model.Model) bool { return m.ModelName == bm.ModelName },
+		func(m *model.Model) bool { return bm.ShowName != "" && m.ShowName == bm.ShowName },
+	}
+	for _, match := range matchers {
+		for _, m := range imp.models {
+			if m.Type == modelType && match(m) {
+				dep.TargetID, dep.Action = m.ID, "matched"
+				return imp.report(dep)
+			}
+		}
+	}
+
+	defaultID := imp.opts.DefaultModelID
+	if modelType == "embedding" {
+		defaultID = imp.opts.DefaultEmbedModelID
+	}
+	for _, m := range imp.models {
+		if defaultID != "" && m.ID == defaultID && m.Type == modelType {
+			dep.TargetID, dep.Action = m.ID, "default"
+			return imp.report(dep)
+		}
+	}
+	dep.Reason = fmt.Sprintf("no %s model matches %s/%s", modelType, bm.Server, bm.ModelName)
+	return imp.report(dep)
+}
+
+// resolveKB 关联同名的知识库，不存在时使用映射后的Embedding模型创建，并导入导出包中的文档
+func (imp *bundleImporter) resolveKB(path, ref string) string {
+	if id, ok := imp.cached(model.BundleDepKnowledge, ref); ok {
+		return id
+	}
+	dep := &model.BundleDependency{Kind: model.BundleDepKnowledge, Ref: ref, Path: path}
+	var bkb *model.BundleKnowledgeBase
+	for _, kb := range imp.bundle.KnowledgeBases {
+		if kb.Ref == ref {
+			bkb = kb
+			break
+		}
+	}
+	if bkb == nil {
+		dep.Reason = "knowledge base is not described in the bundle"
+		return imp.report(dep)
+	}
+	dep.Name = bkb.Name
+
+	if kb, err := imp.s.kbDao.GetKBByName(imp.userID, bkb.Name); err == nil {
+		dep.TargetID, dep.Action = kb.ID, "linked"
+		return imp.report(dep)
+	}
+	embedModelID := imp.resolveModel(fmt.Sprintf("knowledge_bases[%s].embed_model", bkb.Name), bkb.EmbedModel, "embedding")
+	if embedModelID == "" {
+		dep.Reason = "no embedding model to create the knowledge base"
+		return imp.report(dep)
+	}
+	placeholder := "pending-kb:" + ref
+	imp.pendingKBs = append(imp.pendingKBs, &pendingKB{placeholder: placeholder, bkb: bkb, embedModelID: embedModelID, dep: dep})
+	imp.resolved[model.BundleDepKnowledge+":"+ref] = placeholder
+	return placeholder
+}
+
+// createKBs 创建需要新建的知识库并导入文档，将配置中的占位ID替换为知识库ID，创建失败的按未解决处理
+func (imp *bundleImporter) createKBs(agentSchema *model.AgentSchema) error {
+	if len(imp.pendingKBs) == 0 {
+		return nil
+	}
+	ids := make(map[string]string, len(imp.pendingKBs))
+	for _, p := range imp.pendingKBs {
+		kb, err := imp.s.kbSvc.CreateKB(imp.userID, p.bkb.Name, p.bkb.Description, p.embedModelID)
+		if err != nil {
+			p.dep.Reason = err.Error()
+			ids[p.placeholder] = imp.report(p.dep)
+			continue
+		}
+		imp.createdKBs = append(imp.createdKBs, kb.ID)
+		p.dep.TargetID, p.dep.Action = kb.ID, "created"
+		ids[p.placeholder] = imp.report(p.dep)
+		imp.importDocuments(kb, p.bkb.Documents)
+	}
+
+	keep := func(_, v string) string { return v }
+	refs := &schemaRefs{
+		model: func(_, ref, _ string) string { return ref },
+		kb: func(_, ref string) string {
+			if id, ok := ids[ref]; ok {
+				return id
+			}
+			return ref
+		},
+		agent:  keep,
+		url:    func(_, _, u string) string { return u },
+		secret: func(_, _, v string) string { return v },
+	}
+	return refs.walk(agentSchema)
+}
+
+// rollback 删除本次导入创建的知识库和上传的文件
+func (imp *bundleImporter) rollback() {
+	for _, id := range imp.createdKBs {
+		if err := imp.s.kbSvc.DeleteKB(imp.userID, id); err != nil {
+			log.Printf("[ImportAgent] failed to delete knowledge base %s: %v", id, err)
+		}
+	}
+	for _, id := range imp.uploadedFiles {
+		if err := imp.s.fileSvc.DeleteFileOrFolder(imp.userID, id); err != nil {
+			log.Printf("[ImportAgent] failed to delete file %s: %v", id, err)
+		}
+	}
+}
+
+// importDocuments 将文档保存到云盘的知识库目录并向量化，单个文档失败不影响导入
+func (imp *bundleImporter) importDocuments(kb *model.KnowledgeBase, docs []*model.BundleDocument) {
+	if len(docs) == 0 {
+		return
+	}
+	folderID, dirErr := imp.s.fileSvc.InitKnowledgeDir(imp.userID)
+	for _, d := range docs {
+		dep := &model.BundleDependency{
+			Kind: model.BundleDepDocument,
+			Ref:  d.Title,
+			Name: d.Title,
+			Path: fmt.Sprintf("knowledge_bases[%s].documents", kb.Name),
+		}
+		if dirErr != nil {
+			dep.Reason = "failed to create knowledge directory: " + dirErr.Error()
+		} else if doc, err := imp.addDocument(kb, folderID, d); err != nil {
+			dep.Reason = err.Error()
+		} else {
+			dep.TargetID, dep.Action = doc.ID, "created"
+		}
+		imp.report(dep)
+	}
+}
+
+func (imp *bundleImporter) addDocument(kb *model.KnowledgeBase, folderID string, d *model.BundleDocument) (*model.Document, error) {
+	fileID, err := imp.s.fileSvc.UploadData(imp.userID, d.Title, d.Content, folderID)
+	if err != nil {
+		return nil, err
+	}
+	imp.uploadedFiles = append(imp.uploadedFiles, fileID)
+	f, err := imp.s.fileSvc.GetFileByID(fileID)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := imp.s.kbSvc.CreateDocument(imp.userID, kb.ID, f)
+	if err != nil {
+		return nil, err
+	}
+	doc.Status = 1 // 正在处理文档
+	if err := imp.s.kbSvc.ProcessDocument(imp.ctx, imp.userID, kb.ID, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// resolveAgent 其他Agent按名称关联
+func (imp *bundleImporter) resolveAgent(path, ref string) string {
+	if id, ok := imp.cached(model.BundleDepAgent, ref); ok {
+		return id
+	}
+	dep := &model.BundleDependency{Kind: model.BundleDepAgent, Ref: ref, Path: path}
+	for _, a := range imp.bundle.SubAgents {
+		if a.Ref == ref {
+			dep.Name = a.Name
+			break
+		}
+	}
+	if dep.Name == "" {
+		dep.Reason = "agent is not described in the bundle"
+		return imp.report(dep)
+	}
+	for _, a := range imp.agents {
+		if a.Name == dep.Name {
+			dep.TargetID, dep.Action = a.ID, "linked"
+			return imp.report(dep)
+		}
+	}
+	dep.Reason = "no agent with the same name"
+	return imp.report(dep)
+}
+
+// checkURL 导出时被脱敏的地址需要重新填写密钥
+func (imp *bundleImporter) checkURL(path, kind, u string) string {
+	if !strings.Contains(u, model.BundleRedacted) {
+		return u
+	}
+	if _, ok := imp.cached(kind, u); !ok {
+		imp.report(&model.BundleDependency{Kind: kind, Ref: u, Path: path, Reason: "contains redacted secrets"})
+	}
+	return ""
+}
+
+func (imp *bundleImporter) checkSecret(path, name, value string) string {
+	if value != model.BundleRedacted {
+		return value
+	}
+	imp.report(&model.BundleDependency{Kind: model.BundleDepSecret, Ref: path, Name: name, Path: path, Reason: "redacted secret"})
+	return ""
+}
+
+// ListAgentTemplates 内置的Agent模板
+func (s *agentService) ListAgentTemplates() ([]*model.AgentTemplate, error) {
+	entries, err := bundleTemplates.ReadDir("bundle_templates")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	templates := make([]*model.AgentTemplate, 0, len(entries))
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".yaml")
+		bundle, err := loadTemplate(id)
+		if err != nil {
+			return nil, err
+		}
+		t := &model.AgentTemplate{
+			ID:           id,
+			Name:         bundle.Name,
+			Description:  bundle.Description,
+			Type:         bundle.Type,
+			Dependencies: []string{},
+		}
+		for _, m := range bundle.Models {
+			t.Dependencies = append(t.Dependencies, fmt.Sprintf("%s: %s", m.Type, m.ModelName))
+		}
+		for _, kb := range bundle.KnowledgeBases {
+			t.Dependencies = append(t.Dependencies, fmt.Sprintf("%s: %s", model.BundleDepKnowledge, kb.Name))
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// InstantiateTemplate 从内置模板创建Agent，与导入导出包的流程相同
+func (s *agentService) InstantiateTemplate(ctx context.Context, userID uint, req *model.InstantiateTemplateRequest) (*model.ImportAgentResult, error) {
+	bundle, err := loadTemplate(req.TemplateID)
+	if err != nil {
+		return nil, err
+	}
+	return s.importBundle(ctx, userID, bundle, &req.ImportAgentOptions)
+}
+
+func loadTemplate(id string) (*model.AgentBundle, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, errors.New("template not found")
+	}
+	data, err := bundleTemplates.ReadFile("bundle_templates/" + id + ".yaml")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, errors.New("template not found")
+		}
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	bundle, err := parseBundle(data)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", id, err)
+	}
+	return bundle, nil
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"ai-cloud/config"
+	llmfactory "ai-cloud/internal/component/llm"
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	// defaultContextTokens 工作流Agent的历史token预算
+	defaultContextTokens = 4096
+	// defaultContextWindow 模型未配置上下文窗口时使用的窗口长度
+	defaultContextWindow = 16384
+	// memoryTokensPerItem 每条注入提示词的记忆预留的token数
+	memoryTokensPerItem = 64
+)
+
+const (
+	// maxTitleRunes 会话标题的最大长度
+	maxTitleRunes = 30
+	// titleReplyRunes 生成标题时参考的回复长度
+	titleReplyRunes = 500
+)
+
+const titlePrompt = `根据用户的第一条消息和助手的回复，为这段对话生成一个简短的标题，概括对话主题。
+标题使用用户消息的语言，中文不超过15个字，英文不超过8个单词，不加引号和句末标点，只输出标题本身。`
+
+const summarizePrompt = `你负责压缩对话历史。将已有摘要和新的对话内容合并为一份新的摘要，保留用户的目标、关键事实、做出的决定和尚未解决的问题，省略寒暄和重复内容。
+摘要使用第三人称，不超过300字，只输出摘要本身。`
+
+// ContextBudget 计算可用于会话历史（含摘要）的token数：模型的上下文窗口减去为输出预留的长度、系统提示词、用户消息，
+// 以及为知识库检索结果和长期记忆预留的部分。settings为会话设置，可能更换模型、知识库和提示词
+func (s *agentService) ContextBudget(ctx context.Context, userID uint, agentID string, version int, query string, settings *model.ConversationSettings) (int, error) {
+	agent, agentSchema, err := s.loadAgentSchema(ctx, userID, agentID, version)
+	if err != nil {
+		return 0, err
+	}
+	if agent.Type == model.AgentTypeWorkflow {
+		return defaultContextTokens, nil
+	}
+	settings.Apply(&agentSchema)
+	llmModelCfg, err := s.modelSvc.GetModel(ctx, userID, agentSchema.LLMConfig.ModelID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get model: %w", err)
+	}
+
+	budget := llmModelCfg.ContextWindow
+	if budget <= 0 {
+		budget = defaultContextWindow
+	}
+	maxOutput := agentSchema.LLMConfig.MaxOutputLength
+	if maxOutput <= 0 {
+		maxOutput = llmModelCfg.MaxOutputLength
+	}
+	budget -= maxOutput
+	budget -= utils.CountMessageTokens(schema.SystemMessage(agentSchema.Prompt)) + utils.CountMessageTokens(schema.UserMessage(query))
+	if len(agentSchema.Knowledge.KnowledgeIDs) > 0 {
+		// 分块大小按字符计，平均约两个字符一个token
+		budget -= agentSchema.Knowledge.TopK * config.GetConfig().RAG.ChunkSize / 2
+	}
+	if agentSchema.Memory.Enabled {
+		topK := agentSchema.Memory.TopK
+		if topK <= 0 {
+			topK = model.DefaultMemoryTopK
+		}
+		budget -= topK * memoryTokensPerItem
+	}
+	return max(budget, 0), nil
+}
+
+func (s *agentService) SupportsVision(ctx context.Context, userID uint, agentID string, version int, settings *model.ConversationSettings) (bool, error) {
+	agent, agentSchema, err := s.loadAgentSchema(ctx, userID, agentID, version)
+	if err != nil {
+		return false, err
+	}
+	if agent.Type == model.AgentTypeWorkflow {
+		return false, nil
+	}
+	settings.Apply(&agentSchema)
+	llmModelCfg, err := s.modelSvc.GetModel(ctx, userID, agentSchema.LLMConfig.ModelID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get model: %w", err)
+	}
+	return llmModelCfg.Vision, nil
+}
+
+func (s *agentService) EffectiveSettings(ctx context.Context, userID uint, agentID string, version int, settings *model.ConversationSettings) (*model.ConversationSettings, error) {
+	agent, agentSchema, err := s.loadAgentSchema(ctx, userID, agentID, version)
+	if err != nil {
+		return nil, err
+	}
+	if agent.Type == model.AgentTypeWorkflow {
+		return nil, nil
+	}
+	settings.Apply(&agentSchema)
+
+	knowledgeIDs := append([]string{}, agentSchema.Knowledge.KnowledgeIDs...)
+	effective := &model.ConversationSettings{
+		ModelID:      agentSchema.LLMConfig.ModelID,
+		Temperature:  agentSchema.LLMConfig.Temperature,
+		KnowledgeIDs: &knowledgeIDs,
+		TopK:         &agentSchema.Knowledge.TopK,
+	}
+	if settings != nil {
+		effective.Tools = settings.Tools
+		effective.PromptAddendum = settings.PromptAddendum
+	}
+	return effective, nil
+}
+
+// ValidateSettings 检查会话设置：只能用于非工作流Agent，模型须为用户的LLM模型，知识库须为Agent关联的知识库
+func (s *agentService) ValidateSettings(ctx context.Context, userID uint, agentID string, version int, settings *model.ConversationSettings) error {
+	if settings == nil {
+		return nil
+	}
+	agent, agentSchema, err := s.loadAgentSchema(ctx, userID, agentID, version)
+	if err != nil {
+		return err
+	}
+	if agent.Type == model.AgentTypeWorkflow {
+		return errors.New("workflow agents do not support conversation settings")
+	}
+	if settings.ModelID != "" {
+		llmModel, err := s.modelDao.GetByID(ctx, userID, settings.ModelID)
+		if err != nil {
+			return fmt.Errorf("conversation model: %w", err)
+		}
+		if llmModel.Type != "llm" {
+			return fmt.Errorf("model %s is not an llm model", llmModel.ShowName)
+		}
+	}
+	if settings.KnowledgeIDs != nil {
+		for _, id := range *settings.KnowledgeIDs {
+			if !slices.Contains(agentSchema.Knowledge.KnowledgeIDs, id) {
+				return fmt.Errorf("knowledge base %s is not used by the agent", id)
+			}
+		}
+	}
+	return nil
+}
+
+// SummarizeHistory 将超出上下文窗口的消息合并进已有摘要。没有可用的模型时保持原摘要
+func (s *agentService) SummarizeHistory(ctx context.Context, userID uint, agentID string, version int, summary string, msgs []*schema.Message) (string, error) {
+	if len(msgs) == 0 {
+		return summary, nil
+	}
+	llm, err := s.auxLLM(ctx, userID, agentID, version)
+	if err != nil {
+		return "", err
+	}
+	if llm == nil {
+		return summary, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("已有摘要：\n")
+	if summary == "" {
+		sb.WriteString("（无）\n")
+	} else {
+		sb.WriteString(summary + "\n")
+	}
+	sb.WriteString("\n新的对话内容：\n")
+	for _, m := range msgs {
+		role := "用户"
+		if m.Role == schema.Assistant {
+			role = "助手"
+		}
+		fmt.Fprintf(&sb, "%s：%s\n", role, m.Content)
+	}
+
+	out, err := llm.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(summarizePrompt),
+		schema.UserMessage(sb.String()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize history: %w", err)
+	}
+	return strings.TrimSpace(out.Content), nil
+}
+
+// GenerateTitle 根据第一轮对话生成会话标题。没有可用的模型或生成结果为空时截取用户消息作为标题
+func (s *agentService) GenerateTitle(ctx context.Context, userID uint, agentID string, version int, query, reply string) (string, error) {
+	llm, err := s.auxLLM(ctx, userID, agentID, version)
+	if err != nil {
+		return "", err
+	}
+	if llm == nil {
+		return truncateTitle(query), nil
+	}
+
+	if r := []rune(reply); len(r) > titleReplyRunes {
+		reply = string(r[:titleReplyRunes])
+	}
+	out, err := llm.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(titlePrompt),
+		schema.UserMessage(fmt.Sprintf("用户：%s\n助手：%s", query, reply)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate title: %w", err)
+	}
+	if title := cleanTitle(out.Content); title != "" {
+		return title, nil
+	}
+	return truncateTitle(query), nil
+}
+
+// cleanTitle 取模型输出的第一行，去掉引号、"标题："前缀和句末标点
+func cleanTitle(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	for _, prefix := range []string{"标题：", "标题:", "Title:"} {
+		s = strings.TrimPrefix(s, prefix)
+	}
+	const quotes, puncts = " \t\"'“”‘’《》「」*#", "。．.！!？?，,；;：:"
+	s = strings.Trim(strings.TrimRight(strings.Trim(s, quotes), puncts), quotes)
+	return truncateTitle(s)
+}
+
+// truncateTitle 截断为标题的最大长度
+func truncateTitle(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > maxTitleRunes {
+		return string(r[:maxTitleRunes]) + "…"
+	}
+	return s
+}
+
+// auxLLM 标题、摘要等辅助任务使用的模型：优先使用配置的低成本模型，否则使用Agent的模型。
+// 未配置低成本模型的工作流Agent没有可用的模型，返回nil
+func (s *agentService) auxLLM(ctx context.Context, userID uint, agentID string, version int) (einomodel.ToolCallingChatModel, error) {
+	if cfg := config.GetConfig().Conversation.TitleLLM; cfg.Model != "" && cfg.BaseURL != "" {
+		llm, err := llmfactory.GetLLMClient(ctx, &model.Model{
+			Type:            "llm",
+			Server:          "openai",
+			BaseURL:         cfg.BaseURL,
+			ModelName:       cfg.Model,
+			APIKey:          cfg.APIKey,
+			MaxOutputLength: cfg.MaxTokens,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create title llm client: %w", err)
+		}
+		return llm, nil
+	}
+
+	agent, agentSchema, err := s.loadAgentSchema(ctx, userID, agentID, version)
+	if err != nil {
+		return nil, err
+	}
+	if agent.Type == model.AgentTypeWorkflow {
+		return nil, nil
+	}
+	return s.plainLLM(ctx, userID, &agentSchema)
+}
+
+// plainLLM 使用Agent配置的模型创建不带生成参数和思考的LLM，用于摘要、记忆提取等辅助任务
+func (s *agentService) plainLLM(ctx context.Context, userID uint, agentSchema *model.AgentSchema) (einomodel.ToolCallingChatModel, error) {
+	llmModelCfg, err := s.modelSvc.GetModel(ctx, userID, agentSchema.LLMConfig.ModelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model: %w", err)
+	}
+	llm, err := llmfactory.GetLLMClientWithConfig(ctx, llmModelCfg, &model.LLMConfig{ModelID: agentSchema.LLMConfig.ModelID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create llm client: %w", err)
+	}
+	return llm, nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// validateMemoryConfig 开启记忆时必须指定Embedding模型
+func (s *agentService) validateMemoryConfig(ctx context.Context, userID uint, cfg model.MemoryConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.EmbedModelID == "" {
+		return errors.New("memory requires an embedding model")
+	}
+	embedModel, err := s.modelDao.GetByID(ctx, userID, cfg.EmbedModelID)
+	if err != nil {
+		return fmt.Errorf("memory embedding model: %w", err)
+	}
+	if embedModel.Type != "embedding" {
+		return fmt.Errorf("model %s is not an embedding model", embedModel.ShowName)
+	}
+	return nil
+}
+
+// recallMemoryLambda 检索与用户消息相关的记忆。检索失败不影响对话，只是不注入记忆
+func (s *agentService) recallMemoryLambda(userID uint, agentID string, cfg *model.MemoryConfig) func(ctx context.Context, query string) (string, error) {
+	return func(ctx context.Context, query string) (string, error) {
+		memories, err := s.memorySvc.Recall(ctx, userID, agentID, cfg, query)
+		if err != nil {
+			log.Printf("[Memory] failed to recall memories for agent %s: %v", agentID, err)
+		}
+		return formatMemories(memories), nil
+	}
+}
+
+func (s *agentService) ExtractMemories(ctx context.Context, userID uint, agentID string, version int, convID, query, reply string) error {
+	agent, agentSchema, err := s.loadAgentSchema(ctx, userID, agentID, version)
+	if err != nil {
+		return err
+	}
+	if agent.Type == model.AgentTypeWorkflow || !agentSchema.Memory.Enabled || query == "" || reply == "" {
+		return nil
+	}
+
+	llm, err := s.plainLLM(ctx, userID, &agentSchema)
+	if err != nil {
+		return err
+	}
+	return s.memorySvc.Extract(ctx, userID, agentID, &agentSchema.Memory, llm, convID, query, reply)
+}
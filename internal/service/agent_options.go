@@ -0,0 +1,115 @@
+package service
+
+import (
+	"ai-cloud/internal/model"
+
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ExecuteOption 运行Agent时的可选参数
+type ExecuteOption func(*ExecuteOptions)
+
+type ExecuteOptions struct {
+	// Version 运行的Agent版本，见 model.AgentVersionDraft / model.AgentVersionLatest
+	Version int
+	// Debug 调试模式下，工作流会在回复的Extra中附带每个节点的输出，Trace事件也会实时写入输出流
+	Debug bool
+	// ConvID/MsgID Trace关联的会话和助手回复消息
+	ConvID string
+	MsgID  string
+	// Temperature/TopP/MaxTokens 覆盖Agent配置中的生成参数，仅对非工作流Agent生效
+	Temperature *float64
+	TopP        *float64
+	MaxTokens   int
+	// ClientTools 由调用方执行的工具。模型调用这些工具时运行结束，回复中携带工具调用，见 OpenAI 兼容接口
+	ClientTools []*schema.ToolInfo
+	// Memory 检索用户的长期记忆注入提示词，仅对开启了记忆的Agent生效
+	Memory bool
+	// Settings 覆盖Agent配置的会话设置，仅对非工作流Agent生效
+	Settings *model.ConversationSettings
+	// Attachments 会话附件索引，与知识库一同检索，仅对非工作流Agent生效
+	Attachments retriever.Retriever
+}
+
+// WithAgentVersion 指定运行的Agent版本
+func WithAgentVersion(version int) ExecuteOption {
+	return func(o *ExecuteOptions) {
+		o.Version = version
+	}
+}
+
+// WithDebug 以调试模式运行
+func WithDebug() ExecuteOption {
+	return func(o *ExecuteOptions) {
+		o.Debug = true
+	}
+}
+
+func getExecuteOptions(opts ...ExecuteOption) *ExecuteOptions {
+	o := &ExecuteOptions{
+		Version: model.AgentVersionLatest,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithTrace 将本次运行的Trace关联到会话及助手回复消息
+func WithTrace(convID, msgID string) ExecuteOption {
+	return func(o *ExecuteOptions) {
+		o.ConvID = convID
+		o.MsgID = msgID
+	}
+}
+
+// WithMemory 使用用户的长期记忆，仅用于用户本人的会话
+func WithMemory() ExecuteOption {
+	return func(o *ExecuteOptions) {
+		o.Memory = true
+	}
+}
+
+// WithSettings 使用会话设置覆盖Agent配置
+func WithSettings(settings *model.ConversationSettings) ExecuteOption {
+	return func(o *ExecuteOptions) {
+		o.Settings = settings
+	}
+}
+
+// WithAttachments 同时检索会话附件的索引，r为nil时不检索
+func WithAttachments(r retriever.Retriever) ExecuteOption {
+	return func(o *ExecuteOptions) {
+		o.Attachments = r
+	}
+}
+
+// WithGeneration 覆盖Agent的生成参数，为nil或0的参数使用Agent配置
+func WithGeneration(temperature, topP *float64, maxTokens int) ExecuteOption {
+	return func(o *ExecuteOptions) {
+		o.Temperature = temperature
+		o.TopP = topP
+		o.MaxTokens = maxTokens
+	}
+}
+
+// WithClientTools 提供由调用方执行的工具
+func WithClientTools(tools []*schema.ToolInfo) ExecuteOption {
+	return func(o *ExecuteOptions) {
+		o.ClientTools = tools
+	}
+}
+
+// applyLLMConfig 将运行参数中的生成参数覆盖到Agent的LLM配置
+func (o *ExecuteOptions) applyLLMConfig(cfg *model.LLMConfig) {
+	if o.Temperature != nil {
+		cfg.Temperature = o.Temperature
+	}
+	if o.TopP != nil {
+		cfg.TopP = o.TopP
+	}
+	if o.MaxTokens > 0 {
+		cfg.MaxOutputLength = o.MaxTokens
+	}
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"io"
+
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/flow/agent"
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	reactGraphName = "ReActAgent"
+	reactModelNode = "chat"
+	reactToolsNode = "tools"
+	// reactMaxStep ReAct循环的最大步数
+	reactMaxStep = 10
+)
+
+// reactState ReAct循环中累积的消息。与 flow/agent/react 的实现相同，
+// 但状态类型已注册序列化，运行中断（等待工具审批）时可以保存为checkpoint。
+type reactState struct {
+	Messages []*schema.Message
+}
+
+func init() {
+	_ = compose.RegisterSerializableType[reactState]("ai_cloud_react_state")
+	_ = compose.RegisterSerializableType[model.UserMessage]("ai_cloud_user_message")
+}
+
+// newReactGraph 构建ReAct Agent的Graph，作为子图加入Agent的Graph。
+// clientTools 由调用方执行，模型调用其中的工具时直接结束，输出中携带工具调用
+func newReactGraph(ctx context.Context, llm einomodel.ToolCallingChatModel, tools []tool.BaseTool, clientTools []*schema.ToolInfo) (*compose.Graph[[]*schema.Message, *schema.Message], []compose.GraphAddNodeOpt, error) {
+	toolInfos := make([]*schema.ToolInfo, 0, len(tools)+len(clientTools))
+	for _, t := range tools {
+		info, err := t.Info(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		toolInfos = append(toolInfos, info)
+	}
+	clientToolNames := make(map[string]bool, len(clientTools))
+	for _, info := range clientTools {
+		clientToolNames[info.Name] = true
+	}
+	toolInfos = append(toolInfos, clientTools...)
+	chatModel, err := agent.ChatModelWithTools(nil, llm, toolInfos)
+	if err != nil {
+		return nil, nil, err
+	}
+	toolsNode, err := compose.NewToolNode(ctx, &compose.ToolsNodeConfig{Tools: tools})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	graph := compose.NewGraph[[]*schema.Message, *schema.Message](compose.WithGenLocalState(func(ctx context.Context) *reactState {
+		return &reactState{Messages: make([]*schema.Message, 0, reactMaxStep+1)}
+	}))
+
+	modelPreHandle := func(ctx context.Context, input []*schema.Message, state *reactState) ([]*schema.Message, error) {
+		state.Messages = append(state.Messages, input...)
+		return state.Messages, nil
+	}
+	if err = graph.AddChatModelNode(reactModelNode, chatModel, compose.WithStatePreHandler(modelPreHandle), compose.WithNodeName("ChatModel")); err != nil {
+		return nil, nil, err
+	}
+
+	toolsPreHandle := func(ctx context.Context, input *schema.Message, state *reactState) (*schema.Message, error) {
+		// 审批后恢复运行时工具节点重新执行，eino不保存其输入，从状态中取回待执行的工具调用
+		if input == nil {
+			return state.Messages[len(state.Messages)-1], nil
+		}
+		state.Messages = append(state.Messages, input)
+		return input, nil
+	}
+	if err = graph.AddToolsNode(reactToolsNode, toolsNode, compose.WithStatePreHandler(toolsPreHandle), compose.WithNodeName("Tools")); err != nil {
+		return nil, nil, err
+	}
+
+	_ = graph.AddEdge(compose.START, reactModelNode)
+	if err = graph.AddBranch(reactModelNode, compose.NewStreamGraphBranch(func(ctx context.Context, sr *schema.StreamReader[*schema.Message]) (string, error) {
+		toolCalls, err := readToolCalls(sr, len(clientToolNames) > 0)
+		if err != nil {
+			return "", err
+		}
+		for _, call := range toolCalls {
+			if clientToolNames[call.Function.Name] {
+				return compose.END, nil
+			}
+		}
+		if len(toolCalls) > 0 {
+			return reactToolsNode, nil
+		}
+		return compose.END, nil
+	}, map[string]bool{reactToolsNode: true, compose.END: true})); err != nil {
+		return nil, nil, err
+	}
+	_ = graph.AddEdge(reactToolsNode, reactModelNode)
+
+	opts := []compose.GraphAddNodeOpt{
+		compose.WithGraphCompileOptions(
+			compose.WithMaxRunSteps(reactMaxStep),
+			compose.WithNodeTriggerMode(compose.AnyPredecessor),
+			compose.WithGraphName(reactGraphName),
+		),
+		compose.WithNodeName("Agent"),
+	}
+	return graph, opts, nil
+}
+
+// readToolCalls 根据模型流式输出的第一个非空chunk判断是否调用工具。
+// full为true时读取完整输出以获得全部工具调用，否则只返回第一个chunk中的工具调用
+func readToolCalls(sr *schema.StreamReader[*schema.Message], full bool) ([]schema.ToolCall, error) {
+	defer sr.Close()
+	var chunks []*schema.Message
+	for {
+		msg, err := sr.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(chunks) == 0 {
+			if len(msg.ToolCalls) == 0 {
+				if len(msg.Content) == 0 {
+					continue
+				}
+				return nil, nil
+			}
+			if !full {
+				return msg.ToolCalls, nil
+			}
+		}
+		chunks = append(chunks, msg)
+	}
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+	msg, err := schema.ConcatMessages(chunks)
+	if err != nil {
+		return nil, err
+	}
+	return msg.ToolCalls, nil
+}
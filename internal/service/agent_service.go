@@ -3,6 +3,7 @@ package service
 import (
 	llmfactory "ai-cloud/internal/component/llm"
 	mretriever "ai-cloud/internal/component/retriever/milvus"
+	"ai-cloud/internal/component/workflow"
 	"ai-cloud/internal/dao"
 	"ai-cloud/internal/model"
 	"context"
@@ -13,9 +14,9 @@ import (
 
 	mcpp "github.com/cloudwego/eino-ext/components/tool/mcp"
 	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/components/retriever"
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/compose"
-	"github.com/cloudwego/eino/flow/agent/react"
 	"github.com/cloudwego/eino/schema"
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
@@ -27,6 +28,7 @@ const (
 	ChatTemplate   = "ChatTemplate"
 	ChatModel      = "ChatModel"
 	Retriever      = "Retriever"
+	Memory         = "Memory"
 	Agent          = "Agent"
 )
 
@@ -37,27 +39,70 @@ type AgentService interface {
 	GetAgent(ctx context.Context, userID uint, agentID string) (*model.Agent, error)
 	ListAgents(ctx context.Context, userID uint) ([]*model.Agent, error)
 	PageAgents(ctx context.Context, userID uint, page, size int) ([]*model.Agent, int64, error)
-	ExecuteAgent(ctx context.Context, userID uint, agentID string, msg model.UserMessage) (string, error)
-	StreamExecuteAgent(ctx context.Context, userID uint, agentID string, msg model.UserMessage) (*schema.StreamReader[*schema.Message], error)
+	ExecuteAgent(ctx context.Context, userID uint, agentID string, msg model.UserMessage, opts ...ExecuteOption) (string, error)
+	StreamExecuteAgent(ctx context.Context, userID uint, agentID string, msg model.UserMessage, opts ...ExecuteOption) (*schema.StreamReader[*schema.Message], error)
+
+	// 会话上下文管理
+	ContextBudget(ctx context.Context, userID uint, agentID string, version int, query string, settings *model.ConversationSettings) (int, error)
+	// EffectiveSettings 会话设置与Agent配置合并后的生效值，工作流Agent不使用会话设置，返回nil
+	EffectiveSettings(ctx context.Context, userID uint, agentID string, version int, settings *model.ConversationSettings) (*model.ConversationSettings, error)
+	ValidateSettings(ctx context.Context, userID uint, agentID string, version int, settings *model.ConversationSettings) error
+	// SupportsVision Agent生效的模型是否支持图片输入，工作流Agent不接收图片
+	SupportsVision(ctx context.Context, userID uint, agentID string, version int, settings *model.ConversationSettings) (bool, error)
+	SummarizeHistory(ctx context.Context, userID uint, agentID string, version int, summary string, msgs []*schema.Message) (string, error)
+	// GenerateTitle 根据第一轮对话生成会话标题
+	GenerateTitle(ctx context.Context, userID uint, agentID string, version int, query, reply string) (string, error)
+
+	// ExtractMemories 对开启了长期记忆的Agent，从一轮对话中提取用户记忆
+	ExtractMemories(ctx context.Context, userID uint, agentID string, version int, convID, query, reply string) error
+
+	// 工具审批
+	ResumeAgent(ctx context.Context, userID uint, runID string, decisions []model.ApprovalDecision) (*schema.StreamReader[*schema.Message], *model.AgentRun, error)
+	ListPendingApprovals(ctx context.Context, userID uint) ([]*model.ToolApproval, error)
+	// CancelPausedRun 取消助手回复对应的、等待审批的运行，返回是否存在这样的运行
+	CancelPausedRun(ctx context.Context, userID uint, msgID string) (bool, error)
+
+	// 版本管理
+	PublishAgent(ctx context.Context, userID uint, agentID string, changelog string) (*model.AgentVersion, error)
+	ListAgentVersions(ctx context.Context, userID uint, agentID string) ([]*model.AgentVersion, error)
+	GetAgentVersion(ctx context.Context, userID uint, agentID string, version int) (*model.AgentVersion, error)
+	RollbackAgent(ctx context.Context, userID uint, agentID string, version int) error
+	DiffAgentVersions(ctx context.Context, userID uint, agentID string, from, to int) ([]model.SchemaDiff, error)
+
+	// 导出、导入和模板
+	ExportAgent(ctx context.Context, userID uint, req *model.ExportAgentRequest) (string, string, []byte, error)
+	ImportAgent(ctx context.Context, userID uint, data []byte, opts *model.ImportAgentOptions) (*model.ImportAgentResult, error)
+	ListAgentTemplates() ([]*model.AgentTemplate, error)
+	InstantiateTemplate(ctx context.Context, userID uint, req *model.InstantiateTemplateRequest) (*model.ImportAgentResult, error)
 }
 
 type agentService struct {
 	dao        dao.AgentDao
+	versionDao dao.AgentVersionDao
 	modelSvc   ModelService
 	kbSvc      KBService
 	kbDao      dao.KnowledgeBaseDao
 	modelDao   dao.ModelDao
 	historySvc HistoryService
+	traceDao   dao.TraceDao
+	runDao     dao.AgentRunDao
+	memorySvc  MemoryService
+	fileSvc    FileService
 }
 
-func NewAgentService(dao dao.AgentDao, modelSvc ModelService, kbSvc KBService, kbDao dao.KnowledgeBaseDao, modelDao dao.ModelDao, historySvc HistoryService) AgentService {
+func NewAgentService(dao dao.AgentDao, versionDao dao.AgentVersionDao, modelSvc ModelService, kbSvc KBService, kbDao dao.KnowledgeBaseDao, modelDao dao.ModelDao, historySvc HistoryService, traceDao dao.TraceDao, runDao dao.AgentRunDao, memorySvc MemoryService, fileSvc FileService) AgentService {
 	return &agentService{
 		dao:        dao,
+		versionDao: versionDao,
 		modelSvc:   modelSvc,
 		kbSvc:      kbSvc,
 		kbDao:      kbDao,
 		modelDao:   modelDao,
 		historySvc: historySvc,
+		traceDao:   traceDao,
+		runDao:     runDao,
+		memorySvc:  memorySvc,
+		fileSvc:    fileSvc,
 	}
 }
 
@@ -66,11 +111,49 @@ func (s *agentService) CreateAgent(ctx context.Context, agent *model.Agent) erro
 }
 
 func (s *agentService) UpdateAgent(ctx context.Context, agent *model.Agent) error {
+	var agentSchema model.AgentSchema
+	if err := json.Unmarshal([]byte(agent.AgentSchema), &agentSchema); err != nil {
+		return fmt.Errorf("failed to parse agent schema: %w", err)
+	}
+	if err := s.validateAgentSchema(ctx, agent, &agentSchema); err != nil {
+		return err
+	}
 	return s.dao.Update(ctx, agent)
 }
 
+// validateAgentSchema 保存Agent配置前的校验
+func (s *agentService) validateAgentSchema(ctx context.Context, agent *model.Agent, agentSchema *model.AgentSchema) error {
+	if agent.Type == model.AgentTypeWorkflow && agentSchema.Workflow != nil {
+		if err := workflow.Validate(agentSchema.Workflow); err != nil {
+			return fmt.Errorf("invalid workflow: %w", err)
+		}
+	}
+	if agent.Type == model.AgentTypeWorkflow && len(agentSchema.Approval.Policies) > 0 {
+		return errors.New("tool approval is not supported for workflow agents")
+	}
+	if err := validateApprovalConfig(agentSchema.Approval); err != nil {
+		return err
+	}
+	if err := s.validateMemoryConfig(ctx, agent.UserID, agentSchema.Memory); err != nil {
+		return err
+	}
+	return s.checkAgentReferences(ctx, agent, agentSchema)
+}
+
 func (s *agentService) DeleteAgent(ctx context.Context, userID uint, agentID string) error {
-	return s.dao.Delete(ctx, userID, agentID)
+	if err := s.dao.Delete(ctx, userID, agentID); err != nil {
+		return err
+	}
+	if err := s.versionDao.DeleteByAgent(ctx, agentID); err != nil {
+		return err
+	}
+	if err := s.traceDao.DeleteByAgent(ctx, agentID); err != nil {
+		return err
+	}
+	if err := s.memorySvc.DeleteAgentMemories(ctx, userID, agentID); err != nil {
+		return err
+	}
+	return s.runDao.DeleteByAgent(ctx, agentID)
 }
 
 func (s *agentService) GetAgent(ctx context.Context, userID uint, agentID string) (*model.Agent, error) {
@@ -85,20 +168,21 @@ func (s *agentService) PageAgents(ctx context.Context, userID uint, page, size i
 	return s.dao.Page(ctx, userID, page, size)
 }
 
-func (s *agentService) ExecuteAgent(ctx context.Context, userID uint, agentID string, msg model.UserMessage) (string, error) {
-	// Retrieve the agent
-	agent, err := s.dao.GetByID(ctx, userID, agentID)
+func (s *agentService) ExecuteAgent(ctx context.Context, userID uint, agentID string, msg model.UserMessage, opts ...ExecuteOption) (string, error) {
+	o := getExecuteOptions(opts...)
+
+	ctx, err := enterAgent(ctx, agentID, msg.History)
 	if err != nil {
 		return "", err
 	}
 
-	// Parse the agent schema
-	var agentSchema model.AgentSchema
-	if err := json.Unmarshal([]byte(agent.AgentSchema), &agentSchema); err != nil {
+	// Retrieve the agent schema of the requested version
+	agent, agentSchema, err := s.loadAgentSchema(ctx, userID, agentID, o.Version)
+	if err != nil {
 		return "", err
 	}
 
-	graph, err := s.buildGraph(ctx, userID, agentSchema)
+	graph, err := s.buildAgentGraph(ctx, userID, agent, agentSchema, o)
 	if err != nil {
 		return "", fmt.Errorf("buildGraph失败：%w", err)
 	}
@@ -109,53 +193,123 @@ func (s *agentService) ExecuteAgent(ctx context.Context, userID uint, agentID st
 		return "", err
 	}
 
-	res, err := runner.Invoke(ctx, &msg)
+	var runOpts []compose.Option
+	tr := s.startTrace(ctx, userID, agentID, &msg, o, nil)
+	if tr != nil {
+		runOpts = append(runOpts, compose.WithCallbacks(tr.Handler()))
+	}
+
+	res, err := runner.Invoke(ctx, &msg, runOpts...)
 	if err != nil {
+		finishTrace(tr, err)
 		return "", err
 	}
 	return res.String(), nil
 }
 
-func (s *agentService) StreamExecuteAgent(ctx context.Context, userID uint, agentID string, msg model.UserMessage) (*schema.StreamReader[*schema.Message], error) {
-	// 1.获取Agent配置
-	agent, err := s.dao.GetByID(ctx, userID, agentID)
+func (s *agentService) StreamExecuteAgent(ctx context.Context, userID uint, agentID string, msg model.UserMessage, opts ...ExecuteOption) (*schema.StreamReader[*schema.Message], error) {
+	return s.streamAgent(ctx, userID, agentID, msg, getExecuteOptions(opts...), nil, nil)
+}
+
+// streamAgent 流式运行Agent。run不为nil时从该运行的checkpoint恢复，decisions为已审批的工具调用
+func (s *agentService) streamAgent(ctx context.Context, userID uint, agentID string, msg model.UserMessage, o *ExecuteOptions, run *model.AgentRun, decisions map[string]*model.ToolApproval) (*schema.StreamReader[*schema.Message], error) {
+	ctx, err := enterAgent(ctx, agentID, msg.History)
 	if err != nil {
 		return nil, err
 	}
 
-	var agentSchema model.AgentSchema
-	if err := json.Unmarshal([]byte(agent.AgentSchema), &agentSchema); err != nil {
+	// 1.获取指定版本的Agent配置
+	agent, agentSchema, err := s.loadAgentSchema(ctx, userID, agentID, o.Version)
+	if err != nil {
 		return nil, err
 	}
 
 	// 2.构建Graph
-	graph, err := s.buildGraph(ctx, userID, agentSchema)
+	graph, err := s.buildAgentGraph(ctx, userID, agent, agentSchema, o)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build agent graph：%w", err)
 	}
 
+	// 顶层运行且配置了工具审批策略时，运行可在工具调用处中断，状态保存在AgentRun中
+	topLevel := currentAgentCall(ctx).emit == nil
+	compileOpts := []compose.GraphCompileOption{compose.WithGraphName("EinoAgent"), compose.WithNodeTriggerMode(compose.AllPredecessor)}
+	var runOpts []compose.Option
+	var session *approvalSession
+	if topLevel && (run != nil || (agent.Type != model.AgentTypeWorkflow && len(agentSchema.Approval.Policies) > 0)) {
+		if run == nil {
+			if run, err = s.createRun(ctx, userID, agent, msg, o); err != nil {
+				return nil, err
+			}
+		}
+		session = &approvalSession{decisions: decisions, results: run.ToolResults}
+		ctx = withApprovalSession(ctx, session)
+		compileOpts = append(compileOpts, compose.WithCheckPointStore(&checkPointStore{dao: s.runDao}))
+		runOpts = append(runOpts, compose.WithCheckPointID(run.ID))
+	}
+
 	// 3.构建runner
-	runner, err := graph.Compile(ctx, compose.WithGraphName("EinoAgent"), compose.WithNodeTriggerMode(compose.AllPredecessor))
+	runner, err := graph.Compile(ctx, compileOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compile agent graph: %w", err)
 	}
 
+	// 顶层运行时，工具调用、检索、用量、子Agent调用和Trace等事件与回复合并到同一个流中
+	var events *eventStream
+	if topLevel {
+		events = newEventStream()
+		ctx = withAgentEvents(ctx, events.sendAgentEvent)
+		runOpts = append(runOpts, compose.WithCallbacks(events.handler()))
+	}
+
+	tr := s.startTrace(ctx, userID, agentID, &msg, o, events)
+	if tr != nil {
+		runOpts = append(runOpts, compose.WithCallbacks(tr.Handler()))
+	}
+
+	if events != nil {
+		return events.run(ctx, tr, func(ctx context.Context) (*schema.StreamReader[*schema.Message], error) {
+			sr, err := runner.Stream(ctx, &msg, runOpts...)
+			if session != nil {
+				return s.finishRun(ctx, run, session, events, sr, err)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to stream: %w", err)
+			}
+			return sr, nil
+		}), nil
+	}
+
 	// 执行stream
-	sr, err := runner.Stream(ctx, &msg)
+	sr, err := runner.Stream(ctx, &msg, runOpts...)
 	if err != nil {
+		finishTrace(tr, err)
 		return nil, fmt.Errorf("failed to stream: %w", err)
 	}
 
 	return sr, nil
 }
 
-func (s *agentService) buildGraph(ctx context.Context, userID uint, agentSchema model.AgentSchema) (*compose.Graph[*model.UserMessage, *schema.Message], error) {
+// buildAgentGraph 根据Agent类型构建对应的Graph
+func (s *agentService) buildAgentGraph(ctx context.Context, userID uint, agent *model.Agent, agentSchema model.AgentSchema, o *ExecuteOptions) (*compose.Graph[*model.UserMessage, *schema.Message], error) {
+	if agent.Type == model.AgentTypeWorkflow {
+		return s.buildWorkflow(ctx, userID, agentSchema.Workflow, o)
+	}
+	o.Settings.Apply(&agentSchema)
+	o.applyLLMConfig(&agentSchema.LLMConfig)
+	return s.buildGraph(ctx, userID, agent.ID, agentSchema, o)
+}
+
+// buildGraph 构建非工作流Agent的Graph
+func (s *agentService) buildGraph(ctx context.Context, userID uint, agentID string, agentSchema model.AgentSchema, o *ExecuteOptions) (*compose.Graph[*model.UserMessage, *schema.Message], error) {
+	clientTools := o.ClientTools
+	useMemory := o.Memory && agentSchema.Memory.Enabled
+
 	// 1. 创建LLM
 	llmModelCfg, err := s.modelSvc.GetModel(ctx, userID, agentSchema.LLMConfig.ModelID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create get model:%w", err)
 	}
-	llm, err := llmfactory.GetLLMClient(ctx, llmModelCfg)
+	llm, err := llmfactory.GetLLMClientWithConfig(ctx, llmModelCfg, &agentSchema.LLMConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create llm client:%w", err)
 	}
@@ -169,74 +323,69 @@ func (s *agentService) buildGraph(ctx context.Context, userID uint, agentSchema
 		Ctx:      ctx,
 		TopK:     agentSchema.Knowledge.TopK, // 默认返回前5个最相关的文档
 	}
+	var kbRetriever retriever.Retriever = multiRetriever
+	if o.Attachments != nil {
+		kbRetriever = &attachmentRetriever{kb: multiRetriever, attachments: o.Attachments}
+	}
 
 	// 3. 构建Tools
-	tools := []tool.BaseTool{}
 	// 3.1 加载MCPTools
-	for _, serverURL := range agentSchema.MCP.Servers {
-		cli, err := client.NewSSEMCPClient(serverURL)
-		err = cli.Start(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create mcp client: %w", err)
-		}
-		initRequest := mcp.InitializeRequest{}
-		initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
-		initRequest.Params.ClientInfo = mcp.Implementation{
-			Name:    "example-client",
-			Version: "1.0.0",
-		}
-
-		_, err = cli.Initialize(ctx, initRequest)
-
-		if err != nil {
+	tools, err := loadMCPTools(ctx, agentSchema.MCP.Servers)
+	if err != nil {
+		return nil, err
+	}
+	// 3.2 加载系统和用户自定义Tools
+	// 3.3 加载子Agent
+	agentTools, err := s.loadAgentTools(ctx, userID, agentSchema.SubAgents.AgentIDs)
+	if err != nil {
+		return nil, err
+	}
+	tools = append(tools, agentTools...)
+	// 3.4 只保留会话设置中启用的工具
+	if o.Settings != nil && o.Settings.Tools != nil {
+		if tools, err = filterTools(ctx, tools, *o.Settings.Tools); err != nil {
 			return nil, err
 		}
-		// 获取 mcpp 工具
-		mcppTools, err := mcpp.GetTools(ctx, &mcpp.Config{Cli: cli})
-		if err != nil {
-			return nil, fmt.Errorf("failed to get mcpp tools: %w", err)
-		}
-		tools = append(tools, mcppTools...)
 	}
-	// 3.2 加载系统和用户自定义Tools
+	// 3.5 为配置了审批策略的工具加上审批
+	tools, _, err = wrapApprovalTools(ctx, tools, agentSchema.Approval)
+	if err != nil {
+		return nil, err
+	}
 
-	// 4. 构建提示词
-	promptTemplate := prompt.FromMessages(
-		schema.FString,
-		schema.SystemMessage(agentSchema.Prompt),
+	// 4. 构建提示词，开启记忆时在系统提示词后注入检索到的用户记忆
+	templates := []schema.MessagesTemplate{schema.SystemMessage(agentSchema.Prompt)}
+	if useMemory {
+		templates = append(templates, schema.SystemMessage("以下是关于用户的长期记忆，回答时可以参考：\n{memories}"))
+	}
+	templates = append(templates,
 		schema.MessagesPlaceholder("history", true),
 		schema.UserMessage("用户消息：{query}\n 参考信息：{documents}"),
+		schema.MessagesPlaceholder("tool_messages", true),
 	)
+	// 本轮用户消息的附件由attachmentTemplate加入模板生成的用户消息
+	promptTemplate := &attachmentTemplate{prompt.FromMessages(schema.FString, templates...)}
 
 	// 5. 实现图编排
 	graph := compose.NewGraph[*model.UserMessage, *schema.Message]()
 	_ = graph.AddLambdaNode(InputToQuery, compose.InvokableLambdaWithOption(inputToQueryLambda), compose.WithNodeName("UserMessageToQuery"))
 	_ = graph.AddChatTemplateNode(ChatTemplate, promptTemplate)
-	_ = graph.AddRetrieverNode(Retriever, multiRetriever, compose.WithOutputKey("documents"))
+	_ = graph.AddRetrieverNode(Retriever, kbRetriever, compose.WithOutputKey("documents"))
 	_ = graph.AddLambdaNode(InputToHistory, compose.InvokableLambdaWithOption(inputToHistoryLambda), compose.WithNodeName("UserMessageToHistory"))
+	if useMemory {
+		_ = graph.AddLambdaNode(Memory, compose.InvokableLambda(s.recallMemoryLambda(userID, agentID, &agentSchema.Memory)), compose.WithNodeName("MemoryRetriever"), compose.WithOutputKey("memories"))
+		_ = graph.AddEdge(InputToQuery, Memory)
+		_ = graph.AddEdge(Memory, ChatTemplate)
+	}
 
 	// 根据是否有工具决定使用Agent还是直接使用ChatModel
-	if len(tools) > 0 {
-		// 有工具时使用Agent
-		agentConfig := &react.AgentConfig{
-			ToolCallingModel: llm,
-			MaxStep:          10,
-			ToolsConfig: compose.ToolsNodeConfig{
-				Tools: tools,
-			},
-		}
-
-		agt, err := react.NewAgent(ctx, agentConfig)
+	if len(tools) > 0 || len(clientTools) > 0 {
+		// 有工具时使用ReAct Agent子图，其状态可以保存为checkpoint
+		reactGraph, reactOpts, err := newReactGraph(ctx, llm, tools, clientTools)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create agent: %w", err)
 		}
-		if agt == nil {
-			return nil, errors.New("react.NewAgent returned a nil agent instance")
-		}
-
-		agentLambda, _ := compose.AnyLambda(agt.Generate, agt.Stream, nil, nil)
-
-		_ = graph.AddLambdaNode(Agent, agentLambda, compose.WithNodeName("Agent"))
+		_ = graph.AddGraphNode(Agent, reactGraph, reactOpts...)
 
 		_ = graph.AddEdge(compose.START, InputToQuery)
 		_ = graph.AddEdge(compose.START, InputToHistory)
@@ -261,6 +410,56 @@ func (s *agentService) buildGraph(ctx context.Context, userID uint, agentSchema
 	return graph, nil
 }
 
+// loadMCPTools 连接MCP SSE服务器并获取其提供的工具。连接在ctx结束（运行结束或被停止）时关闭，
+// 任一服务器连接失败时关闭已建立的全部连接
+func loadMCPTools(ctx context.Context, servers []string) (_ []tool.BaseTool, err error) {
+	var clients []*client.Client
+	defer func() {
+		if err != nil {
+			for _, cli := range clients {
+				_ = cli.Close()
+			}
+		}
+	}()
+
+	tools := []tool.BaseTool{}
+	for _, serverURL := range servers {
+		cli, err := client.NewSSEMCPClient(serverURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create mcp client: %w", err)
+		}
+		clients = append(clients, cli)
+		err = cli.Start(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create mcp client: %w", err)
+		}
+		initRequest := mcp.InitializeRequest{}
+		initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+		initRequest.Params.ClientInfo = mcp.Implementation{
+			Name:    "example-client",
+			Version: "1.0.0",
+		}
+
+		_, err = cli.Initialize(ctx, initRequest)
+
+		if err != nil {
+			return nil, err
+		}
+		// 获取 mcpp 工具
+		mcppTools, err := mcpp.GetTools(ctx, &mcpp.Config{Cli: cli})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get mcpp tools: %w", err)
+		}
+		tools = append(tools, mcppTools...)
+	}
+
+	// 运行结束或被停止时关闭与MCP服务器的连接，进行中的工具调用随之返回
+	for _, cli := range clients {
+		context.AfterFunc(ctx, func() { _ = cli.Close() })
+	}
+	return tools, nil
+}
+
 // inputToQueryLambda component initialization function of node 'InputToQuery' in graph 'EinoAgent'
 func inputToQueryLambda(ctx context.Context, input *model.UserMessage, opts ...any) (output string, err error) {
 	return input.Query, nil
@@ -269,8 +468,10 @@ func inputToQueryLambda(ctx context.Context, input *model.UserMessage, opts ...a
 // inputToHistoryLambda component initialization function of node 'InputToHistory' in graph 'EinoAgent'
 func inputToHistoryLambda(ctx context.Context, input *model.UserMessage, opts ...any) (output map[string]any, err error) {
 	return map[string]any{
-		"query":   input.Query,
-		"history": input.History,
-		"date":    time.Now().Format(time.DateTime),
+		"query":         input.Query,
+		"history":       input.History,
+		"tool_messages": input.ToolMessages,
+		"attachments":   input.Attachments,
+		"date":          time.Now().Format(time.DateTime),
 	}, nil
 }
@@ -0,0 +1,240 @@
+package service
+
+import (
+	mretriever "ai-cloud/internal/component/retriever/milvus"
+	"ai-cloud/internal/component/tracer"
+	"ai-cloud/internal/model"
+	"ai-cloud/pkgs/stream"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// eventStream 将回复与运行过程中的事件（工具调用、检索、用量、子Agent调用、Trace）合并到同一个输出流中。
+// 事件消息不含内容，仅在Extra中携带事件，见 IsStreamEvent / IsAgentEvent / IsTraceEvent。
+type eventStream struct {
+	sr *schema.StreamReader[*schema.Message]
+	sw *schema.StreamWriter[*schema.Message]
+
+	mu     sync.Mutex
+	closed bool
+	usage  stream.Usage
+	// pending 尚未读取完的模型流式输出，读取完毕后才能得到完整用量
+	pending sync.WaitGroup
+}
+
+func newEventStream() *eventStream {
+	sr, sw := schema.Pipe[*schema.Message](16)
+	return &eventStream{sr: sr, sw: sw}
+}
+
+func (e *eventStream) send(msg *schema.Message, err error) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return true
+	}
+	return e.sw.Send(msg, err)
+}
+
+func (e *eventStream) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.closed {
+		e.closed = true
+		e.sw.Close()
+	}
+}
+
+func (e *eventStream) sendEvent(key string, event any) {
+	e.send(&schema.Message{
+		Role:  schema.Assistant,
+		Extra: map[string]any{key: event},
+	}, nil)
+}
+
+func (e *eventStream) sendStreamEvent(event *stream.Event) {
+	e.sendEvent("stream_event", event)
+}
+
+func (e *eventStream) sendAgentEvent(event *model.AgentEvent) {
+	e.sendEvent("agent_event", event)
+}
+
+func (e *eventStream) sendTraceEvent(event *model.TraceEvent) {
+	e.sendEvent("trace_event", event)
+}
+
+// run 运行流式Graph并转发其输出，最后下发Token用量。
+// 存在Trace时等待Trace结束后再关闭，保证trace_end事件能够下发。
+func (e *eventStream) run(ctx context.Context, tr *tracer.Tracer, run func(ctx context.Context) (*schema.StreamReader[*schema.Message], error)) *schema.StreamReader[*schema.Message] {
+	go func() {
+		defer e.close()
+		if tr != nil {
+			defer func() {
+				select {
+				case <-tr.Done():
+				case <-ctx.Done():
+				}
+			}()
+		}
+
+		out, err := run(ctx)
+		if err != nil {
+			finishTrace(tr, err)
+			e.send(nil, err)
+			return
+		}
+		defer out.Close()
+		for {
+			chunk, err := out.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if closed := e.send(chunk, err); closed || err != nil {
+				return
+			}
+		}
+
+		e.pending.Wait()
+		e.mu.Lock()
+		usage := e.usage
+		e.mu.Unlock()
+		if usage.TotalTokens > 0 {
+			e.sendStreamEvent(&stream.Event{Type: stream.EventUsage, Usage: &usage})
+		}
+	}()
+	return e.sr
+}
+
+// handler 通过回调收集工具调用、检索结果和Token用量，子Agent的运行也会继承该回调
+func (e *eventStream) handler() callbacks.Handler {
+	return callbacks.NewHandlerBuilder().
+		OnStartFn(func(ctx context.Context, info *callbacks.RunInfo, input callbacks.CallbackInput) context.Context {
+			if info.Component == components.ComponentOfTool {
+				if in := tool.ConvCallbackInput(input); in != nil {
+					e.sendStreamEvent(&stream.Event{Type: stream.EventToolCall, ToolCall: &stream.ToolCall{
+						ID:        compose.GetToolCallID(ctx),
+						Name:      info.Name,
+						Arguments: in.ArgumentsInJSON,
+					}})
+				}
+			}
+			return ctx
+		}).
+		OnEndFn(func(ctx context.Context, info *callbacks.RunInfo, output callbacks.CallbackOutput) context.Context {
+			switch info.Component {
+			case components.ComponentOfTool:
+				if out := tool.ConvCallbackOutput(output); out != nil {
+					e.sendStreamEvent(&stream.Event{Type: stream.EventToolResult, ToolResult: &stream.ToolResult{
+						ID:     compose.GetToolCallID(ctx),
+						Name:   info.Name,
+						Result: out.Response,
+					}})
+				}
+			case components.ComponentOfRetriever:
+				if out := retriever.ConvCallbackOutput(output); out != nil && len(out.Docs) > 0 {
+					e.sendStreamEvent(&stream.Event{Type: stream.EventRetrieval, References: newReferences(out.Docs)})
+				}
+			case components.ComponentOfChatModel:
+				if out := einomodel.ConvCallbackOutput(output); out != nil {
+					e.addUsage(out.TokenUsage)
+				}
+			}
+			return ctx
+		}).
+		OnErrorFn(func(ctx context.Context, info *callbacks.RunInfo, err error) context.Context {
+			// 等待审批的工具调用不是错误，恢复运行后才有结果
+			if info.Component == components.ComponentOfTool && !errors.Is(err, compose.InterruptAndRerun) {
+				e.sendStreamEvent(&stream.Event{Type: stream.EventToolResult, ToolResult: &stream.ToolResult{
+					ID:    compose.GetToolCallID(ctx),
+					Name:  info.Name,
+					Error: err.Error(),
+				}})
+			}
+			return ctx
+		}).
+		OnEndWithStreamOutputFn(func(ctx context.Context, info *callbacks.RunInfo, output *schema.StreamReader[callbacks.CallbackOutput]) context.Context {
+			if info.Component != components.ComponentOfChatModel {
+				output.Close()
+				return ctx
+			}
+			e.pending.Add(1)
+			go func() {
+				defer e.pending.Done()
+				defer output.Close()
+				// 流式输出中用量通常只在最后一个chunk中出现
+				var usage *einomodel.TokenUsage
+				for {
+					chunk, err := output.Recv()
+					if err != nil {
+						break
+					}
+					if out := einomodel.ConvCallbackOutput(chunk); out != nil && out.TokenUsage != nil {
+						usage = out.TokenUsage
+					}
+				}
+				e.addUsage(usage)
+			}()
+			return ctx
+		}).
+		Build()
+}
+
+func (e *eventStream) addUsage(usage *einomodel.TokenUsage) {
+	if usage == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.usage.PromptTokens += usage.PromptTokens
+	e.usage.CompletionTokens += usage.CompletionTokens
+	e.usage.TotalTokens += usage.TotalTokens
+}
+
+// newReferences 将检索结果转换为协议中的引用
+func newReferences(docs []*schema.Document) []*stream.Reference {
+	refs := make([]*stream.Reference, 0, len(docs))
+	for _, d := range docs {
+		ref := &stream.Reference{
+			ChunkID: d.ID,
+			Score:   mretriever.DocumentScore(d),
+			Content: d.Content,
+		}
+		ref.KBID, _ = d.MetaData["kb_id"].(string)
+		ref.DocumentID, _ = d.MetaData["document_id"].(string)
+		ref.DocumentName, _ = d.MetaData["document_name"].(string)
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// IsStreamEvent 判断流中的消息是否为工具调用、检索、用量等协议事件
+func IsStreamEvent(msg *schema.Message) (*stream.Event, bool) {
+	if msg == nil || msg.Extra == nil {
+		return nil, false
+	}
+	e, ok := msg.Extra["stream_event"].(*stream.Event)
+	return e, ok
+}
+
+// isEventMessage 判断流中的消息是否为事件，事件不计入回复内容
+func isEventMessage(msg *schema.Message) bool {
+	if _, ok := IsStreamEvent(msg); ok {
+		return true
+	}
+	if _, ok := IsAgentEvent(msg); ok {
+		return true
+	}
+	_, ok := IsTraceEvent(msg)
+	return ok
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+)
+
+// MaxAgentCallDepth Agent之间互相调用的最大嵌套深度（顶层Agent深度为1）
+const MaxAgentCallDepth = 4
+
+var (
+	ErrAgentCycle   = errors.New("agent call cycle detected")
+	ErrAgentTooDeep = fmt.Errorf("agent call depth exceeds %d", MaxAgentCallDepth)
+)
+
+type agentCallKey struct{}
+
+// agentCall 当前Agent调用链，通过ctx在父子Agent之间传递
+type agentCall struct {
+	// stack 调用链上的Agent IDs，最后一个为当前Agent
+	stack []string
+	// history 当前Agent收到的历史消息，调用子Agent时原样传递
+	history []*schema.Message
+	// emit 将子Agent调用事件写入顶层Agent的流式响应，可能为nil
+	emit func(*model.AgentEvent)
+}
+
+// enterAgent 将Agent压入调用链，出现循环调用或超过最大深度时返回错误
+func enterAgent(ctx context.Context, agentID string, history []*schema.Message) (context.Context, error) {
+	parent, _ := ctx.Value(agentCallKey{}).(*agentCall)
+	call := &agentCall{history: history}
+	if parent != nil {
+		if slices.Contains(parent.stack, agentID) {
+			return ctx, fmt.Errorf("%w: %s -> %s", ErrAgentCycle, strings.Join(parent.stack, " -> "), agentID)
+		}
+		call.stack = slices.Clone(parent.stack)
+		call.emit = parent.emit
+	}
+	call.stack = append(call.stack, agentID)
+	if len(call.stack) > MaxAgentCallDepth {
+		return ctx, ErrAgentTooDeep
+	}
+	return context.WithValue(ctx, agentCallKey{}, call), nil
+}
+
+// withAgentEvents 为调用链设置事件回调，子Agent的调用与结果通过emit下发
+func withAgentEvents(ctx context.Context, emit func(*model.AgentEvent)) context.Context {
+	call := &agentCall{emit: emit}
+	if parent, ok := ctx.Value(agentCallKey{}).(*agentCall); ok {
+		call.stack = parent.stack
+		call.history = parent.history
+	}
+	return context.WithValue(ctx, agentCallKey{}, call)
+}
+
+func currentAgentCall(ctx context.Context) *agentCall {
+	call, _ := ctx.Value(agentCallKey{}).(*agentCall)
+	if call == nil {
+		return &agentCall{}
+	}
+	return call
+}
+
+// callSubAgent 以当前Agent的历史消息调用子Agent，并记录调用事件
+func (s *agentService) callSubAgent(ctx context.Context, userID uint, sub *model.Agent, query string) (string, error) {
+	call := currentAgentCall(ctx)
+	event := &model.AgentEvent{
+		AgentID:   sub.ID,
+		AgentName: sub.Name,
+		Depth:     len(call.stack) + 1,
+	}
+	if call.emit != nil {
+		e := *event
+		e.Type = model.AgentEventCall
+		e.Input = query
+		call.emit(&e)
+	}
+
+	// 子Agent的运行不可中断，其中需要审批的工具不会执行
+	ctx = withApprovalSession(ctx, nil)
+	output, err := s.ExecuteAgent(ctx, userID, sub.ID, model.UserMessage{Query: query, History: call.history})
+
+	if call.emit != nil {
+		e := *event
+		e.Type = model.AgentEventResult
+		e.Output = output
+		if err != nil {
+			e.Error = err.Error()
+		}
+		call.emit(&e)
+	}
+	return output, err
+}
+
+// agentTool 将其他Agent包装为可被LLM调用的工具
+type agentTool struct {
+	svc    *agentService
+	userID uint
+	agent  *model.Agent
+}
+
+type agentToolArgs struct {
+	Query string `json:"query"`
+}
+
+func (t *agentTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	desc := t.agent.Name
+	if t.agent.Description != "" {
+		desc += ": " + t.agent.Description
+	}
+	return &schema.ToolInfo{
+		Name: agentToolName(t.agent.ID),
+		Desc: desc,
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"query": {
+				Type:     schema.String,
+				Desc:     "The question or task to hand over to this agent",
+				Required: true,
+			},
+		}),
+	}, nil
+}
+
+func (t *agentTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	var args agentToolArgs
+	if err := json.Unmarshal([]byte(argumentsInJSON), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	output, err := t.svc.callSubAgent(ctx, t.userID, t.agent, args.Query)
+	if err != nil {
+		// 请求被取消时直接中断，其他错误返回给LLM，由其决定如何继续
+		if ctx.Err() != nil {
+			return "", err
+		}
+		return fmt.Sprintf("agent %s failed: %v", t.agent.Name, err), nil
+	}
+	return output, nil
+}
+
+// agentToolName 工具名需满足 ^[a-zA-Z0-9_-]+$，因此使用Agent ID而不是名称
+func agentToolName(agentID string) string {
+	id := strings.ReplaceAll(agentID, "-", "")
+	if len(id) > 16 {
+		id = id[:16]
+	}
+	return "agent_" + id
+}
+
+// loadAgentTools 将子Agent加载为工具
+func (s *agentService) loadAgentTools(ctx context.Context, userID uint, agentIDs []string) ([]tool.BaseTool, error) {
+	tools := make([]tool.BaseTool, 0, len(agentIDs))
+	for _, id := range agentIDs {
+		sub, err := s.dao.GetByID(ctx, userID, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sub agent %s: %w", id, err)
+		}
+		tools = append(tools, &agentTool{svc: s, userID: userID, agent: sub})
+	}
+	return tools, nil
+}
+
+// filterTools 只保留名称在names中的工具
+func filterTools(ctx context.Context, tools []tool.BaseTool, names []string) ([]tool.BaseTool, error) {
+	enabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		enabled[name] = true
+	}
+	kept := make([]tool.BaseTool, 0, len(tools))
+	for _, t := range tools {
+		info, err := t.Info(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tool info: %w", err)
+		}
+		if enabled[info.Name] {
+			kept = append(kept, t)
+		}
+	}
+	return kept, nil
+}
+
+// subAgentIDs 返回Agent配置中直接引用的其他Agent，包括工作流中的Agent节点
+func subAgentIDs(agentSchema *model.AgentSchema) []string {
+	ids := slices.Clone(agentSchema.SubAgents.AgentIDs)
+	if agentSchema.Workflow != nil {
+		ids = append(ids, workflowAgentIDs(agentSchema.Workflow)...)
+	}
+	return ids
+}
+
+func workflowAgentIDs(wf *model.WorkflowSchema) []string {
+	var ids []string
+	for i := range wf.Nodes {
+		n := &wf.Nodes[i]
+		switch n.Type {
+		case model.NodeTypeAgent:
+			var c model.AgentNodeConfig
+			if json.Unmarshal(n.Config, &c) == nil && c.AgentID != "" {
+				ids = append(ids, c.AgentID)
+			}
+		case model.NodeTypeLoop:
+			var c model.LoopNodeConfig
+			if json.Unmarshal(n.Config, &c) == nil {
+				ids = append(ids, workflowAgentIDs(&c.Body)...)
+			}
+		}
+	}
+	return ids
+}
+
+// checkAgentReferences 保存前检查引用的Agent是否存在，以及是否会形成循环调用。
+// 被引用的Agent按最新发布版本解析，与运行时一致。
+func (s *agentService) checkAgentReferences(ctx context.Context, agent *model.Agent, agentSchema *model.AgentSchema) error {
+	var visit func(id string, refs []string, path []string) error
+	visit = func(id string, refs []string, path []string) error {
+		path = append(path, id)
+		if len(path) > MaxAgentCallDepth {
+			return fmt.Errorf("%w: %s", ErrAgentTooDeep, strings.Join(path, " -> "))
+		}
+		for _, ref := range refs {
+			if slices.Contains(path, ref) {
+				return fmt.Errorf("%w: %s -> %s", ErrAgentCycle, strings.Join(path, " -> "), ref)
+			}
+			_, refSchema, err := s.loadAgentSchema(ctx, agent.UserID, ref, model.AgentVersionLatest)
+			if err != nil {
+				return fmt.Errorf("sub agent %s: %w", ref, err)
+			}
+			if err := visit(ref, subAgentIDs(&refSchema), path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return visit(agent.ID, subAgentIDs(agentSchema), nil)
+}
+
+// IsAgentEvent 判断流中的消息是否为子Agent调用事件
+func IsAgentEvent(msg *schema.Message) (*model.AgentEvent, bool) {
+	if msg == nil || msg.Extra == nil {
+		return nil, false
+	}
+	e, ok := msg.Extra["agent_event"].(*model.AgentEvent)
+	return e, ok
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"ai-cloud/internal/component/tracer"
+	"ai-cloud/internal/model"
+	"context"
+	"log"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+// startTrace 为顶层运行创建Trace，被调用的子Agent通过ctx继承回调，记录在同一个Trace中。
+// 嵌套运行或创建失败时返回nil，不影响Agent运行。
+func (s *agentService) startTrace(ctx context.Context, userID uint, agentID string, msg *model.UserMessage, o *ExecuteOptions, events *eventStream) *tracer.Tracer {
+	if len(currentAgentCall(ctx).stack) > 1 {
+		return nil
+	}
+
+	trace := &model.Trace{
+		ID:      uuid.NewString(),
+		UserID:  userID,
+		AgentID: agentID,
+		ConvID:  o.ConvID,
+		MsgID:   o.MsgID,
+		Query:   msg.Query,
+		Status:  model.TraceStatusRunning,
+	}
+	if err := s.traceDao.Create(ctx, trace); err != nil {
+		log.Printf("[Trace] failed to create trace: %v", err)
+		return nil
+	}
+
+	opts := []tracer.Option{
+		tracer.WithOnFinish(func(trace *model.Trace, spans []*model.TraceSpan) {
+			// 请求可能已经结束，使用独立的上下文保存
+			if err := s.traceDao.Finish(context.Background(), trace, spans); err != nil {
+				log.Printf("[Trace] failed to save trace %s: %v", trace.ID, err)
+			}
+		}),
+	}
+	if events != nil && o.Debug {
+		opts = append(opts, tracer.WithOnEvent(events.sendTraceEvent))
+	}
+	return tracer.New(trace, opts...)
+}
+
+// finishTrace 运行在Graph开始前失败时结束Trace
+func finishTrace(tr *tracer.Tracer, err error) {
+	if tr != nil {
+		tr.Finish(err)
+	}
+}
+
+// IsTraceEvent 判断流中的消息是否为Trace事件
+func IsTraceEvent(msg *schema.Message) (*model.TraceEvent, bool) {
+	if msg == nil || msg.Extra == nil {
+		return nil, false
+	}
+	e, ok := msg.Extra["trace_event"].(*model.TraceEvent)
+	return e, ok
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// PublishAgent 将当前草稿快照为一个新的不可变版本，并设为发布版本
+func (s *agentService) PublishAgent(ctx context.Context, userID uint, agentID string, changelog string) (*model.AgentVersion, error) {
+	agent, err := s.dao.GetByID(ctx, userID, agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := s.versionDao.MaxVersion(ctx, agentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest version: %w", err)
+	}
+
+	version := &model.AgentVersion{
+		ID:          utils.GenerateUUID(),
+		AgentID:     agentID,
+		UserID:      userID,
+		Version:     latest + 1,
+		AgentSchema: agent.AgentSchema,
+		Changelog:   changelog,
+	}
+	if err := s.versionDao.Create(ctx, version); err != nil {
+		return nil, fmt.Errorf("failed to create agent version: %w", err)
+	}
+
+	if err := s.dao.UpdatePublishedVersion(ctx, userID, agentID, version.Version); err != nil {
+		return nil, fmt.Errorf("failed to update published version: %w", err)
+	}
+	return version, nil
+}
+
+func (s *agentService) ListAgentVersions(ctx context.Context, userID uint, agentID string) ([]*model.AgentVersion, error) {
+	return s.versionDao.List(ctx, userID, agentID)
+}
+
+func (s *agentService) GetAgentVersion(ctx context.Context, userID uint, agentID string, version int) (*model.AgentVersion, error) {
+	return s.versionDao.GetByVersion(ctx, userID, agentID, version)
+}
+
+// RollbackAgent 将发布版本切换到指定的历史版本。草稿保持不变，未发布的修改不会丢失
+func (s *agentService) RollbackAgent(ctx context.Context, userID uint, agentID string, version int) error {
+	if _, err := s.versionDao.GetByVersion(ctx, userID, agentID, version); err != nil {
+		return err
+	}
+	return s.dao.UpdatePublishedVersion(ctx, userID, agentID, version)
+}
+
+// DiffAgentVersions 比较两个版本的配置，版本号为 model.AgentVersionDraft 时表示草稿
+func (s *agentService) DiffAgentVersions(ctx context.Context, userID uint, agentID string, from, to int) ([]model.SchemaDiff, error) {
+	fromSchema, err := s.rawAgentSchema(ctx, userID, agentID, from)
+	if err != nil {
+		return nil, err
+	}
+	toSchema, err := s.rawAgentSchema(ctx, userID, agentID, to)
+	if err != nil {
+		return nil, err
+	}
+	return utils.DiffJSON(fromSchema, toSchema)
+}
+
+// loadAgentSchema 获取Agent并解析指定版本的配置
+func (s *agentService) loadAgentSchema(ctx context.Context, userID uint, agentID string, version int) (*model.Agent, model.AgentSchema, error) {
+	var agentSchema model.AgentSchema
+	agent, err := s.dao.GetByID(ctx, userID, agentID)
+	if err != nil {
+		return nil, agentSchema, err
+	}
+	raw, err := s.versionSchema(ctx, agent, version)
+	if err != nil {
+		return nil, agentSchema, err
+	}
+	if err := json.Unmarshal([]byte(raw), &agentSchema); err != nil {
+		return nil, agentSchema, fmt.Errorf("failed to parse agent schema: %w", err)
+	}
+	return agent, agentSchema, nil
+}
+
+// rawAgentSchema 获取指定版本的Agent配置JSON
+func (s *agentService) rawAgentSchema(ctx context.Context, userID uint, agentID string, version int) (string, error) {
+	agent, err := s.dao.GetByID(ctx, userID, agentID)
+	if err != nil {
+		return "", err
+	}
+	return s.versionSchema(ctx, agent, version)
+}
+
+// versionSchema 获取Agent指定版本的配置JSON。
+// 跟随最新版本时，如果Agent从未发布过，则回退到草稿。
+func (s *agentService) versionSchema(ctx context.Context, agent *model.Agent, version int) (string, error) {
+	version = resolveVersion(agent, version)
+	if version == model.AgentVersionDraft {
+		return agent.AgentSchema, nil
+	}
+
+	v, err := s.versionDao.GetByVersion(ctx, agent.UserID, agent.ID, version)
+	if err != nil {
+		return "", err
+	}
+	return v.AgentSchema, nil
+}
+
+// resolveVersion 将 AgentVersionLatest 解析为实际运行的版本
+func resolveVersion(agent *model.Agent, version int) int {
+	if version == model.AgentVersionLatest {
+		version = agent.PublishedVersion
+		if version == 0 {
+			version = model.AgentVersionDraft
+		}
+	}
+	return version
+}
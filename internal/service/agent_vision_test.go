@@ -0,0 +1,90 @@
+package service
+
+import (
+	"ai-cloud/internal/dao"
+	"ai-cloud/internal/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// fakeAgentDao 内存中的Agent，只实现测试用到的方法
+type fakeAgentDao struct {
+	dao.AgentDao
+	agents map[string]*model.Agent
+}
+
+func (d *fakeAgentDao) GetByID(_ context.Context, userID uint, agentID string) (*model.Agent, error) {
+	a, ok := d.agents[agentID]
+	if !ok || a.UserID != userID {
+		return nil, errors.New("agent not found")
+	}
+	copied := *a
+	return &copied, nil
+}
+
+// fakeModelService 内存中的模型，只实现测试用到的方法
+type fakeModelService struct {
+	ModelService
+	models map[string]*model.Model
+}
+
+func (s *fakeModelService) GetModel(_ context.Context, userID uint, id string) (*model.Model, error) {
+	m, ok := s.models[id]
+	if !ok || m.UserID != userID {
+		return nil, errors.New("model not found")
+	}
+	return m, nil
+}
+
+func testAgent(t *testing.T, id, typ, modelID string) *model.Agent {
+	t.Helper()
+	raw, err := json.Marshal(model.AgentSchema{LLMConfig: model.LLMConfig{ModelID: modelID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &model.Agent{ID: id, UserID: 1, Type: typ, AgentSchema: string(raw)}
+}
+
+func TestSupportsVision(t *testing.T) {
+	s := &agentService{
+		dao: &fakeAgentDao{agents: map[string]*model.Agent{
+			"vision":   testAgent(t, "vision", model.AgentTypeSimple, "gpt-4o"),
+			"text":     testAgent(t, "text", model.AgentTypeSimple, "deepseek"),
+			"workflow": testAgent(t, "workflow", model.AgentTypeWorkflow, "gpt-4o"),
+			"missing":  testAgent(t, "missing", model.AgentTypeSimple, "deleted"),
+		}},
+		modelSvc: &fakeModelService{models: map[string]*model.Model{
+			"gpt-4o":   {ID: "gpt-4o", UserID: 1, Type: "llm", Vision: true},
+			"deepseek": {ID: "deepseek", UserID: 1, Type: "llm"},
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		agentID  string
+		settings *model.ConversationSettings
+		want     bool
+		wantErr  bool
+	}{
+		{"vision model", "vision", nil, true, false},
+		{"text model", "text", nil, false, false},
+		{"workflow agent", "workflow", nil, false, false},
+		{"settings switch to vision model", "text", &model.ConversationSettings{ModelID: "gpt-4o"}, true, false},
+		{"settings switch to text model", "vision", &model.ConversationSettings{ModelID: "deepseek"}, false, false},
+		{"model not found", "missing", nil, false, true},
+		{"agent not found", "other", nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.SupportsVision(context.Background(), 1, tt.agentID, model.AgentVersionDraft, tt.settings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SupportsVision = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"ai-cloud/internal/dao"
+	"ai-cloud/internal/model"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// lastUsedInterval 最近使用时间的更新间隔，避免每个请求都写库
+const lastUsedInterval = time.Minute
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	ErrAPIKeyExpired = errors.New("api key expired")
+)
+
+type APIKeyService interface {
+	// CreateAPIKey 创建API Key，返回的明文只在此时可见
+	CreateAPIKey(ctx context.Context, userID uint, req *model.CreateAPIKeyRequest) (*model.APIKey, string, error)
+	ListAPIKeys(ctx context.Context, userID uint) ([]*model.APIKey, error)
+	DeleteAPIKey(ctx context.Context, userID uint, id string) error
+	// VerifyAPIKey 校验API Key，返回的记录包含所属用户和权限范围
+	VerifyAPIKey(ctx context.Context, key string) (*model.APIKey, error)
+}
+
+type apiKeyService struct {
+	dao dao.APIKeyDao
+}
+
+func NewAPIKeyService(dao dao.APIKeyDao) APIKeyService {
+	return &apiKeyService{dao: dao}
+}
+
+func (s *apiKeyService) CreateAPIKey(ctx context.Context, userID uint, req *model.CreateAPIKeyRequest) (*model.APIKey, string, error) {
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return nil, "", errors.New("expires_at must be in the future")
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	plain := model.APIKeyPrefix + hex.EncodeToString(buf)
+
+	key := &model.APIKey{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    plain[:len(model.APIKeyPrefix)+6],
+		KeyHash:   hashAPIKey(plain),
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.dao.Create(ctx, key); err != nil {
+		return nil, "", fmt.Errorf("failed to create api key: %w", err)
+	}
+	return key, plain, nil
+}
+
+func (s *apiKeyService) ListAPIKeys(ctx context.Context, userID uint) ([]*model.APIKey, error) {
+	keys, err := s.dao.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		fillLegacyScopes(key)
+	}
+	return keys, nil
+}
+
+func (s *apiKeyService) DeleteAPIKey(ctx context.Context, userID uint, id string) error {
+	return s.dao.Delete(ctx, userID, id)
+}
+
+func (s *apiKeyService) VerifyAPIKey(ctx context.Context, plain string) (*model.APIKey, error) {
+	if !strings.HasPrefix(plain, model.APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	key, err := s.dao.GetByHash(ctx, hashAPIKey(plain))
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	fillLegacyScopes(key)
+
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, ErrAPIKeyExpired
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedInterval {
+		if err := s.dao.UpdateLastUsed(ctx, key.ID, now); err != nil {
+			log.Printf("[APIKey] failed to update last used time: %v", err)
+		}
+	}
+	return key, nil
+}
+
+// fillLegacyScopes 没有权限范围的旧Key按当时的权限处理
+func fillLegacyScopes(key *model.APIKey) {
+	if len(key.Scopes) == 0 {
+		key.Scopes = slices.Clone(model.LegacyAPIKeyScopes)
+	}
+}
+
+func hashAPIKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"ai-cloud/config"
+	"ai-cloud/internal/component/parser/pdf"
+	hisdao "ai-cloud/internal/dao/history"
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/storage"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino-ext/components/document/transformer/splitter/recursive"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxAttachmentSize 单个附件的最大字节数
+	maxAttachmentSize = 20 << 20
+	// maxImageSize 图片以base64随消息发送给模型，限制更小
+	maxImageSize = 5 << 20
+	// attachInlineSize 不超过该字节数的文本文件直接注入用户消息，更大的文件和PDF只通过附件索引检索
+	attachInlineSize = 16 << 10
+	// attachRetrieveTopK 每轮对话从会话附件索引中检索的分块数
+	attachRetrieveTopK = 5
+	// attachSummaryRunes 附件DataSummary保存的文本长度
+	attachSummaryRunes = 200
+)
+
+var (
+	imageExts = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true}
+	codeExts  = map[string]bool{
+		".go": true, ".py": true, ".js": true, ".ts": true, ".java": true, ".c": true, ".cpp": true, ".h": true,
+		".rs": true, ".rb": true, ".php": true, ".kt": true, ".swift": true, ".sql": true, ".sh": true,
+	}
+	textExts = map[string]bool{
+		".txt": true, ".md": true, ".markdown": true, ".csv": true, ".json": true, ".yaml": true, ".yml": true,
+		".xml": true, ".html": true, ".htm": true, ".log": true, ".ini": true, ".toml": true,
+	}
+)
+
+type AttachmentService interface {
+	// Upload 上传文件作为聊天附件，随消息发送前不属于任何会话
+	Upload(ctx context.Context, userID uint, fileHeader *multipart.FileHeader, file multipart.File) (*model.AttachmentRef, error)
+	// AttachDriveFile 将云盘中的文件复制为聊天附件
+	AttachDriveFile(ctx context.Context, userID uint, fileID string) (*model.AttachmentRef, error)
+	// Download 获取附件的元信息和内容
+	Download(ctx context.Context, userID uint, attachID string) (*model.Attachment, []byte, error)
+	// Prepare 校验附件并绑定到会话，返回随本轮用户消息发送给模型的内容和保存在消息中的附件引用
+	Prepare(ctx context.Context, conv *model.Conversation, attachIDs []string) ([]schema.ChatMessagePart, []*model.AttachmentRef, error)
+	// Link 将附件关联到用户消息，首次发送的附件同时记录该消息
+	Link(ctx context.Context, msgID string, attachIDs []string) error
+	// MessageAttachments 用户消息的附件ID
+	MessageAttachments(ctx context.Context, msgID string) ([]string, error)
+	// Retriever 会话附件索引的检索器，会话中没有已建立索引的附件时返回nil
+	Retriever(ctx context.Context, convID string) retriever.Retriever
+	// DeleteByConversation 删除会话的附件、附件索引及存储中的内容
+	DeleteByConversation(ctx context.Context, convID string) error
+}
+
+type attachmentService struct {
+	dao           hisdao.AttachDao
+	fileService   FileService
+	storageDriver storage.Driver
+}
+
+func NewAttachmentService(dao hisdao.AttachDao, fileService FileService) AttachmentService {
+	driver, err := storage.NewDriver(config.AppConfigInstance.Storage)
+	if err != nil {
+		panic("无法连接到存储服务: " + err.Error())
+	}
+	return &attachmentService{dao: dao, fileService: fileService, storageDriver: driver}
+}
+
+func (s *attachmentService) Upload(ctx context.Context, userID uint, fileHeader *multipart.FileHeader, file multipart.File) (*model.AttachmentRef, error) {
+	if fileHeader.Size > maxAttachmentSize {
+		return nil, fmt.Errorf("attachment exceeds %d MB", maxAttachmentSize>>20)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return s.create(ctx, userID, fileHeader.Filename, data, "")
+}
+
+func (s *attachmentService) AttachDriveFile(ctx context.Context, userID uint, fileID string) (*model.AttachmentRef, error) {
+	f, err := s.fileService.GetFileByID(fileID)
+	if err != nil || f.UserID != userID {
+		return nil, errors.New("file not found")
+	}
+	if f.IsDir {
+		return nil, errors.New("folders cannot be attached")
+	}
+	if f.Size > maxAttachmentSize {
+		return nil, fmt.Errorf("attachment exceeds %d MB", maxAttachmentSize>>20)
+	}
+	_, data, err := s.fileService.DownloadFile(fileID)
+	if err != nil {
+		return nil, err
+	}
+	return s.create(ctx, userID, f.Name, data, f.ID)
+}
+
+// create 保存附件内容，文本和PDF附件解析后分块写入附件索引
+func (s *attachmentService) create(ctx context.Context, userID uint, name string, data []byte, fileID string) (*model.AttachmentRef, error) {
+	attachType, mimeType, err := attachmentType(name)
+	if err != nil {
+		return nil, err
+	}
+	if attachType == model.AttachmentTypeImage && len(data) > maxImageSize {
+		return nil, fmt.Errorf("image exceeds %d MB", maxImageSize>>20)
+	}
+
+	attachment := &model.Attachment{
+		AttachID:       uuid.NewString(),
+		UserID:         userID,
+		FileID:         fileID,
+		AttachmentType: attachType,
+		FileName:       name,
+		FileSize:       int64(len(data)),
+		StorageType:    model.AttachmentStorageCloud,
+		MimeType:       mimeType,
+		CreatedAt:      time.Now().Unix(),
+	}
+	var chunks []*model.AttachmentChunk
+	if attachType != model.AttachmentTypeImage {
+		text, err := extractText(ctx, mimeType, data)
+		if err != nil {
+			return nil, err
+		}
+		if chunks, err = splitAttachment(ctx, attachment.AttachID, text); err != nil {
+			return nil, err
+		}
+		attachment.Vectorized = true
+		attachment.DataSummary = truncateRunes(text, attachSummaryRunes)
+	}
+
+	attachment.StoragePath = fmt.Sprintf("user%v-attach-%s", userID, attachment.AttachID)
+	if err := s.storageDriver.Upload(data, attachment.StoragePath, mimeType); err != nil {
+		return nil, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	if err := s.dao.Create(ctx, attachment, chunks); err != nil {
+		_ = s.storageDriver.Delete(attachment.StoragePath)
+		return nil, err
+	}
+	return attachment.Ref(), nil
+}
+
+// attachmentType 按扩展名判断附件类型和MIME类型，不支持的类型返回错误
+func attachmentType(name string) (string, string, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	mimeType := mime.TypeByExtension(ext)
+	switch {
+	case imageExts[ext]:
+		if mimeType == "" {
+			mimeType = "image/" + strings.TrimPrefix(strings.Replace(ext, "jpg", "jpeg", 1), ".")
+		}
+		return model.AttachmentTypeImage, mimeType, nil
+	case ext == ".pdf":
+		return model.AttachmentTypeFile, "application/pdf", nil
+	case codeExts[ext], textExts[ext]:
+		if mimeType == "" || strings.HasPrefix(mimeType, "application/octet-stream") {
+			mimeType = "text/plain; charset=utf-8"
+		}
+		if codeExts[ext] {
+			return model.AttachmentTypeCode, mimeType, nil
+		}
+		return model.AttachmentTypeFile, mimeType, nil
+	default:
+		return "", "", fmt.Errorf("unsupported attachment type: %s", ext)
+	}
+}
+
+// extractText 读取文本和PDF附件的文本内容
+func extractText(ctx context.Context, mimeType string, data []byte) (string, error) {
+	if mimeType == "application/pdf" {
+		p, err := pdf.NewDocconvPDFParser(ctx, nil)
+		if err != nil {
+			return "", err
+		}
+		docs, err := p.Parse(ctx, bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		for _, d := range docs {
+			sb.WriteString(d.Content)
+		}
+		return sb.String(), nil
+	}
+	if !utf8.Valid(data) {
+		return "", errors.New("text attachments must be UTF-8 encoded")
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", errors.New("attachment is empty")
+	}
+	return string(data), nil
+}
+
+// splitAttachment 按RAG配置的分块大小分割附件文本
+func splitAttachment(ctx context.Context, attachID, text string) ([]*model.AttachmentChunk, error) {
+	splitter, err := recursive.NewSplitter(ctx, &recursive.Config{
+		ChunkSize:   config.AppConfigInstance.RAG.ChunkSize,
+		OverlapSize: config.AppConfigInstance.RAG.OverlapSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("加载分块器失败: %w", err)
+	}
+	docs, err := splitter.Transform(ctx, []*schema.Document{{Content: text}})
+	if err != nil {
+		return nil, fmt.Errorf("分块失败: %w", err)
+	}
+	chunks := make([]*model.AttachmentChunk, 0, len(docs))
+	for i, d := range docs {
+		chunks = append(chunks, &model.AttachmentChunk{AttachID: attachID, ChunkIndex: i, Content: d.Content})
+	}
+	return chunks, nil
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+func (s *attachmentService) Download(ctx context.Context, userID uint, attachID string) (*model.Attachment, []byte, error) {
+	attachment, err := s.dao.Get(ctx, attachID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if attachment.UserID != userID {
+		return nil, nil, errors.New("attachment not found")
+	}
+	data, err := s.storageDriver.Download(attachment.StoragePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	return attachment, data, nil
+}
+
+func (s *attachmentService) Prepare(ctx context.Context, conv *model.Conversation, attachIDs []string) ([]schema.ChatMessagePart, []*model.AttachmentRef, error) {
+	var parts []schema.ChatMessagePart
+	var refs []*model.AttachmentRef
+	for _, id := range attachIDs {
+		attachment, err := s.dao.Get(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if attachment.UserID != conv.UserID {
+			return nil, nil, errors.New("attachment not found")
+		}
+		if attachment.ConvID != conv.ConvID {
+			if attachment.ConvID != "" {
+				return nil, nil, errors.New("attachment belongs to another conversation")
+			}
+			if err := s.dao.Bind(ctx, id, conv.ConvID); err != nil {
+				return nil, nil, err
+			}
+		}
+		part, err := s.content(attachment)
+		if err != nil {
+			return nil, nil, err
+		}
+		parts = append(parts, part)
+		refs = append(refs, attachment.Ref())
+	}
+	return parts, refs, nil
+}
+
+// content 附件随用户消息发送的内容：图片为多模态内容，小文本文件为全文，其余只提示已建立索引
+func (s *attachmentService) content(attachment *model.Attachment) (schema.ChatMessagePart, error) {
+	inline := attachment.AttachmentType == model.AttachmentTypeImage ||
+		attachment.MimeType != "application/pdf" && attachment.FileSize <= attachInlineSize
+	if !inline {
+		return schema.ChatMessagePart{
+			Type: schema.ChatMessagePartTypeText,
+			Text: fmt.Sprintf("附件《%s》内容较长，已建立索引，相关内容见参考信息。", attachment.FileName),
+		}, nil
+	}
+
+	data, err := s.storageDriver.Download(attachment.StoragePath)
+	if err != nil {
+		return schema.ChatMessagePart{}, fmt.Errorf("failed to read attachment %s: %w", attachment.FileName, err)
+	}
+	if attachment.AttachmentType == model.AttachmentTypeImage {
+		return schema.ChatMessagePart{
+			Type: schema.ChatMessagePartTypeImageURL,
+			ImageURL: &schema.ChatMessageImageURL{
+				URL:      fmt.Sprintf("data:%s;base64,%s", attachment.MimeType, base64.StdEncoding.EncodeToString(data)),
+				MIMEType: attachment.MimeType,
+			},
+		}, nil
+	}
+	return schema.ChatMessagePart{
+		Type: schema.ChatMessagePartTypeText,
+		Text: fmt.Sprintf("附件《%s》的内容：\n%s", attachment.FileName, data),
+	}, nil
+}
+
+func (s *attachmentService) Link(ctx context.Context, msgID string, attachIDs []string) error {
+	return s.dao.Link(ctx, msgID, attachIDs)
+}
+
+func (s *attachmentService) MessageAttachments(ctx context.Context, msgID string) ([]string, error) {
+	return s.dao.ListByMessage(ctx, msgID)
+}
+
+func (s *attachmentService) Retriever(ctx context.Context, convID string) retriever.Retriever {
+	ok, err := s.dao.HasChunks(ctx, convID)
+	if err != nil {
+		log.Printf("[Attachment] 读取会话 %s 的附件索引失败: %v", convID, err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	return &attachmentIndex{dao: s.dao, convID: convID, topK: attachRetrieveTopK}
+}
+
+func (s *attachmentService) DeleteByConversation(ctx context.Context, convID string) error {
+	attachments, err := s.dao.ListByConv(ctx, convID)
+	if err != nil {
+		return err
+	}
+	if err := s.dao.DeleteByConv(ctx, convID); err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		if err := s.storageDriver.Delete(a.StoragePath); err != nil {
+			log.Printf("[Attachment] 删除附件 %s 的内容失败: %v", a.AttachID, err)
+		}
+	}
+	return nil
+}
+
+// attachmentIndex 会话内附件分块的全文检索
+type attachmentIndex struct {
+	dao    hisdao.AttachDao
+	convID string
+	topK   int
+}
+
+func (r *attachmentIndex) Retrieve(ctx context.Context, query string, opts ...retriever.Option) ([]*schema.Document, error) {
+	hits, err := r.dao.SearchChunks(ctx, r.convID, query, r.topK)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]*schema.Document, 0, len(hits))
+	for _, h := range hits {
+		doc := &schema.Document{
+			ID:      fmt.Sprintf("%s-%d", h.AttachID, h.ChunkIndex),
+			Content: h.Content,
+			MetaData: map[string]any{
+				"attach_id":     h.AttachID,
+				"document_name": h.FileName,
+				"chunk_index":   h.ChunkIndex,
+			},
+		}
+		docs = append(docs, doc.WithScore(h.Score))
+	}
+	return docs, nil
+}
@@ -1,29 +1,50 @@
 package service
 
 import (
+	hisdao "ai-cloud/internal/dao/history"
 	"ai-cloud/internal/model"
+	"ai-cloud/internal/utils"
+	"ai-cloud/pkgs/stream"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/cloudwego/eino/schema"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 var defaultConvTitle = "新对话"
 
+// ErrAgentNotPublished 固定版本的会话要求Agent已经发布
+var ErrAgentNotPublished = errors.New("agent has no published version to pin")
+
 type ConversationService interface {
 	// Debug模式：临时会话，不保存历史
 	DebugStreamAgent(ctx context.Context, userID uint, agentID string, message string) (*schema.StreamReader[*schema.Message], error)
 
-	// 会话模式：创建/获取会话，记录历史
-	StreamAgentWithConversation(ctx context.Context, userID uint, agentID string, convID string, message string) (*schema.StreamReader[*schema.Message], error)
+	// 会话模式：创建/获取会话，记录历史，attachIDs为随消息发送的附件。返回助手回复和用户消息的ID
+	StreamAgentWithConversation(ctx context.Context, userID uint, agentID string, convID string, message string, attachIDs []string) (*schema.StreamReader[*schema.Message], string, string, error)
+
+	// 重新生成助手回复，新回复与原回复互为兄弟节点
+	RegenerateReply(ctx context.Context, userID uint, convID, msgID string) (*schema.StreamReader[*schema.Message], string, string, error)
+
+	// 编辑用户消息并重新发送，编辑后的消息与原消息互为兄弟节点，沿用原消息的附件
+	EditMessage(ctx context.Context, userID uint, convID, msgID, message string) (*schema.StreamReader[*schema.Message], string, string, error)
+
+	// 切换会话的当前分支
+	SwitchBranch(ctx context.Context, userID uint, convID, msgID string) error
 
-	// 创建新会话
-	CreateConversation(ctx context.Context, userID uint, agentID string) (string, error)
+	// 获取会话的消息树
+	GetMessageTree(ctx context.Context, userID uint, convID string) (*model.MessageTree, error)
+
+	// 创建新会话，pinVersion为true时固定使用当前发布的Agent版本，Agent从未发布时返回 ErrAgentNotPublished
+	CreateConversation(ctx context.Context, userID uint, agentID string, pinVersion bool) (string, error)
 
 	// 删除会话
 	DeleteConversation(ctx context.Context, convID string) error
@@ -34,6 +55,39 @@ type ConversationService interface {
 	// 列出特定Agent的会话
 	ListAgentConversations(ctx context.Context, userID uint, agentID string, page, size int) ([]*model.Conversation, int64, error)
 
+	// 提交工具审批结果并恢复暂停的运行
+	ResumeAgentWithApproval(ctx context.Context, userID uint, runID string, decisions []model.ApprovalDecision) (*schema.StreamReader[*schema.Message], string, string, error)
+
+	// 手动设置会话标题
+	RenameConversation(ctx context.Context, userID uint, convID, title string) error
+
+	// 清除会话上下文，之后的对话不再携带之前的历史
+	ClearContext(ctx context.Context, userID uint, convID string) error
+
+	// 在用户的会话历史中全文检索
+	SearchHistory(ctx context.Context, userID uint, req *model.SearchRequest) (*model.SearchResult, error)
+
+	// 以消息为游标分页获取会话历史
+	PageMessages(ctx context.Context, userID uint, req *model.MessagePageRequest) (*model.MessagePage, error)
+
+	// 导出会话，返回文件名、Content-Type和内容
+	ExportConversations(ctx context.Context, userID uint, req *model.ExportConvRequest) (string, string, []byte, error)
+
+	// 从导出文件导入会话到Agent
+	ImportConversations(ctx context.Context, userID uint, agentID, filename string, data []byte) (*model.ImportConvResult, error)
+
+	// 重新连接到进行中或刚结束的回复生成，返回回复流、父消息ID和会话ID
+	AttachReply(ctx context.Context, userID uint, msgID string) (*schema.StreamReader[*schema.Message], string, string, error)
+
+	// 获取会话设置及生效值
+	GetSettings(ctx context.Context, userID uint, convID string) (*model.ConvSettingsResponse, error)
+
+	// 更新会话设置，覆盖Agent的默认配置
+	UpdateSettings(ctx context.Context, userID uint, convID string, settings *model.ConversationSettings) error
+
+	// 停止进行中的回复生成，已生成的部分保存为回复
+	StopReply(ctx context.Context, userID uint, convID, msgID string) error
+
 	// 获取会话历史消息
 	GetConversationHistory(ctx context.Context, convID string, limit int) ([]*schema.Message, error)
 }
@@ -41,12 +95,27 @@ type ConversationService interface {
 type conversationService struct {
 	agentSvc   AgentService
 	historySvc HistoryService
+	attachSvc  AttachmentService
+	// runs 进行中和刚结束的回复生成
+	runs *replyRuns
 }
 
-func NewConversationService(agentSvc AgentService, historySvc HistoryService) ConversationService {
+// NewConversationService 创建会话服务。stopDao为共享协调后端，为nil时停止请求只作用于本实例上的运行
+func NewConversationService(agentSvc AgentService, historySvc HistoryService, attachSvc AttachmentService, stopDao hisdao.StopDao) ConversationService {
+	// 上次退出时未结束的回复不会再结束。单实例部署时全部标记为error，
+	// 配置了共享协调后端时其他实例可能仍在生成，只处理超过最长运行时间的
+	before := time.Now()
+	if stopDao != nil {
+		before = before.Add(-staleReplyAge)
+	}
+	if err := historySvc.FailStaleReplies(context.Background(), before); err != nil {
+		log.Printf("[Conversation] 清理中断的回复失败: %v", err)
+	}
 	return &conversationService{
 		agentSvc:   agentSvc,
 		historySvc: historySvc,
+		attachSvc:  attachSvc,
+		runs:       newReplyRuns(stopDao),
 	}
 }
 
@@ -58,127 +127,577 @@ func (s *conversationService) DebugStreamAgent(ctx context.Context, userID uint,
 		History: []*schema.Message{},
 	}
 
-	// 调用无状态的StreamExecuteAgent
-	return s.agentSvc.StreamExecuteAgent(ctx, userID, agentID, userMsg)
+	// 调用无状态的StreamExecuteAgent，调试模式运行草稿配置
+	return s.agentSvc.StreamExecuteAgent(ctx, userID, agentID, userMsg, WithAgentVersion(model.AgentVersionDraft), WithDebug())
 }
 
-// StreamAgentWithConversation 会话模式：记录历史
-func (s *conversationService) StreamAgentWithConversation(ctx context.Context, userID uint, agentID string, convID string, message string) (*schema.StreamReader[*schema.Message], error) {
-	// 确保会话存在
-	conv := &model.Conversation{
-		ConvID:    convID,
-		UserID:    userID,
-		AgentID:   agentID,
-		CreatedAt: time.Now().Unix(),
-		UpdatedAt: time.Now().Unix(),
+// turn 一轮对话，回复保存为parentID（本轮用户消息）的子消息
+type turn struct {
+	conv     *model.Conversation
+	query    string
+	parentID string
+	replyID  string
+	// variant 回复是否为重新生成的变体
+	variant bool
+	window  *ContextWindow
+	// settings 本轮生效的会话设置，随回复保存
+	settings *model.ConversationSettings
+}
+
+// StreamAgentWithConversation 会话模式：记录历史，用户消息接在当前分支的末端。同时返回助手回复和用户消息的ID
+func (s *conversationService) StreamAgentWithConversation(ctx context.Context, userID uint, agentID string, convID string, message string, attachIDs []string) (*schema.StreamReader[*schema.Message], string, string, error) {
+	// 已有会话必须属于该用户和Agent，不存在时才创建
+	conv, err := s.getOwnConversation(ctx, userID, convID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		conv = &model.Conversation{
+			ConvID:    convID,
+			UserID:    userID,
+			AgentID:   agentID,
+			CreatedAt: time.Now().Unix(),
+			UpdatedAt: time.Now().Unix(),
+		}
+		if err := s.historySvc.CreateConversation(ctx, conv); err != nil {
+			log.Printf("[StreamAgentWithConversation] 创建会话失败: %v", err)
+			return nil, "", "", fmt.Errorf("创建会话失败: %w", err)
+		}
+	case err != nil:
+		return nil, "", "", err
+	case agentID != "" && conv.AgentID != agentID:
+		return nil, "", "", errors.New("conversation does not belong to the agent")
 	}
-	err := s.historySvc.CreateConversation(ctx, conv)
+
+	parentID, err := s.historySvc.ActiveLeaf(ctx, conv)
 	if err != nil {
-		// 可能是会话已存在，忽略错误
-		log.Printf("[StreamAgentWithConversation] 创建会话失败: %w", err)
-		return nil, fmt.Errorf("获取会话失败: %w", err)
+		return nil, "", "", fmt.Errorf("获取历史消息失败: %w", err)
 	}
+	return s.streamTurn(ctx, conv, parentID, message, attachIDs, nil, false)
+}
 
-	// 先获取历史消息
-	historyMsgs, err := s.historySvc.GetHistory(ctx, convID, 50)
+// RegenerateReply 以原回复对应的用户消息重新运行，历史为该用户消息之前的分支
+func (s *conversationService) RegenerateReply(ctx context.Context, userID uint, convID, msgID string) (*schema.StreamReader[*schema.Message], string, string, error) {
+	conv, err := s.getOwnConversation(ctx, userID, convID)
+	if err != nil {
+		return nil, "", "", err
+	}
+	reply, err := s.historySvc.GetMessage(ctx, convID, msgID)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if reply.Role != string(schema.Assistant) {
+		return nil, "", "", errors.New("only assistant replies can be regenerated")
+	}
+	userMsg, err := s.historySvc.GetMessage(ctx, convID, reply.ParentID)
+	if err != nil || userMsg.Role != string(schema.User) {
+		return nil, "", "", errors.New("reply has no user message to regenerate from")
+	}
+	attachIDs, err := s.attachSvc.MessageAttachments(ctx, userMsg.MsgID)
 	if err != nil {
-		log.Printf("[StreamAgentWithConversation] 获取历史消息失败: %w", err)
-		return nil, fmt.Errorf("获取历史消息失败: %w", err)
+		return nil, "", "", err
 	}
+	return s.streamTurn(ctx, conv, userMsg.ParentID, userMsg.Content, attachIDs, userMsg, false)
+}
 
-	// 保存用户消息
-	userSchemaMsg := &schema.Message{
-		Role:    schema.User,
-		Content: message,
+// EditMessage 将编辑后的消息保存为原消息的兄弟节点并运行，原消息及其后续回复保留在原分支
+func (s *conversationService) EditMessage(ctx context.Context, userID uint, convID, msgID, message string) (*schema.StreamReader[*schema.Message], string, string, error) {
+	conv, err := s.getOwnConversation(ctx, userID, convID)
+	if err != nil {
+		return nil, "", "", err
+	}
+	orig, err := s.historySvc.GetMessage(ctx, convID, msgID)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if orig.Role != string(schema.User) {
+		return nil, "", "", errors.New("only user messages can be edited")
 	}
-	err = s.historySvc.SaveMessage(ctx, userSchemaMsg, convID)
+	attachIDs, err := s.attachSvc.MessageAttachments(ctx, orig.MsgID)
 	if err != nil {
-		log.Printf("[StreamAgentWithConversation] 保存用户消息失败: %w", err)
-		return nil, fmt.Errorf("保存用户消息失败: %w", err)
+		return nil, "", "", err
 	}
+	return s.streamTurn(ctx, conv, orig.ParentID, message, attachIDs, nil, true)
+}
 
-	// 创建用户消息，包含历史
-	userMsg := model.UserMessage{
-		Query:   message,
-		History: historyMsgs,
+// streamTurn 在parentID之后运行一轮对话，历史为从根到parentID的分支，attachIDs为本轮用户消息的附件。
+// userMsg为nil时将query保存为parentID的新子消息（edited标记编辑产生的变体），否则复用该用户消息，回复作为原回复的变体
+func (s *conversationService) streamTurn(ctx context.Context, conv *model.Conversation, parentID, query string, attachIDs []string, userMsg *model.Message, edited bool) (*schema.StreamReader[*schema.Message], string, string, error) {
+	// 校验附件并绑定到会话
+	attachments, refs, err := s.attachSvc.Prepare(ctx, conv, attachIDs)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("附件无效: %w", err)
+	}
+	settings := conversationSettings(conv)
+	if hasImageAttachment(refs) {
+		vision, err := s.agentSvc.SupportsVision(ctx, conv.UserID, conv.AgentID, conv.AgentVersion, settings)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("获取Agent模型失败: %w", err)
+		}
+		if !vision {
+			return nil, "", "", errors.New("当前Agent的模型不支持图片输入")
+		}
+	}
+
+	// 先获取历史消息，按模型的上下文长度选取最近的消息，直接注入的附件文本计入本轮消息
+	budget, err := s.agentSvc.ContextBudget(ctx, conv.UserID, conv.AgentID, conv.AgentVersion, query+attachmentText(attachments), settings)
+	if err != nil {
+		log.Printf("[StreamAgentWithConversation] 计算上下文长度失败: %v", err)
+		budget = defaultContextTokens
+	}
+	window, err := s.historySvc.GetContext(ctx, conv, parentID, budget)
+	if err != nil {
+		log.Printf("[StreamAgentWithConversation] 获取历史消息失败: %v", err)
+		return nil, "", "", fmt.Errorf("获取历史消息失败: %w", err)
+	}
+	// 预算为0时摘要也放不进上下文，不生成摘要，避免每轮都调用模型
+	if budget <= 0 {
+		window.Overflow = nil
+	}
+
+	// 保存用户消息，重新生成时只将当前分支切回该用户消息
+	regenerate := userMsg != nil
+	if regenerate {
+		err = s.historySvc.SetCurrentMsg(ctx, conv, userMsg.MsgID)
+	} else {
+		userMsg, err = s.historySvc.AddMessage(ctx, conv, schema.UserMessage(query), "", parentID, edited, &model.MessageMetadata{Attachments: refs})
+		if err == nil {
+			err = s.attachSvc.Link(ctx, userMsg.MsgID, attachIDs)
+		}
+	}
+	if err != nil {
+		log.Printf("[StreamAgentWithConversation] 保存用户消息失败: %v", err)
+		return nil, "", "", fmt.Errorf("保存用户消息失败: %w", err)
+	}
+
+	// 创建用户消息，包含历史和本轮的附件
+	input := model.UserMessage{
+		Query:       query,
+		History:     window.History(),
+		Attachments: attachments,
+	}
+
+	// 预先创建pending状态的助手回复，其ID同时用于关联本次运行的Trace
+	replyID := uuid.NewString()
+	if _, err := s.historySvc.AddPendingReply(ctx, conv, replyID, userMsg.MsgID, regenerate); err != nil {
+		log.Printf("[StreamAgentWithConversation] 创建助手回复失败: %v", err)
+		return nil, "", "", fmt.Errorf("创建助手回复失败: %w", err)
+	}
+
+	// 调用Agent处理，访客会话不使用分享者的长期记忆。生成在服务端进行，不随请求结束
+	opts := []ExecuteOption{WithAgentVersion(conv.AgentVersion), WithTrace(conv.ConvID, replyID), WithSettings(settings)}
+	if r := s.attachSvc.Retriever(ctx, conv.ConvID); r != nil {
+		opts = append(opts, WithAttachments(r))
+	}
+	if conv.VisitorID == "" {
+		opts = append(opts, WithMemory())
+	}
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), replyRunTimeout)
+	sr, err := s.agentSvc.StreamExecuteAgent(runCtx, conv.UserID, conv.AgentID, input, opts...)
+	if err != nil {
+		cancel()
+		log.Printf("[StreamAgentWithConversation] 运行Agent失败: %v", err)
+		_ = s.historySvc.FinalizeReply(context.WithoutCancel(ctx), replyID, nil, nil, model.MessageStatusError)
+		return nil, "", "", fmt.Errorf("运行Agent失败: %w", err)
+	}
+
+	t := &turn{
+		conv:     conv,
+		query:    query,
+		parentID: userMsg.MsgID,
+		replyID:  replyID,
+		variant:  regenerate,
+		window:   window,
+		settings: s.effectiveSettings(ctx, conv, settings),
+	}
+	return s.startReply(sr, t, cancel), replyID, userMsg.MsgID, nil
+}
+
+// attachmentText 附件中直接注入用户消息的文本
+func attachmentText(parts []schema.ChatMessagePart) string {
+	var sb strings.Builder
+	for _, p := range parts {
+		if p.Type == schema.ChatMessagePartTypeText {
+			sb.WriteString(p.Text)
+		}
+	}
+	return sb.String()
+}
+
+// hasImageAttachment 本轮消息是否带有图片附件
+func hasImageAttachment(refs []*model.AttachmentRef) bool {
+	for _, ref := range refs {
+		if ref.Type == model.AttachmentTypeImage {
+			return true
+		}
+	}
+	return false
+}
+
+// conversationSettings 解析会话设置，没有设置时为nil
+func conversationSettings(conv *model.Conversation) *model.ConversationSettings {
+	if len(conv.Settings) == 0 || string(conv.Settings) == "null" {
+		return nil
+	}
+	var settings model.ConversationSettings
+	if err := json.Unmarshal(conv.Settings, &settings); err != nil {
+		log.Printf("[Conversation %s] 解析会话设置失败: %v", conv.ConvID, err)
+		return nil
+	}
+	return &settings
+}
+
+// effectiveSettings 计算本轮生效的会话设置，失败时不记录
+func (s *conversationService) effectiveSettings(ctx context.Context, conv *model.Conversation, settings *model.ConversationSettings) *model.ConversationSettings {
+	effective, err := s.agentSvc.EffectiveSettings(ctx, conv.UserID, conv.AgentID, conv.AgentVersion, settings)
+	if err != nil {
+		log.Printf("[Conversation %s] 计算生效设置失败: %v", conv.ConvID, err)
+		return nil
+	}
+	return effective
+}
+
+// GetSettings 获取会话设置及与Agent配置合并后的生效值
+func (s *conversationService) GetSettings(ctx context.Context, userID uint, convID string) (*model.ConvSettingsResponse, error) {
+	conv, err := s.getOwnConversation(ctx, userID, convID)
+	if err != nil {
+		return nil, err
+	}
+	settings := conversationSettings(conv)
+	effective, err := s.agentSvc.EffectiveSettings(ctx, conv.UserID, conv.AgentID, conv.AgentVersion, settings)
+	if err != nil {
+		return nil, err
+	}
+	return &model.ConvSettingsResponse{Settings: settings, Effective: effective}, nil
+}
+
+// UpdateSettings 替换会话设置，settings为nil时恢复Agent的默认配置
+func (s *conversationService) UpdateSettings(ctx context.Context, userID uint, convID string, settings *model.ConversationSettings) error {
+	conv, err := s.getOwnConversation(ctx, userID, convID)
+	if err != nil {
+		return err
+	}
+	if err := s.agentSvc.ValidateSettings(ctx, userID, conv.AgentID, conv.AgentVersion, settings); err != nil {
+		return err
 	}
+	return s.historySvc.SetSettings(ctx, conv.ConvID, settings)
+}
 
-	// 调用Agent处理
-	sr, err := s.agentSvc.StreamExecuteAgent(ctx, userID, agentID, userMsg)
+// SwitchBranch 切换到包含msgID的分支
+func (s *conversationService) SwitchBranch(ctx context.Context, userID uint, convID, msgID string) error {
+	conv, err := s.getOwnConversation(ctx, userID, convID)
 	if err != nil {
-		log.Printf("[StreamAgentWithConversation] 运行Agent失败: %w", err)
-		return nil, fmt.Errorf("运行Agent失败: %w", err)
+		return err
 	}
+	return s.historySvc.SwitchBranch(ctx, conv, msgID)
+}
 
-	// 复制流
-	srs := sr.Copy(2)
+// GetMessageTree 获取会话的消息树
+func (s *conversationService) GetMessageTree(ctx context.Context, userID uint, convID string) (*model.MessageTree, error) {
+	conv, err := s.getOwnConversation(ctx, userID, convID)
+	if err != nil {
+		return nil, err
+	}
+	return s.historySvc.GetTree(ctx, conv)
+}
+
+// getOwnConversation 获取属于该用户的会话
+func (s *conversationService) getOwnConversation(ctx context.Context, userID uint, convID string) (*model.Conversation, error) {
+	conv, err := s.historySvc.GetConversation(ctx, convID)
+	if err != nil {
+		return nil, err
+	}
+	if conv.UserID != userID {
+		return nil, errors.New("conversation not found or no permission")
+	}
+	return conv, nil
+}
+
+// ResumeAgentWithApproval 提交工具审批结果并恢复暂停的运行，会话模式下的运行恢复后同样在服务端继续生成。
+// 返回助手回复的消息ID和会话ID（非会话模式为空）
+func (s *conversationService) ResumeAgentWithApproval(ctx context.Context, userID uint, runID string, decisions []model.ApprovalDecision) (*schema.StreamReader[*schema.Message], string, string, error) {
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), replyRunTimeout)
+	sr, run, err := s.agentSvc.ResumeAgent(runCtx, userID, runID, decisions)
+	if err != nil {
+		cancel()
+		return nil, "", "", err
+	}
+	if run.ConvID == "" {
+		// 非会话模式没有可重新连接的回复，仍随请求结束
+		context.AfterFunc(ctx, cancel)
+		return sr, uuid.NewString(), "", nil
+	}
+
+	conv := &model.Conversation{
+		ConvID:  run.ConvID,
+		UserID:  userID,
+		AgentID: run.AgentID,
+	}
+	if err := s.historySvc.CreateConversation(ctx, conv); err != nil {
+		sr.Close()
+		cancel()
+		return nil, "", "", fmt.Errorf("获取会话失败: %w", err)
+	}
+	var input model.UserMessage
+	_ = json.Unmarshal([]byte(run.Input), &input)
+
+	// 暂停时回复保持pending状态；之前版本暂停的运行没有预先创建回复，其父消息是当前分支末端的用户消息
+	reply, err := s.historySvc.GetMessage(ctx, conv.ConvID, run.MsgID)
+	if err != nil {
+		reply, err = s.historySvc.AddPendingReply(ctx, conv, run.MsgID, conv.CurrentMsgID, false)
+		if err != nil {
+			sr.Close()
+			cancel()
+			return nil, "", "", fmt.Errorf("创建助手回复失败: %w", err)
+		}
+	}
+	var settings *model.ConversationSettings
+	if len(run.Settings) > 0 {
+		settings = &model.ConversationSettings{}
+		_ = json.Unmarshal(run.Settings, settings)
+	}
+	t := &turn{
+		conv:     conv,
+		query:    input.Query,
+		parentID: reply.ParentID,
+		replyID:  run.MsgID,
+		settings: s.effectiveSettings(ctx, conv, settings),
+	}
+	return s.startReply(sr, t, cancel), run.MsgID, run.ConvID, nil
+}
+
+// AttachReply 重新连接到进行中或刚结束的回复生成，从头回放回复流。返回父消息ID和会话ID
+func (s *conversationService) AttachReply(ctx context.Context, userID uint, msgID string) (*schema.StreamReader[*schema.Message], string, string, error) {
+	run, ok := s.runs.get(msgID)
+	if !ok || run.userID != userID {
+		return nil, "", "", ErrReplyRunNotFound
+	}
+	return run.reader(), run.parentID, run.convID, nil
+}
+
+// StopReply 停止进行中的回复生成。运行不在本实例上时通过共享协调后端通知运行所在的实例，
+// 因等待审批暂停的运行取消待审批的调用，回复标记为stopped
+func (s *conversationService) StopReply(ctx context.Context, userID uint, convID, msgID string) error {
+	conv, err := s.getOwnConversation(ctx, userID, convID)
+	if err != nil {
+		return err
+	}
+	if run, ok := s.runs.get(msgID); ok && run.convID == conv.ConvID && !run.isDone() {
+		run.stop()
+		return nil
+	}
+
+	msg, err := s.historySvc.GetMessage(ctx, conv.ConvID, msgID)
+	if err != nil {
+		return err
+	}
+	if msg.Status != model.MessageStatusPending {
+		return errors.New("reply is not being generated")
+	}
+	cancelled, err := s.agentSvc.CancelPausedRun(ctx, userID, msgID)
+	if err != nil {
+		return err
+	}
+	if cancelled {
+		return s.historySvc.FinalizeReply(ctx, msgID, nil, nil, model.MessageStatusStopped)
+	}
+	requested, err := s.runs.requestStop(ctx, msgID)
+	if err != nil {
+		return err
+	}
+	if !requested {
+		return ErrReplyRunNotFound
+	}
+	return nil
+}
+
+// startReply 在后台读取完整的回复流并缓存，客户端断开不影响生成。结束后保存回复（出错时保留已生成的部分并标记为error），
+// 再从本轮对话中提取长期记忆，并将超出上下文窗口的消息合并进摘要。运行因等待审批暂停时回复保持pending状态。
+// cancel在生成结束时调用，返回的流从头读取本次回复
+func (s *conversationService) startReply(sr *schema.StreamReader[*schema.Message], t *turn, cancel context.CancelFunc) *schema.StreamReader[*schema.Message] {
+	conv := t.conv
+	run := newReplyRun(conv.UserID, t.replyID, conv.ConvID, t.parentID, cancel)
+	s.runs.add(run)
 
 	// 创建一个独立的上下文用于保存消息，不依赖于请求上下文
 	saveCtx := context.Background()
 
-	// 后台处理：记录完整回复
 	go func() {
+		defer cancel()
+		defer sr.Close()
+
 		fullMsgs := make([]*schema.Message, 0)
+		meta := &model.MessageMetadata{Settings: t.settings}
+		paused := false
+		var runErr error
+		for {
+			chunk, err := sr.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				runErr = err
+				break
+			}
+			run.append(chunk)
+
+			// 运行过程中的事件不计入回复，工具调用、引用和用量随回复保存
+			if e, ok := IsStreamEvent(chunk); ok {
+				collectMetadata(meta, e)
+				paused = paused || e.Type == stream.EventApprovalRequest
+			}
+			if isEventMessage(chunk) {
+				continue
+			}
+			fullMsgs = append(fullMsgs, chunk)
+		}
 
-		defer func() {
-			srs[1].Close()
-			// 合并消息
-			if len(fullMsgs) > 0 {
-				fullMsg, err := schema.ConcatMessages(fullMsgs)
-				if err != nil {
-					fmt.Println("合并消息失败:", err.Error())
-					return
-				}
-
-				// 使用独立上下文保存消息
-				err = s.historySvc.SaveMessage(saveCtx, fullMsg, convID)
-				if err != nil {
-					fmt.Println("保存消息失败:", err.Error())
-				}
-
-				// 更新会话最后更新时间
-				conv.UpdatedAt = time.Now().Unix()
-				_ = s.historySvc.UpdateConversation(saveCtx, conv)
+		var fullMsg *schema.Message
+		if len(fullMsgs) > 0 {
+			msg, err := schema.ConcatMessages(fullMsgs)
+			if err != nil {
+				log.Printf("[Reply %s] 合并消息失败: %v", t.replyID, err)
+			} else {
+				fullMsg = msg
 			}
-		}()
+		}
 
-	outer:
-		for {
-			select {
-			case <-ctx.Done():
-				fmt.Println("上下文已关闭:", ctx.Err())
-				return
-			default:
-				chunk, err := srs[1].Recv()
-				if err != nil {
-					if errors.Is(err, io.EOF) {
-						break outer
-					}
-					fmt.Println("接收消息块错误:", err.Error())
-					return
-				}
-
-				fullMsgs = append(fullMsgs, chunk)
+		status := model.MessageStatusSent
+		switch {
+		case run.isStopped():
+			// 被停止时运行因上下文取消而出错，已生成的部分作为回复保存
+			status, runErr = model.MessageStatusStopped, ErrReplyStopped
+		case runErr != nil:
+			log.Printf("[Reply %s] 接收消息块错误: %v", t.replyID, runErr)
+			status = model.MessageStatusError
+		}
+		if runErr != nil || !paused {
+			if err := s.historySvc.FinalizeReply(saveCtx, t.replyID, fullMsg, meta, status); err != nil {
+				log.Printf("[Reply %s] 保存消息失败: %v", t.replyID, err)
+			}
+		}
+		run.finish(runErr)
+		s.runs.expire(t.replyID, replyRunTTL)
+
+		// 更新会话最后更新时间
+		_ = s.historySvc.TouchConversation(saveCtx, conv.ConvID)
+		if runErr != nil || fullMsg == nil {
+			return
+		}
+
+		// 第一轮对话后自动生成标题
+		if needsTitle(conv) {
+			s.autoTitle(saveCtx, conv, t.query, fullMsg.Content)
+		}
+
+		// 提取长期记忆，访客会话不记录
+		if conv.VisitorID == "" {
+			err := s.agentSvc.ExtractMemories(saveCtx, conv.UserID, conv.AgentID, conv.AgentVersion, conv.ConvID, t.query, fullMsg.Content)
+			if err != nil {
+				log.Printf("[Memory] 会话%s提取记忆失败: %v", conv.ConvID, err)
 			}
 		}
+
+		// 滚动摘要
+		if t.window != nil && len(t.window.Overflow) > 0 {
+			s.rollupSummary(saveCtx, conv, t.window)
+		}
 	}()
 
-	return srs[0], nil
+	return run.reader()
+}
+
+// collectMetadata 记录回复运行过程中的工具调用、检索引用和用量
+func collectMetadata(meta *model.MessageMetadata, e *stream.Event) {
+	switch {
+	case e.Type == stream.EventToolCall && e.ToolCall != nil:
+		meta.ToolCalls = append(meta.ToolCalls, e.ToolCall)
+	case e.Type == stream.EventToolResult && e.ToolResult != nil:
+		meta.ToolResults = append(meta.ToolResults, e.ToolResult)
+	case e.Type == stream.EventRetrieval:
+		meta.References = append(meta.References, e.References...)
+	case e.Type == stream.EventUsage:
+		meta.Usage = e.Usage
+	}
+}
+
+// needsTitle 会话仍是默认标题且未被手动命名
+func needsTitle(conv *model.Conversation) bool {
+	return !conv.TitleManual && (conv.Title == "" || strings.HasPrefix(conv.Title, defaultConvTitle))
+}
+
+// autoTitle 生成会话标题，不会覆盖期间用户手动设置的标题
+func (s *conversationService) autoTitle(ctx context.Context, conv *model.Conversation, query, reply string) {
+	title, err := s.agentSvc.GenerateTitle(ctx, conv.UserID, conv.AgentID, conv.AgentVersion, query, reply)
+	if err != nil {
+		log.Printf("[Title conv=%s] 生成标题失败: %v", conv.ConvID, err)
+		return
+	}
+	if title == "" {
+		return
+	}
+	if err := s.historySvc.SetTitle(ctx, conv.ConvID, title, false); err != nil {
+		log.Printf("[Title conv=%s] 保存标题失败: %v", conv.ConvID, err)
+		return
+	}
+	conv.Title = title
+}
+
+// RenameConversation 手动设置会话标题，之后不再自动生成
+func (s *conversationService) RenameConversation(ctx context.Context, userID uint, convID, title string) error {
+	if _, err := s.getOwnConversation(ctx, userID, convID); err != nil {
+		return err
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return errors.New("title is required")
+	}
+	return s.historySvc.SetTitle(ctx, convID, title, true)
+}
+
+// rollupSummary 将超出上下文窗口的消息合并进会话摘要
+func (s *conversationService) rollupSummary(ctx context.Context, conv *model.Conversation, window *ContextWindow) {
+	summary, err := s.agentSvc.SummarizeHistory(ctx, conv.UserID, conv.AgentID, conv.AgentVersion, window.Summary, utils.MessageList2ChatHistory(window.Overflow))
+	if err != nil {
+		log.Printf("[Summary conv=%s] 生成摘要失败: %v", conv.ConvID, err)
+		return
+	}
+	last := window.Overflow[len(window.Overflow)-1]
+	if err := s.historySvc.UpdateSummary(ctx, conv.ConvID, summary, last.ID); err != nil {
+		log.Printf("[Summary conv=%s] 保存摘要失败: %v", conv.ConvID, err)
+	}
+}
+
+// ClearContext 清除会话上下文，历史消息保留
+func (s *conversationService) ClearContext(ctx context.Context, userID uint, convID string) error {
+	if _, err := s.getOwnConversation(ctx, userID, convID); err != nil {
+		return err
+	}
+	return s.historySvc.ClearContext(ctx, convID)
 }
 
 // CreateConversation 创建新会话
-func (s *conversationService) CreateConversation(ctx context.Context, userID uint, agentID string) (string, error) {
+func (s *conversationService) CreateConversation(ctx context.Context, userID uint, agentID string, pinVersion bool) (string, error) {
 	convID := uuid.NewString()
 
 	conv := &model.Conversation{
 		ConvID:    convID,
 		UserID:    userID,
 		AgentID:   agentID,
-		Title:     defaultConvTitle + time.Now().String(),
+		Title:     defaultConvTitle,
 		CreatedAt: time.Now().Unix(),
 		UpdatedAt: time.Now().Unix(),
 	}
 
+	if pinVersion {
+		agent, err := s.agentSvc.GetAgent(ctx, userID, agentID)
+		if err != nil {
+			return "", fmt.Errorf("[CreateConversation] 获取Agent失败: %w", err)
+		}
+		if agent.PublishedVersion == 0 {
+			return "", ErrAgentNotPublished
+		}
+		conv.AgentVersion = agent.PublishedVersion
+	}
+
 	err := s.historySvc.CreateConversation(ctx, conv)
 	if err != nil {
 		return "", fmt.Errorf("[CreateConversation] 创建会话失败: %w", err)
@@ -197,12 +716,29 @@ func (s *conversationService) ListAgentConversations(ctx context.Context, userID
 	return s.historySvc.ListConversationsByAgent(ctx, userID, agentID, page, size)
 }
 
+// SearchHistory 在用户的会话历史中全文检索
+func (s *conversationService) SearchHistory(ctx context.Context, userID uint, req *model.SearchRequest) (*model.SearchResult, error) {
+	return s.historySvc.Search(ctx, userID, req)
+}
+
+// PageMessages 以消息为游标分页获取会话历史，用于从检索结果跳转到消息所在位置
+func (s *conversationService) PageMessages(ctx context.Context, userID uint, req *model.MessagePageRequest) (*model.MessagePage, error) {
+	conv, err := s.getOwnConversation(ctx, userID, req.ConvID)
+	if err != nil {
+		return nil, err
+	}
+	return s.historySvc.PageMessages(ctx, conv, req)
+}
+
 // GetConversationHistory 获取会话历史消息
 func (s *conversationService) GetConversationHistory(ctx context.Context, convID string, limit int) ([]*schema.Message, error) {
 	return s.historySvc.GetHistory(ctx, convID, limit)
 }
 
-// DeleteConversation 删除会话
+// DeleteConversation 删除会话及其附件
 func (s *conversationService) DeleteConversation(ctx context.Context, convID string) error {
+	if err := s.attachSvc.DeleteByConversation(ctx, convID); err != nil {
+		return err
+	}
 	return s.historySvc.DeleteConversation(ctx, convID)
 }
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// fakeHistory 内存中的会话，只实现测试用到的方法
+type fakeHistory struct {
+	HistoryService
+	convs   map[string]*model.Conversation
+	created []*model.Conversation
+}
+
+var errNoLeaf = errors.New("no active leaf")
+
+func (h *fakeHistory) GetConversation(_ context.Context, convID string) (*model.Conversation, error) {
+	conv, ok := h.convs[convID]
+	if !ok {
+		return nil, fmt.Errorf("failed to get conversation: %w", gorm.ErrRecordNotFound)
+	}
+	copied := *conv
+	return &copied, nil
+}
+
+func (h *fakeHistory) CreateConversation(_ context.Context, conv *model.Conversation) error {
+	h.created = append(h.created, conv)
+	return nil
+}
+
+// ActiveLeaf 返回错误，在会话校验之后结束本轮对话
+func (h *fakeHistory) ActiveLeaf(context.Context, *model.Conversation) (string, error) {
+	return "", errNoLeaf
+}
+
+func TestStreamAgentWithConversationOwnership(t *testing.T) {
+	tests := []struct {
+		name        string
+		userID      uint
+		agentID     string
+		convID      string
+		wantErr     string
+		wantCreated bool
+	}{
+		{"own conversation", 1, "agent-1", "conv-1", "获取历史消息失败", false},
+		{"other user's conversation", 2, "agent-1", "conv-1", "no permission", false},
+		{"mismatched agent", 1, "agent-2", "conv-1", "does not belong to the agent", false},
+		{"new conversation", 2, "agent-2", "conv-new", "获取历史消息失败", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := &fakeHistory{convs: map[string]*model.Conversation{
+				"conv-1": {ConvID: "conv-1", UserID: 1, AgentID: "agent-1"},
+			}}
+			s := &conversationService{historySvc: history}
+			_, _, _, err := s.StreamAgentWithConversation(context.Background(), tt.userID, tt.agentID, tt.convID, "hi", nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if got := len(history.created) == 1; got != tt.wantCreated {
+				t.Fatalf("created = %+v", history.created)
+			}
+			if tt.wantCreated {
+				if c := history.created[0]; c.ConvID != tt.convID || c.UserID != tt.userID || c.AgentID != tt.agentID {
+					t.Errorf("created conversation = %+v", c)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,575 @@
+package service
+
+import (
+	"ai-cloud/internal/model"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxExportConversations 按Agent导出时最多导出的会话数，超出时导出最近更新的会话
+	maxExportConversations = 500
+	// MaxImportSize 导入文件及zip中单个文件解压后的最大字节数
+	MaxImportSize = 50 << 20
+	// MaxImportUnzippedSize zip中全部文件解压后的最大总字节数
+	MaxImportUnzippedSize = 200 << 20
+)
+
+var errUnknownImportFormat = errors.New("unrecognized conversation format, expected an exported JSON or ChatGPT conversations.json")
+
+// ExportConversations 导出会话，返回文件名、Content-Type和文件内容。单个会话直接返回对应格式的文件，多个会话打包为zip
+func (s *conversationService) ExportConversations(ctx context.Context, userID uint, req *model.ExportConvRequest) (string, string, []byte, error) {
+	convs, err := s.exportTargets(ctx, userID, req)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if len(convs) == 1 {
+		exp, err := s.historySvc.ExportConversation(ctx, convs[0])
+		if err != nil {
+			return "", "", nil, err
+		}
+		data, ext, contentType, err := renderExport(exp, req.Format)
+		if err != nil {
+			return "", "", nil, err
+		}
+		return "conversation-" + convs[0].ConvID + ext, contentType, data, nil
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, conv := range convs {
+		exp, err := s.historySvc.ExportConversation(ctx, conv)
+		if err != nil {
+			return "", "", nil, err
+		}
+		data, ext, _, err := renderExport(exp, req.Format)
+		if err != nil {
+			return "", "", nil, err
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     exportEntryName(conv, ext),
+			Method:   zip.Deflate,
+			Modified: time.Unix(conv.UpdatedAt, 0),
+		})
+		if err != nil {
+			return "", "", nil, fmt.Errorf("failed to write zip: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return "", "", nil, fmt.Errorf("failed to write zip: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", "", nil, fmt.Errorf("failed to write zip: %w", err)
+	}
+	return "conversations-" + time.Now().Format("20060102150405") + ".zip", "application/zip", buf.Bytes(), nil
+}
+
+// exportTargets 获取要导出的会话：指定的会话，或Agent下的全部会话（不含访客会话）
+func (s *conversationService) exportTargets(ctx context.Context, userID uint, req *model.ExportConvRequest) ([]*model.Conversation, error) {
+	if len(req.ConvIDs) > 0 {
+		convs := make([]*model.Conversation, 0, len(req.ConvIDs))
+		for _, convID := range req.ConvIDs {
+			conv, err := s.getOwnConversation(ctx, userID, convID)
+			if err != nil {
+				return nil, err
+			}
+			convs = append(convs, conv)
+		}
+		return convs, nil
+	}
+	if req.AgentID == "" {
+		return nil, errors.New("conversation ID or agent ID is required")
+	}
+
+	convs, _, err := s.historySvc.ListConversationsByAgent(ctx, userID, req.AgentID, 1, maxExportConversations)
+	if err != nil {
+		return nil, err
+	}
+	if len(convs) == 0 {
+		return nil, errors.New("no conversations to export")
+	}
+	return convs, nil
+}
+
+// exportEntryName zip中的文件名：标题加会话ID前缀，避免重名
+func exportEntryName(conv *model.Conversation, ext string) string {
+	return fmt.Sprintf("%s-%.8s%s", safeFileName(exportTitle(conv.Title)), conv.ConvID, ext)
+}
+
+// safeFileName 替换文件名中不允许的字符，并截断到50个字符
+func safeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, name)
+	if r := []rune(name); len(r) > 50 {
+		name = string(r[:50])
+	}
+	return name
+}
+
+// renderExport 按格式渲染导出内容，返回内容、扩展名和Content-Type
+func renderExport(exp *model.ConversationExport, format string) ([]byte, string, string, error) {
+	switch format {
+	case model.ExportJSON:
+		data, err := json.MarshalIndent(exp, "", "  ")
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to marshal conversation: %w", err)
+		}
+		return data, ".json", "application/json; charset=utf-8", nil
+	case model.ExportHTML:
+		var buf bytes.Buffer
+		if err := transcriptTemplate.Execute(&buf, newTranscript(exp)); err != nil {
+			return nil, "", "", fmt.Errorf("failed to render html: %w", err)
+		}
+		return buf.Bytes(), ".html", "text/html; charset=utf-8", nil
+	default:
+		return renderMarkdown(exp), ".md", "text/markdown; charset=utf-8", nil
+	}
+}
+
+// exportPath Markdown和HTML只导出当前分支
+func exportPath(exp *model.ConversationExport) []*model.MessageExport {
+	byID := make(map[string]*model.MessageExport, len(exp.Messages))
+	for _, m := range exp.Messages {
+		byID[m.MsgID] = m
+	}
+	var msgs []*model.MessageExport
+	for id := exp.CurrentMsgID; id != "" && len(msgs) < len(exp.Messages); {
+		m, ok := byID[id]
+		if !ok {
+			break
+		}
+		msgs = append(msgs, m)
+		id = m.ParentID
+	}
+	slices.Reverse(msgs)
+	return msgs
+}
+
+func exportTitle(title string) string {
+	if title == "" {
+		return defaultConvTitle
+	}
+	return title
+}
+
+func exportRole(role string) string {
+	switch role {
+	case string(schema.User):
+		return "用户"
+	case string(schema.Assistant):
+		return "助手"
+	case string(schema.System):
+		return "系统"
+	default:
+		return role
+	}
+}
+
+func exportTime(ts int64) string {
+	if ts <= 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+}
+
+func renderMarkdown(exp *model.ConversationExport) []byte {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", exportTitle(exp.Title))
+	fmt.Fprintf(&sb, "- 会话ID：%s\n- Agent：%s\n- 创建时间：%s\n\n", exp.ConvID, exp.AgentID, exportTime(exp.CreatedAt))
+	if exp.Summary != "" {
+		fmt.Fprintf(&sb, "> 早期对话摘要：%s\n\n", exp.Summary)
+	}
+
+	for _, m := range exportPath(exp) {
+		sb.WriteString("## " + exportRole(m.Role))
+		if ts := exportTime(m.CreatedAt); ts != "" {
+			sb.WriteString(" · " + ts)
+		}
+		sb.WriteString("\n\n")
+		if m.ReasoningContent != "" {
+			fmt.Fprintf(&sb, "<details>\n<summary>思考过程</summary>\n\n%s\n\n</details>\n\n", m.ReasoningContent)
+		}
+		if m.Metadata != nil {
+			for _, tc := range m.Metadata.ToolCalls {
+				fmt.Fprintf(&sb, "> 调用工具 `%s`：`%s`\n\n", tc.Name, tc.Arguments)
+			}
+		}
+		sb.WriteString(m.Content + "\n\n")
+		if m.Metadata != nil && len(m.Metadata.References) > 0 {
+			sb.WriteString("引用：\n\n")
+			for _, ref := range m.Metadata.References {
+				fmt.Fprintf(&sb, "- %s（%.2f）\n", ref.DocumentName, ref.Score)
+			}
+			sb.WriteString("\n")
+		}
+		if m.IsContextEdge {
+			sb.WriteString("---\n\n*此处清除了上下文*\n\n")
+		}
+	}
+	return []byte(sb.String())
+}
+
+// transcript HTML导出的模板数据
+type transcript struct {
+	*model.ConversationExport
+	Path []*model.MessageExport
+}
+
+func newTranscript(exp *model.ConversationExport) *transcript {
+	return &transcript{ConversationExport: exp, Path: exportPath(exp)}
+}
+
+var transcriptTemplate = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"title": exportTitle,
+	"role":  exportRole,
+	"time":  exportTime,
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{title .Title}}</title>
+<style>
+body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI","PingFang SC","Microsoft YaHei",sans-serif;max-width:860px;margin:0 auto;padding:24px;color:#1f2328;background:#f6f8fa}
+h1{font-size:22px;margin-bottom:4px}
+.meta{color:#57606a;font-size:13px;margin-bottom:24px}
+.summary{border-left:3px solid #d0d7de;padding-left:12px;color:#57606a;font-size:14px}
+.msg{background:#fff;border:1px solid #d0d7de;border-radius:8px;padding:12px 16px;margin:12px 0}
+.msg.user{background:#ddf4ff}
+.head{font-size:12px;color:#57606a;margin-bottom:6px}
+.content{white-space:pre-wrap;word-break:break-word;line-height:1.6}
+details,.tool,.refs{font-size:13px;color:#57606a;margin-bottom:8px}
+details div{white-space:pre-wrap}
+code{background:#eff1f3;padding:1px 4px;border-radius:4px}
+.edge{text-align:center;color:#8c959f;font-size:12px;margin:16px 0}
+</style>
+</head>
+<body>
+<h1>{{title .Title}}</h1>
+<div class="meta">会话ID：{{.ConvID}} · Agent：{{.AgentID}} · 创建时间：{{time .CreatedAt}}</div>
+{{if .Summary}}<p class="summary">早期对话摘要：{{.Summary}}</p>{{end}}
+{{range .Path}}<div class="msg {{.Role}}">
+<div class="head">{{role .Role}}{{with time .CreatedAt}} · {{.}}{{end}}</div>
+{{if .ReasoningContent}}<details><summary>思考过程</summary><div>{{.ReasoningContent}}</div></details>{{end}}
+{{with .Metadata}}{{range .ToolCalls}}<div class="tool">调用工具 <code>{{.Name}}</code>：<code>{{.Arguments}}</code></div>{{end}}{{end}}
+<div class="content">{{.Content}}</div>
+{{with .Metadata}}{{if .References}}<div class="refs">引用：{{range .References}}<div>{{.DocumentName}}（{{printf "%.2f" .Score}}）</div>{{end}}</div>{{end}}{{end}}
+</div>
+{{if .IsContextEdge}}<div class="edge">此处清除了上下文</div>{{end}}
+{{end}}</body>
+</html>
+`))
+
+// ImportConversations 将会话导入到Agent下，支持本系统导出的JSON、ChatGPT导出的conversations.json，以及包含它们的zip。
+// 导入的会话和消息使用新的ID
+func (s *conversationService) ImportConversations(ctx context.Context, userID uint, agentID, filename string, data []byte) (*model.ImportConvResult, error) {
+	if _, err := s.agentSvc.GetAgent(ctx, userID, agentID); err != nil {
+		return nil, err
+	}
+	exps, skipped, err := parseImportFile(filename, data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.ImportConvResult{ConvIDs: []string{}, Skipped: skipped}
+	for _, exp := range exps {
+		conv, msgs := newImportedConversation(userID, agentID, exp)
+		if len(msgs) == 0 {
+			result.Skipped++
+			continue
+		}
+		if err := s.historySvc.ImportConversation(ctx, conv, msgs); err != nil {
+			return result, err
+		}
+		result.ConvIDs = append(result.ConvIDs, conv.ConvID)
+	}
+	return result, nil
+}
+
+// newImportedConversation 为导入的会话和消息生成新ID，保持消息树结构。除第一个根消息外，其余根消息标记为变体，
+// 避免被当作早期没有父消息的记录串成一条链
+func newImportedConversation(userID uint, agentID string, exp *model.ConversationExport) (*model.Conversation, []*model.Message) {
+	now := time.Now().Unix()
+	conv := &model.Conversation{
+		ConvID:    uuid.NewString(),
+		UserID:    userID,
+		AgentID:   agentID,
+		Title:     exp.Title,
+		CreatedAt: exp.CreatedAt,
+		UpdatedAt: exp.UpdatedAt,
+	}
+	if conv.CreatedAt <= 0 {
+		conv.CreatedAt = now
+	}
+	if conv.UpdatedAt <= 0 {
+		conv.UpdatedAt = conv.CreatedAt
+	}
+
+	ids := make(map[string]string, len(exp.Messages))
+	msgs := make([]*model.Message, 0, len(exp.Messages))
+	hasRoot := false
+	for _, m := range exp.Messages {
+		switch schema.RoleType(m.Role) {
+		case schema.User, schema.Assistant, schema.System:
+		default:
+			continue
+		}
+		msg := &model.Message{
+			MsgID:            uuid.NewString(),
+			UserID:           userID,
+			ConvID:           conv.ConvID,
+			ParentID:         ids[m.ParentID],
+			Role:             m.Role,
+			Content:          m.Content,
+			ReasoningContent: m.ReasoningContent,
+			CreatedAt:        m.CreatedAt,
+			TokenCount:       m.TokenCount,
+			IsVariant:        m.IsVariant,
+			IsContextEdge:    m.IsContextEdge,
+		}
+		if msg.ParentID == "" {
+			msg.IsVariant = hasRoot
+			hasRoot = true
+		}
+		if msg.CreatedAt <= 0 {
+			msg.CreatedAt = conv.CreatedAt
+		}
+		if msg.TokenCount == 0 {
+			msg.TokenCount = messageTokens(&schema.Message{Role: schema.RoleType(m.Role), Content: m.Content})
+		}
+		if !m.Metadata.Empty() {
+			msg.Metadata, _ = json.Marshal(m.Metadata)
+		}
+		ids[m.MsgID] = msg.MsgID
+		msgs = append(msgs, msg)
+	}
+	conv.CurrentMsgID = ids[exp.CurrentMsgID]
+	return conv, msgs
+}
+
+// parseImportFile 解析导入文件，zip中的每个JSON文件分别解析。返回识别出的会话和跳过的条目数
+func parseImportFile(filename string, data []byte) ([]*model.ConversationExport, int, error) {
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return parseImportJSON(data)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read zip %s: %w", filename, err)
+	}
+	var exps []*model.ConversationExport
+	skipped := 0
+	// remaining 全部条目解压后剩余可用的字节数，不信任条目头中记录的大小
+	remaining := int64(MaxImportUnzippedSize)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !strings.EqualFold(path.Ext(f.Name), ".json") {
+			continue
+		}
+		entry, err := readZipFile(f, min(MaxImportSize, remaining))
+		if err != nil {
+			return nil, 0, err
+		}
+		remaining -= int64(len(entry))
+		found, n, err := parseImportJSON(entry)
+		if errors.Is(err, errUnknownImportFormat) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		exps = append(exps, found...)
+		skipped += n
+	}
+	if len(exps) == 0 && skipped == 0 {
+		return nil, 0, errUnknownImportFormat
+	}
+	return exps, skipped, nil
+}
+
+// readZipFile 读取zip中的一个文件，解压后超过limit字节时返回错误
+func readZipFile(f *zip.File, limit int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(io.LimitReader(rc, limit+1)); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	if int64(buf.Len()) > limit {
+		return nil, fmt.Errorf("%s is too large: each file is limited to %d MB and the archive to %d MB uncompressed", f.Name, MaxImportSize>>20, MaxImportUnzippedSize>>20)
+	}
+	return buf.Bytes(), nil
+}
+
+// parseImportJSON 解析单个会话或会话数组，识别本系统的导出格式和ChatGPT格式
+func parseImportJSON(data []byte) ([]*model.ConversationExport, int, error) {
+	data = bytes.TrimSpace(data)
+	var items []json.RawMessage
+	switch {
+	case bytes.HasPrefix(data, []byte("[")):
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, 0, fmt.Errorf("invalid json: %w", err)
+		}
+	case bytes.HasPrefix(data, []byte("{")):
+		items = []json.RawMessage{data}
+	default:
+		return nil, 0, errUnknownImportFormat
+	}
+
+	var exps []*model.ConversationExport
+	skipped := 0
+	for _, item := range items {
+		var probe struct {
+			Format  string          `json:"format"`
+			Mapping json.RawMessage `json:"mapping"`
+		}
+		if err := json.Unmarshal(item, &probe); err != nil {
+			skipped++
+			continue
+		}
+		switch {
+		case probe.Format == model.ExportFormat:
+			var exp model.ConversationExport
+			if err := json.Unmarshal(item, &exp); err != nil {
+				return nil, 0, fmt.Errorf("invalid conversation: %w", err)
+			}
+			exps = append(exps, &exp)
+		case len(probe.Mapping) > 0:
+			var conv chatGPTConversation
+			if err := json.Unmarshal(item, &conv); err != nil {
+				return nil, 0, fmt.Errorf("invalid chatgpt conversation: %w", err)
+			}
+			exps = append(exps, conv.toExport())
+		default:
+			skipped++
+		}
+	}
+	if len(exps) == 0 {
+		return nil, 0, errUnknownImportFormat
+	}
+	return exps, skipped, nil
+}
+
+// chatGPTConversation ChatGPT数据导出（conversations.json）中的一个会话，消息以树的形式保存在mapping中
+type chatGPTConversation struct {
+	Title       string                  `json:"title"`
+	CreateTime  float64                 `json:"create_time"`
+	UpdateTime  float64                 `json:"update_time"`
+	CurrentNode string                  `json:"current_node"`
+	Mapping     map[string]*chatGPTNode `json:"mapping"`
+}
+
+type chatGPTNode struct {
+	ID       string          `json:"id"`
+	Parent   string          `json:"parent"`
+	Children []string        `json:"children"`
+	Message  *chatGPTMessage `json:"message"`
+}
+
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime float64 `json:"create_time"`
+	Content    struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+	} `json:"content"`
+	Metadata struct {
+		IsVisuallyHidden bool `json:"is_visually_hidden_from_conversation"`
+	} `json:"metadata"`
+}
+
+// text 消息的文本内容。只保留用户和助手可见的文本，系统提示、工具调用和图片等跳过
+func (m *chatGPTMessage) text() string {
+	if m == nil || m.Metadata.IsVisuallyHidden {
+		return ""
+	}
+	if m.Author.Role != string(schema.User) && m.Author.Role != string(schema.Assistant) {
+		return ""
+	}
+	if m.Content.ContentType != "text" && m.Content.ContentType != "multimodal_text" {
+		return ""
+	}
+	var parts []string
+	for _, p := range m.Content.Parts {
+		var s string
+		if json.Unmarshal(p, &s) == nil && strings.TrimSpace(s) != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// toExport 转换为本系统的导出格式。跳过的节点由其最近的保留祖先代替作为父消息
+func (c *chatGPTConversation) toExport() *model.ConversationExport {
+	exp := &model.ConversationExport{
+		Format:    model.ExportFormat,
+		Version:   model.ExportVersion,
+		Title:     c.Title,
+		CreatedAt: int64(c.CreateTime),
+		UpdatedAt: int64(c.UpdateTime),
+		Messages:  []*model.MessageExport{},
+	}
+
+	// kept 节点自身或最近的保留祖先，hasChild 已有保留子消息的消息，之后的兄弟消息为变体
+	kept := make(map[string]string, len(c.Mapping))
+	hasChild := make(map[string]bool)
+	var walk func(id, parentID string, depth int)
+	walk = func(id, parentID string, depth int) {
+		node, ok := c.Mapping[id]
+		if !ok || depth > len(c.Mapping) {
+			return
+		}
+		if text := node.Message.text(); text != "" {
+			exp.Messages = append(exp.Messages, &model.MessageExport{
+				MsgID:     id,
+				ParentID:  parentID,
+				Role:      node.Message.Author.Role,
+				Content:   text,
+				CreatedAt: int64(node.Message.CreateTime),
+				IsVariant: hasChild[parentID],
+			})
+			hasChild[parentID] = true
+			parentID = id
+		}
+		kept[id] = parentID
+		for _, child := range node.Children {
+			walk(child, parentID, depth+1)
+		}
+	}
+	// 根节点按ID排序，保证结果稳定
+	var roots []string
+	for id, node := range c.Mapping {
+		if _, ok := c.Mapping[node.Parent]; !ok {
+			roots = append(roots, id)
+		}
+	}
+	slices.Sort(roots)
+	for _, id := range roots {
+		walk(id, "", 0)
+	}
+	exp.CurrentMsgID = kept[c.CurrentNode]
+	return exp
+}
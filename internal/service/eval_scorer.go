@@ -0,0 +1,361 @@
+package service
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+
+	einoEmbedding "github.com/cloudwego/eino/components/embedding"
+	eino_model "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// defaultEvalRubric 未指定评分标准时评审模型使用的标准
+const defaultEvalRubric = "回答是否准确、完整地解决了问题；有参考答案时，事实是否与参考答案一致；表达是否清晰简洁。"
+
+const evalJudgePrompt = `你是一名严格、公正的评审，请根据评分标准为待评回答打分。
+
+评分标准：
+%s
+
+问题：
+%s
+
+参考答案（可能为空）：
+%s
+
+待评回答：
+%s
+
+只输出JSON，不要输出其他内容：{"score": 0到10的整数, "reason": "一句话理由"}`
+
+// evalScorer 按评测选择的评分方式为输出打分，评审模型和Embedding模型在评测开始时创建
+type evalScorer struct {
+	scorers  []string
+	rubric   string
+	judge    eino_model.BaseChatModel
+	embedder einoEmbedding.Embedder
+}
+
+func (sc *evalScorer) has(scorer string) bool {
+	for _, s := range sc.scorers {
+		if s == scorer {
+			return true
+		}
+	}
+	return false
+}
+
+// scoreCase 为一条用例两个配置的输出打分，出错的一方不打分。
+// 单项评分失败只跳过该项，评审失败的原因记录在评审理由中
+func (sc *evalScorer) scoreCase(ctx context.Context, c *model.EvalCase, res *model.EvalResult) {
+	type side struct {
+		output string
+		scores *map[string]float64
+		judge  *string
+	}
+	var sides []side
+	if res.ErrorA == "" {
+		sides = append(sides, side{res.OutputA, &res.ScoresA, &res.JudgeA})
+	}
+	if res.ErrorB == "" {
+		sides = append(sides, side{res.OutputB, &res.ScoresB, &res.JudgeB})
+	}
+	for _, s := range sides {
+		*s.scores = make(map[string]float64)
+		if sc.has(model.EvalScorerExact) && c.Reference != "" {
+			(*s.scores)[model.EvalScorerExact] = exactScore(s.output, c.Reference)
+		}
+		if sc.has(model.EvalScorerRegex) && c.Pattern != "" {
+			// 正则在创建评测时已校验
+			if re, err := regexp.Compile(c.Pattern); err == nil {
+				(*s.scores)[model.EvalScorerRegex] = boolScore(re.MatchString(s.output))
+			}
+		}
+		if sc.has(model.EvalScorerJudge) {
+			score, reason, err := sc.judgeOutput(ctx, c, s.output)
+			if err != nil {
+				*s.judge = "评审失败: " + err.Error()
+			} else {
+				(*s.scores)[model.EvalScorerJudge] = score
+				*s.judge = reason
+			}
+		}
+	}
+
+	if sc.has(model.EvalScorerEmbedding) && c.Reference != "" && len(sides) > 0 {
+		texts := []string{c.Reference}
+		for _, s := range sides {
+			texts = append(texts, s.output)
+		}
+		vectors, err := sc.embedder.EmbedStrings(ctx, texts)
+		if err == nil && len(vectors) == len(texts) {
+			for i, s := range sides {
+				(*s.scores)[model.EvalScorerEmbedding] = cosineSimilarity(vectors[0], vectors[i+1])
+			}
+		}
+	}
+}
+
+// judgeOutput 由评审模型按评分标准打分，返回归一化到0-1的得分和理由
+func (sc *evalScorer) judgeOutput(ctx context.Context, c *model.EvalCase, output string) (float64, string, error) {
+	prompt := fmt.Sprintf(evalJudgePrompt, sc.rubric, c.Input, c.Reference, output)
+	msg, err := sc.judge.Generate(ctx, []*schema.Message{schema.UserMessage(prompt)})
+	if err != nil {
+		return 0, "", err
+	}
+	return parseJudgement(msg.Content)
+}
+
+// parseJudgement 解析评审模型输出的JSON，兼容包裹在代码块中的JSON
+func parseJudgement(content string) (float64, string, error) {
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return 0, "", errors.New("judge returned no json")
+	}
+	var j struct {
+		Score  *float64 `json:"score"`
+		Reason string   `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(content[start:end+1]), &j); err != nil {
+		return 0, "", fmt.Errorf("failed to parse judgement: %w", err)
+	}
+	if j.Score == nil {
+		return 0, "", errors.New("judgement has no score")
+	}
+	return math.Max(0, math.Min(10, *j.Score)) / 10, j.Reason, nil
+}
+
+// exactScore 比较时忽略首尾空白和连续空白的差异
+func exactScore(output, reference string) float64 {
+	return boolScore(strings.Join(strings.Fields(output), " ") == strings.Join(strings.Fields(reference), " "))
+}
+
+func boolScore(ok bool) float64 {
+	if ok {
+		return 1
+	}
+	return 0
+}
+
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// evalScoreEpsilon 得分差距小于该值视为平局
+const evalScoreEpsilon = 1e-9
+
+// evalWinner 比较两个配置在共同评分项上的平均得分，出错的一方判负，都出错或没有共同评分项时为平局
+func evalWinner(res *model.EvalResult) string {
+	switch {
+	case res.ErrorA != "" && res.ErrorB != "":
+		return model.EvalWinnerTie
+	case res.ErrorA != "":
+		return model.EvalWinnerB
+	case res.ErrorB != "":
+		return model.EvalWinnerA
+	}
+	var sumA, sumB float64
+	n := 0
+	for k, a := range res.ScoresA {
+		if b, ok := res.ScoresB[k]; ok {
+			sumA += a
+			sumB += b
+			n++
+		}
+	}
+	if n == 0 {
+		return model.EvalWinnerTie
+	}
+	return compareScores(sumA/float64(n), sumB/float64(n))
+}
+
+func compareScores(a, b float64) string {
+	switch {
+	case a-b > evalScoreEpsilon:
+		return model.EvalWinnerA
+	case b-a > evalScoreEpsilon:
+		return model.EvalWinnerB
+	}
+	return model.EvalWinnerTie
+}
+
+// summarizeEval 汇总各用例的胜负和各评分项的平均分
+func summarizeEval(results []*model.EvalResult, scorers []string) *model.EvalSummary {
+	summary := &model.EvalSummary{Scorers: make(map[string]*model.EvalScoreStats)}
+	for _, s := range scorers {
+		summary.Scorers[s] = &model.EvalScoreStats{}
+	}
+	total := 0
+	for _, res := range results {
+		if res == nil {
+			continue
+		}
+		total++
+		switch res.Winner {
+		case model.EvalWinnerA:
+			summary.WinsA++
+		case model.EvalWinnerB:
+			summary.WinsB++
+		default:
+			summary.Ties++
+		}
+		if res.ErrorA != "" {
+			summary.ErrorsA++
+		}
+		if res.ErrorB != "" {
+			summary.ErrorsB++
+		}
+		for name, stats := range summary.Scorers {
+			a, okA := res.ScoresA[name]
+			b, okB := res.ScoresB[name]
+			if !okA || !okB {
+				continue
+			}
+			stats.Cases++
+			stats.MeanA += a
+			stats.MeanB += b
+			switch compareScores(a, b) {
+			case model.EvalWinnerA:
+				stats.WinsA++
+			case model.EvalWinnerB:
+				stats.WinsB++
+			default:
+				stats.Ties++
+			}
+		}
+	}
+	for _, stats := range summary.Scorers {
+		if stats.Cases > 0 {
+			stats.MeanA /= float64(stats.Cases)
+			stats.MeanB /= float64(stats.Cases)
+		}
+	}
+	if total > 0 {
+		summary.WinRateA = float64(summary.WinsA) / float64(total)
+		summary.WinRateB = float64(summary.WinsB) / float64(total)
+	}
+	return summary
+}
+
+// maxDiffTokens 去掉相同的开头和结尾后仍超过该长度的输出不逐词对比，中间部分整体显示为删除和插入
+const maxDiffTokens = 2000
+
+// diffText 逐词对比两个输出。英文等按单词、中日韩文字按字切分，标点和空白单独成段
+func diffText(a, b string) []*model.TextDiff {
+	ta, tb := diffTokens(a), diffTokens(b)
+	prefix := 0
+	for prefix < len(ta) && prefix < len(tb) && ta[prefix] == tb[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(ta)-prefix && suffix < len(tb)-prefix && ta[len(ta)-1-suffix] == tb[len(tb)-1-suffix] {
+		suffix++
+	}
+
+	var diff []*model.TextDiff
+	diff = appendDiff(diff, "equal", strings.Join(ta[:prefix], ""))
+	diff = append(diff, diffMiddle(ta[prefix:len(ta)-suffix], tb[prefix:len(tb)-suffix])...)
+	return appendDiff(diff, "equal", strings.Join(ta[len(ta)-suffix:], ""))
+}
+
+func diffMiddle(ta, tb []string) []*model.TextDiff {
+	var diff []*model.TextDiff
+	if len(ta) > maxDiffTokens || len(tb) > maxDiffTokens {
+		diff = appendDiff(diff, "delete", strings.Join(ta, ""))
+		return appendDiff(diff, "insert", strings.Join(tb, ""))
+	}
+
+	// lcs[i][j] 为ta[i:]和tb[j:]的最长公共子序列长度
+	lcs := make([][]int32, len(ta)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(tb)+1)
+	}
+	for i := len(ta) - 1; i >= 0; i-- {
+		for j := len(tb) - 1; j >= 0; j-- {
+			if ta[i] == tb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(ta) && j < len(tb) {
+		switch {
+		case ta[i] == tb[j]:
+			diff = appendDiff(diff, "equal", ta[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = appendDiff(diff, "delete", ta[i])
+			i++
+		default:
+			diff = appendDiff(diff, "insert", tb[j])
+			j++
+		}
+	}
+	for ; i < len(ta); i++ {
+		diff = appendDiff(diff, "delete", ta[i])
+	}
+	for ; j < len(tb); j++ {
+		diff = appendDiff(diff, "insert", tb[j])
+	}
+	return diff
+}
+
+// appendDiff 与上一段操作相同时合并
+func appendDiff(diff []*model.TextDiff, op, text string) []*model.TextDiff {
+	if text == "" {
+		return diff
+	}
+	if n := len(diff); n > 0 && diff[n-1].Op == op {
+		diff[n-1].Text += text
+		return diff
+	}
+	return append(diff, &model.TextDiff{Op: op, Text: text})
+}
+
+func diffTokens(s string) []string {
+	var (
+		tokens []string
+		word   []rune
+	)
+	flush := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range s {
+		switch {
+		case unicode.IsDigit(r), r == '_',
+			unicode.IsLetter(r) && !unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			word = append(word, r)
+		default:
+			flush()
+			tokens = append(tokens, string(r))
+		}
+	}
+	flush()
+	return tokens
+}
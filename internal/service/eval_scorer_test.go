@@ -0,0 +1,361 @@
+package service
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/cloudwego/eino/components/embedding"
+	eino_model "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// fakeChatModel 确定性的模型，由reply根据最后一条消息生成回复
+type fakeChatModel struct {
+	reply func(prompt string) (string, error)
+}
+
+func (m *fakeChatModel) Generate(_ context.Context, in []*schema.Message, _ ...eino_model.Option) (*schema.Message, error) {
+	content, err := m.reply(in[len(in)-1].Content)
+	if err != nil {
+		return nil, err
+	}
+	return schema.AssistantMessage(content, nil), nil
+}
+
+func (m *fakeChatModel) Stream(ctx context.Context, in []*schema.Message, opts ...eino_model.Option) (*schema.StreamReader[*schema.Message], error) {
+	msg, err := m.Generate(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{msg}), nil
+}
+
+func (m *fakeChatModel) WithTools([]*schema.ToolInfo) (eino_model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+// judgedOutput 从评审提示词中取出待评回答
+func judgedOutput(prompt string) string {
+	_, rest, _ := strings.Cut(prompt, "待评回答：\n")
+	output, _, _ := strings.Cut(rest, "\n\n只输出JSON")
+	return output
+}
+
+// fakeJudge 回答包含"巴黎"得9分，否则得3分；回答为"坏"时返回无法解析的内容
+func fakeJudge() *fakeChatModel {
+	return &fakeChatModel{reply: func(prompt string) (string, error) {
+		output := judgedOutput(prompt)
+		switch {
+		case output == "坏":
+			return "无法评分", nil
+		case strings.Contains(output, "巴黎"):
+			return "```json\n{\"score\": 9, \"reason\": \"正确\"}\n```", nil
+		}
+		return `{"score": 3, "reason": "错误"}`, nil
+	}}
+}
+
+// fakeEmbedder 按字符计数生成向量，相同的字符组成得到相同的方向
+type fakeEmbedder struct {
+	err error
+}
+
+func (e *fakeEmbedder) EmbedStrings(_ context.Context, texts []string, _ ...embedding.Option) ([][]float64, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		v := make([]float64, 4096)
+		for _, r := range text {
+			if !unicode.IsSpace(r) {
+				v[int(r)%len(v)]++
+			}
+		}
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+func TestScoreCase(t *testing.T) {
+	all := []string{model.EvalScorerExact, model.EvalScorerRegex, model.EvalScorerEmbedding, model.EvalScorerJudge}
+	tests := []struct {
+		name     string
+		scorers  []string
+		embedErr error
+		c        *model.EvalCase
+		res      *model.EvalResult
+		wantA    map[string]float64
+		wantB    map[string]float64
+		judgeA   string
+		judgeB   string
+	}{
+		{
+			name:    "all scorers",
+			scorers: all,
+			c:       &model.EvalCase{Input: "法国首都？", Reference: "巴黎", Pattern: "^巴"},
+			res:     &model.EvalResult{OutputA: " 巴黎 ", OutputB: "伦敦"},
+			wantA:   map[string]float64{"exact": 1, "regex": 0, "embedding": 1, "judge": 0.9},
+			wantB:   map[string]float64{"exact": 0, "regex": 0, "embedding": 0, "judge": 0.3},
+			judgeA:  "正确",
+			judgeB:  "错误",
+		},
+		{
+			name:    "regex matches trimmed output only",
+			scorers: []string{model.EvalScorerRegex},
+			c:       &model.EvalCase{Input: "q", Pattern: `^\d+$`},
+			res:     &model.EvalResult{OutputA: "42", OutputB: "42 个"},
+			wantA:   map[string]float64{"regex": 1},
+			wantB:   map[string]float64{"regex": 0},
+		},
+		{
+			name:    "no reference skips exact and embedding",
+			scorers: all,
+			c:       &model.EvalCase{Input: "q"},
+			res:     &model.EvalResult{OutputA: "巴黎", OutputB: "伦敦"},
+			wantA:   map[string]float64{"judge": 0.9},
+			wantB:   map[string]float64{"judge": 0.3},
+			judgeA:  "正确",
+			judgeB:  "错误",
+		},
+		{
+			name:    "failed side is not scored",
+			scorers: all,
+			c:       &model.EvalCase{Input: "q", Reference: "巴黎"},
+			res:     &model.EvalResult{ErrorA: "timeout", OutputB: "巴黎"},
+			wantB:   map[string]float64{"exact": 1, "embedding": 1, "judge": 0.9},
+			judgeB:  "正确",
+		},
+		{
+			name:    "judge failure is recorded",
+			scorers: []string{model.EvalScorerJudge},
+			c:       &model.EvalCase{Input: "q"},
+			res:     &model.EvalResult{OutputA: "坏", OutputB: "巴黎"},
+			wantA:   map[string]float64{},
+			wantB:   map[string]float64{"judge": 0.9},
+			judgeA:  "评审失败: judge returned no json",
+			judgeB:  "正确",
+		},
+		{
+			name:     "embedding failure skips embedding score",
+			scorers:  []string{model.EvalScorerExact, model.EvalScorerEmbedding},
+			embedErr: errors.New("embedding unavailable"),
+			c:        &model.EvalCase{Input: "q", Reference: "巴黎"},
+			res:      &model.EvalResult{OutputA: "巴黎", OutputB: "伦敦"},
+			wantA:    map[string]float64{"exact": 1},
+			wantB:    map[string]float64{"exact": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := &evalScorer{scorers: tt.scorers, rubric: defaultEvalRubric, judge: fakeJudge(), embedder: &fakeEmbedder{err: tt.embedErr}}
+			sc.scoreCase(context.Background(), tt.c, tt.res)
+			if !scoresEqual(tt.res.ScoresA, tt.wantA) {
+				t.Errorf("ScoresA = %v, want %v", tt.res.ScoresA, tt.wantA)
+			}
+			if !scoresEqual(tt.res.ScoresB, tt.wantB) {
+				t.Errorf("ScoresB = %v, want %v", tt.res.ScoresB, tt.wantB)
+			}
+			if tt.res.JudgeA != tt.judgeA || tt.res.JudgeB != tt.judgeB {
+				t.Errorf("judge = %q/%q, want %q/%q", tt.res.JudgeA, tt.res.JudgeB, tt.judgeA, tt.judgeB)
+			}
+		})
+	}
+}
+
+// scoresEqual 比较得分，容忍浮点误差
+func scoresEqual(got, want map[string]float64) bool {
+	if (got == nil) != (want == nil) || len(got) != len(want) {
+		return false
+	}
+	for k, w := range want {
+		g, ok := got[k]
+		if !ok || math.Abs(g-w) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseJudgement(t *testing.T) {
+	tests := []struct {
+		content    string
+		wantScore  float64
+		wantReason string
+		wantErr    bool
+	}{
+		{`{"score": 7, "reason": "ok"}`, 0.7, "ok", false},
+		{"评审结果：\n```json\n{\"score\": 10, \"reason\": \"完美\"}\n```", 1, "完美", false},
+		{`{"score": 15}`, 1, "", false},
+		{`{"score": -2}`, 0, "", false},
+		{`{"score": 0, "reason": "完全错误"}`, 0, "完全错误", false},
+		{`{"reason": "missing score"}`, 0, "", true},
+		{`{"score": "high"}`, 0, "", true},
+		{"no json here", 0, "", true},
+	}
+	for _, tt := range tests {
+		score, reason, err := parseJudgement(tt.content)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseJudgement(%q) err = %v, wantErr %v", tt.content, err, tt.wantErr)
+			continue
+		}
+		if math.Abs(score-tt.wantScore) > 1e-9 || reason != tt.wantReason {
+			t.Errorf("parseJudgement(%q) = %v, %q, want %v, %q", tt.content, score, reason, tt.wantScore, tt.wantReason)
+		}
+	}
+}
+
+func TestEvalWinner(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *model.EvalResult
+		want string
+	}{
+		{"both failed", &model.EvalResult{ErrorA: "x", ErrorB: "y"}, model.EvalWinnerTie},
+		{"a failed", &model.EvalResult{ErrorA: "x", ScoresB: map[string]float64{"exact": 0}}, model.EvalWinnerB},
+		{"b failed", &model.EvalResult{ErrorB: "y", ScoresA: map[string]float64{"exact": 0}}, model.EvalWinnerA},
+		{"no scores", &model.EvalResult{}, model.EvalWinnerTie},
+		{"a higher", &model.EvalResult{ScoresA: map[string]float64{"exact": 1}, ScoresB: map[string]float64{"exact": 0}}, model.EvalWinnerA},
+		{"b higher on average", &model.EvalResult{
+			ScoresA: map[string]float64{"exact": 1, "judge": 0.2},
+			ScoresB: map[string]float64{"exact": 1, "judge": 0.4},
+		}, model.EvalWinnerB},
+		{"equal within epsilon", &model.EvalResult{
+			ScoresA: map[string]float64{"embedding": 0.1 + 0.2},
+			ScoresB: map[string]float64{"embedding": 0.3},
+		}, model.EvalWinnerTie},
+		{"only common scorers count", &model.EvalResult{
+			ScoresA: map[string]float64{"exact": 0, "judge": 1},
+			ScoresB: map[string]float64{"exact": 1},
+		}, model.EvalWinnerB},
+		{"no common scorers", &model.EvalResult{
+			ScoresA: map[string]float64{"judge": 1},
+			ScoresB: map[string]float64{"exact": 0},
+		}, model.EvalWinnerTie},
+	}
+	for _, tt := range tests {
+		if got := evalWinner(tt.res); got != tt.want {
+			t.Errorf("%s: evalWinner = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeEval(t *testing.T) {
+	results := []*model.EvalResult{
+		{Winner: model.EvalWinnerA, ScoresA: map[string]float64{"exact": 1, "judge": 0.8}, ScoresB: map[string]float64{"exact": 0, "judge": 0.6}},
+		{Winner: model.EvalWinnerB, ScoresA: map[string]float64{"exact": 0, "judge": 0.2}, ScoresB: map[string]float64{"exact": 1, "judge": 1}},
+		{Winner: model.EvalWinnerTie, ScoresA: map[string]float64{"exact": 1}, ScoresB: map[string]float64{"exact": 1}},
+		{Winner: model.EvalWinnerB, ErrorA: "timeout", ScoresB: map[string]float64{"exact": 1}},
+		nil, // 未完成的用例
+	}
+	got := summarizeEval(results, []string{model.EvalScorerExact, model.EvalScorerJudge, model.EvalScorerRegex})
+	want := &model.EvalSummary{
+		WinsA:    1,
+		WinsB:    2,
+		Ties:     1,
+		WinRateA: 0.25,
+		WinRateB: 0.5,
+		ErrorsA:  1,
+		Scorers: map[string]*model.EvalScoreStats{
+			"exact": {Cases: 3, MeanA: 2.0 / 3, MeanB: 2.0 / 3, WinsA: 1, WinsB: 1, Ties: 1},
+			"judge": {Cases: 2, MeanA: 0.5, MeanB: 0.8, WinsA: 1, WinsB: 1},
+			"regex": {},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("summarizeEval = %+v, want %+v", got, want)
+		for k, s := range got.Scorers {
+			t.Logf("%s: %+v (want %+v)", k, s, want.Scorers[k])
+		}
+	}
+
+	empty := summarizeEval(nil, []string{model.EvalScorerExact})
+	if empty.WinRateA != 0 || empty.WinRateB != 0 || empty.Scorers["exact"].Cases != 0 {
+		t.Errorf("summarizeEval(nil) = %+v", empty)
+	}
+}
+
+func TestDiffText(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []*model.TextDiff
+	}{
+		{"identical", "same text", "same text", []*model.TextDiff{{Op: "equal", Text: "same text"}}},
+		{"both empty", "", "", nil},
+		{"insert all", "", "new", []*model.TextDiff{{Op: "insert", Text: "new"}}},
+		{"delete all", "old", "", []*model.TextDiff{{Op: "delete", Text: "old"}}},
+		{"replace word", "the quick fox", "the slow fox", []*model.TextDiff{
+			{Op: "equal", Text: "the "},
+			{Op: "delete", Text: "quick"},
+			{Op: "insert", Text: "slow"},
+			{Op: "equal", Text: " fox"},
+		}},
+		{"words are not split", "version1 ok", "version2 ok", []*model.TextDiff{
+			{Op: "delete", Text: "version1"},
+			{Op: "insert", Text: "version2"},
+			{Op: "equal", Text: " ok"},
+		}},
+		{"cjk by character", "北京是首都", "巴黎是首都", []*model.TextDiff{
+			{Op: "delete", Text: "北京"},
+			{Op: "insert", Text: "巴黎"},
+			{Op: "equal", Text: "是首都"},
+		}},
+		{"insert in middle", "a c", "a b c", []*model.TextDiff{
+			{Op: "equal", Text: "a "},
+			{Op: "insert", Text: "b "},
+			{Op: "equal", Text: "c"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffText(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffText(%q, %q) = %s, want %s", tt.a, tt.b, diffString(got), diffString(tt.want))
+			}
+			// 去掉insert得到a，去掉delete得到b
+			var a, b strings.Builder
+			for _, d := range got {
+				if d.Op != "insert" {
+					a.WriteString(d.Text)
+				}
+				if d.Op != "delete" {
+					b.WriteString(d.Text)
+				}
+			}
+			if a.String() != tt.a || b.String() != tt.b {
+				t.Errorf("diff does not reconstruct inputs: %q, %q", a.String(), b.String())
+			}
+		})
+	}
+}
+
+func TestDiffTextLongOutputs(t *testing.T) {
+	a := "start " + strings.Repeat("x ", maxDiffTokens) + "end"
+	b := "start " + strings.Repeat("y ", maxDiffTokens) + "end"
+	got := diffText(a, b)
+	// 相同的开头和结尾仍单独对比
+	want := []*model.TextDiff{
+		{Op: "equal", Text: "start "},
+		{Op: "delete", Text: strings.TrimSpace(strings.Repeat("x ", maxDiffTokens))},
+		{Op: "insert", Text: strings.TrimSpace(strings.Repeat("y ", maxDiffTokens))},
+		{Op: "equal", Text: " end"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("long diff = %d segments, want whole middle replaced", len(got))
+	}
+}
+
+func diffString(diff []*model.TextDiff) string {
+	var sb strings.Builder
+	for _, d := range diff {
+		sb.WriteString("[" + d.Op + ":" + d.Text + "]")
+	}
+	return sb.String()
+}
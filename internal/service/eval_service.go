@@ -0,0 +1,278 @@
+package service
+
+import (
+	"ai-cloud/internal/component/embedding"
+	llmfactory "ai-cloud/internal/component/llm"
+	"ai-cloud/internal/dao"
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	einoEmbedding "github.com/cloudwego/eino/components/embedding"
+	eino_model "github.com/cloudwego/eino/components/model"
+	"github.com/google/uuid"
+)
+
+const (
+	// evalRunTimeout 一次评测的最长时间
+	evalRunTimeout = 2 * time.Hour
+	// defaultEvalConcurrency 默认同时运行的用例数
+	defaultEvalConcurrency = 4
+)
+
+type EvalService interface {
+	// CreateEvalRun 创建评测并在后台运行，返回的记录可通过GetEvalRun查看进度
+	CreateEvalRun(ctx context.Context, userID uint, req *model.CreateEvalRunRequest) (*model.EvalRun, error)
+	GetEvalRun(ctx context.Context, userID uint, id string) (*model.EvalRun, error)
+	PageEvalRuns(ctx context.Context, userID uint, page, size int) ([]*model.EvalRun, int64, error)
+	// PageEvalResults 分页获取各用例的结果，附带两个输出的逐词对比
+	PageEvalResults(ctx context.Context, userID uint, runID string, page, size int) ([]*model.EvalResult, int64, error)
+	DeleteEvalRun(ctx context.Context, userID uint, id string) error
+}
+
+type evalService struct {
+	dao      dao.EvalDao
+	agentSvc AgentService
+	modelSvc ModelService
+	// newChatModel/newEmbedder 创建评审模型和Embedding客户端
+	newChatModel func(ctx context.Context, cfg *model.Model, genCfg *model.LLMConfig) (eino_model.ToolCallingChatModel, error)
+	newEmbedder  func(ctx context.Context, cfg *model.Model) (einoEmbedding.Embedder, error)
+}
+
+func NewEvalService(dao dao.EvalDao, agentSvc AgentService, modelSvc ModelService) EvalService {
+	return &evalService{
+		dao:          dao,
+		agentSvc:     agentSvc,
+		modelSvc:     modelSvc,
+		newChatModel: llmfactory.GetLLMClientWithConfig,
+		newEmbedder: func(ctx context.Context, cfg *model.Model) (einoEmbedding.Embedder, error) {
+			return embedding.NewEmbeddingService(ctx, cfg, embedding.WithTimeout(30*time.Second))
+		},
+	}
+}
+
+// CreateEvalRun 校验两个配置、评分方式和用例后在后台运行评测。
+// 每条用例依次在两个配置上运行，同时运行的用例数不超过Concurrency
+func (s *evalService) CreateEvalRun(ctx context.Context, userID uint, req *model.CreateEvalRunRequest) (*model.EvalRun, error) {
+	for _, v := range []*model.EvalVariant{req.VariantA, req.VariantB} {
+		if err := s.checkVariant(ctx, userID, v); err != nil {
+			return nil, err
+		}
+	}
+
+	scorers := uniqueStrings(req.Scorers)
+	if len(scorers) == 0 {
+		scorers = []string{model.EvalScorerExact, model.EvalScorerRegex}
+	}
+	run := &model.EvalRun{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		Name:        req.Name,
+		VariantA:    req.VariantA,
+		VariantB:    req.VariantB,
+		Scorers:     scorers,
+		Rubric:      req.Rubric,
+		Concurrency: req.Concurrency,
+		Status:      model.EvalRunRunning,
+		Total:       len(req.Cases),
+	}
+	if run.Concurrency <= 0 {
+		run.Concurrency = defaultEvalConcurrency
+	}
+	if run.Rubric == "" {
+		run.Rubric = defaultEvalRubric
+	}
+	if run.Name == "" {
+		run.Name = "评测 " + time.Now().Format("2006-01-02 15:04")
+	}
+
+	sc, err := s.newScorer(ctx, userID, run, req)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range req.Cases {
+		if c.Pattern == "" {
+			continue
+		}
+		if _, err := regexp.Compile(c.Pattern); err != nil {
+			return nil, fmt.Errorf("case %d: invalid pattern: %w", i+1, err)
+		}
+	}
+
+	if err := s.dao.CreateRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("failed to create eval run: %w", err)
+	}
+	// 后台运行会修改run，返回副本
+	created := *run
+	go s.execute(run, req.Cases, sc)
+	return &created, nil
+}
+
+// checkVariant 检查Agent和指定的版本存在
+func (s *evalService) checkVariant(ctx context.Context, userID uint, v *model.EvalVariant) error {
+	if _, err := s.agentSvc.GetAgent(ctx, userID, v.AgentID); err != nil {
+		return err
+	}
+	if v.Version > 0 {
+		if _, err := s.agentSvc.GetAgentVersion(ctx, userID, v.AgentID, v.Version); err != nil {
+			return err
+		}
+	} else if v.Version < model.AgentVersionDraft {
+		return fmt.Errorf("invalid agent version: %d", v.Version)
+	}
+	return nil
+}
+
+// newScorer 创建评测选择的评分方式需要的评审模型和Embedding客户端。评审模型以温度0运行
+func (s *evalService) newScorer(ctx context.Context, userID uint, run *model.EvalRun, req *model.CreateEvalRunRequest) (*evalScorer, error) {
+	sc := &evalScorer{scorers: run.Scorers, rubric: run.Rubric}
+	if sc.has(model.EvalScorerJudge) {
+		if req.JudgeModelID == "" {
+			return nil, errors.New("judge_model_id is required for the judge scorer")
+		}
+		cfg, err := s.modelSvc.GetModel(ctx, userID, req.JudgeModelID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get judge model: %w", err)
+		}
+		temperature := 0.0
+		sc.judge, err = s.newChatModel(ctx, cfg, &model.LLMConfig{ModelID: cfg.ID, Temperature: &temperature})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create judge model: %w", err)
+		}
+		run.JudgeModelID = req.JudgeModelID
+	}
+	if sc.has(model.EvalScorerEmbedding) {
+		if req.EmbedModelID == "" {
+			return nil, errors.New("embed_model_id is required for the embedding scorer")
+		}
+		cfg, err := s.modelSvc.GetModel(ctx, userID, req.EmbedModelID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get embedding model: %w", err)
+		}
+		sc.embedder, err = s.newEmbedder(ctx, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create embedding model: %w", err)
+		}
+		run.EmbedModelID = req.EmbedModelID
+	}
+	return sc, nil
+}
+
+// execute 运行全部用例并保存汇总。单条用例的运行错误记录在结果中，不影响其他用例
+func (s *evalService) execute(run *model.EvalRun, cases []*model.EvalCase, sc *evalScorer) {
+	ctx, cancel := context.WithTimeout(context.Background(), evalRunTimeout)
+	defer cancel()
+	// 保存结果不受评测超时影响
+	saveCtx := context.Background()
+
+	results := make([]*model.EvalResult, len(cases))
+	sem := make(chan struct{}, run.Concurrency)
+	var wg sync.WaitGroup
+	for i, c := range cases {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, c *model.EvalCase) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res := s.evalCase(ctx, run, sc, i, c)
+			if err := s.dao.SaveResult(saveCtx, res); err != nil {
+				log.Printf("[Eval %s] 保存用例%d结果失败: %v", run.ID, i, err)
+			}
+			results[i] = res
+		}(i, c)
+	}
+	wg.Wait()
+
+	run.Status = model.EvalRunCompleted
+	if err := ctx.Err(); err != nil {
+		run.Status = model.EvalRunFailed
+		run.Error = "eval run timed out"
+	}
+	run.Summary = summarizeEval(results, run.Scorers)
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	if err := s.dao.FinishRun(saveCtx, run); err != nil {
+		log.Printf("[Eval %s] 保存评测结果失败: %v", run.ID, err)
+	}
+}
+
+// evalCase 依次在两个配置上运行一条用例并评分
+func (s *evalService) evalCase(ctx context.Context, run *model.EvalRun, sc *evalScorer, i int, c *model.EvalCase) *model.EvalResult {
+	res := &model.EvalResult{
+		RunID:     run.ID,
+		CaseIndex: i,
+		Input:     c.Input,
+		Reference: c.Reference,
+		Pattern:   c.Pattern,
+	}
+	var err error
+	if res.OutputA, err = s.runVariant(ctx, run.UserID, run.VariantA, c.Input); err != nil {
+		res.ErrorA = err.Error()
+	}
+	if res.OutputB, err = s.runVariant(ctx, run.UserID, run.VariantB, c.Input); err != nil {
+		res.ErrorB = err.Error()
+	}
+	sc.scoreCase(ctx, c, res)
+	res.Winner = evalWinner(res)
+	return res
+}
+
+func (s *evalService) runVariant(ctx context.Context, userID uint, v *model.EvalVariant, input string) (string, error) {
+	return s.agentSvc.ExecuteAgent(ctx, userID, v.AgentID, model.UserMessage{Query: input},
+		WithAgentVersion(v.Version),
+		WithGeneration(v.Temperature, v.TopP, v.MaxTokens),
+	)
+}
+
+func (s *evalService) GetEvalRun(ctx context.Context, userID uint, id string) (*model.EvalRun, error) {
+	s.failStaleRuns(ctx)
+	return s.dao.GetRun(ctx, userID, id)
+}
+
+func (s *evalService) PageEvalRuns(ctx context.Context, userID uint, page, size int) ([]*model.EvalRun, int64, error) {
+	s.failStaleRuns(ctx)
+	return s.dao.PageRuns(ctx, userID, page, size)
+}
+
+// failStaleRuns 运行所在实例退出后评测不会结束，超时后标记为失败
+func (s *evalService) failStaleRuns(ctx context.Context) {
+	if err := s.dao.FailStaleRuns(ctx, time.Now().Add(-evalRunTimeout-5*time.Minute), "eval run interrupted"); err != nil {
+		log.Printf("[Eval] 清理中断的评测失败: %v", err)
+	}
+}
+
+func (s *evalService) PageEvalResults(ctx context.Context, userID uint, runID string, page, size int) ([]*model.EvalResult, int64, error) {
+	if _, err := s.dao.GetRun(ctx, userID, runID); err != nil {
+		return nil, 0, err
+	}
+	results, total, err := s.dao.PageResults(ctx, runID, page, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, res := range results {
+		res.Diff = diffText(res.OutputA, res.OutputB)
+	}
+	return results, total, nil
+}
+
+func (s *evalService) DeleteEvalRun(ctx context.Context, userID uint, id string) error {
+	return s.dao.DeleteRun(ctx, userID, id)
+}
+
+func uniqueStrings(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	var out []string
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
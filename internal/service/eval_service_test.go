@@ -0,0 +1,286 @@
+package service
+
+import (
+	"ai-cloud/internal/dao"
+	"ai-cloud/internal/model"
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	einoEmbedding "github.com/cloudwego/eino/components/embedding"
+	eino_model "github.com/cloudwego/eino/components/model"
+)
+
+// fakeEvalDao 内存中的评测记录，FinishRun时关闭finished
+type fakeEvalDao struct {
+	dao.EvalDao
+	mu       sync.Mutex
+	runs     map[string]*model.EvalRun
+	results  []*model.EvalResult
+	finished chan struct{}
+}
+
+func newFakeEvalDao() *fakeEvalDao {
+	return &fakeEvalDao{runs: make(map[string]*model.EvalRun), finished: make(chan struct{})}
+}
+
+func (d *fakeEvalDao) CreateRun(_ context.Context, run *model.EvalRun) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	copied := *run
+	d.runs[run.ID] = &copied
+	return nil
+}
+
+func (d *fakeEvalDao) GetRun(_ context.Context, userID uint, id string) (*model.EvalRun, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	run, ok := d.runs[id]
+	if !ok || run.UserID != userID {
+		return nil, errors.New("eval run not found")
+	}
+	copied := *run
+	return &copied, nil
+}
+
+func (d *fakeEvalDao) SaveResult(_ context.Context, res *model.EvalResult) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.results = append(d.results, res)
+	d.runs[res.RunID].Completed++
+	return nil
+}
+
+func (d *fakeEvalDao) FinishRun(_ context.Context, run *model.EvalRun) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stored := d.runs[run.ID]
+	stored.Status, stored.Summary, stored.Error, stored.FinishedAt = run.Status, run.Summary, run.Error, run.FinishedAt
+	close(d.finished)
+	return nil
+}
+
+func (d *fakeEvalDao) PageResults(_ context.Context, runID string, page, size int) ([]*model.EvalResult, int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var results []*model.EvalResult
+	for _, res := range d.results {
+		if res.RunID == runID {
+			copied := *res
+			results = append(results, &copied)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].CaseIndex < results[j].CaseIndex })
+	return results, int64(len(results)), nil
+}
+
+func (d *fakeEvalDao) FailStaleRuns(context.Context, time.Time, string) error {
+	return nil
+}
+
+// fakeEvalAgents 两个确定性的Agent：good按答案表回答，bad总是答错，并对部分问题出错
+type fakeEvalAgents struct {
+	AgentService
+	mu   sync.Mutex
+	opts map[string]ExecuteOptions
+}
+
+var evalAnswers = map[string]map[string]string{
+	"good": {"法国首都？": "巴黎", "1+1=": "2", "日本首都？": "东京"},
+	"bad":  {"法国首都？": "伦敦", "1+1=": "2"},
+}
+
+func (a *fakeEvalAgents) GetAgent(_ context.Context, userID uint, agentID string) (*model.Agent, error) {
+	if _, ok := evalAnswers[agentID]; !ok || userID != 1 {
+		return nil, errors.New("agent not found")
+	}
+	return &model.Agent{ID: agentID, UserID: userID, PublishedVersion: 2}, nil
+}
+
+func (a *fakeEvalAgents) GetAgentVersion(_ context.Context, _ uint, agentID string, version int) (*model.AgentVersion, error) {
+	if version > 2 {
+		return nil, errors.New("agent version not found")
+	}
+	return &model.AgentVersion{AgentID: agentID, Version: version}, nil
+}
+
+func (a *fakeEvalAgents) ExecuteAgent(_ context.Context, _ uint, agentID string, msg model.UserMessage, opts ...ExecuteOption) (string, error) {
+	o := ExecuteOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	a.mu.Lock()
+	a.opts[agentID] = o
+	a.mu.Unlock()
+
+	answer, ok := evalAnswers[agentID][msg.Query]
+	if !ok {
+		return "", errors.New("model timeout")
+	}
+	return answer, nil
+}
+
+func newTestEvalService(t *testing.T) (*evalService, *fakeEvalDao, *fakeEvalAgents, *model.LLMConfig) {
+	t.Helper()
+	evalDao := newFakeEvalDao()
+	agents := &fakeEvalAgents{opts: make(map[string]ExecuteOptions)}
+	models := &fakeModelService{models: map[string]*model.Model{
+		"judge": {ID: "judge", UserID: 1, Type: "llm"},
+		"embed": {ID: "embed", UserID: 1, Type: "embedding"},
+	}}
+	s := NewEvalService(evalDao, agents, models).(*evalService)
+
+	judgeCfg := &model.LLMConfig{}
+	s.newChatModel = func(_ context.Context, cfg *model.Model, genCfg *model.LLMConfig) (eino_model.ToolCallingChatModel, error) {
+		if cfg.ID != "judge" {
+			t.Errorf("judge model = %s", cfg.ID)
+		}
+		*judgeCfg = *genCfg
+		return fakeJudge(), nil
+	}
+	s.newEmbedder = func(_ context.Context, cfg *model.Model) (einoEmbedding.Embedder, error) {
+		if cfg.ID != "embed" {
+			t.Errorf("embedding model = %s", cfg.ID)
+		}
+		return &fakeEmbedder{}, nil
+	}
+	return s, evalDao, agents, judgeCfg
+}
+
+func TestEvalServiceRun(t *testing.T) {
+	s, evalDao, agents, judgeCfg := newTestEvalService(t)
+	ctx := context.Background()
+
+	temperature := 0.9
+	req := &model.CreateEvalRunRequest{
+		Name:     "首都问答",
+		VariantA: &model.EvalVariant{AgentID: "good", Version: 2},
+		VariantB: &model.EvalVariant{AgentID: "bad", Version: model.AgentVersionDraft, Temperature: &temperature, MaxTokens: 256},
+		Cases: []*model.EvalCase{
+			{Input: "法国首都？", Reference: "巴黎", Pattern: "巴"},
+			{Input: "1+1=", Reference: "2", Pattern: `^\d+$`},
+			{Input: "日本首都？", Reference: "东京"},
+		},
+		Scorers:      []string{model.EvalScorerExact, model.EvalScorerRegex, model.EvalScorerEmbedding, model.EvalScorerJudge, model.EvalScorerExact},
+		JudgeModelID: "judge",
+		EmbedModelID: "embed",
+		Concurrency:  2,
+	}
+	created, err := s.CreateEvalRun(ctx, 1, req)
+	if err != nil {
+		t.Fatalf("CreateEvalRun: %v", err)
+	}
+	if created.Status != model.EvalRunRunning || created.Total != 3 || len(created.Scorers) != 4 {
+		t.Errorf("created run = %+v", created)
+	}
+	if judgeCfg.Temperature == nil || *judgeCfg.Temperature != 0 {
+		t.Errorf("judge temperature = %v, want 0", judgeCfg.Temperature)
+	}
+
+	select {
+	case <-evalDao.finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("eval run did not finish")
+	}
+
+	run, err := s.GetEvalRun(ctx, 1, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != model.EvalRunCompleted || run.Completed != 3 || run.FinishedAt == nil {
+		t.Errorf("run = %+v", run)
+	}
+	sum := run.Summary
+	if sum.WinsA != 2 || sum.WinsB != 0 || sum.Ties != 1 || sum.ErrorsA != 0 || sum.ErrorsB != 1 {
+		t.Errorf("summary = %+v", sum)
+	}
+	if math.Abs(sum.WinRateA-2.0/3) > 1e-9 {
+		t.Errorf("win rate A = %v", sum.WinRateA)
+	}
+	exact := sum.Scorers[model.EvalScorerExact]
+	if exact.Cases != 2 || exact.MeanA != 1 || exact.MeanB != 0.5 || exact.WinsA != 1 || exact.Ties != 1 {
+		t.Errorf("exact stats = %+v", exact)
+	}
+	judge := sum.Scorers[model.EvalScorerJudge]
+	if judge.Cases != 2 || math.Abs(judge.MeanA-0.6) > 1e-9 || math.Abs(judge.MeanB-0.3) > 1e-9 {
+		t.Errorf("judge stats = %+v", judge)
+	}
+
+	// 各配置使用指定的版本和生成参数
+	if o := agents.opts["good"]; o.Version != 2 || o.Temperature != nil {
+		t.Errorf("variant A options = %+v", o)
+	}
+	if o := agents.opts["bad"]; o.Version != model.AgentVersionDraft || o.Temperature == nil || *o.Temperature != 0.9 || o.MaxTokens != 256 {
+		t.Errorf("variant B options = %+v", o)
+	}
+
+	results, total, err := s.PageEvalResults(ctx, 1, created.ID, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 {
+		t.Fatalf("total results = %d", total)
+	}
+	first := results[0]
+	if first.Winner != model.EvalWinnerA || first.JudgeA != "正确" || first.JudgeB != "错误" {
+		t.Errorf("case 0 = %+v", first)
+	}
+	if diffString(first.Diff) != "[delete:巴黎][insert:伦敦]" {
+		t.Errorf("case 0 diff = %s", diffString(first.Diff))
+	}
+	if results[1].Winner != model.EvalWinnerTie {
+		t.Errorf("case 1 winner = %s", results[1].Winner)
+	}
+	last := results[2]
+	if last.Winner != model.EvalWinnerA || last.ErrorB != "model timeout" || last.ScoresB != nil {
+		t.Errorf("case 2 = %+v", last)
+	}
+
+	if _, _, err := s.PageEvalResults(ctx, 2, created.ID, 1, 10); err == nil {
+		t.Error("other user can read eval results")
+	}
+}
+
+func TestCreateEvalRunValidation(t *testing.T) {
+	valid := func() *model.CreateEvalRunRequest {
+		return &model.CreateEvalRunRequest{
+			VariantA: &model.EvalVariant{AgentID: "good"},
+			VariantB: &model.EvalVariant{AgentID: "bad"},
+			Cases:    []*model.EvalCase{{Input: "1+1=", Reference: "2"}},
+		}
+	}
+	tests := []struct {
+		name    string
+		modify  func(req *model.CreateEvalRunRequest)
+		wantErr string
+	}{
+		{"unknown agent", func(r *model.CreateEvalRunRequest) { r.VariantB.AgentID = "missing" }, "agent not found"},
+		{"unknown version", func(r *model.CreateEvalRunRequest) { r.VariantA.Version = 9 }, "version not found"},
+		{"invalid version", func(r *model.CreateEvalRunRequest) { r.VariantA.Version = -5 }, "invalid agent version"},
+		{"judge without model", func(r *model.CreateEvalRunRequest) { r.Scorers = []string{model.EvalScorerJudge} }, "judge_model_id is required"},
+		{"embedding without model", func(r *model.CreateEvalRunRequest) { r.Scorers = []string{model.EvalScorerEmbedding} }, "embed_model_id is required"},
+		{"unknown judge model", func(r *model.CreateEvalRunRequest) {
+			r.Scorers, r.JudgeModelID = []string{model.EvalScorerJudge}, "missing"
+		}, "failed to get judge model"},
+		{"invalid pattern", func(r *model.CreateEvalRunRequest) { r.Cases[0].Pattern = "(" }, "case 1: invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, evalDao, _, _ := newTestEvalService(t)
+			req := valid()
+			tt.modify(req)
+			_, err := s.CreateEvalRun(context.Background(), 1, req)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if len(evalDao.runs) != 0 {
+				t.Error("invalid eval run was created")
+			}
+		})
+	}
+}
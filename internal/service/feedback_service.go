@@ -0,0 +1,215 @@
+package service
+
+import (
+	"ai-cloud/internal/dao"
+	"ai-cloud/internal/model"
+	"ai-cloud/pkgs/stream"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/schema"
+)
+
+type FeedbackService interface {
+	// Submit 评价会话中的一条助手回复，重复评价时覆盖
+	Submit(ctx context.Context, userID uint, req *model.FeedbackRequest) (*model.MessageFeedback, error)
+	Delete(ctx context.Context, userID uint, msgID string) error
+	Get(ctx context.Context, userID uint, msgID string) (*model.MessageFeedback, error)
+	// Stats 满意度及其随时间的变化
+	Stats(ctx context.Context, userID uint, q *model.FeedbackQuery) (*model.FeedbackStats, error)
+	// WorstConversations 差评最多的会话
+	WorstConversations(ctx context.Context, userID uint, q *model.FeedbackQuery) ([]*model.ConvFeedback, error)
+	// TopReasons 差评原因按出现次数排序
+	TopReasons(ctx context.Context, userID uint, q *model.FeedbackQuery) ([]*model.ReasonCount, error)
+	// ExportDataset 导出评价及回复生成时检索到的分块，每行一个JSON编码的 model.FeedbackSample
+	ExportDataset(ctx context.Context, userID uint, q *model.FeedbackQuery) ([]byte, error)
+}
+
+type feedbackService struct {
+	dao        dao.FeedbackDao
+	traceDao   dao.TraceDao
+	historySvc HistoryService
+}
+
+func NewFeedbackService(dao dao.FeedbackDao, traceDao dao.TraceDao, historySvc HistoryService) FeedbackService {
+	return &feedbackService{dao: dao, traceDao: traceDao, historySvc: historySvc}
+}
+
+func (s *feedbackService) Submit(ctx context.Context, userID uint, req *model.FeedbackRequest) (*model.MessageFeedback, error) {
+	conv, err := s.historySvc.GetConversation(ctx, req.ConvID)
+	if err != nil {
+		return nil, err
+	}
+	if conv.UserID != userID {
+		return nil, errors.New("conversation not found or no permission")
+	}
+	msg, err := s.historySvc.GetMessage(ctx, conv.ConvID, req.MsgID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Role != string(schema.Assistant) {
+		return nil, errors.New("only assistant messages can be rated")
+	}
+
+	fb := &model.MessageFeedback{
+		MsgID:     msg.MsgID,
+		UserID:    userID,
+		ConvID:    conv.ConvID,
+		AgentID:   conv.AgentID,
+		Rating:    req.Rating,
+		Reasons:   req.Reasons,
+		Comment:   req.Comment,
+		CreatedAt: time.Now(),
+	}
+	if fb.Reasons == nil {
+		fb.Reasons = []string{}
+	}
+	// 早期的消息或未开启Trace的运行没有运行记录
+	if trace, err := s.traceDao.GetByMsgID(ctx, userID, msg.MsgID); err == nil {
+		fb.TraceID = trace.ID
+	}
+	if err := s.dao.Upsert(ctx, fb); err != nil {
+		return nil, err
+	}
+	return fb, nil
+}
+
+func (s *feedbackService) Delete(ctx context.Context, userID uint, msgID string) error {
+	return s.dao.Delete(ctx, userID, msgID)
+}
+
+func (s *feedbackService) Get(ctx context.Context, userID uint, msgID string) (*model.MessageFeedback, error) {
+	return s.dao.Get(ctx, userID, msgID)
+}
+
+func (s *feedbackService) Stats(ctx context.Context, userID uint, q *model.FeedbackQuery) (*model.FeedbackStats, error) {
+	trend, err := s.dao.Trend(ctx, userID, q)
+	if err != nil {
+		return nil, err
+	}
+	stats := &model.FeedbackStats{Trend: trend}
+	for _, t := range trend {
+		t.Satisfaction = satisfaction(t.Up, t.Down)
+		stats.Up += t.Up
+		stats.Down += t.Down
+	}
+	stats.Satisfaction = satisfaction(stats.Up, stats.Down)
+	return stats, nil
+}
+
+// satisfaction 好评占全部评价的比例，没有评价时为0
+func satisfaction(up, down int64) float64 {
+	if up+down == 0 {
+		return 0
+	}
+	return float64(up) / float64(up+down)
+}
+
+func (s *feedbackService) WorstConversations(ctx context.Context, userID uint, q *model.FeedbackQuery) ([]*model.ConvFeedback, error) {
+	return s.dao.WorstConversations(ctx, userID, q)
+}
+
+func (s *feedbackService) TopReasons(ctx context.Context, userID uint, q *model.FeedbackQuery) ([]*model.ReasonCount, error) {
+	reasons, err := s.dao.ListReasons(ctx, userID, q)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64)
+	for _, rs := range reasons {
+		for _, r := range rs {
+			counts[r]++
+		}
+	}
+	result := make([]*model.ReasonCount, 0, len(counts))
+	for r, n := range counts {
+		result = append(result, &model.ReasonCount{Reason: r, Count: n})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Reason < result[j].Reason
+	})
+	return result, nil
+}
+
+func (s *feedbackService) ExportDataset(ctx context.Context, userID uint, q *model.FeedbackQuery) ([]byte, error) {
+	fbs, err := s.dao.List(ctx, userID, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, fb := range fbs {
+		reply, query, err := s.historySvc.GetTurn(ctx, fb.ConvID, fb.MsgID)
+		if err != nil {
+			// 会话或消息已被删除
+			continue
+		}
+		sample := &model.FeedbackSample{
+			FeedbackID: fb.ID,
+			AgentID:    fb.AgentID,
+			ConvID:     fb.ConvID,
+			MsgID:      fb.MsgID,
+			TraceID:    fb.TraceID,
+			Answer:     reply.Content,
+			Rating:     fb.Rating,
+			Reasons:    fb.Reasons,
+			Comment:    fb.Comment,
+			Chunks:     s.retrievedChunks(ctx, reply, fb.TraceID),
+			CreatedAt:  fb.CreatedAt.Unix(),
+		}
+		if query != nil {
+			sample.Query = query.Content
+		}
+		if err := enc.Encode(sample); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// retrievedChunks 生成回复时检索到的分块：优先使用随回复保存的引用，早期的回复从Trace中Retriever步骤的输出读取
+func (s *feedbackService) retrievedChunks(ctx context.Context, reply *model.Message, traceID string) []*stream.Reference {
+	if len(reply.Metadata) > 0 {
+		var meta model.MessageMetadata
+		if err := json.Unmarshal(reply.Metadata, &meta); err == nil && len(meta.References) > 0 {
+			return meta.References
+		}
+	}
+
+	chunks := []*stream.Reference{}
+	if traceID == "" {
+		return chunks
+	}
+	spans, err := s.traceDao.ListSpans(ctx, traceID)
+	if err != nil {
+		log.Printf("[Feedback] failed to load trace %s: %v", traceID, err)
+		return chunks
+	}
+	for _, span := range spans {
+		if span.Component != string(components.ComponentOfRetriever) || span.Documents == "" {
+			continue
+		}
+		var docs []model.TraceDocument
+		if err := json.Unmarshal([]byte(span.Documents), &docs); err != nil {
+			continue
+		}
+		for _, d := range docs {
+			chunks = append(chunks, &stream.Reference{
+				ChunkID:      d.ID,
+				DocumentName: d.DocumentName,
+				Score:        d.Score,
+				Content:      d.Content,
+			})
+		}
+	}
+	return chunks
+}
@@ -20,6 +20,8 @@ import (
 
 type FileService interface {
 	UploadFile(userID uint, fileHeader *multipart.FileHeader, file multipart.File, parentID string) (string, error)
+	// UploadData 保存已读取到内存中的文件，用于导入等非表单上传的场景
+	UploadData(userID uint, name string, data []byte, parentID string) (string, error)
 	GetFileURL(key string) (string, error)
 	PageList(userID uint, parentID *string, page int, pageSize int, sort string) (int64, []model.File, error)
 	DownloadFile(fileID string) (*model.File, []byte, error)
@@ -50,9 +52,18 @@ func NewFileService(fileDao dao.FileDao) FileService {
 }
 
 func (fs *fileService) UploadFile(userID uint, fileHeader *multipart.FileHeader, file multipart.File, parentID string) (string, error) {
+	// Read file data
+	fileData, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return fs.UploadData(userID, fileHeader.Filename, fileData, parentID)
+}
+
+func (fs *fileService) UploadData(userID uint, name string, data []byte, parentID string) (string, error) {
 	fileID := GenerateUUID()
 
-	ext := filepath.Ext(fileHeader.Filename)
+	ext := filepath.Ext(name)
 	mimeType := mime.TypeByExtension(ext)
 
 	key := fmt.Sprintf("user%v-%s", userID, fileID)
@@ -60,8 +71,8 @@ func (fs *fileService) UploadFile(userID uint, fileHeader *multipart.FileHeader,
 	newFile := model.File{
 		ID:          fileID,
 		UserID:      userID,
-		Name:        fileHeader.Filename,
-		Size:        fileHeader.Size,
+		Name:        name,
+		Size:        int64(len(data)),
 		MIMEType:    mimeType,
 		StorageType: config.AppConfigInstance.Storage.Type,
 		StorageKey:  key,
@@ -74,14 +85,8 @@ func (fs *fileService) UploadFile(userID uint, fileHeader *multipart.FileHeader,
 	}
 	// TODO:校验ParentID的合法性
 
-	// Read file data
-	fileData, err := io.ReadAll(file)
-	if err != nil {
-		return "", fmt.Errorf("failed to read file: %w", err)
-	}
-	//
 	// Upload file to storage
-	if err := fs.storageDriver.Upload(fileData, newFile.StorageKey, mimeType); err != nil {
+	if err := fs.storageDriver.Upload(data, newFile.StorageKey, mimeType); err != nil {
 		return "", fmt.Errorf("failed to upload file: %w", err)
 	}
 
@@ -1,20 +1,65 @@
 package service
 
 import (
+	llmfactory "ai-cloud/internal/component/llm"
 	hisdao "ai-cloud/internal/dao/history"
 	"ai-cloud/internal/model"
 	"ai-cloud/internal/utils"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/cloudwego/eino/schema"
 )
 
 type HistoryService interface {
-	SaveMessage(ctx context.Context, mess *schema.Message, convID string) error
+	// AddMessage 将消息保存为parentID的子消息，并设为会话当前分支的末端。msgID为空时自动生成，meta为回复的运行信息
+	AddMessage(ctx context.Context, conv *model.Conversation, mess *schema.Message, msgID, parentID string, variant bool, meta *model.MessageMetadata) (*model.Message, error)
+	// AddPendingReply 预先创建pending状态的空助手回复，并设为会话当前分支的末端
+	AddPendingReply(ctx context.Context, conv *model.Conversation, msgID, parentID string, variant bool) (*model.Message, error)
+	// FinalizeReply 保存回复生成的结果，status为sent或error，出错时保留已生成的部分内容
+	FinalizeReply(ctx context.Context, msgID string, mess *schema.Message, meta *model.MessageMetadata, status string) error
+	// FailStaleReplies 将before之前开始、仍为pending且不在等待审批的回复标记为error
+	FailStaleReplies(ctx context.Context, before time.Time) error
+	// GetMessage 获取会话中的消息，ParentID为消息在消息树中的父消息
+	GetMessage(ctx context.Context, convID, msgID string) (*model.Message, error)
+	// GetTurn 获取助手回复及其回答的用户消息（回复的父消息），没有父消息时query为nil
+	GetTurn(ctx context.Context, convID, replyID string) (reply, query *model.Message, err error)
+	// ActiveLeaf 会话当前分支末端的消息ID，没有消息时为空
+	ActiveLeaf(ctx context.Context, conv *model.Conversation) (string, error)
+	// GetHistory 获取会话当前分支最近的limit条消息，按时间顺序
 	GetHistory(ctx context.Context, convID string, limit int) ([]*schema.Message, error)
+	// Search 在用户的会话标题和消息中全文检索
+	Search(ctx context.Context, userID uint, req *model.SearchRequest) (*model.SearchResult, error)
+	// PageMessages 以消息为游标分页获取历史，游标不在当前分支上时沿游标所在的分支返回
+	PageMessages(ctx context.Context, conv *model.Conversation, req *model.MessagePageRequest) (*model.MessagePage, error)
+	// GetContext 选取发送给模型的历史：从根到parentID的分支上，上次清除上下文之后、能放入budget个token的最近消息，以及更早消息的摘要
+	GetContext(ctx context.Context, conv *model.Conversation, parentID string, budget int) (*ContextWindow, error)
+	// ClearContext 将会话当前分支的末端标记为上下文边界，之后的对话不再携带之前的历史
+	ClearContext(ctx context.Context, convID string) error
+	// SetCurrentMsg 将msgID设为会话当前分支的末端
+	SetCurrentMsg(ctx context.Context, conv *model.Conversation, msgID string) error
+	// SwitchBranch 切换到包含msgID的分支，末端为该消息最新的后代
+	SwitchBranch(ctx context.Context, conv *model.Conversation, msgID string) error
+	// ExportConversation 导出会话的全部消息和分支
+	ExportConversation(ctx context.Context, conv *model.Conversation) (*model.ConversationExport, error)
+	// ImportConversation 创建会话并按顺序保存消息，消息保存失败时删除已创建的会话
+	ImportConversation(ctx context.Context, conv *model.Conversation, msgs []*model.Message) error
+	// GetTree 获取会话的消息树
+	GetTree(ctx context.Context, conv *model.Conversation) (*model.MessageTree, error)
+	UpdateSummary(ctx context.Context, convID, summary string, summaryMsgID uint64) error
+	GetConversation(ctx context.Context, convID string) (*model.Conversation, error)
 	CreateConversation(ctx context.Context, conv *model.Conversation) error
 	UpdateConversation(ctx context.Context, conv *model.Conversation) error
+	// TouchConversation 只更新会话的最后更新时间
+	TouchConversation(ctx context.Context, convID string) error
+	// SetSettings 替换会话设置，settings为nil时清空
+	SetSettings(ctx context.Context, convID string, settings *model.ConversationSettings) error
+	// SetTitle 设置会话标题，manual为false时不覆盖用户手动设置的标题
+	SetTitle(ctx context.Context, convID, title string, manual bool) error
 	DeleteConversation(ctx context.Context, convID string) error
 	ArchiveConversation(ctx context.Context, convID string) error
 	UnArchiveConversation(ctx context.Context, convID string) error
@@ -23,50 +68,447 @@ type HistoryService interface {
 	ListConversations(ctx context.Context, userID uint, page, size int) ([]*model.Conversation, int64, error)
 	ListConversationsByAgent(ctx context.Context, userID uint, agentID string, page, size int) ([]*model.Conversation, int64, error)
 }
+
+const (
+	// contextCandidateLimit 选取上下文时最多读取的消息数
+	contextCandidateLimit = 200
+	// searchTitleLimit 检索时最多返回的标题命中会话数
+	searchTitleLimit = 10
+	// searchSnippetRadius 检索结果片段在命中位置前的字符数，片段总长约为其三倍
+	searchSnippetRadius = 40
+)
+
+// ContextWindow 发送给模型的会话上下文
+type ContextWindow struct {
+	// Summary 早期消息的摘要，上次清除上下文之后没有摘要时为空
+	Summary string
+	// Messages 放入上下文窗口的最近消息，按时间顺序
+	Messages []*schema.Message
+	// Overflow 超出窗口且尚未纳入摘要的消息，按时间顺序
+	Overflow []*model.Message
+}
+
+// History 摘要和窗口内的消息，摘要作为一条系统消息放在最前面
+func (w *ContextWindow) History() []*schema.Message {
+	if w.Summary == "" {
+		return w.Messages
+	}
+	return append([]*schema.Message{schema.SystemMessage("以下是之前对话的摘要：\n" + w.Summary)}, w.Messages...)
+}
+
 type history struct {
-	convDao hisdao.ConvDao
-	msgDao  hisdao.MsgDao
+	convDao   hisdao.ConvDao
+	msgDao    hisdao.MsgDao
+	searchDao hisdao.SearchDao
 }
 
 // NewHistoryService 创建历史记录服务
-func NewHistoryService(convDao hisdao.ConvDao, msgDao hisdao.MsgDao) HistoryService {
+func NewHistoryService(convDao hisdao.ConvDao, msgDao hisdao.MsgDao, searchDao hisdao.SearchDao) HistoryService {
 	return &history{
-		convDao: convDao,
-		msgDao:  msgDao,
+		convDao:   convDao,
+		msgDao:    msgDao,
+		searchDao: searchDao,
+	}
+}
+
+// AddMessage 保存消息并更新会话当前分支的末端
+func (s *history) AddMessage(ctx context.Context, conv *model.Conversation, mess *schema.Message, msgID, parentID string, variant bool, meta *model.MessageMetadata) (*model.Message, error) {
+	msg := &model.Message{
+		MsgID:            msgID,
+		Role:             string(mess.Role),
+		Content:          mess.Content,
+		ReasoningContent: llmfactory.ReasoningContent(mess),
+		ConvID:           conv.ConvID,
+		ParentID:         parentID,
+		IsVariant:        variant,
+		TokenCount:       messageTokens(mess),
+	}
+	if !meta.Empty() {
+		msg.Metadata, _ = json.Marshal(meta)
+	}
+	if err := s.msgDao.Create(ctx, msg); err != nil {
+		return nil, fmt.Errorf("failed to save message: %w", err)
+	}
+	if err := s.SetCurrentMsg(ctx, conv, msg.MsgID); err != nil {
+		return nil, err
 	}
+	return msg, nil
 }
 
-// SaveMessage 保存消息
-func (s *history) SaveMessage(ctx context.Context, mess *schema.Message, convID string) error {
-	err := s.msgDao.Create(ctx, &model.Message{
-		Role:    string(mess.Role),
-		Content: mess.Content,
-		ConvID:  convID,
-	})
+func (s *history) AddPendingReply(ctx context.Context, conv *model.Conversation, msgID, parentID string, variant bool) (*model.Message, error) {
+	msg := &model.Message{
+		MsgID:     msgID,
+		Role:      string(schema.Assistant),
+		ConvID:    conv.ConvID,
+		ParentID:  parentID,
+		IsVariant: variant,
+		Status:    model.MessageStatusPending,
+	}
+	if err := s.msgDao.Create(ctx, msg); err != nil {
+		return nil, fmt.Errorf("failed to save reply: %w", err)
+	}
+	if err := s.SetCurrentMsg(ctx, conv, msg.MsgID); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (s *history) FinalizeReply(ctx context.Context, msgID string, mess *schema.Message, meta *model.MessageMetadata, status string) error {
+	msg := &model.Message{
+		MsgID:  msgID,
+		Status: status,
+	}
+	if mess != nil {
+		msg.Content = mess.Content
+		msg.ReasoningContent = llmfactory.ReasoningContent(mess)
+		msg.TokenCount = messageTokens(mess)
+	}
+	if !meta.Empty() {
+		msg.Metadata, _ = json.Marshal(meta)
+	}
+	return s.msgDao.UpdateReply(ctx, msg)
+}
+
+func (s *history) FailStaleReplies(ctx context.Context, before time.Time) error {
+	_, err := s.msgDao.FailStaleReplies(ctx, "", before.Unix())
+	return err
+}
+
+// loadTree 读取会话的全部消息并构建消息树。已中断的回复不会再结束，读取时标记为error，避免客户端一直等待
+func (s *history) loadTree(ctx context.Context, convID string) (*messageTree, error) {
+	msgs, err := s.msgDao.ListByConvID(ctx, convID)
 	if err != nil {
-		return fmt.Errorf("failed to save message: %w", err)
+		return nil, fmt.Errorf("failed to get messages: %w", err)
 	}
-	return nil
+	cutoff := time.Now().Add(-staleReplyAge).Unix()
+	if slices.ContainsFunc(msgs, func(m *model.Message) bool {
+		return m.Status == model.MessageStatusPending && m.CreatedAt < cutoff
+	}) {
+		n, err := s.msgDao.FailStaleReplies(ctx, convID, cutoff)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			if msgs, err = s.msgDao.ListByConvID(ctx, convID); err != nil {
+				return nil, fmt.Errorf("failed to get messages: %w", err)
+			}
+		}
+	}
+	return newMessageTree(msgs), nil
+}
+
+func (s *history) GetMessage(ctx context.Context, convID, msgID string) (*model.Message, error) {
+	tree, err := s.loadTree(ctx, convID)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := tree.byID[msgID]
+	if !ok {
+		return nil, errors.New("message not found")
+	}
+	msg := *m
+	msg.ParentID = tree.parents[msgID]
+	return &msg, nil
+}
+
+func (s *history) GetTurn(ctx context.Context, convID, replyID string) (*model.Message, *model.Message, error) {
+	tree, err := s.loadTree(ctx, convID)
+	if err != nil {
+		return nil, nil, err
+	}
+	reply, ok := tree.byID[replyID]
+	if !ok {
+		return nil, nil, errors.New("message not found")
+	}
+	return reply, tree.byID[tree.parents[replyID]], nil
+}
+
+func (s *history) ActiveLeaf(ctx context.Context, conv *model.Conversation) (string, error) {
+	tree, err := s.loadTree(ctx, conv.ConvID)
+	if err != nil {
+		return "", err
+	}
+	return tree.leaf(conv), nil
 }
 
-// GetHistory 获取对话的历史消息
+// GetHistory 获取对话当前分支的历史消息
 func (s *history) GetHistory(ctx context.Context, convID string, limit int) ([]*schema.Message, error) {
 	if limit == 0 {
 		limit = 50
 	}
-	_, err := s.convDao.GetByID(ctx, convID)
+	conv, err := s.convDao.GetByID(ctx, convID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get conversation: %w", err)
 	}
 
-	msgs, _, err := s.msgDao.List(ctx, convID, 0, limit)
+	tree, err := s.loadTree(ctx, convID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get messages: %w", err)
+		return nil, err
+	}
+	msgs := tree.path(tree.leaf(conv))
+	if len(msgs) > limit {
+		msgs = msgs[len(msgs)-limit:]
 	}
 
 	return utils.MessageList2ChatHistory(msgs), nil
 }
 
+// Search 标题命中的会话只在第一页返回，指定角色时只检索消息
+func (s *history) Search(ctx context.Context, userID uint, req *model.SearchRequest) (*model.SearchResult, error) {
+	terms := utils.SearchTerms(req.Query)
+	if len(terms) == 0 {
+		return nil, errors.New("search query is empty")
+	}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.Size <= 0 {
+		req.Size = 10
+	}
+
+	result := &model.SearchResult{Conversations: []*model.SearchHit{}, Messages: []*model.SearchHit{}}
+	if req.Page == 1 && req.Role == "" {
+		convs, err := s.searchDao.SearchTitles(ctx, userID, terms, req, searchTitleLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range convs {
+			result.Conversations = append(result.Conversations, &model.SearchHit{
+				ConvID:    c.ConvID,
+				AgentID:   c.AgentID,
+				Title:     c.Title,
+				Snippet:   utils.HighlightSnippet(c.Title, terms, searchSnippetRadius),
+				CreatedAt: c.UpdatedAt,
+			})
+		}
+	}
+
+	hits, total, err := s.searchDao.SearchMessages(ctx, userID, terms, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hits {
+		result.Messages = append(result.Messages, &model.SearchHit{
+			ConvID:    h.ConvID,
+			MsgID:     h.MsgID,
+			AgentID:   h.AgentID,
+			Title:     h.Title,
+			Role:      h.Role,
+			Snippet:   utils.HighlightSnippet(h.Content, terms, searchSnippetRadius),
+			CreatedAt: h.CreatedAt,
+		})
+	}
+	result.Total = total
+	return result, nil
+}
+
+func (s *history) PageMessages(ctx context.Context, conv *model.Conversation, req *model.MessagePageRequest) (*model.MessagePage, error) {
+	if req.Limit <= 0 {
+		req.Limit = 20
+	}
+	tree, err := s.loadTree(ctx, conv.ConvID)
+	if err != nil {
+		return nil, err
+	}
+	path := tree.path(tree.leaf(conv))
+	start, end := max(len(path)-req.Limit, 0), len(path)
+	if req.Cursor != "" {
+		if _, ok := tree.byID[req.Cursor]; !ok {
+			return nil, errors.New("message not found")
+		}
+		pos := slices.IndexFunc(path, func(m *model.Message) bool { return m.MsgID == req.Cursor })
+		if pos < 0 {
+			path = tree.path(tree.latestDescendant(req.Cursor))
+			pos = slices.IndexFunc(path, func(m *model.Message) bool { return m.MsgID == req.Cursor })
+		}
+		switch req.Direction {
+		case "before":
+			start, end = max(pos-req.Limit, 0), pos
+		case "after":
+			start, end = pos+1, min(pos+1+req.Limit, len(path))
+		default:
+			start = max(pos-(req.Limit-1)/2, 0)
+			end = min(start+req.Limit, len(path))
+			start = max(end-req.Limit, 0)
+		}
+	}
+
+	page := &model.MessagePage{Messages: utils.MessageList2ChatHistory(path[start:end])}
+	if page.Messages == nil {
+		page.Messages = []*schema.Message{}
+	}
+	if start > 0 && start < end {
+		page.PrevCursor = path[start].MsgID
+	}
+	if end < len(path) && start < end {
+		page.NextCursor = path[end-1].MsgID
+	}
+	return page, nil
+}
+
+// GetContext 从parentID开始沿分支向前选取，直到超出budget。摘要只在其最后一条消息位于该分支上、且在上次清除上下文之后时有效
+func (s *history) GetContext(ctx context.Context, conv *model.Conversation, parentID string, budget int) (*ContextWindow, error) {
+	tree, err := s.loadTree(ctx, conv.ConvID)
+	if err != nil {
+		return nil, err
+	}
+	path := tree.path(parentID)
+
+	w := &ContextWindow{}
+	from := 0
+	for i, m := range path {
+		switch {
+		case m.IsContextEdge:
+			from = i + 1
+			w.Summary = ""
+		case m.ID == conv.SummaryMsgID && conv.Summary != "":
+			from = i + 1
+			w.Summary = conv.Summary
+		}
+	}
+	budget -= utils.CountTokens(w.Summary)
+
+	// 没有内容的回复（生成中、等待审批或生成失败）不作为历史
+	msgs := make([]*model.Message, 0, len(path)-from)
+	for _, m := range path[from:] {
+		if m.Content != "" {
+			msgs = append(msgs, m)
+		}
+	}
+	if len(msgs) > contextCandidateLimit {
+		msgs = msgs[len(msgs)-contextCandidateLimit:]
+	}
+	used, n := 0, len(msgs)
+	for ; n > 0; n-- {
+		tokens := msgs[n-1].TokenCount
+		if tokens == 0 {
+			// 早期保存的消息没有token数
+			tokens = utils.CountTokens(msgs[n-1].Content)
+		}
+		if used+tokens > budget {
+			break
+		}
+		used += tokens
+	}
+
+	w.Messages = utils.MessageList2ChatHistory(msgs[n:])
+	w.Overflow = msgs[:n]
+	return w, nil
+}
+
+func (s *history) ClearContext(ctx context.Context, convID string) error {
+	conv, err := s.GetConversation(ctx, convID)
+	if err != nil {
+		return err
+	}
+	leaf, err := s.ActiveLeaf(ctx, conv)
+	if err != nil {
+		return err
+	}
+	if leaf == "" {
+		return nil
+	}
+	return s.msgDao.SetContextEdge(ctx, leaf, true)
+}
+
+func (s *history) SetCurrentMsg(ctx context.Context, conv *model.Conversation, msgID string) error {
+	if err := s.convDao.SetCurrentMsg(ctx, conv.ConvID, msgID); err != nil {
+		return err
+	}
+	conv.CurrentMsgID = msgID
+	return nil
+}
+
+func (s *history) SwitchBranch(ctx context.Context, conv *model.Conversation, msgID string) error {
+	tree, err := s.loadTree(ctx, conv.ConvID)
+	if err != nil {
+		return err
+	}
+	if _, ok := tree.byID[msgID]; !ok {
+		return errors.New("message not found")
+	}
+	return s.SetCurrentMsg(ctx, conv, tree.latestDescendant(msgID))
+}
+
+func (s *history) ExportConversation(ctx context.Context, conv *model.Conversation) (*model.ConversationExport, error) {
+	tree, err := s.loadTree(ctx, conv.ConvID)
+	if err != nil {
+		return nil, err
+	}
+	exp := &model.ConversationExport{
+		Format:       model.ExportFormat,
+		Version:      model.ExportVersion,
+		ConvID:       conv.ConvID,
+		AgentID:      conv.AgentID,
+		Title:        conv.Title,
+		Summary:      conv.Summary,
+		CreatedAt:    conv.CreatedAt,
+		UpdatedAt:    conv.UpdatedAt,
+		CurrentMsgID: tree.leaf(conv),
+		Messages:     make([]*model.MessageExport, 0, len(tree.msgs)),
+	}
+	for _, m := range tree.msgs {
+		var meta *model.MessageMetadata
+		if len(m.Metadata) > 0 {
+			_ = json.Unmarshal(m.Metadata, &meta)
+		}
+		exp.Messages = append(exp.Messages, &model.MessageExport{
+			MsgID:            m.MsgID,
+			ParentID:         tree.parents[m.MsgID],
+			Role:             m.Role,
+			Content:          m.Content,
+			ReasoningContent: m.ReasoningContent,
+			CreatedAt:        m.CreatedAt,
+			TokenCount:       m.TokenCount,
+			IsVariant:        m.IsVariant,
+			IsContextEdge:    m.IsContextEdge,
+			Metadata:         meta,
+		})
+	}
+	return exp, nil
+}
+
+func (s *history) ImportConversation(ctx context.Context, conv *model.Conversation, msgs []*model.Message) error {
+	if err := s.convDao.Create(ctx, conv); err != nil {
+		return err
+	}
+	if err := s.msgDao.CreateBatch(ctx, msgs); err != nil {
+		_ = s.convDao.Delete(ctx, conv.ConvID)
+		return err
+	}
+	return nil
+}
+
+func (s *history) GetTree(ctx context.Context, conv *model.Conversation) (*model.MessageTree, error) {
+	tree, err := s.loadTree(ctx, conv.ConvID)
+	if err != nil {
+		return nil, err
+	}
+	return tree.toModel(conv), nil
+}
+
+func (s *history) UpdateSummary(ctx context.Context, convID, summary string, summaryMsgID uint64) error {
+	return s.convDao.UpdateSummary(ctx, convID, summary, summaryMsgID)
+}
+
+// messageTokens 计算消息的token数。模型返回了用量且没有思考内容时使用实际的输出token数
+func messageTokens(mess *schema.Message) int {
+	if mess.ResponseMeta != nil && mess.ResponseMeta.Usage != nil && mess.ResponseMeta.Usage.CompletionTokens > 0 &&
+		llmfactory.ReasoningContent(mess) == "" {
+		return mess.ResponseMeta.Usage.CompletionTokens
+	}
+	return utils.CountMessageTokens(mess)
+}
+
+// GetConversation 获取会话
+func (s *history) GetConversation(ctx context.Context, convID string) (*model.Conversation, error) {
+	conv, err := s.convDao.GetByID(ctx, convID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+	return conv, nil
+}
+
 // CreateConversation 创建会话
 func (s *history) CreateConversation(ctx context.Context, conv *model.Conversation) error {
 	if err := s.convDao.FirstOrCreate(ctx, conv); err != nil {
@@ -83,6 +525,26 @@ func (s *history) UpdateConversation(ctx context.Context, conv *model.Conversati
 	return nil
 }
 
+// TouchConversation 更新会话最后更新时间
+func (s *history) TouchConversation(ctx context.Context, convID string) error {
+	return s.convDao.Touch(ctx, convID, time.Now().Unix())
+}
+
+func (s *history) SetSettings(ctx context.Context, convID string, settings *model.ConversationSettings) error {
+	var raw json.RawMessage
+	if settings != nil {
+		var err error
+		if raw, err = json.Marshal(settings); err != nil {
+			return err
+		}
+	}
+	return s.convDao.SetSettings(ctx, convID, raw)
+}
+
+func (s *history) SetTitle(ctx context.Context, convID, title string, manual bool) error {
+	return s.convDao.SetTitle(ctx, convID, title, manual)
+}
+
 // ArchiveConversation 归档会话
 func (s *history) ArchiveConversation(ctx context.Context, convID string) error {
 	if err := s.convDao.Archive(ctx, convID); err != nil {
@@ -10,12 +10,11 @@ import (
 	"ai-cloud/internal/database"
 	"ai-cloud/internal/model"
 	"ai-cloud/internal/storage"
+	"ai-cloud/pkgs/stream"
 	"context"
 	"errors"
 	"fmt"
 	einoRetriever "github.com/cloudwego/eino/components/retriever"
-	"io"
-	"log"
 	"path/filepath"
 	"strings"
 	"time"
@@ -31,10 +30,10 @@ import (
 
 type KBService interface {
 	// 知识库
-	CreateKB(userID uint, name, description, embedModelID string) error             // 创建知识库
-	DeleteKB(userID uint, kbID string) error                                        // 删除知识库
-	PageList(userID uint, page int, size int) (int64, []model.KnowledgeBase, error) // 获取知识库列表
-	GetKBDetail(userID uint, kbID string) (*model.KnowledgeBase, error)             // 获取知识库详情
+	CreateKB(userID uint, name, description, embedModelID string) (*model.KnowledgeBase, error) // 创建知识库
+	DeleteKB(userID uint, kbID string) error                                                    // 删除知识库
+	PageList(userID uint, page int, size int) (int64, []model.KnowledgeBase, error)             // 获取知识库列表
+	GetKBDetail(userID uint, kbID string) (*model.KnowledgeBase, error)                         // 获取知识库详情
 
 	// 文档
 	CreateDocument(userID uint, kbID string, file *model.File) (*model.Document, error) // 添加File到知识库
@@ -43,8 +42,8 @@ type KBService interface {
 	DeleteDocs(userID uint, kbID string, docs []string) error                              // 批量删除文件
 
 	// RAG
-	RAGQuery(ctx context.Context, userID uint, query string, kbIDs []string) (*model.ChatResponse, error)                    // 新增RAG查询方法
-	RAGQueryStream(ctx context.Context, userID uint, query string, kbIDs []string) (<-chan *model.ChatStreamResponse, error) // 流式对话
+	RAGQuery(ctx context.Context, userID uint, query string, kbIDs []string) (*model.ChatResponse, error)                         // 新增RAG查询方法
+	RAGQueryStream(ctx context.Context, userID uint, query string, kbIDs []string) (*schema.StreamReader[*schema.Message], error) // 流式对话，先下发检索引用事件
 	Retrieve(ctx context.Context, userID uint, kbID string, query string, topK int) ([]*schema.Document, error)
 	// TODO: 移动Document到其他知识库
 	// TODO：修改知识库（名称、说明）
@@ -93,9 +92,8 @@ func NewKBService(kbDao dao.KnowledgeBaseDao, fileService FileService, modelDao
 	}
 }
 
-func (ks *kbService) CreateKB(userID uint, name, description, embedModelID string) error {
-	collectionName := fmt.Sprintf("embed_%s", embedModelID)
-	collectionName = strings.ReplaceAll(collectionName, "-", "_")
+func (ks *kbService) CreateKB(userID uint, name, description, embedModelID string) (*model.KnowledgeBase, error) {
+	collectionName := embedCollectionName(embedModelID)
 
 	kb := &model.KnowledgeBase{
 		ID:               GenerateUUID(),
@@ -108,9 +106,14 @@ func (ks *kbService) CreateKB(userID uint, name, description, embedModelID strin
 
 	// 保存知识库记录
 	if err := ks.kbDao.CreateKB(kb); err != nil {
-		return errors.New("知识库创建失败")
+		return nil, errors.New("知识库创建失败")
 	}
-	return nil
+	return kb, nil
+}
+
+// embedCollectionName 同一Embedding模型产生的向量保存在同一个Milvus集合中，按kb_id区分
+func embedCollectionName(embedModelID string) string {
+	return strings.ReplaceAll(fmt.Sprintf("embed_%s", embedModelID), "-", "_")
 }
 
 func (ks *kbService) DeleteKB(userID uint, kbID string) error {
@@ -422,10 +425,7 @@ func (ks *kbService) RAGQuery(ctx context.Context, userID uint, query string, kb
 }
 
 // RAGQueryStream 实现流式RAG查询
-func (ks *kbService) RAGQueryStream(ctx context.Context, userID uint, query string, kbIDs []string) (<-chan *model.ChatStreamResponse, error) {
-	// 创建响应通道
-	responseChan := make(chan *model.ChatStreamResponse)
-
+func (ks *kbService) RAGQueryStream(ctx context.Context, userID uint, query string, kbIDs []string) (*schema.StreamReader[*schema.Message], error) {
 	// 1. 权限校验
 	for _, kbID := range kbIDs {
 		kb, err := ks.kbDao.GetKBByID(kbID)
@@ -460,70 +460,14 @@ func (ks *kbService) RAGQueryStream(ctx context.Context, userID uint, query stri
 		schema.UserMessage(query),
 	}
 
-	log.Printf("messages: %v", messages)
-
-	// 4. 启动goroutine处理流式响应
-	go func() {
-		defer close(responseChan)
-
-		reader, err := ks.llm.Stream(ctx, messages)
-		if err != nil {
-			return
-		}
-		defer reader.Close()
-
-		id := GenerateUUID()
-		created := time.Now().Unix()
-		for {
-			chunk, err := reader.Recv()
-			if err != nil {
-				// Send a final message with finish_reason if it's EOF
-				if err == io.EOF {
-					stop := "stop"
-					response := &model.ChatStreamResponse{
-						ID:      id,
-						Object:  "chat.completion.chunk",
-						Created: created,
-						Model:   "deepseek-v3-250324",
-						Choices: []model.ChatStreamChoice{
-							{
-								Delta:        model.ChatStreamDelta{},
-								Index:        0,
-								FinishReason: &stop,
-							},
-						},
-					}
-					responseChan <- response
-				}
-				break
-			}
-
-			response := &model.ChatStreamResponse{
-				ID:      id,
-				Object:  "chat.completion.chunk",
-				Created: created,
-				Model:   "deepseek-v3-250324",
-				Choices: []model.ChatStreamChoice{
-					{
-						Delta: model.ChatStreamDelta{
-							Content: chunk.Content,
-						},
-						Index:        0,
-						FinishReason: nil,
-					},
-				},
-			}
-
-			select {
-			case <-ctx.Done():
-				return
-			case responseChan <- response:
-			}
-		}
-
-	}()
-
-	return responseChan, nil
+	// 4. 先下发检索到的引用，再转发模型的流式输出
+	events := newEventStream()
+	if len(allChunks) > 0 {
+		events.sendStreamEvent(&stream.Event{Type: stream.EventRetrieval, References: newReferences(allChunks)})
+	}
+	return events.run(ctx, nil, func(ctx context.Context) (*schema.StreamReader[*schema.Message], error) {
+		return ks.llm.Stream(ctx, messages)
+	}), nil
 }
 
 func (ks *kbService) DocList(userID uint, kbID string, page int, size int) (int64, []model.Document, error) {
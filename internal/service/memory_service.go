@@ -0,0 +1,320 @@
+package service
+
+import (
+	"ai-cloud/internal/component/embedding"
+	mindexer "ai-cloud/internal/component/indexer/milvus"
+	mretriever "ai-cloud/internal/component/retriever/milvus"
+	"ai-cloud/internal/dao"
+	"ai-cloud/internal/database"
+	"ai-cloud/internal/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+// memoryExtractLimit 提取记忆时提供给LLM对比的已有记忆数量
+const memoryExtractLimit = 50
+
+const memoryExtractPrompt = `你负责维护用户的长期记忆。阅读下面的一轮对话，找出关于用户、值得在以后的对话中记住的信息，例如身份、职业、偏好、习惯、正在进行的项目，以及用户明确要求记住的内容。
+与已有记忆对比后给出变更：
+- 新的信息放入 add
+- 与已有记忆冲突或需要补充时，在 update 中给出该记忆的ID和修改后的完整内容
+- 用户否定或已经过时的记忆，将其ID放入 delete
+不要记录一次性的问题、闲聊或助手回答的内容。每条记忆使用一句简洁的陈述句，以"用户"作为主语。
+只输出JSON，格式为：{"add": ["..."], "update": [{"id": "...", "content": "..."}], "delete": ["..."]}。没有变更时输出 {"add": [], "update": [], "delete": []}。`
+
+type MemoryService interface {
+	// Recall 检索与query相关的记忆
+	Recall(ctx context.Context, userID uint, agentID string, cfg *model.MemoryConfig, query string) ([]*model.Memory, error)
+	// Extract 由LLM从一轮对话中提取记忆，并对已有记忆做新增、修改和删除
+	Extract(ctx context.Context, userID uint, agentID string, cfg *model.MemoryConfig, llm einomodel.BaseChatModel, convID, query, reply string) error
+
+	ListMemories(ctx context.Context, userID uint, agentID string, page, size int) ([]*model.Memory, int64, error)
+	UpdateMemory(ctx context.Context, userID uint, id, content string) error
+	DeleteMemory(ctx context.Context, userID uint, id string) error
+	// DeleteAgentMemories 删除用户在Agent下的全部记忆
+	DeleteAgentMemories(ctx context.Context, userID uint, agentID string) error
+}
+
+type memoryService struct {
+	dao      dao.MemoryDao
+	modelDao dao.ModelDao
+}
+
+func NewMemoryService(dao dao.MemoryDao, modelDao dao.ModelDao) MemoryService {
+	return &memoryService{dao: dao, modelDao: modelDao}
+}
+
+func (s *memoryService) Recall(ctx context.Context, userID uint, agentID string, cfg *model.MemoryConfig, query string) ([]*model.Memory, error) {
+	// 还没有记忆时无需检索，此时向量集合也可能尚未创建
+	if existing, err := s.dao.List(ctx, userID, agentID, 1); err != nil || len(existing) == 0 {
+		return nil, err
+	}
+	topK := cfg.TopK
+	if topK <= 0 {
+		topK = model.DefaultMemoryTopK
+	}
+
+	embedder, err := s.embedder(ctx, userID, cfg.EmbedModelID)
+	if err != nil {
+		return nil, err
+	}
+	retriever, err := mretriever.NewMilvusRetriever(ctx, &mretriever.MilvusRetrieverConfig{
+		Client:     database.GetMilvusClient(),
+		Embedding:  embedder,
+		Collection: embedCollectionName(cfg.EmbedModelID),
+		KBIDs:      []string{memoryNamespace(userID, agentID)},
+		TopK:       topK,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create memory retriever: %w", err)
+	}
+	docs, err := retriever.Retrieve(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve memories: %w", err)
+	}
+
+	// 以数据库中的记录为准，已删除记忆的残留向量会被忽略
+	ids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, doc.ID)
+	}
+	memories, err := s.dao.GetByIDs(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*model.Memory, len(memories))
+	for _, m := range memories {
+		byID[m.ID] = m
+	}
+	res := make([]*model.Memory, 0, len(memories))
+	for _, id := range ids {
+		if m, ok := byID[id]; ok {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+func (s *memoryService) Extract(ctx context.Context, userID uint, agentID string, cfg *model.MemoryConfig, llm einomodel.BaseChatModel, convID, query, reply string) error {
+	existing, err := s.dao.List(ctx, userID, agentID, memoryExtractLimit)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("已有记忆：\n")
+	if len(existing) == 0 {
+		sb.WriteString("（无）\n")
+	}
+	for _, m := range existing {
+		fmt.Fprintf(&sb, "[%s] %s\n", m.ID, m.Content)
+	}
+	fmt.Fprintf(&sb, "\n对话：\n用户：%s\n助手：%s", query, reply)
+
+	out, err := llm.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(memoryExtractPrompt),
+		schema.UserMessage(sb.String()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to extract memories: %w", err)
+	}
+	update, err := parseMemoryUpdate(out.Content)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]*model.Memory, len(existing))
+	for _, m := range existing {
+		known[m.ID] = m
+	}
+
+	// 1. 删除
+	var deleted []*model.Memory
+	for _, id := range update.Delete {
+		if m, ok := known[id]; ok {
+			deleted = append(deleted, m)
+			delete(known, id)
+		}
+	}
+	if err := s.deleteMemories(ctx, userID, deleted); err != nil {
+		return err
+	}
+
+	// 2. 修改，向量使用当前配置的Embedding模型重新生成
+	for _, u := range update.Update {
+		m, ok := known[u.ID]
+		content := strings.TrimSpace(u.Content)
+		if !ok || content == "" || content == m.Content {
+			continue
+		}
+		if err := s.reindex(ctx, m, content, cfg.EmbedModelID); err != nil {
+			return err
+		}
+	}
+
+	// 3. 新增，先写入向量再保存记录
+	var added []*model.Memory
+	for _, content := range update.Add {
+		if content = strings.TrimSpace(content); content == "" {
+			continue
+		}
+		added = append(added, &model.Memory{
+			ID:           uuid.NewString(),
+			UserID:       userID,
+			AgentID:      agentID,
+			Content:      content,
+			EmbedModelID: cfg.EmbedModelID,
+			SourceConvID: convID,
+		})
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	if err := s.index(ctx, userID, agentID, cfg.EmbedModelID, added); err != nil {
+		return err
+	}
+	return s.dao.Create(ctx, added)
+}
+
+func (s *memoryService) ListMemories(ctx context.Context, userID uint, agentID string, page, size int) ([]*model.Memory, int64, error) {
+	return s.dao.Page(ctx, userID, agentID, page, size)
+}
+
+func (s *memoryService) UpdateMemory(ctx context.Context, userID uint, id, content string) error {
+	m, err := s.dao.GetByID(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	return s.reindex(ctx, m, strings.TrimSpace(content), m.EmbedModelID)
+}
+
+func (s *memoryService) DeleteMemory(ctx context.Context, userID uint, id string) error {
+	m, err := s.dao.GetByID(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	return s.deleteMemories(ctx, userID, []*model.Memory{m})
+}
+
+func (s *memoryService) DeleteAgentMemories(ctx context.Context, userID uint, agentID string) error {
+	memories, err := s.dao.List(ctx, userID, agentID, 0)
+	if err != nil {
+		return err
+	}
+	return s.deleteMemories(ctx, userID, memories)
+}
+
+// reindex 修改记忆内容并重新生成向量
+func (s *memoryService) reindex(ctx context.Context, m *model.Memory, content, embedModelID string) error {
+	if err := mindexer.DeleteDos(database.GetMilvusClient(), []string{m.ID}, embedCollectionName(m.EmbedModelID)); err != nil {
+		return err
+	}
+	updated := *m
+	updated.Content = content
+	updated.EmbedModelID = embedModelID
+	if err := s.index(ctx, m.UserID, m.AgentID, embedModelID, []*model.Memory{&updated}); err != nil {
+		return err
+	}
+	return s.dao.Update(ctx, m.UserID, m.ID, content, embedModelID)
+}
+
+// deleteMemories 删除记忆的向量和记录
+func (s *memoryService) deleteMemories(ctx context.Context, userID uint, memories []*model.Memory) error {
+	if len(memories) == 0 {
+		return nil
+	}
+	byModel := make(map[string][]string)
+	ids := make([]string, 0, len(memories))
+	for _, m := range memories {
+		byModel[m.EmbedModelID] = append(byModel[m.EmbedModelID], m.ID)
+		ids = append(ids, m.ID)
+	}
+	for embedModelID, modelIDs := range byModel {
+		if err := mindexer.DeleteDos(database.GetMilvusClient(), modelIDs, embedCollectionName(embedModelID)); err != nil {
+			log.Printf("[Memory] failed to delete memory vectors: %v", err)
+		}
+	}
+	return s.dao.Delete(ctx, userID, ids)
+}
+
+// index 将记忆写入Embedding模型对应的向量集合，以记忆命名空间作为kb_id与知识库文档区分
+func (s *memoryService) index(ctx context.Context, userID uint, agentID, embedModelID string, memories []*model.Memory) error {
+	embedder, err := s.embedder(ctx, userID, embedModelID)
+	if err != nil {
+		return err
+	}
+	indexer, err := mindexer.NewMilvusIndexer(ctx, &mindexer.MilvusIndexerConfig{
+		Client:     database.GetMilvusClient(),
+		Collection: embedCollectionName(embedModelID),
+		Dimension:  embedder.GetDimension(),
+		Embedding:  embedder,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create memory indexer: %w", err)
+	}
+
+	docs := make([]*schema.Document, 0, len(memories))
+	for _, m := range memories {
+		docs = append(docs, &schema.Document{
+			ID:      m.ID,
+			Content: m.Content,
+			MetaData: map[string]any{
+				"kb_id":       memoryNamespace(userID, agentID),
+				"document_id": m.ID,
+			},
+		})
+	}
+	if _, err := indexer.Store(ctx, docs); err != nil {
+		return fmt.Errorf("failed to store memory vectors: %w", err)
+	}
+	return nil
+}
+
+func (s *memoryService) embedder(ctx context.Context, userID uint, embedModelID string) (embedding.EmbeddingService, error) {
+	embedModel, err := s.modelDao.GetByID(ctx, userID, embedModelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get embedding model: %w", err)
+	}
+	return embedding.NewEmbeddingService(ctx, embedModel, embedding.WithTimeout(30*time.Second))
+}
+
+// memoryNamespace 记忆在向量集合中的kb_id，按用户和Agent隔离
+func memoryNamespace(userID uint, agentID string) string {
+	return fmt.Sprintf("mem_%d_%s", userID, agentID)
+}
+
+// parseMemoryUpdate 解析LLM输出的记忆变更，兼容包裹在代码块中的JSON
+func parseMemoryUpdate(content string) (*model.MemoryUpdate, error) {
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("memory extraction returned no json")
+	}
+	var update model.MemoryUpdate
+	if err := json.Unmarshal([]byte(content[start:end+1]), &update); err != nil {
+		return nil, fmt.Errorf("failed to parse memory extraction: %w", err)
+	}
+	return &update, nil
+}
+
+// formatMemories 将记忆格式化为注入提示词的文本
+func formatMemories(memories []*model.Memory) string {
+	if len(memories) == 0 {
+		return "（无）"
+	}
+	var sb strings.Builder
+	for _, m := range memories {
+		sb.WriteString("- ")
+		sb.WriteString(m.Content)
+		sb.WriteString("\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"ai-cloud/internal/model"
+	"slices"
+)
+
+// messageTree 会话的消息树。早期保存的消息没有ParentID，按保存顺序视为一条链
+type messageTree struct {
+	// msgs 按保存顺序
+	msgs     []*model.Message
+	byID     map[string]*model.Message
+	parents  map[string]string
+	children map[string][]*model.Message
+}
+
+func newMessageTree(msgs []*model.Message) *messageTree {
+	t := &messageTree{
+		msgs:     msgs,
+		byID:     make(map[string]*model.Message, len(msgs)),
+		parents:  make(map[string]string, len(msgs)),
+		children: make(map[string][]*model.Message),
+	}
+	lastLegacy := ""
+	for _, m := range msgs {
+		t.byID[m.MsgID] = m
+		parentID := m.ParentID
+		if parentID == "" && !m.IsVariant {
+			parentID = lastLegacy
+			lastLegacy = m.MsgID
+		}
+		t.parents[m.MsgID] = parentID
+		t.children[parentID] = append(t.children[parentID], m)
+	}
+	return t
+}
+
+// leaf 当前分支的末端：会话记录的末端消息不存在时使用最后保存的消息，没有消息时为空
+func (t *messageTree) leaf(conv *model.Conversation) string {
+	if _, ok := t.byID[conv.CurrentMsgID]; ok {
+		return conv.CurrentMsgID
+	}
+	if len(t.msgs) == 0 {
+		return ""
+	}
+	return t.msgs[len(t.msgs)-1].MsgID
+}
+
+// path 从根到msgID的消息，按时间顺序。msgID为空时返回空
+func (t *messageTree) path(msgID string) []*model.Message {
+	var path []*model.Message
+	for id := msgID; id != "" && len(path) < len(t.msgs); id = t.parents[id] {
+		m, ok := t.byID[id]
+		if !ok {
+			break
+		}
+		path = append(path, m)
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// latestDescendant 沿最新的子消息向下，返回msgID所在分支的末端
+func (t *messageTree) latestDescendant(msgID string) string {
+	for depth := 0; depth < len(t.msgs); depth++ {
+		children := t.children[msgID]
+		if len(children) == 0 {
+			break
+		}
+		msgID = children[len(children)-1].MsgID
+	}
+	return msgID
+}
+
+// toModel 转换为接口返回的树结构
+func (t *messageTree) toModel(conv *model.Conversation) *model.MessageTree {
+	leaf := t.leaf(conv)
+	tree := &model.MessageTree{
+		ConvID:       conv.ConvID,
+		CurrentMsgID: leaf,
+		ActivePath:   []string{},
+		Nodes:        make([]*model.MessageNode, 0, len(t.msgs)),
+	}
+	for _, m := range t.path(leaf) {
+		tree.ActivePath = append(tree.ActivePath, m.MsgID)
+	}
+	for _, m := range t.msgs {
+		node := &model.MessageNode{
+			MsgID:         m.MsgID,
+			ParentID:      t.parents[m.MsgID],
+			Role:          m.Role,
+			Content:       m.Content,
+			Status:        m.Status,
+			IsVariant:     m.IsVariant,
+			IsContextEdge: m.IsContextEdge,
+			CreatedAt:     m.CreatedAt,
+			Children:      []string{},
+			Attachments:   m.Attachments(),
+		}
+		for _, c := range t.children[m.MsgID] {
+			node.Children = append(node.Children, c.MsgID)
+		}
+		tree.Nodes = append(tree.Nodes, node)
+	}
+	return tree
+}
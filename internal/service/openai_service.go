@@ -0,0 +1,162 @@
+package service
+
+import (
+	"ai-cloud/internal/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var ErrNoUserMessage = errors.New("messages must contain at least one user message")
+
+// OpenAIService 以OpenAI兼容的接口暴露Agent，model为Agent的ID或名称
+type OpenAIService interface {
+	ListModels(ctx context.Context, userID uint) ([]*model.Agent, error)
+	// ChatCompletion 运行model对应的Agent，返回统一事件协议的回复流（见 StreamExecuteAgent）
+	ChatCompletion(ctx context.Context, userID uint, req *model.ChatCompletionRequest) (*schema.StreamReader[*schema.Message], error)
+}
+
+type openAIService struct {
+	agentSvc AgentService
+}
+
+func NewOpenAIService(agentSvc AgentService) OpenAIService {
+	return &openAIService{agentSvc: agentSvc}
+}
+
+func (s *openAIService) ListModels(ctx context.Context, userID uint) ([]*model.Agent, error) {
+	return s.agentSvc.ListAgents(ctx, userID)
+}
+
+func (s *openAIService) ChatCompletion(ctx context.Context, userID uint, req *model.ChatCompletionRequest) (*schema.StreamReader[*schema.Message], error) {
+	agent, err := s.resolveAgent(ctx, userID, req.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := toUserMessage(req.Messages)
+	if err != nil {
+		return nil, err
+	}
+	tools, err := toToolInfos(req.Tools)
+	if err != nil {
+		return nil, err
+	}
+
+	maxTokens := req.MaxTokens
+	if req.MaxCompletionTokens > 0 {
+		maxTokens = req.MaxCompletionTokens
+	}
+	return s.agentSvc.StreamExecuteAgent(ctx, userID, agent.ID, *msg,
+		WithGeneration(req.Temperature, req.TopP, maxTokens),
+		WithClientTools(tools),
+	)
+}
+
+// resolveAgent 按ID或名称查找Agent
+func (s *openAIService) resolveAgent(ctx context.Context, userID uint, idOrName string) (*model.Agent, error) {
+	if agent, err := s.agentSvc.GetAgent(ctx, userID, idOrName); err == nil {
+		return agent, nil
+	}
+	agents, err := s.agentSvc.ListAgents(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, agent := range agents {
+		if agent.Name == idOrName {
+			return agent, nil
+		}
+	}
+	return nil, fmt.Errorf("model %s not found", idOrName)
+}
+
+// toUserMessage 以最后一条用户消息为本轮输入，之前的消息作为历史，之后的工具调用及结果作为ToolMessages
+func toUserMessage(messages []model.ChatCompletionMessage) (*model.UserMessage, error) {
+	last := -1
+	for i := range messages {
+		if messages[i].Role == string(schema.User) {
+			last = i
+		}
+	}
+	if last < 0 {
+		return nil, ErrNoUserMessage
+	}
+
+	msg := &model.UserMessage{Query: messages[last].Content.String()}
+	for i := range messages {
+		if i == last {
+			continue
+		}
+		m, err := toSchemaMessage(&messages[i])
+		if err != nil {
+			return nil, err
+		}
+		if i < last {
+			msg.History = append(msg.History, m)
+		} else {
+			msg.ToolMessages = append(msg.ToolMessages, m)
+		}
+	}
+	return msg, nil
+}
+
+func toSchemaMessage(m *model.ChatCompletionMessage) (*schema.Message, error) {
+	msg := &schema.Message{
+		Content:    m.Content.String(),
+		Name:       m.Name,
+		ToolCallID: m.ToolCallID,
+	}
+	switch m.Role {
+	case "system", "developer":
+		msg.Role = schema.System
+	case "user":
+		msg.Role = schema.User
+	case "assistant":
+		msg.Role = schema.Assistant
+	case "tool":
+		msg.Role = schema.Tool
+	default:
+		return nil, fmt.Errorf("unsupported message role: %s", m.Role)
+	}
+	for _, tc := range m.ToolCalls {
+		msg.ToolCalls = append(msg.ToolCalls, schema.ToolCall{
+			ID:   tc.ID,
+			Type: "function",
+			Function: schema.FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			},
+		})
+	}
+	return msg, nil
+}
+
+// toToolInfos 将请求中的函数定义转换为工具信息，参数为JSON Schema
+func toToolInfos(tools []model.ChatCompletionTool) ([]*schema.ToolInfo, error) {
+	infos := make([]*schema.ToolInfo, 0, len(tools))
+	for _, t := range tools {
+		if t.Type != "" && t.Type != "function" {
+			return nil, fmt.Errorf("unsupported tool type: %s", t.Type)
+		}
+		if t.Function.Name == "" {
+			return nil, errors.New("tool function name is required")
+		}
+		info := &schema.ToolInfo{
+			Name: t.Function.Name,
+			Desc: t.Function.Description,
+		}
+		if len(t.Function.Parameters) > 0 {
+			var params openapi3.Schema
+			if err := json.Unmarshal(t.Function.Parameters, &params); err != nil {
+				return nil, fmt.Errorf("invalid parameters of tool %s: %w", t.Function.Name, err)
+			}
+			info.ParamsOneOf = schema.NewParamsOneOfByOpenAPIV3(&params)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	hisdao "ai-cloud/internal/dao/history"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	// replyRunTTL 回复生成结束后在内存中保留的时间，期间客户端可以重新连接并回放
+	replyRunTTL = 10 * time.Minute
+	// replyRunTimeout 单次回复生成的最长时间
+	replyRunTimeout = 30 * time.Minute
+	// staleReplyAge 超过该时间仍为pending的回复已不可能在任何实例上生成（运行所在实例退出或重启），标记为error
+	staleReplyAge = replyRunTimeout + 5*time.Minute
+	// stopPollInterval 配置了共享协调后端时检查其他实例发来的停止请求的间隔
+	stopPollInterval = time.Second
+)
+
+var (
+	ErrReplyRunNotFound = errors.New("reply run not found or expired")
+	// ErrReplyStopped 回复流因生成被停止而结束
+	ErrReplyStopped = errors.New("reply stopped")
+)
+
+// replyRun 在服务端进行的一次回复生成，与HTTP连接解耦。输出流被完整读取并缓存，
+// 客户端断开不影响生成，之后可以重新连接并从任意位置回放
+type replyRun struct {
+	userID   uint
+	msgID    string
+	convID   string
+	parentID string
+
+	// cancel 取消运行的上下文，生成结束或被停止时调用
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	chunks  []*schema.Message
+	err     error
+	done    bool
+	stopped bool
+	// wake 有新的消息块或运行结束时关闭并替换，唤醒等待中的读者
+	wake chan struct{}
+}
+
+func newReplyRun(userID uint, msgID, convID, parentID string, cancel context.CancelFunc) *replyRun {
+	return &replyRun{
+		userID:   userID,
+		msgID:    msgID,
+		convID:   convID,
+		parentID: parentID,
+		cancel:   cancel,
+		wake:     make(chan struct{}),
+	}
+}
+
+// stop 停止生成：取消运行的上下文，模型请求、工具和MCP调用随之结束
+func (r *replyRun) stop() {
+	r.mu.Lock()
+	if r.done {
+		r.mu.Unlock()
+		return
+	}
+	r.stopped = true
+	r.mu.Unlock()
+	r.cancel()
+}
+
+func (r *replyRun) isStopped() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stopped
+}
+
+func (r *replyRun) isDone() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.done
+}
+
+func (r *replyRun) append(chunk *schema.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chunks = append(r.chunks, chunk)
+	close(r.wake)
+	r.wake = make(chan struct{})
+}
+
+// finish 结束运行，err为运行出错时的错误
+func (r *replyRun) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done, r.err = true, err
+	close(r.wake)
+	r.wake = make(chan struct{})
+}
+
+// reader 从头读取已缓存和之后产生的消息块，直到运行结束。读者关闭只停止读取，不影响生成
+func (r *replyRun) reader() *schema.StreamReader[*schema.Message] {
+	sr, sw := schema.Pipe[*schema.Message](16)
+	go func() {
+		defer sw.Close()
+		for next := 0; ; {
+			r.mu.Lock()
+			chunks, done, err, wake := r.chunks[next:], r.done, r.err, r.wake
+			r.mu.Unlock()
+
+			for _, chunk := range chunks {
+				if closed := sw.Send(chunk, nil); closed {
+					return
+				}
+				next++
+			}
+			if done {
+				if err != nil {
+					sw.Send(nil, err)
+				}
+				return
+			}
+			<-wake
+		}
+	}()
+	return sr
+}
+
+// replyRuns 进行中和刚结束的回复生成，按助手回复的消息ID索引。
+// stops不为nil时（配置了共享协调后端）定期读取其他实例发来的停止请求
+type replyRuns struct {
+	mu    sync.Mutex
+	runs  map[string]*replyRun
+	stops hisdao.StopDao
+}
+
+func newReplyRuns(stops hisdao.StopDao) *replyRuns {
+	rs := &replyRuns{runs: make(map[string]*replyRun), stops: stops}
+	if stops != nil {
+		go rs.watchStops()
+	}
+	return rs
+}
+
+// requestStop 通过共享协调后端请求停止运行在其他实例上的生成，没有配置时返回false
+func (rs *replyRuns) requestStop(ctx context.Context, msgID string) (bool, error) {
+	if rs.stops == nil {
+		return false, nil
+	}
+	return true, rs.stops.Create(ctx, msgID)
+}
+
+// watchStops 轮询停止请求，停止本实例上对应的运行，并清理过期的请求
+func (rs *replyRuns) watchStops() {
+	ctx := context.Background()
+	ticker := time.NewTicker(stopPollInterval)
+	defer ticker.Stop()
+	purged := time.Now()
+	for now := range ticker.C {
+		// 运行最长replyRunTimeout，更早的请求对应的运行已经结束
+		if now.Sub(purged) > time.Minute {
+			_ = rs.stops.DeleteBefore(ctx, now.Add(-replyRunTimeout).Unix())
+			purged = now
+		}
+
+		active := rs.active()
+		if len(active) == 0 {
+			continue
+		}
+		ids := make([]string, 0, len(active))
+		for id := range active {
+			ids = append(ids, id)
+		}
+		requested, err := rs.stops.ListRequested(ctx, ids)
+		if err != nil {
+			log.Printf("[ReplyRuns] 读取停止请求失败: %v", err)
+			continue
+		}
+		if len(requested) == 0 {
+			continue
+		}
+		for _, id := range requested {
+			active[id].stop()
+		}
+		_ = rs.stops.Delete(ctx, requested)
+	}
+}
+
+// active 本实例上仍在生成的运行
+func (rs *replyRuns) active() map[string]*replyRun {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	active := make(map[string]*replyRun)
+	for id, run := range rs.runs {
+		if !run.isDone() {
+			active[id] = run
+		}
+	}
+	return active
+}
+
+func (rs *replyRuns) add(run *replyRun) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.runs[run.msgID] = run
+}
+
+func (rs *replyRuns) get(msgID string) (*replyRun, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	run, ok := rs.runs[msgID]
+	return run, ok
+}
+
+// expire 在ttl后移除运行
+func (rs *replyRuns) expire(msgID string, ttl time.Duration) {
+	time.AfterFunc(ttl, func() {
+		rs.mu.Lock()
+		defer rs.mu.Unlock()
+		delete(rs.runs, msgID)
+	})
+}
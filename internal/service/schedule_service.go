@@ -0,0 +1,453 @@
+package service
+
+import (
+	"ai-cloud/internal/dao"
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/utils"
+	"ai-cloud/pkgs/stream"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	// 内嵌时区数据，部署环境缺少系统时区数据库时也能解析时区
+	_ "time/tzdata"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// schedulePollInterval 调度器检查到期任务的间隔
+	schedulePollInterval = 15 * time.Second
+	// scheduleMinInterval 两次运行之间的最短间隔
+	scheduleMinInterval = time.Minute
+	// scheduleMaxConcurrent 本实例同时进行的定时运行数量
+	scheduleMaxConcurrent = 4
+	// scheduleStaleAfter 超过该时间仍为running的运行记录视为所在实例已退出
+	scheduleStaleAfter = replyRunTimeout + 5*time.Minute
+	// scheduleOutputPreview 运行记录中保存的回复长度（字符）
+	scheduleOutputPreview = 1000
+	webhookTimeout        = 10 * time.Second
+)
+
+var (
+	ErrScheduleRunPaused = errors.New("run is waiting for tool approval")
+	// ErrSchedulerStopped 调度器停止时进行中的运行被中断
+	ErrSchedulerStopped = errors.New("scheduler stopped")
+)
+
+type ScheduleService interface {
+	CreateSchedule(ctx context.Context, userID uint, req *model.CreateScheduleRequest) (*model.AgentSchedule, error)
+	UpdateSchedule(ctx context.Context, userID uint, req *model.UpdateScheduleRequest) (*model.AgentSchedule, error)
+	DeleteSchedule(ctx context.Context, userID uint, id string) error
+	ListSchedules(ctx context.Context, userID uint, agentID string) ([]*model.AgentSchedule, error)
+	PageRuns(ctx context.Context, userID uint, scheduleID string, page, size int) ([]*model.ScheduleRun, int64, error)
+	// TriggerSchedule 立即运行一次，不影响下次定时运行的时间。运行在后台进行，返回运行记录
+	TriggerSchedule(ctx context.Context, userID uint, id string) (*model.ScheduleRun, error)
+	// Start 启动调度器，ctx取消后停止
+	Start(ctx context.Context)
+	// Stop 停止调度器，中断进行中的运行并等待其保存运行记录
+	Stop()
+}
+
+type scheduleService struct {
+	dao        dao.ScheduleDao
+	agentSvc   AgentService
+	historySvc HistoryService
+	convSvc    ConversationService
+	httpClient *http.Client
+	// sem 限制本实例同时进行的运行数量
+	sem chan struct{}
+
+	// ctx 调度器的生命周期，所有运行都由它派生，停止时取消
+	ctx    context.Context
+	cancel context.CancelFunc
+	// running 进行中的运行，停止时等待它们结束
+	running sync.WaitGroup
+}
+
+func NewScheduleService(dao dao.ScheduleDao, agentSvc AgentService, historySvc HistoryService, convSvc ConversationService) ScheduleService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &scheduleService{
+		dao:        dao,
+		agentSvc:   agentSvc,
+		historySvc: historySvc,
+		convSvc:    convSvc,
+		// Webhook地址由用户配置，只允许访问公网地址
+		httpClient: utils.NewGuardedHTTPClient(webhookTimeout),
+		sem:        make(chan struct{}, scheduleMaxConcurrent),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// validateWebhookURL Webhook只能是http或https的公网地址
+func validateWebhookURL(webhookURL string) error {
+	if webhookURL == "" {
+		return nil
+	}
+	if err := utils.ValidatePublicURL(webhookURL); err != nil {
+		return fmt.Errorf("invalid webhook url: %w", err)
+	}
+	return nil
+}
+
+// parseSchedule 解析cron表达式和时区，时区为空时使用UTC。时区只能通过timezone指定
+func parseSchedule(expr, timezone string) (cron.Schedule, *time.Location, error) {
+	if strings.Contains(expr, "TZ=") {
+		return nil, nil, errors.New("set the time zone with the timezone field instead of the cron expression")
+	}
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid timezone: %s", timezone)
+	}
+	sched, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cron expression: %w", err)
+	}
+	return sched, loc, nil
+}
+
+// nextRunAt 计算after之后的下次运行时间
+func nextRunAt(expr, timezone string, after time.Time) (int64, error) {
+	sched, loc, err := parseSchedule(expr, timezone)
+	if err != nil {
+		return 0, err
+	}
+	next := sched.Next(after.In(loc))
+	if next.IsZero() {
+		return 0, errors.New("cron expression never fires")
+	}
+	if sched.Next(next).Sub(next) < scheduleMinInterval {
+		return 0, fmt.Errorf("schedule must not run more often than every %s", scheduleMinInterval)
+	}
+	return next.Unix(), nil
+}
+
+// CreateSchedule 创建定时任务。指定的会话必须属于该Agent，未指定时创建一个以任务名命名的会话
+func (s *scheduleService) CreateSchedule(ctx context.Context, userID uint, req *model.CreateScheduleRequest) (*model.AgentSchedule, error) {
+	if _, err := s.agentSvc.GetAgent(ctx, userID, req.AgentID); err != nil {
+		return nil, err
+	}
+	if err := validateWebhookURL(req.WebhookURL); err != nil {
+		return nil, err
+	}
+	next, err := nextRunAt(req.CronExpr, req.Timezone, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	convID := req.ConvID
+	if convID != "" {
+		conv, err := s.historySvc.GetConversation(ctx, convID)
+		if err != nil || conv.UserID != userID || conv.AgentID != req.AgentID {
+			return nil, errors.New("conversation not found or does not belong to the agent")
+		}
+	} else {
+		convID, err = s.convSvc.CreateConversation(ctx, userID, req.AgentID, false)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.convSvc.RenameConversation(ctx, userID, convID, req.Name); err != nil {
+			log.Printf("[Schedule] 设置会话标题失败: %v", err)
+		}
+	}
+
+	schedule := &model.AgentSchedule{
+		ID:         uuid.NewString(),
+		UserID:     userID,
+		AgentID:    req.AgentID,
+		Name:       req.Name,
+		CronExpr:   req.CronExpr,
+		Timezone:   req.Timezone,
+		Message:    req.Message,
+		ConvID:     convID,
+		WebhookURL: req.WebhookURL,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+		NextRunAt:  next,
+	}
+	if err := s.dao.Create(ctx, schedule); err != nil {
+		return nil, fmt.Errorf("failed to create schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// UpdateSchedule 更新定时任务并重新计算下次运行时间
+func (s *scheduleService) UpdateSchedule(ctx context.Context, userID uint, req *model.UpdateScheduleRequest) (*model.AgentSchedule, error) {
+	schedule, err := s.dao.GetByID(ctx, userID, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWebhookURL(req.WebhookURL); err != nil {
+		return nil, err
+	}
+	next, err := nextRunAt(req.CronExpr, req.Timezone, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	schedule.Name = req.Name
+	schedule.CronExpr = req.CronExpr
+	schedule.Timezone = req.Timezone
+	schedule.Message = req.Message
+	schedule.WebhookURL = req.WebhookURL
+	schedule.Enabled = req.Enabled
+	schedule.NextRunAt = next
+	if err := s.dao.Update(ctx, schedule); err != nil {
+		return nil, fmt.Errorf("failed to update schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// DeleteSchedule 删除定时任务及其运行记录，会话保留
+func (s *scheduleService) DeleteSchedule(ctx context.Context, userID uint, id string) error {
+	return s.dao.Delete(ctx, userID, id)
+}
+
+func (s *scheduleService) ListSchedules(ctx context.Context, userID uint, agentID string) ([]*model.AgentSchedule, error) {
+	return s.dao.List(ctx, userID, agentID)
+}
+
+func (s *scheduleService) PageRuns(ctx context.Context, userID uint, scheduleID string, page, size int) ([]*model.ScheduleRun, int64, error) {
+	return s.dao.PageRuns(ctx, userID, scheduleID, page, size)
+}
+
+func (s *scheduleService) TriggerSchedule(ctx context.Context, userID uint, id string) (*model.ScheduleRun, error) {
+	schedule, err := s.dao.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.ctx.Err() != nil {
+		return nil, ErrSchedulerStopped
+	}
+	run, err := s.newRun(ctx, schedule, model.ScheduleTriggerManual)
+	if err != nil {
+		return nil, err
+	}
+	s.spawn(schedule, run)
+	return run, nil
+}
+
+// Start 启动调度器。每个实例都会轮询到期的任务，运行前通过条件更新next_run_at抢占，
+// 抢占成功的实例才会运行，因此多实例部署时同一次运行只会执行一次。
+// 服务停机期间错过的多次运行在恢复后只补运行一次
+func (s *scheduleService) Start(ctx context.Context) {
+	context.AfterFunc(ctx, s.cancel)
+	go func() {
+		ticker := time.NewTicker(schedulePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				s.poll(s.ctx)
+			}
+		}
+	}()
+}
+
+func (s *scheduleService) Stop() {
+	s.cancel()
+	s.running.Wait()
+}
+
+// spawn 在后台运行，停止调度器时等待其结束
+func (s *scheduleService) spawn(schedule *model.AgentSchedule, run *model.ScheduleRun) {
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		s.execute(s.ctx, schedule, run)
+	}()
+}
+
+func (s *scheduleService) poll(ctx context.Context) {
+	now := time.Now()
+	if err := s.dao.FailStaleRuns(ctx, now.Add(-scheduleStaleAfter), "run interrupted"); err != nil {
+		log.Printf("[Schedule] 清理中断的运行失败: %v", err)
+	}
+
+	due, err := s.dao.ListDue(ctx, now.Unix(), 100)
+	if err != nil {
+		log.Printf("[Schedule] 获取到期任务失败: %v", err)
+		return
+	}
+	for _, schedule := range due {
+		next, err := nextRunAt(schedule.CronExpr, schedule.Timezone, now)
+		if err != nil {
+			// 表达式在创建时已校验，出错时停止调度该任务
+			log.Printf("[Schedule %s] 计算下次运行时间失败: %v", schedule.ID, err)
+			next = 0
+		}
+		ok, err := s.dao.Claim(ctx, schedule.ID, schedule.NextRunAt, next, now.Unix())
+		if err != nil {
+			log.Printf("[Schedule %s] 抢占运行失败: %v", schedule.ID, err)
+			continue
+		}
+		if !ok {
+			// 已被其他实例抢占，或任务在此期间被修改
+			continue
+		}
+		run, err := s.newRun(ctx, schedule, model.ScheduleTriggerCron)
+		if err != nil {
+			log.Printf("[Schedule %s] 创建运行记录失败: %v", schedule.ID, err)
+			continue
+		}
+		s.spawn(schedule, run)
+	}
+}
+
+func (s *scheduleService) newRun(ctx context.Context, schedule *model.AgentSchedule, trigger string) (*model.ScheduleRun, error) {
+	run := &model.ScheduleRun{
+		ID:         uuid.NewString(),
+		ScheduleID: schedule.ID,
+		UserID:     schedule.UserID,
+		Trigger:    trigger,
+		Status:     model.ScheduleRunRunning,
+		ConvID:     schedule.ConvID,
+		StartedAt:  time.Now(),
+	}
+	if err := s.dao.CreateRun(ctx, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// execute 在会话中运行Agent并等待回复生成结束，保存运行结果后调用Webhook。
+// ctx取消（调度器停止）时停止回复生成，运行记录为失败，记录和Webhook仍会完成
+func (s *scheduleService) execute(ctx context.Context, schedule *model.AgentSchedule, run *model.ScheduleRun) {
+	var (
+		output string
+		err    error
+	)
+	select {
+	case s.sem <- struct{}{}:
+		output, err = s.runAgent(ctx, schedule, run)
+		<-s.sem
+	case <-ctx.Done():
+	}
+	if ctx.Err() != nil {
+		err = ErrSchedulerStopped
+	}
+	// 运行记录和Webhook不受调度器停止的影响
+	ctx = context.WithoutCancel(ctx)
+
+	switch {
+	case errors.Is(err, ErrScheduleRunPaused):
+		run.Status = model.ScheduleRunPaused
+	case err != nil:
+		run.Status = model.ScheduleRunFailed
+		run.Error = err.Error()
+	default:
+		run.Status = model.ScheduleRunSuccess
+	}
+	if runes := []rune(output); len(runes) > scheduleOutputPreview {
+		run.Output = string(runes[:scheduleOutputPreview])
+	} else {
+		run.Output = output
+	}
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+
+	if schedule.WebhookURL != "" {
+		run.WebhookStatus, err = s.postWebhook(ctx, schedule, run, output)
+		if err != nil {
+			run.WebhookError = err.Error()
+		}
+	}
+
+	if err := s.dao.FinishRun(ctx, run); err != nil {
+		log.Printf("[Schedule %s] 保存运行记录失败: %v", schedule.ID, err)
+	}
+	if err := s.dao.SetLastStatus(ctx, schedule.ID, run.Status); err != nil {
+		log.Printf("[Schedule %s] 更新任务状态失败: %v", schedule.ID, err)
+	}
+}
+
+// runAgent 读取完整的回复流，返回回复内容。运行因等待工具审批暂停时返回ErrScheduleRunPaused
+func (s *scheduleService) runAgent(ctx context.Context, schedule *model.AgentSchedule, run *model.ScheduleRun) (string, error) {
+	sr, msgID, _, err := s.convSvc.StreamAgentWithConversation(ctx, schedule.UserID, schedule.AgentID, schedule.ConvID, schedule.Message, nil)
+	if err != nil {
+		return "", err
+	}
+	defer sr.Close()
+	run.MsgID = msgID
+	// 回复在服务端独立生成，ctx取消时需要主动停止，已生成的部分保存为回复，回复流随之结束
+	stop := context.AfterFunc(ctx, func() {
+		if err := s.convSvc.StopReply(context.WithoutCancel(ctx), schedule.UserID, schedule.ConvID, msgID); err != nil {
+			log.Printf("[Schedule %s] 停止回复失败: %v", schedule.ID, err)
+		}
+	})
+	defer stop()
+
+	var (
+		sb     strings.Builder
+		paused bool
+	)
+	for {
+		chunk, err := sr.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return sb.String(), err
+		}
+		if e, ok := IsStreamEvent(chunk); ok {
+			paused = paused || e.Type == stream.EventApprovalRequest
+		}
+		if isEventMessage(chunk) {
+			continue
+		}
+		sb.WriteString(chunk.Content)
+	}
+	if paused {
+		return sb.String(), ErrScheduleRunPaused
+	}
+	return sb.String(), nil
+}
+
+// postWebhook 将运行结果POST到Webhook，返回响应的状态码，非2xx视为失败
+func (s *scheduleService) postWebhook(ctx context.Context, schedule *model.AgentSchedule, run *model.ScheduleRun, output string) (int, error) {
+	payload := &model.ScheduleWebhookPayload{
+		ScheduleID:   schedule.ID,
+		ScheduleName: schedule.Name,
+		AgentID:      schedule.AgentID,
+		RunID:        run.ID,
+		Trigger:      run.Trigger,
+		Status:       run.Status,
+		ConvID:       run.ConvID,
+		MsgID:        run.MsgID,
+		Output:       output,
+		Error:        run.Error,
+		StartedAt:    run.StartedAt,
+		FinishedAt:   *run.FinishedAt,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, schedule.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook url: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"ai-cloud/internal/dao"
+	hisdao "ai-cloud/internal/dao/history"
+	"ai-cloud/internal/model"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrShareNotFound       = errors.New("share not found, revoked or expired")
+	ErrShareOriginDenied   = errors.New("origin not allowed by share")
+	ErrSharePassword       = errors.New("invalid share password")
+	ErrShareVisitor        = errors.New("invalid visitor or conversation")
+	ErrShareRateLimited    = errors.New("too many requests, please retry later")
+	ErrShareMessageLimit   = errors.New("message limit reached for this visitor")
+	ErrShareConvLimit      = errors.New("conversation limit reached for this share")
+	ErrShareAgentDraftOnly = errors.New("agent must be published before sharing")
+)
+
+type ShareService interface {
+	// 分享管理（分享者）
+	CreateShare(ctx context.Context, userID uint, req *model.CreateShareRequest) (*model.AgentShare, error)
+	ListShares(ctx context.Context, userID uint, agentID string) ([]*model.AgentShare, error)
+	RevokeShare(ctx context.Context, userID uint, id string) error
+	ListVisitorConversations(ctx context.Context, userID uint, shareID string, page, size int) ([]*model.Conversation, int64, error)
+
+	// 公开接口（访客），origin为请求的Origin头，clientIP用于按来源IP限流
+	GetShareInfo(ctx context.Context, token, origin string) (*model.ShareInfo, error)
+	CreateVisitorConversation(ctx context.Context, token, origin, clientIP, visitorID, password string) (*model.CreateShareConvResponse, error)
+	StreamVisitorConversation(ctx context.Context, token, origin, clientIP, visitorID, convID, message string) (*schema.StreamReader[*schema.Message], string, string, error)
+	GetVisitorHistory(ctx context.Context, token, origin, visitorID, convID string, limit int) ([]*schema.Message, error)
+}
+
+type shareService struct {
+	dao        dao.ShareDao
+	convDao    hisdao.ConvDao
+	agentSvc   AgentService
+	historySvc HistoryService
+	convSvc    ConversationService
+	limiter    *visitorLimiter
+}
+
+func NewShareService(dao dao.ShareDao, convDao hisdao.ConvDao, agentSvc AgentService, historySvc HistoryService, convSvc ConversationService) ShareService {
+	return &shareService{
+		dao:        dao,
+		convDao:    convDao,
+		agentSvc:   agentSvc,
+		historySvc: historySvc,
+		convSvc:    convSvc,
+		limiter:    newVisitorLimiter(time.Minute),
+	}
+}
+
+// CreateShare 创建分享链接，只有已发布的Agent可以分享，访客始终使用最新发布的版本
+func (s *shareService) CreateShare(ctx context.Context, userID uint, req *model.CreateShareRequest) (*model.AgentShare, error) {
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("expires_at must be in the future")
+	}
+	agent, err := s.agentSvc.GetAgent(ctx, userID, req.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	if agent.PublishedVersion == 0 {
+		return nil, ErrShareAgentDraftOnly
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate share token: %w", err)
+	}
+	share := &model.AgentShare{
+		ID:               uuid.NewString(),
+		Token:            hex.EncodeToString(buf),
+		UserID:           userID,
+		AgentID:          agent.ID,
+		Name:             req.Name,
+		RateLimit:        req.RateLimit,
+		MaxMessages:      req.MaxMessages,
+		ShareRateLimit:   req.ShareRateLimit,
+		MaxConversations: req.MaxConversations,
+		ExpiresAt:        req.ExpiresAt,
+	}
+	if share.Name == "" {
+		share.Name = agent.Name
+	}
+	for _, origin := range req.AllowedOrigins {
+		share.AllowedOrigins = append(share.AllowedOrigins, normalizeOrigin(origin))
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash share password: %w", err)
+		}
+		share.PasswordHash = string(hash)
+		share.HasPassword = true
+	}
+
+	if err := s.dao.Create(ctx, share); err != nil {
+		return nil, fmt.Errorf("failed to create share: %w", err)
+	}
+	return share, nil
+}
+
+func (s *shareService) ListShares(ctx context.Context, userID uint, agentID string) ([]*model.AgentShare, error) {
+	return s.dao.List(ctx, userID, agentID)
+}
+
+func (s *shareService) RevokeShare(ctx context.Context, userID uint, id string) error {
+	return s.dao.Revoke(ctx, userID, id, time.Now())
+}
+
+// ListVisitorConversations 分页获取分享链接下的访客会话，消息可通过 /chat/history 查看
+func (s *shareService) ListVisitorConversations(ctx context.Context, userID uint, shareID string, page, size int) ([]*model.Conversation, int64, error) {
+	if _, err := s.dao.GetByID(ctx, userID, shareID); err != nil {
+		return nil, 0, err
+	}
+	return s.convDao.PageByShare(ctx, userID, shareID, page, size)
+}
+
+func (s *shareService) GetShareInfo(ctx context.Context, token, origin string) (*model.ShareInfo, error) {
+	share, err := s.getActiveShare(ctx, token, origin)
+	if err != nil {
+		return nil, err
+	}
+	agent, err := s.agentSvc.GetAgent(ctx, share.UserID, share.AgentID)
+	if err != nil {
+		return nil, ErrShareNotFound
+	}
+	return &model.ShareInfo{
+		Name:             share.Name,
+		AgentName:        agent.Name,
+		AgentDescription: agent.Description,
+		PasswordRequired: share.HasPassword,
+	}, nil
+}
+
+// CreateVisitorConversation 为访客创建会话。未携带访客ID（或访客ID无效）时校验密码并分配新的访客ID。
+// 访客ID可以随意重新获取，因此会话创建按来源IP限流，并受分享的会话总数上限约束
+func (s *shareService) CreateVisitorConversation(ctx context.Context, token, origin, clientIP, visitorID, password string) (*model.CreateShareConvResponse, error) {
+	share, err := s.getActiveShare(ctx, token, origin)
+	if err != nil {
+		return nil, err
+	}
+	if share.MaxConversations > 0 {
+		n, err := s.convDao.CountByShare(ctx, share.ID)
+		if err != nil {
+			return nil, err
+		}
+		if n >= int64(share.MaxConversations) {
+			return nil, ErrShareConvLimit
+		}
+	}
+	if !s.limiter.Allow(limitRule{share.ID + ":conv-ip:" + clientIP, visitorConvsPerMinute}) {
+		return nil, ErrShareRateLimited
+	}
+
+	known := false
+	if visitorID != "" {
+		n, err := s.convDao.CountByVisitor(ctx, share.ID, visitorID)
+		if err != nil {
+			return nil, err
+		}
+		known = n > 0
+	}
+	if !known {
+		if share.HasPassword && bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)) != nil {
+			return nil, ErrSharePassword
+		}
+		visitorID = uuid.NewString()
+	}
+
+	now := time.Now().Unix()
+	conv := &model.Conversation{
+		ConvID:    uuid.NewString(),
+		UserID:    share.UserID,
+		AgentID:   share.AgentID,
+		Title:     defaultConvTitle,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ShareID:   share.ID,
+		VisitorID: visitorID,
+	}
+	if err := s.historySvc.CreateConversation(ctx, conv); err != nil {
+		return nil, err
+	}
+	return &model.CreateShareConvResponse{ConvID: conv.ConvID, VisitorID: visitorID}, nil
+}
+
+// StreamVisitorConversation 访客发送消息，依次检查会话归属、消息总数上限和频率限制。
+// 频率限制同时按访客、来源IP和整个分享计数，避免通过更换访客ID绕过
+func (s *shareService) StreamVisitorConversation(ctx context.Context, token, origin, clientIP, visitorID, convID, message string) (*schema.StreamReader[*schema.Message], string, string, error) {
+	share, err := s.getActiveShare(ctx, token, origin)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if err := s.checkVisitorConv(ctx, share, visitorID, convID); err != nil {
+		return nil, "", "", err
+	}
+	if share.MaxMessages > 0 {
+		n, err := s.convDao.CountVisitorMessages(ctx, share.ID, visitorID)
+		if err != nil {
+			return nil, "", "", err
+		}
+		if n >= int64(share.MaxMessages) {
+			return nil, "", "", ErrShareMessageLimit
+		}
+	}
+	allowed := s.limiter.Allow(
+		limitRule{share.ID + ":visitor:" + visitorID, share.RateLimit},
+		limitRule{share.ID + ":ip:" + clientIP, share.RateLimit},
+		limitRule{share.ID, share.ShareRateLimit},
+	)
+	if !allowed {
+		return nil, "", "", ErrShareRateLimited
+	}
+
+	return s.convSvc.StreamAgentWithConversation(ctx, share.UserID, share.AgentID, convID, message, nil)
+}
+
+func (s *shareService) GetVisitorHistory(ctx context.Context, token, origin, visitorID, convID string, limit int) ([]*schema.Message, error) {
+	share, err := s.getActiveShare(ctx, token, origin)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkVisitorConv(ctx, share, visitorID, convID); err != nil {
+		return nil, err
+	}
+	return s.convSvc.GetConversationHistory(ctx, convID, limit)
+}
+
+// getActiveShare 获取可用的分享并校验请求来源
+func (s *shareService) getActiveShare(ctx context.Context, token, origin string) (*model.AgentShare, error) {
+	share, err := s.dao.GetByToken(ctx, token)
+	if err != nil || !share.Active(time.Now()) {
+		return nil, ErrShareNotFound
+	}
+	if len(share.AllowedOrigins) > 0 {
+		origin = normalizeOrigin(origin)
+		allowed := false
+		for _, o := range share.AllowedOrigins {
+			if o == origin {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, ErrShareOriginDenied
+		}
+	}
+	return share, nil
+}
+
+// checkVisitorConv 校验会话属于该分享下的该访客
+func (s *shareService) checkVisitorConv(ctx context.Context, share *model.AgentShare, visitorID, convID string) error {
+	if visitorID == "" {
+		return ErrShareVisitor
+	}
+	conv, err := s.convDao.GetByID(ctx, convID)
+	if err != nil || conv.ShareID != share.ID || conv.VisitorID != visitorID {
+		return ErrShareVisitor
+	}
+	return nil
+}
+
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
+
+// visitorConvsPerMinute 同一IP每分钟在一个分享下最多创建的会话数
+const visitorConvsPerMinute = 10
+
+// visitorLimiter 按key统计滑动窗口内的请求数，仅在内存中计数，多实例部署时各实例独立限流
+type visitorLimiter struct {
+	window time.Duration
+	mu     sync.Mutex
+	hits   map[string][]time.Time
+}
+
+func newVisitorLimiter(window time.Duration) *visitorLimiter {
+	return &visitorLimiter{window: window, hits: make(map[string][]time.Time)}
+}
+
+// limitRule 一条限流规则，limit<=0表示不限制
+type limitRule struct {
+	key   string
+	limit int
+}
+
+// Allow 判断所有规则在窗口内是否都还能再请求一次，全部允许时才为每个key记录本次请求
+func (l *visitorLimiter) Allow(rules ...limitRule) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-l.window)
+	// 记录过多时顺带清理已过窗口的key
+	if len(l.hits) > 10000 {
+		for k, ts := range l.hits {
+			if len(ts) == 0 || ts[len(ts)-1].Before(cutoff) {
+				delete(l.hits, k)
+			}
+		}
+	}
+
+	allowed := true
+	for _, r := range rules {
+		if r.limit <= 0 {
+			continue
+		}
+		ts := l.hits[r.key]
+		i := 0
+		for i < len(ts) && ts[i].Before(cutoff) {
+			i++
+		}
+		l.hits[r.key] = ts[i:]
+		if len(ts)-i >= r.limit {
+			allowed = false
+		}
+	}
+	if !allowed {
+		return false
+	}
+	for _, r := range rules {
+		if r.limit > 0 {
+			l.hits[r.key] = append(l.hits[r.key], now)
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"ai-cloud/internal/dao"
+	"ai-cloud/internal/model"
+	"context"
+)
+
+type TraceService interface {
+	GetTrace(ctx context.Context, userID uint, traceID string) (*model.TraceDetail, error)
+	// GetTraceByMessage 获取生成该助手消息的运行记录
+	GetTraceByMessage(ctx context.Context, userID uint, msgID string) (*model.TraceDetail, error)
+	PageTraces(ctx context.Context, userID uint, agentID string, page, size int) ([]*model.Trace, int64, error)
+}
+
+type traceService struct {
+	dao dao.TraceDao
+}
+
+func NewTraceService(dao dao.TraceDao) TraceService {
+	return &traceService{dao: dao}
+}
+
+func (s *traceService) GetTrace(ctx context.Context, userID uint, traceID string) (*model.TraceDetail, error) {
+	trace, err := s.dao.GetByID(ctx, userID, traceID)
+	if err != nil {
+		return nil, err
+	}
+	return s.detail(ctx, trace)
+}
+
+func (s *traceService) GetTraceByMessage(ctx context.Context, userID uint, msgID string) (*model.TraceDetail, error) {
+	trace, err := s.dao.GetByMsgID(ctx, userID, msgID)
+	if err != nil {
+		return nil, err
+	}
+	return s.detail(ctx, trace)
+}
+
+func (s *traceService) PageTraces(ctx context.Context, userID uint, agentID string, page, size int) ([]*model.Trace, int64, error) {
+	return s.dao.Page(ctx, userID, agentID, page, size)
+}
+
+func (s *traceService) detail(ctx context.Context, trace *model.Trace) (*model.TraceDetail, error) {
+	spans, err := s.dao.ListSpans(ctx, trace.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.TraceDetail{Trace: trace, Spans: spans}, nil
+}
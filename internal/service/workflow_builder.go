@@ -0,0 +1,611 @@
+package service
+
+import (
+	llmfactory "ai-cloud/internal/component/llm"
+	mretriever "ai-cloud/internal/component/retriever/milvus"
+	"ai-cloud/internal/component/workflow"
+	"ai-cloud/internal/model"
+	"ai-cloud/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	WorkflowInput  = "WorkflowInput"
+	WorkflowGraph  = "Workflow"
+	WorkflowOutput = "WorkflowOutput"
+
+	workflowStartKey = "__start"
+	workflowEndKey   = "__end"
+
+	defaultLoopIterations = 20
+	maxLoopIterations     = 100
+	defaultHTTPTimeout    = 30 * time.Second
+	maxHTTPResponseSize   = 1 << 20
+)
+
+// workflowState 工作流运行时的共享变量，节点输出以节点ID为key写入Vars
+type workflowState struct {
+	Vars  map[string]any
+	Nodes []model.WorkflowNodeOutput
+}
+
+// workflowResult 工作流子图的输出
+type workflowResult struct {
+	Output string
+	Nodes  []model.WorkflowNodeOutput
+}
+
+// nodeExecutor 执行单个工作流节点，vars为当前所有变量的快照
+type nodeExecutor func(ctx context.Context, vars map[string]any) (map[string]any, error)
+
+// buildWorkflow 将工作流定义编译为与简单Agent相同输入输出的Graph
+func (s *agentService) buildWorkflow(ctx context.Context, userID uint, wf *model.WorkflowSchema, o *ExecuteOptions) (*compose.Graph[*model.UserMessage, *schema.Message], error) {
+	if err := workflow.Validate(wf); err != nil {
+		return nil, fmt.Errorf("invalid workflow: %w", err)
+	}
+
+	inner, err := s.buildWorkflowGraph(ctx, userID, wf)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := compose.NewGraph[*model.UserMessage, *schema.Message]()
+	_ = graph.AddLambdaNode(WorkflowInput, compose.InvokableLambda(func(ctx context.Context, input *model.UserMessage) (map[string]any, error) {
+		return map[string]any{
+			model.WorkflowStartNode: map[string]any{
+				"query":   input.Query,
+				"history": input.History,
+				"date":    time.Now().Format(time.DateTime),
+			},
+		}, nil
+	}), compose.WithNodeName("UserMessageToVars"))
+	_ = graph.AddGraphNode(WorkflowGraph, inner, compose.WithGraphCompileOptions(compose.WithNodeTriggerMode(compose.AllPredecessor)))
+	_ = graph.AddLambdaNode(WorkflowOutput, compose.InvokableLambda(func(ctx context.Context, result *workflowResult) (*schema.Message, error) {
+		msg := schema.AssistantMessage(result.Output, nil)
+		if o.Debug {
+			msg.Extra = map[string]any{"node_outputs": result.Nodes}
+		}
+		return msg, nil
+	}), compose.WithNodeName("ResultToMessage"))
+
+	_ = graph.AddEdge(compose.START, WorkflowInput)
+	_ = graph.AddEdge(WorkflowInput, WorkflowGraph)
+	_ = graph.AddEdge(WorkflowGraph, WorkflowOutput)
+	_ = graph.AddEdge(WorkflowOutput, compose.END)
+	return graph, nil
+}
+
+// buildWorkflowGraph 构建工作流子图：输入为初始变量，输出为渲染后的结果。
+// 节点之间的连线只负责触发顺序，数据统一通过workflowState共享。
+func (s *agentService) buildWorkflowGraph(ctx context.Context, userID uint, wf *model.WorkflowSchema) (*compose.Graph[map[string]any, *workflowResult], error) {
+	graph := compose.NewGraph[map[string]any, *workflowResult](
+		compose.WithGenLocalState(func(ctx context.Context) *workflowState {
+			return &workflowState{Vars: map[string]any{}}
+		}),
+	)
+
+	// 开始节点：将输入变量写入状态
+	_ = graph.AddLambdaNode(workflowStartKey, compose.InvokableLambda(func(ctx context.Context, input map[string]any) (map[string]any, error) {
+		err := compose.ProcessState[*workflowState](ctx, func(_ context.Context, st *workflowState) error {
+			for k, v := range input {
+				st.Vars[k] = v
+			}
+			return nil
+		})
+		return map[string]any{model.WorkflowStartNode: input[model.WorkflowStartNode]}, err
+	}), compose.WithNodeName("Start"))
+
+	// 结束节点：渲染最终输出
+	_ = graph.AddLambdaNode(workflowEndKey, compose.InvokableLambda(func(ctx context.Context, _ map[string]any) (*workflowResult, error) {
+		result := &workflowResult{}
+		err := compose.ProcessState[*workflowState](ctx, func(_ context.Context, st *workflowState) error {
+			result.Nodes = st.Nodes
+			if wf.Output != "" {
+				out, err := workflow.Render(wf.Output, st.Vars)
+				result.Output = out
+				return err
+			}
+			// 未配置输出模板时，使用最后一个执行节点的输出
+			if len(st.Nodes) > 0 {
+				result.Output = defaultNodeText(st.Nodes[len(st.Nodes)-1].Output)
+			}
+			return nil
+		})
+		return result, err
+	}), compose.WithNodeName("End"))
+
+	for i := range wf.Nodes {
+		node := &wf.Nodes[i]
+		exec, err := s.buildNodeExecutor(ctx, userID, node)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build node %q: %w", node.ID, err)
+		}
+		if err := graph.AddLambdaNode(node.ID, compose.InvokableLambda(wrapNodeExecutor(node, exec)), compose.WithNodeName(nodeDisplayName(node))); err != nil {
+			return nil, err
+		}
+	}
+
+	_ = graph.AddEdge(compose.START, workflowStartKey)
+	_ = graph.AddEdge(workflowEndKey, compose.END)
+	for _, e := range wf.Edges {
+		if err := graph.AddEdge(workflowKey(e.From), workflowKey(e.To)); err != nil {
+			return nil, err
+		}
+	}
+
+	// 条件节点通过分支连接后续节点
+	for i := range wf.Nodes {
+		node := &wf.Nodes[i]
+		if node.Type != model.NodeTypeCondition {
+			continue
+		}
+		c, err := workflow.DecodeConfig[model.ConditionNodeConfig](node)
+		if err != nil {
+			return nil, err
+		}
+		endNodes := map[string]bool{}
+		for _, b := range c.Branches {
+			endNodes[workflowKey(b.Target)] = true
+		}
+		if c.Default != "" {
+			endNodes[workflowKey(c.Default)] = true
+		}
+		nodeID := node.ID
+		branch := compose.NewGraphBranch(func(ctx context.Context, in map[string]any) (string, error) {
+			out, _ := in[nodeID].(map[string]any)
+			target, _ := out["branch"].(string)
+			if target == "" {
+				return "", fmt.Errorf("condition node %q matched no branch", nodeID)
+			}
+			return workflowKey(target), nil
+		}, endNodes)
+		if err := graph.AddBranch(nodeID, branch); err != nil {
+			return nil, err
+		}
+	}
+
+	return graph, nil
+}
+
+// wrapNodeExecutor 为节点执行器补充变量读写、耗时统计和调试输出记录
+func wrapNodeExecutor(node *model.WorkflowNode, exec nodeExecutor) func(ctx context.Context, _ map[string]any) (map[string]any, error) {
+	return func(ctx context.Context, _ map[string]any) (map[string]any, error) {
+		var vars map[string]any
+		_ = compose.ProcessState[*workflowState](ctx, func(_ context.Context, st *workflowState) error {
+			vars = make(map[string]any, len(st.Vars))
+			for k, v := range st.Vars {
+				vars[k] = v
+			}
+			return nil
+		})
+
+		start := time.Now()
+		output, err := exec(ctx, vars)
+		record := model.WorkflowNodeOutput{
+			NodeID:     node.ID,
+			Type:       node.Type,
+			Output:     output,
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+
+		_ = compose.ProcessState[*workflowState](ctx, func(_ context.Context, st *workflowState) error {
+			st.Vars[node.ID] = output
+			st.Nodes = append(st.Nodes, record)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("workflow node %q failed: %w", node.ID, err)
+		}
+		return map[string]any{node.ID: output}, nil
+	}
+}
+
+// buildNodeExecutor 根据节点类型创建执行器，模型客户端、工具等在构建阶段初始化
+func (s *agentService) buildNodeExecutor(ctx context.Context, userID uint, node *model.WorkflowNode) (nodeExecutor, error) {
+	switch node.Type {
+	case model.NodeTypeLLM:
+		c, err := workflow.DecodeConfig[model.LLMNodeConfig](node)
+		if err != nil {
+			return nil, err
+		}
+		return s.llmNodeExecutor(ctx, userID, c)
+	case model.NodeTypeRetriever:
+		c, err := workflow.DecodeConfig[model.RetrieverNodeConfig](node)
+		if err != nil {
+			return nil, err
+		}
+		return s.retrieverNodeExecutor(userID, c), nil
+	case model.NodeTypePrompt:
+		c, err := workflow.DecodeConfig[model.PromptNodeConfig](node)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, vars map[string]any) (map[string]any, error) {
+			text, err := workflow.Render(c.Template, vars)
+			return map[string]any{"text": text}, err
+		}, nil
+	case model.NodeTypeTool:
+		c, err := workflow.DecodeConfig[model.ToolNodeConfig](node)
+		if err != nil {
+			return nil, err
+		}
+		return toolNodeExecutor(ctx, c)
+	case model.NodeTypeCondition:
+		c, err := workflow.DecodeConfig[model.ConditionNodeConfig](node)
+		if err != nil {
+			return nil, err
+		}
+		return conditionNodeExecutor(c), nil
+	case model.NodeTypeLoop:
+		c, err := workflow.DecodeConfig[model.LoopNodeConfig](node)
+		if err != nil {
+			return nil, err
+		}
+		return s.loopNodeExecutor(ctx, userID, c)
+	case model.NodeTypeCode:
+		c, err := workflow.DecodeConfig[model.CodeNodeConfig](node)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, vars map[string]any) (map[string]any, error) {
+			out := make(map[string]any, len(c.Outputs))
+			for key, expression := range c.Outputs {
+				v, err := workflow.Eval(expression, vars)
+				if err != nil {
+					return nil, fmt.Errorf("output %q: %w", key, err)
+				}
+				out[key] = v
+			}
+			return out, nil
+		}, nil
+	case model.NodeTypeHTTP:
+		c, err := workflow.DecodeConfig[model.HTTPNodeConfig](node)
+		if err != nil {
+			return nil, err
+		}
+		return httpNodeExecutor(c), nil
+	case model.NodeTypeAgent:
+		c, err := workflow.DecodeConfig[model.AgentNodeConfig](node)
+		if err != nil {
+			return nil, err
+		}
+		return s.agentNodeExecutor(ctx, userID, c)
+	}
+	return nil, fmt.Errorf("unknown node type %q", node.Type)
+}
+
+func (s *agentService) llmNodeExecutor(ctx context.Context, userID uint, c *model.LLMNodeConfig) (nodeExecutor, error) {
+	llmModelCfg, err := s.modelSvc.GetModel(ctx, userID, c.ModelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model: %w", err)
+	}
+	llm, err := llmfactory.GetLLMClient(ctx, llmModelCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create llm client: %w", err)
+	}
+
+	var opts []einomodel.Option
+	if c.Temperature > 0 {
+		opts = append(opts, einomodel.WithTemperature(float32(c.Temperature)))
+	}
+
+	return func(ctx context.Context, vars map[string]any) (map[string]any, error) {
+		var msgs []*schema.Message
+		if c.SystemPrompt != "" {
+			system, err := workflow.Render(c.SystemPrompt, vars)
+			if err != nil {
+				return nil, err
+			}
+			msgs = append(msgs, schema.SystemMessage(system))
+		}
+		if c.WithHistory {
+			if start, ok := vars[model.WorkflowStartNode].(map[string]any); ok {
+				if history, ok := start["history"].([]*schema.Message); ok {
+					msgs = append(msgs, history...)
+				}
+			}
+		}
+		prompt, err := workflow.Render(c.Prompt, vars)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, schema.UserMessage(prompt))
+
+		resp, err := llm.Generate(ctx, msgs, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"text": resp.Content}, nil
+	}, nil
+}
+
+func (s *agentService) retrieverNodeExecutor(userID uint, c *model.RetrieverNodeConfig) nodeExecutor {
+	query := c.Query
+	if query == "" {
+		query = "{{ start.query }}"
+	}
+	topK := c.TopK
+	if topK <= 0 {
+		topK = 3
+	}
+
+	return func(ctx context.Context, vars map[string]any) (map[string]any, error) {
+		q, err := workflow.Render(query, vars)
+		if err != nil {
+			return nil, err
+		}
+		retriever := mretriever.MultiKBRetriever{
+			KBIDs:    c.KnowledgeIDs,
+			UserID:   userID,
+			KBDao:    s.kbDao,
+			ModelDao: s.modelDao,
+			Ctx:      ctx,
+			TopK:     topK,
+		}
+		docs, err := retriever.Retrieve(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+
+		documents := make([]any, 0, len(docs))
+		contents := make([]string, 0, len(docs))
+		for _, d := range docs {
+			documents = append(documents, map[string]any{
+				"id":            d.ID,
+				"content":       d.Content,
+				"score":         d.Score(),
+				"document_name": d.MetaData["document_name"],
+			})
+			contents = append(contents, d.Content)
+		}
+		return map[string]any{
+			"documents": documents,
+			"text":      strings.Join(contents, "\n\n"),
+		}, nil
+	}
+}
+
+func toolNodeExecutor(ctx context.Context, c *model.ToolNodeConfig) (nodeExecutor, error) {
+	tools, err := loadMCPTools(ctx, []string{c.MCPServer})
+	if err != nil {
+		return nil, err
+	}
+
+	var target tool.InvokableTool
+	for _, t := range tools {
+		info, err := t.Info(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if info.Name != c.ToolName {
+			continue
+		}
+		it, ok := t.(tool.InvokableTool)
+		if !ok {
+			return nil, fmt.Errorf("tool %q is not invokable", c.ToolName)
+		}
+		target = it
+		break
+	}
+	if target == nil {
+		return nil, fmt.Errorf("tool %q not found on %s", c.ToolName, c.MCPServer)
+	}
+
+	return func(ctx context.Context, vars map[string]any) (map[string]any, error) {
+		args, err := workflow.RenderValue(c.Arguments, vars)
+		if err != nil {
+			return nil, err
+		}
+		if args == nil {
+			args = map[string]any{}
+		}
+		argBytes, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+		result, err := target.InvokableRun(ctx, string(argBytes))
+		if err != nil {
+			return nil, err
+		}
+		out := map[string]any{"result": result}
+		var parsed any
+		if json.Unmarshal([]byte(result), &parsed) == nil {
+			out["json"] = parsed
+		}
+		return out, nil
+	}, nil
+}
+
+func conditionNodeExecutor(c *model.ConditionNodeConfig) nodeExecutor {
+	return func(ctx context.Context, vars map[string]any) (map[string]any, error) {
+		for _, b := range c.Branches {
+			ok, err := workflow.EvalBool(b.Expression, vars)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return map[string]any{"branch": b.Target}, nil
+			}
+		}
+		if c.Default == "" {
+			return nil, errors.New("no branch matched and no default branch configured")
+		}
+		return map[string]any{"branch": c.Default}, nil
+	}
+}
+
+func (s *agentService) loopNodeExecutor(ctx context.Context, userID uint, c *model.LoopNodeConfig) (nodeExecutor, error) {
+	body, err := s.buildWorkflowGraph(ctx, userID, &c.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build loop body: %w", err)
+	}
+	runner, err := body.Compile(ctx, compose.WithGraphName("WorkflowLoopBody"), compose.WithNodeTriggerMode(compose.AllPredecessor))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile loop body: %w", err)
+	}
+
+	limit := c.MaxIterations
+	if limit <= 0 {
+		limit = defaultLoopIterations
+	}
+	if limit > maxLoopIterations {
+		limit = maxLoopIterations
+	}
+
+	return func(ctx context.Context, vars map[string]any) (map[string]any, error) {
+		v, err := workflow.Eval(c.Items, vars)
+		if err != nil {
+			return nil, err
+		}
+		items, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("loop items must be an array, got %T", v)
+		}
+		if len(items) > limit {
+			items = items[:limit]
+		}
+
+		results := make([]any, 0, len(items))
+		for i, item := range items {
+			iterVars := make(map[string]any, len(vars)+1)
+			for k, val := range vars {
+				iterVars[k] = val
+			}
+			iterVars["loop"] = map[string]any{"item": item, "index": i}
+
+			r, err := runner.Invoke(ctx, iterVars)
+			if err != nil {
+				return nil, fmt.Errorf("iteration %d: %w", i, err)
+			}
+			results = append(results, r.Output)
+		}
+		return map[string]any{"results": results}, nil
+	}, nil
+}
+
+func httpNodeExecutor(c *model.HTTPNodeConfig) nodeExecutor {
+	timeout := defaultHTTPTimeout
+	if c.TimeoutSeconds > 0 {
+		timeout = time.Duration(c.TimeoutSeconds) * time.Second
+	}
+	method := strings.ToUpper(c.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	// URL可由工作流变量拼出，只允许访问公网地址
+	cli := utils.NewGuardedHTTPClient(timeout)
+
+	return func(ctx context.Context, vars map[string]any) (map[string]any, error) {
+		url, err := workflow.Render(c.URL, vars)
+		if err != nil {
+			return nil, err
+		}
+		var body io.Reader
+		if c.Body != "" {
+			b, err := workflow.Render(c.Body, vars)
+			if err != nil {
+				return nil, err
+			}
+			body = strings.NewReader(b)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, url, body)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range c.Headers {
+			hv, err := workflow.Render(v, vars)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set(k, hv)
+		}
+
+		resp, err := cli.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseSize))
+		if err != nil {
+			return nil, err
+		}
+		out := map[string]any{
+			"status": resp.StatusCode,
+			"body":   string(respBody),
+		}
+		var parsed any
+		if json.Unmarshal(respBody, &parsed) == nil {
+			out["json"] = parsed
+		}
+		return out, nil
+	}
+}
+
+func (s *agentService) agentNodeExecutor(ctx context.Context, userID uint, c *model.AgentNodeConfig) (nodeExecutor, error) {
+	sub, err := s.dao.GetByID(ctx, userID, c.AgentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sub agent %s: %w", c.AgentID, err)
+	}
+	query := c.Query
+	if query == "" {
+		query = "{{ start.query }}"
+	}
+	return func(ctx context.Context, vars map[string]any) (map[string]any, error) {
+		q, err := workflow.Render(query, vars)
+		if err != nil {
+			return nil, err
+		}
+		text, err := s.callSubAgent(ctx, userID, sub, q)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"text": text}, nil
+	}, nil
+}
+
+// workflowKey 将工作流中的节点ID映射为Graph中的节点key
+func workflowKey(id string) string {
+	switch id {
+	case model.WorkflowStartNode:
+		return workflowStartKey
+	case model.WorkflowEndNode:
+		return workflowEndKey
+	}
+	return id
+}
+
+func nodeDisplayName(node *model.WorkflowNode) string {
+	if node.Name != "" {
+		return node.Name
+	}
+	return node.ID
+}
+
+// defaultNodeText 从节点输出中提取文本
+func defaultNodeText(output any) string {
+	if out, ok := output.(map[string]any); ok {
+		for _, key := range []string{"text", "result", "body"} {
+			if v, ok := out[key]; ok {
+				return workflow.ToString(v)
+			}
+		}
+	}
+	return workflow.ToString(output)
+}
@@ -13,8 +13,19 @@ func MessageList2ChatHistory(mess []*model.Message) (history []*schema.Message)
 }
 
 func message2MessagesTemplate(mess *model.Message) *schema.Message {
-	return &schema.Message{
+	msg := &schema.Message{
 		Role:    schema.RoleType(mess.Role),
 		Content: mess.Content,
+		// 消息ID用于重新生成、编辑和切换分支
+		Extra: map[string]any{"msg_id": mess.MsgID},
 	}
+	// 标记清除上下文的位置，便于前端展示
+	if mess.IsContextEdge {
+		msg.Extra["context_edge"] = true
+	}
+	// 附件只用于展示，不会随历史消息发送给模型
+	if attachments := mess.Attachments(); len(attachments) > 0 {
+		msg.Extra["attachments"] = attachments
+	}
+	return msg
 }
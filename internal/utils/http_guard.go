@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress 请求的目标为本机、内网或链路本地等非公网地址
+var ErrForbiddenAddress = errors.New("request to loopback, private or link-local address is not allowed")
+
+// maxRedirects 与net/http的默认值相同
+const maxRedirects = 10
+
+// cgnatPrefix 运营商级NAT的共享地址段，不在netip的私有地址范围内
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// NewGuardedHTTPClient 创建请求用户配置的URL（工作流HTTP节点、Webhook等）使用的HTTP客户端。
+// 只允许http和https，建立连接时检查解析后的IP，拒绝本机、内网和链路本地地址，
+// 重定向后的每次连接同样检查。不使用环境变量中的代理，否则检查的是代理的地址
+func NewGuardedHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   guardDial,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return checkScheme(req.URL)
+		},
+	}
+}
+
+// ValidatePublicURL 保存URL时的检查：只允许http和https，主机为IP时不能是非公网地址。
+// 域名在请求时才解析，由NewGuardedHTTPClient检查
+func ValidatePublicURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if err := checkScheme(u); err != nil {
+		return err
+	}
+	if u.Hostname() == "" {
+		return errors.New("url has no host")
+	}
+	if ip, err := netip.ParseAddr(u.Hostname()); err == nil && !IsPublicAddr(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// IsPublicAddr 判断IP是否为可以访问的公网地址
+func IsPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() &&
+		!ip.IsUnspecified() &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!cgnatPrefix.Contains(ip)
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+// guardDial 在建立连接前检查DNS解析后的实际地址，避免域名指向内网或解析结果在检查后改变
+func guardDial(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !IsPublicAddr(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"ai-cloud/internal/model"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// DiffJSON 比较两个JSON文档，返回按路径排序的叶子节点差异
+func DiffJSON(from, to string) ([]model.SchemaDiff, error) {
+	var a, b any
+	if err := json.Unmarshal([]byte(from), &a); err != nil {
+		return nil, fmt.Errorf("failed to parse source json: %w", err)
+	}
+	if err := json.Unmarshal([]byte(to), &b); err != nil {
+		return nil, fmt.Errorf("failed to parse target json: %w", err)
+	}
+
+	left := map[string]any{}
+	right := map[string]any{}
+	flattenJSON("", a, left)
+	flattenJSON("", b, right)
+
+	paths := make(map[string]struct{}, len(left)+len(right))
+	for p := range left {
+		paths[p] = struct{}{}
+	}
+	for p := range right {
+		paths[p] = struct{}{}
+	}
+
+	diffs := make([]model.SchemaDiff, 0)
+	for p := range paths {
+		l, r := left[p], right[p]
+		if reflect.DeepEqual(l, r) {
+			continue
+		}
+		diffs = append(diffs, model.SchemaDiff{Path: p, From: l, To: r})
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs, nil
+}
+
+func flattenJSON(prefix string, v any, out map[string]any) {
+	switch val := v.(type) {
+	case map[string]any:
+		if len(val) == 0 && prefix != "" {
+			out[prefix] = val
+			return
+		}
+		for k, child := range val {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			flattenJSON(p, child, out)
+		}
+	case []any:
+		if len(val) == 0 {
+			out[prefix] = val
+			return
+		}
+		for i, child := range val {
+			flattenJSON(fmt.Sprintf("%s[%d]", prefix, i), child, out)
+		}
+	default:
+		out[prefix] = val
+	}
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// SearchTerms 将检索输入按空白拆分为检索词，去掉重复的词
+func SearchTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, t := range strings.Fields(query) {
+		key := strings.ToLower(t)
+		if !seen[key] {
+			seen[key] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// HighlightSnippet 截取第一个检索词前后radius个字符的片段，检索词用<em>标记（不区分大小写），其余内容做HTML转义。
+// 没有命中时返回开头的片段
+func HighlightSnippet(text string, terms []string, radius int) string {
+	lower := strings.ToLower(text)
+	first := -1
+	for _, t := range terms {
+		if i := strings.Index(lower, strings.ToLower(t)); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	// 大小写转换可能改变个别字符的字节长度，确保位置落在原文的字符边界上
+	if first < 0 || first >= len(text) {
+		first = 0
+	}
+	for first > 0 && !utf8.RuneStart(text[first]) {
+		first--
+	}
+
+	// 以字符为单位向前后扩展
+	start := first
+	for n := 0; n < radius && start > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	end := first
+	for n := 0; n < 2*radius && end < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+	sb.WriteString(highlight(text[start:end], terms))
+	if end < len(text) {
+		sb.WriteString("…")
+	}
+	return sb.String()
+}
+
+// highlight 标记片段中所有检索词的出现位置
+func highlight(s string, terms []string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		matched := 0
+		for _, t := range terms {
+			if len(t) > matched && i+len(t) <= len(s) && strings.EqualFold(s[i:i+len(t)], t) {
+				matched = len(t)
+			}
+		}
+		if matched > 0 {
+			sb.WriteString("<em>" + html.EscapeString(s[i:i+matched]) + "</em>")
+			i += matched
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		sb.WriteString(html.EscapeString(s[i : i+size]))
+		i += size
+	}
+	return sb.String()
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"unicode"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// messageTokenOverhead 每条消息的角色、分隔符等额外开销
+const messageTokenOverhead = 4
+
+// CountTokens 近似估算文本的token数，不使用模型的分词器：中日韩字符按每字一个token，其他字符按约4字节一个token计算。
+// 与常见BPE分词器的结果接近且略偏保守，只用于上下文预算等估算，不能作为计费或精确截断的依据
+func CountTokens(text string) int {
+	tokens, other := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r), unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r), unicode.Is(unicode.Hangul, r):
+			tokens++
+		case unicode.IsSpace(r):
+			// 空白通常与相邻的词合并为一个token
+			tokens += (other + 3) / 4
+			other = 0
+		default:
+			if r < 0x80 {
+				other++
+			} else {
+				other += 2
+			}
+		}
+	}
+	return tokens + (other+3)/4
+}
+
+// CountMessageTokens 估算一条消息在模型输入中占用的token数
+func CountMessageTokens(msg *schema.Message) int {
+	tokens := messageTokenOverhead + CountTokens(msg.Content)
+	for _, tc := range msg.ToolCalls {
+		tokens += CountTokens(tc.Function.Name) + CountTokens(tc.Function.Arguments)
+	}
+	return tokens
+}
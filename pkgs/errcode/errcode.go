@@ -39,4 +39,15 @@ const (
 	FileSearchFailed = 21008 // 文件搜索失败
 	// 订单模块 (22000-22999)
 	// 可后续扩展...
+
+	// 分享模块 (23000-23999)
+	ShareNotFound      = 23001 // 分享不存在、已撤销或已过期
+	ShareOriginDenied  = 23002 // 来源不在分享的白名单中
+	SharePasswordError = 23003 // 分享密码错误
+	ShareVisitorError  = 23004 // 访客身份无效
+	ShareMessageLimit  = 23005 // 访客消息数已达上限
+	ShareConvLimit     = 23006 // 分享的会话数已达上限
+
+	// 会话模块 (24000-24999)
+	ReplyRunNotFound = 24001 // 回复生成不存在或已过期
 )
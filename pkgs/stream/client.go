@@ -0,0 +1,185 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Client 调用流式接口并解析事件，主要用于集成测试
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Token:      token,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// Post 以JSON请求体调用流式接口，如 /api/chat/stream。
+// 接口在开始流式输出前出错时返回普通JSON响应，此时返回包含响应内容的错误。
+func (c *Client) Post(ctx context.Context, path string, body any) (*Reader, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("stream request failed: status %d: %s", resp.StatusCode, msg)
+	}
+	return NewReader(resp.Body), nil
+}
+
+// Reader 从SSE响应中逐个读取事件
+type Reader struct {
+	r    *bufio.Reader
+	body io.ReadCloser
+}
+
+func NewReader(body io.ReadCloser) *Reader {
+	return &Reader{r: bufio.NewReader(body), body: body}
+}
+
+// doneSentinel OpenAI兼容接口以该数据结束流
+const doneSentinel = "[DONE]"
+
+// Next 读取下一个事件，流结束或读到 [DONE] 时返回 io.EOF
+func (r *Reader) Next() (*Event, error) {
+	var typ string
+	var data []byte
+	for {
+		line, err := r.r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		eof := err != nil
+		line = strings.TrimRight(line, "\r\n")
+
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				typ = value
+			case "data":
+				if data != nil {
+					data = append(data, '\n')
+				}
+				data = append(data, value...)
+			}
+		}
+		// 空行表示一个事件结束
+		if (line == "" || eof) && data != nil {
+			if string(data) == doneSentinel {
+				return nil, io.EOF
+			}
+			return decodeEvent(typ, data)
+		}
+		if eof {
+			return nil, io.EOF
+		}
+	}
+}
+
+func (r *Reader) Close() error {
+	return r.body.Close()
+}
+
+func decodeEvent(typ string, data []byte) (*Event, error) {
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("invalid %s event: %w", typ, err)
+	}
+	if e.Type == "" {
+		e.Type = typ
+	}
+	return &e, nil
+}
+
+// Result 一次完整回复的汇总
+type Result struct {
+	MessageID      string
+	ParentID       string
+	ConversationID string
+	Version        string
+	Content        string
+	Reasoning      string
+	ToolCalls      []*ToolCall
+	ToolResults    []*ToolResult
+	References     []*Reference
+	Usage          *Usage
+	FinishReason   string
+	// ApprovalRequest 运行因等待审批而暂停时的待审批工具调用
+	ApprovalRequest *ApprovalRequest
+	// Events 收到的全部事件
+	Events []*Event
+}
+
+// Collect 读取全部事件直到 done，收到 error 事件时返回该错误
+func (r *Reader) Collect() (*Result, error) {
+	defer r.Close()
+	res := &Result{}
+	for {
+		e, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return res, errors.New("stream ended without done event")
+		}
+		if err != nil {
+			return res, err
+		}
+		res.Events = append(res.Events, e)
+
+		switch e.Type {
+		case EventMessageStart:
+			res.MessageID = e.MessageID
+			res.ParentID = e.ParentID
+			res.ConversationID = e.ConversationID
+			res.Version = e.Version
+		case EventContentDelta:
+			res.Content += e.Content
+		case EventReasoningDelta:
+			res.Reasoning += e.Content
+		case EventToolCall:
+			res.ToolCalls = append(res.ToolCalls, e.ToolCall)
+		case EventToolResult:
+			res.ToolResults = append(res.ToolResults, e.ToolResult)
+		case EventRetrieval:
+			res.References = append(res.References, e.References...)
+		case EventUsage:
+			res.Usage = e.Usage
+		case EventApprovalRequest:
+			res.ApprovalRequest = e.ApprovalRequest
+		case EventError:
+			return res, errors.New(e.Error.Message)
+		case EventDone:
+			res.FinishReason = e.FinishReason
+			return res, nil
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sseServer 以SSE返回write写出的事件，每个事件后立即flush，模拟逐块到达的响应
+func sseServer(t *testing.T, write func(w *Writer) error) (*httptest.Server, *http.Request) {
+	t.Helper()
+	var got http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		got = *r.Clone(context.Background())
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set(VersionHeader, Version)
+		w := NewWriter(flushWriter{rw}, "msg-1", "conv-1").WithParent("user-1")
+		if err := write(w); err != nil {
+			t.Errorf("write events: %v", err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+type flushWriter struct {
+	rw http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.rw.Write(p)
+	f.rw.(http.Flusher).Flush()
+	return n, err
+}
+
+func TestClientCollect(t *testing.T) {
+	srv, req := sseServer(t, func(w *Writer) error {
+		events := []func() error{
+			w.Start,
+			func() error { return w.Reasoning("先想一想") },
+			func() error {
+				return w.Write(&Event{Type: EventRetrieval, References: []*Reference{{ChunkID: "c1", Score: 0.9, Content: "文档"}}})
+			},
+			func() error {
+				return w.Write(&Event{Type: EventToolCall, ToolCall: &ToolCall{ID: "call-1", Name: "search", Arguments: `{"q":"天气"}`}})
+			},
+			func() error {
+				return w.Write(&Event{Type: EventToolResult, ToolResult: &ToolResult{ID: "call-1", Name: "search", Result: "晴"}})
+			},
+			func() error { return w.Content("今天") },
+			func() error { return w.Content("是晴天\n多行内容") },
+			func() error { return w.Extension(EventTrace, map[string]string{"node": "model"}) },
+			func() error {
+				return w.Write(&Event{Type: EventUsage, Usage: &Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}})
+			},
+			w.Done,
+		}
+		for _, write := range events {
+			if err := write(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	c := NewClient(srv.URL+"/", "token-1")
+	r, err := c.Post(context.Background(), "/api/chat/stream", map[string]string{"message": "天气如何"})
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	res, err := r.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	if req.URL.Path != "/api/chat/stream" || req.Header.Get("Authorization") != "Bearer token-1" || req.Header.Get("Accept") != "text/event-stream" {
+		t.Errorf("request = %s %v", req.URL.Path, req.Header)
+	}
+	if res.MessageID != "msg-1" || res.ConversationID != "conv-1" || res.ParentID != "user-1" || res.Version != Version {
+		t.Errorf("message start = %+v", res)
+	}
+	if res.Content != "今天是晴天\n多行内容" || res.Reasoning != "先想一想" {
+		t.Errorf("content = %q, reasoning = %q", res.Content, res.Reasoning)
+	}
+	if len(res.ToolCalls) != 1 || res.ToolCalls[0].Arguments != `{"q":"天气"}` || len(res.ToolResults) != 1 || res.ToolResults[0].Result != "晴" {
+		t.Errorf("tools = %+v %+v", res.ToolCalls, res.ToolResults)
+	}
+	if len(res.References) != 1 || res.References[0].ChunkID != "c1" {
+		t.Errorf("references = %+v", res.References)
+	}
+	if !reflect.DeepEqual(res.Usage, &Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}) {
+		t.Errorf("usage = %+v", res.Usage)
+	}
+	if res.FinishReason != FinishReasonStop {
+		t.Errorf("finish reason = %q", res.FinishReason)
+	}
+	if len(res.Events) != 10 {
+		t.Fatalf("got %d events, want 10", len(res.Events))
+	}
+	for i, e := range res.Events {
+		if e.Seq != i+1 || e.MessageID != "msg-1" {
+			t.Errorf("event %d: seq = %d, message id = %q", i, e.Seq, e.MessageID)
+		}
+	}
+	if trace := res.Events[7]; trace.Type != EventTrace || string(trace.Data) != `{"node":"model"}` {
+		t.Errorf("extension event = %+v", trace)
+	}
+}
+
+func TestClientApprovalRequest(t *testing.T) {
+	req := &ApprovalRequest{RunID: "run-1", Approvals: []*PendingApproval{{ID: "a1", ToolCallID: "call-1", ToolName: "delete_file"}}}
+	srv, _ := sseServer(t, func(w *Writer) error {
+		if err := w.Start(); err != nil {
+			return err
+		}
+		if err := w.Write(&Event{Type: EventApprovalRequest, ApprovalRequest: req}); err != nil {
+			return err
+		}
+		return w.Done()
+	})
+	r, err := NewClient(srv.URL, "").Post(context.Background(), "/api/chat/stream", struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := r.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if res.FinishReason != FinishReasonApproval || !reflect.DeepEqual(res.ApprovalRequest, req) {
+		t.Errorf("finish reason = %q, approval = %+v", res.FinishReason, res.ApprovalRequest)
+	}
+}
+
+func TestClientMidStreamErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		write       func(w *Writer) error
+		wantErr     string
+		wantContent string
+	}{
+		{
+			name: "error event",
+			write: func(w *Writer) error {
+				_ = w.Start()
+				_ = w.Content("部分")
+				return w.Error(errors.New("model timeout"))
+			},
+			wantErr:     "model timeout",
+			wantContent: "部分",
+		},
+		{
+			name: "connection closed before done",
+			write: func(w *Writer) error {
+				_ = w.Start()
+				return w.Content("部分")
+			},
+			wantErr:     "stream ended without done event",
+			wantContent: "部分",
+		},
+		{
+			name: "invalid event data",
+			write: func(w *Writer) error {
+				_ = w.Start()
+				_, err := io.WriteString(w.w, "event: content_delta\ndata: {not json\n\n")
+				return err
+			},
+			wantErr: "invalid content_delta event",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := sseServer(t, tt.write)
+			r, err := NewClient(srv.URL, "").Post(context.Background(), "/api/chat/stream", struct{}{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := r.Collect()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if res.MessageID != "msg-1" || res.Content != tt.wantContent {
+				t.Errorf("partial result = %+v", res)
+			}
+		})
+	}
+}
+
+func TestClientRequestFailed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, `{"code":10001,"message":"Parameter error"}`)
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.URL, "").Post(context.Background(), "/api/chat/stream", struct{}{})
+	if err == nil || !strings.Contains(err.Error(), "status 400") || !strings.Contains(err.Error(), "Parameter error") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestReaderNext(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []*Event
+	}{
+		{
+			name: "type from event field",
+			raw:  "id: 1\nevent: content_delta\ndata: {\"content\":\"hi\"}\n\n",
+			want: []*Event{{Type: EventContentDelta, Content: "hi"}},
+		},
+		{
+			name: "type in data wins",
+			raw:  "event: message\ndata: {\"type\":\"done\",\"finish_reason\":\"stop\"}\n\n",
+			want: []*Event{{Type: EventDone, FinishReason: FinishReasonStop}},
+		},
+		{
+			name: "crlf and comments",
+			raw:  ": keep-alive\r\n\r\nevent: content_delta\r\ndata:{\"content\":\"a\"}\r\n\r\nevent: content_delta\r\ndata: {\"content\":\"b\"}\r\n\r\n",
+			want: []*Event{{Type: EventContentDelta, Content: "a"}, {Type: EventContentDelta, Content: "b"}},
+		},
+		{
+			name: "multi-line data",
+			raw:  "event: usage\ndata: {\"usage\":\ndata: {\"total_tokens\":3}}\n\n",
+			want: []*Event{{Type: EventUsage, Usage: &Usage{TotalTokens: 3}}},
+		},
+		{
+			name: "last event without blank line",
+			raw:  "event: done\ndata: {\"finish_reason\":\"stop\"}",
+			want: []*Event{{Type: EventDone, FinishReason: FinishReasonStop}},
+		},
+		{
+			name: "done sentinel ends stream",
+			raw:  "data: {\"type\":\"content_delta\",\"content\":\"x\"}\n\ndata: [DONE]\n\ndata: {\"type\":\"content_delta\",\"content\":\"ignored\"}\n\n",
+			want: []*Event{{Type: EventContentDelta, Content: "x"}},
+		},
+		{
+			name: "empty stream",
+			raw:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(io.NopCloser(strings.NewReader(tt.raw)))
+			var got []*Event
+			for {
+				e, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next: %v", err)
+				}
+				got = append(got, e)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %s, want %s", eventsJSON(got), eventsJSON(tt.want))
+			}
+		})
+	}
+}
+
+func TestCollectDoneSentinelWithoutDoneEvent(t *testing.T) {
+	r := NewReader(io.NopCloser(strings.NewReader("data: {\"type\":\"content_delta\",\"content\":\"x\"}\n\ndata: [DONE]\n\n")))
+	res, err := r.Collect()
+	if err == nil || !strings.Contains(err.Error(), "without done event") {
+		t.Errorf("err = %v", err)
+	}
+	if res.Content != "x" {
+		t.Errorf("content = %q", res.Content)
+	}
+}
+
+func TestWriterSkip(t *testing.T) {
+	var sb strings.Builder
+	w := NewWriter(&sb, "msg-1", "").Skip(2)
+	_ = w.Start()
+	_ = w.Content("a")
+	_ = w.Content("b")
+	_ = w.Done()
+
+	r := NewReader(io.NopCloser(strings.NewReader(sb.String())))
+	res, err := r.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if res.Content != "b" || len(res.Events) != 2 || res.Events[0].Seq != 3 || res.Events[1].Seq != 4 {
+		t.Errorf("replayed = %s", eventsJSON(res.Events))
+	}
+}
+
+func eventsJSON(events []*Event) string {
+	data, _ := json.Marshal(events)
+	return string(data)
+}
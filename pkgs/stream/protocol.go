@@ -0,0 +1,124 @@
+// Package stream 定义各流式接口（/agent/stream、/knowledge/stream、/chat/stream、/chat/debug）统一使用的SSE事件协议。
+//
+// 每个SSE事件的 event 字段为事件类型，id 字段为事件序号，data 字段为JSON编码的 Event。
+// 一次回复总是以 message_start 开始，以 done 或 error 结束。
+package stream
+
+import "encoding/json"
+
+// Version 协议版本，随 message_start 事件和 X-Stream-Version 响应头下发
+const Version = "1"
+
+// VersionHeader 响应头中的协议版本
+const VersionHeader = "X-Stream-Version"
+
+const (
+	// EventMessageStart 回复开始，携带协议版本、消息ID、父消息ID和会话ID
+	EventMessageStart = "message_start"
+	// EventContentDelta 回复内容增量
+	EventContentDelta = "content_delta"
+	// EventReasoningDelta 思考内容增量
+	EventReasoningDelta = "reasoning_delta"
+	// EventToolCall 模型发起的工具调用
+	EventToolCall = "tool_call"
+	// EventToolResult 工具调用结果
+	EventToolResult = "tool_result"
+	// EventRetrieval 知识库检索到的引用
+	EventRetrieval = "retrieval"
+	// EventUsage 本次回复的Token用量
+	EventUsage = "usage"
+	// EventError 运行出错，之后不再有其他事件
+	EventError = "error"
+	// EventDone 回复结束
+	EventDone = "done"
+	// EventApprovalRequest 工具调用需要人工审批，运行已暂停，之后以 finish_reason=approval_required 的done事件结束
+	EventApprovalRequest = "approval_request"
+
+	// EventAgentCall / EventAgentResult 子Agent调用事件
+	EventAgentCall   = "agent_call"
+	EventAgentResult = "agent_result"
+	// EventTrace 调试模式下的Trace事件
+	EventTrace = "trace"
+	// EventNodeOutputs 调试模式下工作流各节点的输出
+	EventNodeOutputs = "node_outputs"
+)
+
+const (
+	// FinishReasonStop 正常结束
+	FinishReasonStop = "stop"
+	// FinishReasonApproval 等待工具调用审批，审批后通过 /chat/approve 恢复运行
+	FinishReasonApproval = "approval_required"
+	// FinishReasonStopped 生成被用户通过 /chat/stop 停止，已生成的部分作为回复保存
+	FinishReasonStopped = "stopped"
+)
+
+// Event 协议中的一个事件，不同类型的事件只填充对应的字段
+type Event struct {
+	Type           string `json:"type"`
+	Seq            int    `json:"seq"`
+	MessageID      string `json:"message_id"`
+	ConversationID string `json:"conversation_id,omitempty"`
+
+	// Version 仅 message_start
+	Version string `json:"version,omitempty"`
+	// ParentID 仅 message_start，回复在消息树中的父消息，即本轮的用户消息
+	ParentID string `json:"parent_id,omitempty"`
+	// Content content_delta / reasoning_delta 的增量文本
+	Content      string       `json:"content,omitempty"`
+	ToolCall     *ToolCall    `json:"tool_call,omitempty"`
+	ToolResult   *ToolResult  `json:"tool_result,omitempty"`
+	References   []*Reference `json:"references,omitempty"`
+	Usage        *Usage       `json:"usage,omitempty"`
+	Error        *Error       `json:"error,omitempty"`
+	FinishReason string       `json:"finish_reason,omitempty"`
+	// ApprovalRequest 仅 approval_request
+	ApprovalRequest *ApprovalRequest `json:"approval_request,omitempty"`
+	// Data agent_call、agent_result、trace、node_outputs 等扩展事件的内容
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type ToolResult struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Reference 检索到的知识库文档片段
+type Reference struct {
+	ChunkID      string  `json:"chunk_id"`
+	KBID         string  `json:"kb_id,omitempty"`
+	DocumentID   string  `json:"document_id,omitempty"`
+	DocumentName string  `json:"document_name,omitempty"`
+	Score        float64 `json:"score"`
+	Content      string  `json:"content"`
+}
+
+// ApprovalRequest 暂停的运行及其待审批的工具调用
+type ApprovalRequest struct {
+	RunID     string             `json:"run_id"`
+	Approvals []*PendingApproval `json:"approvals"`
+}
+
+type PendingApproval struct {
+	ID         string `json:"id"`
+	ToolCallID string `json:"tool_call_id"`
+	ToolName   string `json:"tool_name"`
+	Arguments  string `json:"arguments"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type Error struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,103 @@
+package stream
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/gin-contrib/sse"
+)
+
+// Writer 将事件编码为SSE写入响应，自动填充序号、消息ID和会话ID
+type Writer struct {
+	w              io.Writer
+	seq            int
+	messageID      string
+	conversationID string
+	// parentID message_start事件携带的父消息ID
+	parentID string
+	// skip 序号不大于skip的事件不写出，用于重新连接时从指定位置回放
+	skip int
+	// finishReason done事件的结束原因，写入审批请求后为 FinishReasonApproval
+	finishReason string
+}
+
+func NewWriter(w io.Writer, messageID, conversationID string) *Writer {
+	return &Writer{
+		w:              w,
+		messageID:      messageID,
+		conversationID: conversationID,
+	}
+}
+
+func (w *Writer) Write(e *Event) error {
+	w.seq++
+	e.Seq = w.seq
+	e.MessageID = w.messageID
+	e.ConversationID = w.conversationID
+	if e.Type == EventApprovalRequest {
+		w.finishReason = FinishReasonApproval
+	}
+	if e.Seq <= w.skip {
+		return nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return sse.Encode(w.w, sse.Event{
+		Id:    strconv.Itoa(e.Seq),
+		Event: e.Type,
+		Data:  string(data),
+	})
+}
+
+// WithParent 设置回复的父消息ID，随 message_start 事件下发
+func (w *Writer) WithParent(parentID string) *Writer {
+	w.parentID = parentID
+	return w
+}
+
+// Skip 跳过序号不大于seq的事件。同一回复重新编码时序号不变，客户端重新连接时据此从上次收到的位置继续
+func (w *Writer) Skip(seq int) *Writer {
+	w.skip = seq
+	return w
+}
+
+func (w *Writer) Start() error {
+	return w.Write(&Event{Type: EventMessageStart, Version: Version, ParentID: w.parentID})
+}
+
+func (w *Writer) Content(content string) error {
+	return w.Write(&Event{Type: EventContentDelta, Content: content})
+}
+
+func (w *Writer) Reasoning(content string) error {
+	return w.Write(&Event{Type: EventReasoningDelta, Content: content})
+}
+
+func (w *Writer) Error(err error) error {
+	return w.Write(&Event{Type: EventError, Error: &Error{Message: err.Error()}})
+}
+
+func (w *Writer) Done() error {
+	reason := w.finishReason
+	if reason == "" {
+		reason = FinishReasonStop
+	}
+	return w.Write(&Event{Type: EventDone, FinishReason: reason})
+}
+
+// Stopped 生成被停止时代替Done结束回复
+func (w *Writer) Stopped() error {
+	return w.Write(&Event{Type: EventDone, FinishReason: FinishReasonStopped})
+}
+
+// Extension 写入扩展事件，data为JSON编码的内容
+func (w *Writer) Extension(typ string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return w.Write(&Event{Type: typ, Data: raw})
+}